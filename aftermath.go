@@ -0,0 +1,72 @@
+package hotload
+
+import (
+	"net/url"
+	"sync/atomic"
+	"time"
+
+	"github.com/infobloxopen/hotload/metrics"
+)
+
+const rotationWindowKey = "rotationWindow"
+
+// DefaultRotationWindow is how long after a rotation queries are counted in
+// hotload_queries_after_rotation_total when rotationWindow is not set.
+var DefaultRotationWindow = time.Minute
+
+// rotationWindow is when the connections of a location were last reset and
+// for how long queries are counted afterwards. It is shared with the
+// connections of the location, which read it without the group lock.
+type rotationWindow struct {
+	// last is the unix time in nanoseconds of the last rotation, 0 before
+	// the first one
+	last atomic.Int64
+	// window replaces DefaultRotationWindow once set, 0 turns counting off
+	window atomic.Int64
+	set    atomic.Bool
+}
+
+// parseRotationWindow reads rotationWindow, 0 turns counting off.
+func (cg *chanGroup) parseRotationWindow(vs url.Values) {
+	v := vs.Get(rotationWindowKey)
+	if v == "" {
+		return
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil || d < 0 {
+		cg.log("invalid rotationWindow, ignoring", v)
+		return
+	}
+	cg.rotationWindow.window.Store(int64(d))
+	cg.rotationWindow.set.Store(true)
+	cg.log("rotationWindow set to", d)
+}
+
+// rotated records that the connections were reset at t.
+func (cg *chanGroup) rotated(t time.Time) {
+	cg.rotationWindow.last.Store(t.UnixNano())
+	metrics.SetHotloadLastRotation(cg.name, t)
+}
+
+// within reports whether t is within the window after the last rotation.
+func (w *rotationWindow) within(t time.Time) bool {
+	last := w.last.Load()
+	if last == 0 {
+		return false
+	}
+	window := DefaultRotationWindow
+	if w.set.Load() {
+		window = time.Duration(w.window.Load())
+	}
+	since := t.Sub(time.Unix(0, last))
+	return since >= 0 && since < window
+}
+
+// countAfterRotation counts a query or exec attempted shortly after the
+// location rotated.
+func (c *managedConn) countAfterRotation() {
+	if c.rotation == nil || !c.rotation.within(c.now()) {
+		return
+	}
+	metrics.IncHotloadQueriesAfterRotationCounter(c.location)
+}
@@ -0,0 +1,221 @@
+// Package appconfig implements a hotload strategy that reads the connection
+// string from AWS AppConfig with the AppConfig Data API session/poll model.
+//
+// hotload does not depend on the AWS SDK. The strategy talks to AppConfig
+// through the Client interface, which mirrors the two AppConfig Data API
+// calls it needs, so applications adapt their SDK client and register the
+// strategy themselves:
+//
+//	hotload.RegisterStrategy("appconfig", appconfig.NewStrategy(client))
+//
+//	db, err := sql.Open("hotload", "appconfig://postgres/?application=orders&environment=prod&profile=dsn")
+package appconfig
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/infobloxopen/hotload/logger"
+	"github.com/infobloxopen/hotload/metrics"
+	"github.com/infobloxopen/hotload/strategy"
+)
+
+const strategyName = "appconfig"
+
+const (
+	// ApplicationKey is the query parameter with the AppConfig application
+	// identifier.
+	ApplicationKey = "application"
+	// EnvironmentKey is the query parameter with the AppConfig environment
+	// identifier.
+	EnvironmentKey = "environment"
+	// ProfileKey is the query parameter with the AppConfig configuration
+	// profile identifier.
+	ProfileKey = "profile"
+)
+
+// DefaultPollInterval is used when AppConfig does not return a poll interval
+// hint.
+var DefaultPollInterval = 60 * time.Second
+
+// StartConfigurationSessionInput mirrors the AppConfig Data API input of the
+// same name.
+type StartConfigurationSessionInput struct {
+	ApplicationIdentifier          string
+	EnvironmentIdentifier          string
+	ConfigurationProfileIdentifier string
+}
+
+// StartConfigurationSessionOutput mirrors the AppConfig Data API output of the
+// same name.
+type StartConfigurationSessionOutput struct {
+	InitialConfigurationToken string
+}
+
+// GetLatestConfigurationInput mirrors the AppConfig Data API input of the same
+// name.
+type GetLatestConfigurationInput struct {
+	ConfigurationToken string
+}
+
+// GetLatestConfigurationOutput mirrors the AppConfig Data API output of the
+// same name. Configuration is empty if it did not change since the previous
+// call of the session.
+type GetLatestConfigurationOutput struct {
+	Configuration              []byte
+	NextPollConfigurationToken string
+	NextPollIntervalInSeconds  int32
+}
+
+// Client is the subset of the AppConfig Data API used by the strategy.
+type Client interface {
+	StartConfigurationSession(ctx context.Context, in *StartConfigurationSessionInput) (*StartConfigurationSessionOutput, error)
+	GetLatestConfiguration(ctx context.Context, in *GetLatestConfigurationInput) (*GetLatestConfigurationOutput, error)
+}
+
+// NewStrategy returns a strategy that polls AppConfig through client.
+func NewStrategy(client Client) *Strategy {
+	if client == nil {
+		panic("appconfig: NewStrategy client is nil")
+	}
+	return &Strategy{client: client, done: make(chan struct{})}
+}
+
+// Strategy implements the hotload Strategy interface with AWS AppConfig.
+type Strategy struct {
+	client    Client
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+// Close stops the poll loops of every watch and makes further calls of Watch
+// fail. hotload.UnregisterStrategy calls it.
+func (s *Strategy) Close() error {
+	s.closeOnce.Do(func() { close(s.done) })
+	return nil
+}
+
+// closable returns a context that is also canceled when s is closed.
+func (s *Strategy) closable(ctx context.Context) (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(ctx)
+	go func() {
+		select {
+		case <-s.done:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+	return ctx, cancel
+}
+
+// session is a configuration session and its next poll.
+type session struct {
+	in    StartConfigurationSessionInput
+	token string
+	intv  time.Duration
+}
+
+// Watch implements the hotload.Strategy interface. Errors starting the
+// session or fetching the initial configuration are returned, later errors are
+// logged and the session is restarted on the next poll. The poll loop stops
+// when ctx is canceled or the strategy is closed.
+func (s *Strategy) Watch(ctx context.Context, pth string, options url.Values) (value string, values <-chan string, err error) {
+	in := StartConfigurationSessionInput{
+		ApplicationIdentifier:          options.Get(ApplicationKey),
+		EnvironmentIdentifier:          options.Get(EnvironmentKey),
+		ConfigurationProfileIdentifier: options.Get(ProfileKey),
+	}
+	for _, key := range []string{ApplicationKey, EnvironmentKey, ProfileKey} {
+		if options.Get(key) == "" {
+			return "", nil, fmt.Errorf("appconfig: %w", strategy.MissingOption(key))
+		}
+	}
+	ctx, cancel := s.closable(ctx)
+	select {
+	case <-s.done:
+		cancel()
+		return "", nil, strategy.WatchError(s.resource(in), strategy.ErrWatchClosed)
+	default:
+	}
+	sess := &session{in: in}
+	value, _, err = s.poll(ctx, sess)
+	if err != nil {
+		cancel()
+		return "", nil, err
+	}
+	out := make(chan string)
+	go s.run(ctx, cancel, sess, value, out)
+	return value, out, nil
+}
+
+func (s *Strategy) resource(in StartConfigurationSessionInput) string {
+	return fmt.Sprintf("%s/%s/%s", in.ApplicationIdentifier, in.EnvironmentIdentifier, in.ConfigurationProfileIdentifier)
+}
+
+// poll fetches the latest configuration, starting a session first if needed.
+// changed is false if the configuration did not change since the previous
+// poll.
+func (s *Strategy) poll(ctx context.Context, sess *session) (value string, changed bool, err error) {
+	if sess.token == "" {
+		started, err := s.client.StartConfigurationSession(ctx, &sess.in)
+		if err != nil {
+			return "", false, strategy.WatchError(s.resource(sess.in), err)
+		}
+		sess.token = started.InitialConfigurationToken
+	}
+	latest, err := s.client.GetLatestConfiguration(ctx, &GetLatestConfigurationInput{ConfigurationToken: sess.token})
+	if err != nil {
+		// the token may be spent, start over with a new session
+		sess.token = ""
+		return "", false, strategy.ReadError(s.resource(sess.in), err)
+	}
+	sess.token = latest.NextPollConfigurationToken
+	sess.intv = DefaultPollInterval
+	if latest.NextPollIntervalInSeconds > 0 {
+		sess.intv = time.Duration(latest.NextPollIntervalInSeconds) * time.Second
+	}
+	if len(latest.Configuration) == 0 {
+		return "", false, nil
+	}
+	return strings.TrimSpace(string(latest.Configuration)), true, nil
+}
+
+func (s *Strategy) run(ctx context.Context, cancel context.CancelFunc, sess *session, last string, out chan<- string) {
+	defer cancel()
+	metrics.IncHotloadWatchGoroutines(strategyName)
+	defer metrics.DecHotloadWatchGoroutines(strategyName)
+	log := logger.GetLogger()
+	timer := time.NewTimer(sess.intv)
+	defer timer.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-timer.C:
+		}
+		restart := sess.token == ""
+		v, changed, err := s.poll(ctx, sess)
+		if restart && err == nil {
+			metrics.IncHotloadWatchRestarts(strategyName)
+		}
+		timer.Reset(sess.intv)
+		if err != nil {
+			log("appconfig:", err)
+			continue
+		}
+		if !changed || v == last {
+			continue
+		}
+		log("appconfig: configuration changed", s.resource(sess.in))
+		select {
+		case out <- v:
+			last = v
+		case <-ctx.Done():
+			return
+		}
+	}
+}
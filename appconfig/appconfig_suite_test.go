@@ -0,0 +1,13 @@
+package appconfig
+
+import (
+	"testing"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+func TestAppconfig(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Appconfig Suite")
+}
@@ -0,0 +1,149 @@
+package appconfig
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/infobloxopen/hotload/strategy"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+// fakeClient serves configs in order, an empty config means unchanged.
+type fakeClient struct {
+	mu       sync.Mutex
+	startErr error
+	getErr   error
+	configs  []string
+	sessions int
+	intv     int32
+}
+
+func (fc *fakeClient) StartConfigurationSession(ctx context.Context, in *StartConfigurationSessionInput) (*StartConfigurationSessionOutput, error) {
+	fc.mu.Lock()
+	defer fc.mu.Unlock()
+	if fc.startErr != nil {
+		return nil, fc.startErr
+	}
+	fc.sessions++
+	return &StartConfigurationSessionOutput{InitialConfigurationToken: "token-0"}, nil
+}
+
+func (fc *fakeClient) GetLatestConfiguration(ctx context.Context, in *GetLatestConfigurationInput) (*GetLatestConfigurationOutput, error) {
+	fc.mu.Lock()
+	defer fc.mu.Unlock()
+	if fc.getErr != nil {
+		err := fc.getErr
+		fc.getErr = nil
+		return nil, err
+	}
+	var cfg string
+	if len(fc.configs) > 0 {
+		cfg, fc.configs = fc.configs[0], fc.configs[1:]
+	}
+	return &GetLatestConfigurationOutput{
+		Configuration:              []byte(cfg),
+		NextPollConfigurationToken: in.ConfigurationToken + "+",
+		NextPollIntervalInSeconds:  fc.intv,
+	}, nil
+}
+
+var _ = Describe("Strategy", func() {
+	var (
+		ctx     context.Context
+		cancel  context.CancelFunc
+		options url.Values
+	)
+
+	BeforeEach(func() {
+		ctx, cancel = context.WithCancel(context.Background())
+		options = url.Values{ApplicationKey: {"orders"}, EnvironmentKey: {"prod"}, ProfileKey: {"dsn"}}
+	})
+
+	BeforeSuite(func() {
+		DefaultPollInterval = 10 * time.Millisecond
+	})
+
+	AfterEach(func() {
+		cancel()
+	})
+
+	It("Should return the initial configuration and emit changes", func() {
+		fc := &fakeClient{configs: []string{"dbname=one\n", "", "dbname=two"}}
+		value, values, err := NewStrategy(fc).Watch(ctx, "/", options)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(value).To(Equal("dbname=one"))
+		Eventually(values).Should(Receive(Equal("dbname=two")))
+	})
+
+	It("Should return session errors from Watch", func() {
+		fc := &fakeClient{startErr: errors.New("access denied")}
+		_, _, err := NewStrategy(fc).Watch(ctx, "/", options)
+		Expect(err).To(MatchError(strategy.ErrWatchFailed))
+		Expect(err).To(MatchError(ContainSubstring("access denied")))
+	})
+
+	It("Should return initial configuration errors from Watch", func() {
+		fc := &fakeClient{getErr: errors.New("throttled")}
+		_, _, err := NewStrategy(fc).Watch(ctx, "/", options)
+		Expect(err).To(MatchError(strategy.ErrReadFailed))
+	})
+
+	It("Should require the identifiers", func() {
+		options.Del(ProfileKey)
+		_, _, err := NewStrategy(&fakeClient{}).Watch(ctx, "/", options)
+		Expect(err).To(MatchError(strategy.ErrMissingOption))
+		Expect(err).To(MatchError(ContainSubstring(ProfileKey)))
+	})
+
+	It("Should restart the session after a poll error", func() {
+		fc := &fakeClient{configs: []string{"dbname=one"}}
+		_, values, err := NewStrategy(fc).Watch(ctx, "/", options)
+		Expect(err).ToNot(HaveOccurred())
+		fc.mu.Lock()
+		fc.getErr = errors.New("expired")
+		fc.configs = []string{"dbname=two"}
+		fc.mu.Unlock()
+		Eventually(values).Should(Receive(Equal("dbname=two")))
+		fc.mu.Lock()
+		defer fc.mu.Unlock()
+		Expect(fc.sessions).To(Equal(2))
+	})
+
+	It("Should respect the poll interval hint", func() {
+		fc := &fakeClient{configs: []string{"dbname=one", "dbname=two"}, intv: 3600}
+		_, values, err := NewStrategy(fc).Watch(ctx, "/", options)
+		Expect(err).ToNot(HaveOccurred())
+		Consistently(values, "100ms").ShouldNot(Receive())
+	})
+
+	It("Should stop polling when ctx is canceled", func() {
+		fc := &fakeClient{configs: []string{"dbname=one"}}
+		_, values, err := NewStrategy(fc).Watch(ctx, "/", options)
+		Expect(err).ToNot(HaveOccurred())
+		cancel()
+		fc.mu.Lock()
+		fc.configs = []string{"dbname=two"}
+		fc.mu.Unlock()
+		Consistently(values, "100ms").ShouldNot(Receive())
+	})
+
+	It("Should stop polling and fail new watches when closed", func() {
+		fc := &fakeClient{configs: []string{"dbname=one"}}
+		s := NewStrategy(fc)
+		_, values, err := s.Watch(ctx, "/", options)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(s.Close()).To(Succeed())
+		Expect(s.Close()).To(Succeed())
+		fc.mu.Lock()
+		fc.configs = []string{"dbname=two"}
+		fc.mu.Unlock()
+		Consistently(values, "100ms").ShouldNot(Receive())
+
+		_, _, err = s.Watch(ctx, "/", options)
+		Expect(err).To(MatchError(strategy.ErrWatchClosed))
+	})
+})
@@ -0,0 +1,63 @@
+package hotload
+
+import (
+	"net/url"
+	"strings"
+)
+
+const appNameKey = "appName"
+
+// DefaultAppNameKey is the connection string option appName is passed as
+// unless the driver was registered WithAppNameKey. It is the option of
+// lib/pq and pgx.
+const DefaultAppNameKey = "application_name"
+
+// parseAppName reads the application name connections identify themselves
+// with. An empty appName defaults to the location without its query, so
+// database-side monitoring can attribute connections to their hotload
+// source.
+func (cg *chanGroup) parseAppName(vs url.Values) {
+	if _, ok := vs[appNameKey]; !ok {
+		return
+	}
+	cg.appName = vs.Get(appNameKey)
+	if cg.appName == "" {
+		cg.appName, _, _ = strings.Cut(cg.name, "?")
+	}
+	cg.log("appName set to", cg.appName)
+}
+
+// mergeDriverOptions merges the options of the driver and the application
+// name into the connection string v. Key/value connection strings have no
+// query, the application name is appended to them as a quoted key='value'
+// pair instead, replacing one v may set.
+func (cg *chanGroup) mergeDriverOptions(v string) (string, error) {
+	if _, ok := splitDSNURL(v); ok || cg.appName == "" {
+		return mergeConnectionStringOptions(v, cg.driverOptions())
+	}
+	key := cg.appNameKey()
+	v = removeKeyValue(v, key) + " " + key + "='" + strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace(cg.appName) + "'"
+	return mergeConnectionStringOptions(strings.TrimSpace(v), cg.sqlDriver.options)
+}
+
+// driverOptions returns the options merged into the connection string, the
+// options of the driver plus the application name.
+func (cg *chanGroup) driverOptions() map[string]string {
+	if cg.appName == "" {
+		return cg.sqlDriver.options
+	}
+	options := make(map[string]string, len(cg.sqlDriver.options)+1)
+	for k, v := range cg.sqlDriver.options {
+		options[k] = v
+	}
+	options[cg.appNameKey()] = cg.appName
+	return options
+}
+
+// appNameKey returns the option the driver takes the application name as.
+func (cg *chanGroup) appNameKey() string {
+	if cg.sqlDriver.appNameKey == "" {
+		return DefaultAppNameKey
+	}
+	return cg.sqlDriver.appNameKey
+}
@@ -0,0 +1,67 @@
+package hotload
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"time"
+)
+
+// AuditEvent describes a rotation of the connection information of a
+// location. It never contains raw connection strings, only hashes and
+// redacted forms.
+type AuditEvent struct {
+	Time     time.Time
+	Location string
+	Driver   string
+	// OldHash and NewHash identify the previous and new values without
+	// revealing them, see HashValue.
+	OldHash string
+	NewHash string
+	// OldRedacted and NewRedacted are the values passed through Redact.
+	OldRedacted string
+	NewRedacted string
+	// Policy is the reset policy applied to existing connections.
+	Policy ResetPolicy
+	// Rejected is why the change was refused and the previous value
+	// retained, e.g. by a host policy or a failed health check. It is nil
+	// for applied rotations.
+	Rejected error
+}
+
+// AuditSink receives an AuditEvent for every rotation and every rejected
+// change.
+type AuditSink interface {
+	// Record is called after a rotation has been applied or a change
+	// rejected, outside of any hotload lock. It should not block for long.
+	Record(event AuditEvent)
+}
+
+var auditSinks []AuditSink
+
+// RegisterAuditSink adds sink to the sinks notified of every rotation.
+// Multiple sinks may be registered, they are called in registration order.
+func RegisterAuditSink(sink AuditSink) {
+	if sink == nil {
+		panic("hotload: RegisterAuditSink sink is nil")
+	}
+	hooksMu.Lock()
+	defer hooksMu.Unlock()
+	auditSinks = append(auditSinks, sink)
+}
+
+func recordAudit(event AuditEvent) {
+	hooksMu.RLock()
+	sinks := auditSinks
+	hooksMu.RUnlock()
+	for _, s := range sinks {
+		s.Record(event)
+	}
+}
+
+// HashValue returns a short, stable hash identifying a connection string
+// without revealing it. It is meant for correlating values, e.g. in audit
+// logs, not as a secure commitment: a weak password could be brute forced.
+func HashValue(v string) string {
+	sum := sha256.Sum256([]byte(v))
+	return hex.EncodeToString(sum[:8])
+}
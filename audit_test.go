@@ -0,0 +1,77 @@
+package hotload
+
+import (
+	"context"
+	"strings"
+	"sync"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+type recordingSink struct {
+	mu     sync.Mutex
+	events []AuditEvent
+}
+
+func (rs *recordingSink) Record(event AuditEvent) {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+	rs.events = append(rs.events, event)
+}
+
+var _ = Describe("AuditSink", func() {
+	var sinks []AuditSink
+
+	BeforeEach(func() {
+		hooksMu.RLock()
+		sinks = auditSinks
+		hooksMu.RUnlock()
+	})
+
+	AfterEach(func() {
+		hooksMu.Lock()
+		auditSinks = sinks
+		hooksMu.Unlock()
+	})
+
+	It("Should record every rotation in all sinks without raw secrets", func() {
+		first, second := &recordingSink{}, &recordingSink{}
+		RegisterAuditSink(first)
+		RegisterAuditSink(second)
+
+		cg := &chanGroup{
+			name:        "fsnotify://postgres/audit",
+			driverName:  "postgres",
+			value:       "user=app password=old",
+			resetPolicy: ResetPolicyForce,
+			log:         func(...interface{}) {},
+		}
+		cg.ctx, cg.cancel = noopContext()
+		cg.parentCtx = cg.ctx
+		cg.valueChanged("user=app password=new")
+
+		for _, rs := range []*recordingSink{first, second} {
+			Expect(rs.events).To(HaveLen(1))
+			e := rs.events[0]
+			Expect(e.Location).To(Equal(cg.name))
+			Expect(e.Driver).To(Equal("postgres"))
+			Expect(e.Policy).To(Equal(ResetPolicyForce))
+			Expect(e.OldHash).To(Equal(HashValue("user=app password=old")))
+			Expect(e.NewHash).To(Equal(HashValue("user=app password=new")))
+			Expect(e.NewHash).ToNot(Equal(e.OldHash))
+			Expect(e.Time).ToNot(BeZero())
+			for _, f := range []string{e.OldHash, e.NewHash, e.OldRedacted, e.NewRedacted} {
+				Expect(strings.Contains(f, "old") || strings.Contains(f, "new")).To(BeFalse(), f)
+			}
+		}
+	})
+
+	It("Should panic on a nil sink", func() {
+		Expect(func() { RegisterAuditSink(nil) }).To(PanicWith(MatchRegexp("sink is nil")))
+	})
+})
+
+func noopContext() (context.Context, context.CancelFunc) {
+	return context.WithCancel(context.Background())
+}
@@ -0,0 +1,130 @@
+package hotload
+
+import (
+	"math/rand"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+const rampWindowKey = "rampWindow"
+const rampStartKey = "rampStart"
+
+// canary gradually shifts new connections from the previous value to the
+// current one after a change. The fraction of opens using the current value
+// grows linearly from start to 1 over window.
+type canary struct {
+	window  time.Duration
+	start   float64
+	from    string
+	started time.Time
+	random  func() float64
+	// gen counts the ramps, connections opened with from remember the ramp
+	// they were opened in
+	gen int
+	// timer ends the ramp, nil if none is running
+	timer clockTimer
+}
+
+// begin starts ramping away from the previous value from.
+func (c *canary) begin(from string, now time.Time) {
+	c.from = from
+	c.started = now
+	c.gen++
+}
+
+// pick returns the value a new connection should use and whether it is the
+// previous value.
+func (c *canary) pick(current string, now time.Time) (string, bool) {
+	if c.window <= 0 || c.from == "" {
+		return current, false
+	}
+	elapsed := now.Sub(c.started)
+	if elapsed >= c.window {
+		// ramp complete
+		c.from = ""
+		return current, false
+	}
+	frac := c.start + (1-c.start)*float64(elapsed)/float64(c.window)
+	random := c.random
+	if random == nil {
+		random = rand.Float64
+	}
+	if random() < frac {
+		return current, false
+	}
+	return c.from, true
+}
+
+// beginRamp starts ramping away from the value in use, once the window has
+// elapsed endRamp resets the connections opened with it meanwhile. cg.mu must
+// be held.
+func (cg *chanGroup) beginRamp() {
+	c := &cg.canary
+	c.begin(cg.value, cg.now())
+	if c.timer != nil {
+		c.timer.Stop()
+	}
+	gen := c.gen
+	c.timer = cg.afterFunc(c.window, func() { cg.endRamp(gen) })
+}
+
+// endRamp completes the ramp gen, resetting the connections opened with the
+// previous value during it according to the reset policy. A ramp restarted by
+// a change meanwhile is left alone.
+func (cg *chanGroup) endRamp(gen int) {
+	defer cg.fireConnsHooks()
+	cg.mu.Lock()
+	defer cg.mu.Unlock()
+	c := &cg.canary
+	if gen != c.gen {
+		return
+	}
+	c.from = ""
+	c.timer = nil
+	if cg.resetPolicy == ResetPolicySoft {
+		// existing connections keep using the previous value
+		return
+	}
+	var previous []*managedConn
+	kept := make([]*managedConn, 0, len(cg.conns))
+	for _, conn := range cg.conns {
+		if conn.rampGen == gen {
+			previous = append(previous, conn)
+		} else {
+			kept = append(kept, conn)
+		}
+	}
+	if len(previous) == 0 {
+		return
+	}
+	cg.trace("ramp complete, resetting", len(previous), "connections opened with the previous value")
+	cg.resetConns(previous)
+	cg.conns = kept
+	cg.connsChanged(cg.resetReason())
+}
+
+// parseCanary reads the ramp options. Without a valid rampWindow every open
+// uses the current value.
+func (cg *chanGroup) parseCanary(vs url.Values) {
+	v := vs.Get(rampWindowKey)
+	if v == "" {
+		return
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil || d <= 0 {
+		cg.log("invalid rampWindow, ignoring", v)
+		return
+	}
+	cg.canary.window = d
+	cg.log("rampWindow set to", d)
+	if v := vs.Get(rampStartKey); v != "" {
+		f, err := strconv.ParseFloat(v, 64)
+		if err != nil || f < 0 || f >= 1 {
+			cg.log("invalid rampStart, ignoring", v)
+			return
+		}
+		cg.canary.start = f
+		cg.log("rampStart set to", f)
+	}
+}
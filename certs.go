@@ -0,0 +1,98 @@
+package hotload
+
+import (
+	"context"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/infobloxopen/hotload/modtime"
+)
+
+const certFilesKey = "certFiles"
+const certPollIntervalKey = "certPollInterval"
+
+// certStrategy is the strategy name cert files are monitored under.
+const certStrategy = "hotload-cert"
+
+// DefaultCertPollInterval is how often cert files are checked for changes
+// when certPollInterval is not set.
+var DefaultCertPollInterval = 30 * time.Second
+
+// parseCertFiles reads the cert files to monitor, a comma separated list in
+// one or more certFiles parameters.
+func (cg *chanGroup) parseCertFiles(vs url.Values) {
+	for _, v := range vs[certFilesKey] {
+		for _, p := range strings.Split(v, ",") {
+			if p = strings.TrimSpace(p); p != "" {
+				cg.certFiles = append(cg.certFiles, modtime.CleanPath(p))
+			}
+		}
+	}
+	if len(cg.certFiles) > 0 {
+		cg.log("certFiles set to", cg.certFiles)
+	}
+	cg.certPollInterval = DefaultCertPollInterval
+	if v := vs.Get(certPollIntervalKey); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d <= 0 {
+			cg.log("invalid certPollInterval, ignoring", v)
+			return
+		}
+		cg.certPollInterval = d
+		cg.log("certPollInterval set to", d)
+	}
+}
+
+// watchCerts resets the connections of the group whenever the modtime of one
+// of its cert files changes, even though the connection string is unchanged.
+// It returns when the parent context is done.
+func (cg *chanGroup) watchCerts() {
+	mtm := modtime.NewModTimeMonitor(cg.parentCtx, modtime.WithCheckInterval(cg.certPollInterval), modtime.WithLogger(cg.log))
+	last := make(map[string]time.Time, len(cg.certFiles))
+	for _, p := range cg.certFiles {
+		if err := mtm.AddMonitoredPath(certStrategy, p); err != nil {
+			cg.log("not monitoring cert file", p, err)
+			continue
+		}
+		if fi, err := os.Stat(p); err == nil {
+			last[p] = fi.ModTime()
+		}
+	}
+	ticker := time.NewTicker(cg.certPollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-cg.parentCtx.Done():
+			return
+		case <-ticker.C:
+		}
+		changed := false
+		for _, p := range cg.certFiles {
+			sts, err := mtm.GetPathStatus(certStrategy, p)
+			if err != nil || sts.ModTime.IsZero() || sts.ModTime.Equal(last[p]) {
+				continue
+			}
+			cg.log("cert file changed for location", cg.name, p)
+			last[p] = sts.ModTime
+			changed = true
+		}
+		if changed {
+			cg.certsChanged()
+		}
+	}
+}
+
+// certsChanged recycles connections after a cert file rotation according to
+// the reset policy.
+func (cg *chanGroup) certsChanged() {
+	defer cg.fireConnsHooks()
+	cg.mu.Lock()
+	defer cg.mu.Unlock()
+	if cg.resetPolicy != ResetPolicySoft {
+		cg.cancel()
+		cg.ctx, cg.cancel = context.WithCancel(cg.parentCtx)
+	}
+	cg.resetConnections()
+}
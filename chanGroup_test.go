@@ -3,11 +3,26 @@ package hotload
 import (
 	"context"
 	"database/sql/driver"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/url"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/infobloxopen/hotload/logger"
+	"github.com/infobloxopen/hotload/metrics"
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	dto "github.com/prometheus/client_model/go"
 )
 
 type testConn struct {
@@ -30,6 +45,265 @@ func (tc *testConn) Close() error {
 	return nil
 }
 
+// healthDriver opens connections whose queries fail for connection strings
+// containing "unhealthy".
+type healthDriver struct {
+	mu      sync.Mutex
+	queries []string
+}
+
+func (hd *healthDriver) Open(name string) (driver.Conn, error) {
+	return &healthConn{driver: hd, unhealthy: strings.Contains(name, "unhealthy")}, nil
+}
+
+func (hd *healthDriver) probes() []string {
+	hd.mu.Lock()
+	defer hd.mu.Unlock()
+	return append([]string(nil), hd.queries...)
+}
+
+type healthConn struct {
+	testConn
+	driver    *healthDriver
+	unhealthy bool
+}
+
+func (hc *healthConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	hc.driver.mu.Lock()
+	hc.driver.queries = append(hc.driver.queries, query)
+	hc.driver.mu.Unlock()
+	if hc.unhealthy {
+		return nil, errors.New("relation does not exist")
+	}
+	return healthRows{}, nil
+}
+
+type healthRows struct{}
+
+func (healthRows) Columns() []string              { return []string{"?column?"} }
+func (healthRows) Close() error                   { return nil }
+func (healthRows) Next(dest []driver.Value) error { return io.EOF }
+
+// fakeClock is a clock whose time only moves when advanced. Timers fire in
+// Advance once their time has come.
+type fakeClock struct {
+	mu     sync.Mutex
+	t      time.Time
+	timers []*fakeTimer
+}
+
+type fakeTimer struct {
+	clock *fakeClock
+	at    time.Time
+	f     func()
+}
+
+func (ft *fakeTimer) Stop() bool {
+	ft.clock.mu.Lock()
+	defer ft.clock.mu.Unlock()
+	for i, t := range ft.clock.timers {
+		if t == ft {
+			ft.clock.timers = append(ft.clock.timers[:i], ft.clock.timers[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+func (fc *fakeClock) AfterFunc(d time.Duration, f func()) clockTimer {
+	fc.mu.Lock()
+	defer fc.mu.Unlock()
+	ft := &fakeTimer{clock: fc, at: fc.t.Add(d), f: f}
+	fc.timers = append(fc.timers, ft)
+	return ft
+}
+
+func newFakeClock() *fakeClock {
+	return &fakeClock{t: time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)}
+}
+
+func (fc *fakeClock) Now() time.Time {
+	fc.mu.Lock()
+	defer fc.mu.Unlock()
+	return fc.t
+}
+
+func (fc *fakeClock) Advance(d time.Duration) {
+	fc.mu.Lock()
+	fc.t = fc.t.Add(d)
+	var due []*fakeTimer
+	pending := fc.timers[:0]
+	for _, t := range fc.timers {
+		if t.at.After(fc.t) {
+			pending = append(pending, t)
+		} else {
+			due = append(due, t)
+		}
+	}
+	fc.timers = pending
+	fc.mu.Unlock()
+	// called synchronously so tests see their effects right away
+	for _, t := range due {
+		t.f()
+	}
+}
+
+// recordingDriver records the connection strings it is asked to open.
+type recordingDriver struct {
+	mu   sync.Mutex
+	dsns []string
+}
+
+func (rd *recordingDriver) Open(name string) (driver.Conn, error) {
+	rd.mu.Lock()
+	defer rd.mu.Unlock()
+	rd.dsns = append(rd.dsns, name)
+	return &testConn{}, nil
+}
+
+func (rd *recordingDriver) count(dsn string) int {
+	rd.mu.Lock()
+	defer rd.mu.Unlock()
+	n := 0
+	for _, d := range rd.dsns {
+		if d == dsn {
+			n++
+		}
+	}
+	rd.dsns = nil
+	return n
+}
+
+var errBackendNotReady = errors.New("backend not ready")
+
+// flakyDriver fails the first failures opens.
+type flakyDriver struct {
+	mu       sync.Mutex
+	failures int
+	opens    int
+}
+
+func (fd *flakyDriver) Open(name string) (driver.Conn, error) {
+	fd.mu.Lock()
+	defer fd.mu.Unlock()
+	fd.opens++
+	if fd.opens <= fd.failures {
+		return nil, errBackendNotReady
+	}
+	return &testConn{}, nil
+}
+
+// leakyDriver violates the driver.Driver contract by returning a connection
+// along with an error.
+type leakyDriver struct {
+	conn *testConn
+}
+
+func (ld *leakyDriver) Open(name string) (driver.Conn, error) {
+	ld.conn = &testConn{}
+	return ld.conn, errors.New("half open")
+}
+
+// recordingRecorder records the measurements of one location.
+type recordingRecorder struct {
+	mu       sync.Mutex
+	location string
+	values   map[string][]float64
+}
+
+func (r *recordingRecorder) Record(inst metrics.Instrument, value float64, labelValues ...string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if len(labelValues) == 0 || labelValues[0] != r.location {
+		return
+	}
+	r.values[inst.Name] = append(r.values[inst.Name], value)
+}
+
+func (r *recordingRecorder) get(name string) []float64 {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.values[name]
+}
+
+// fakeTunneler hands out tunnels listening on consecutive local ports.
+type fakeTunneler struct {
+	mu      sync.Mutex
+	tunnels []*fakeTunnel
+}
+
+func (ft *fakeTunneler) Tunnel(cfg TunnelConfig, remoteAddr string) (Tunnel, error) {
+	ft.mu.Lock()
+	defer ft.mu.Unlock()
+	t := &fakeTunnel{
+		addr:   fmt.Sprintf("127.0.0.1:%d", 40000+len(ft.tunnels)),
+		remote: remoteAddr,
+		done:   make(chan struct{}),
+	}
+	ft.tunnels = append(ft.tunnels, t)
+	return t, nil
+}
+
+type fakeTunnel struct {
+	mu     sync.Mutex
+	addr   string
+	remote string
+	done   chan struct{}
+	closed bool
+}
+
+func (t *fakeTunnel) LocalAddr() string     { return t.addr }
+func (t *fakeTunnel) Done() <-chan struct{} { return t.done }
+
+func (t *fakeTunnel) Close() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.closed = true
+	return nil
+}
+
+func (t *fakeTunnel) isClosed() bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.closed
+}
+
+// gatedDriver blocks opens until release is closed and tracks how many
+// opens run at once.
+type gatedDriver struct {
+	mu      sync.Mutex
+	active  int
+	release chan struct{}
+}
+
+func (gd *gatedDriver) Open(name string) (driver.Conn, error) {
+	gd.mu.Lock()
+	gd.active++
+	gd.mu.Unlock()
+	<-gd.release
+	gd.mu.Lock()
+	gd.active--
+	gd.mu.Unlock()
+	return &testConn{}, nil
+}
+
+func (gd *gatedDriver) getActive() int {
+	gd.mu.Lock()
+	defer gd.mu.Unlock()
+	return gd.active
+}
+
+// blockingConn is a connection whose Close blocks until unblock is closed.
+type blockingConn struct {
+	testConn
+	unblock chan struct{}
+}
+
+func (bc *blockingConn) Close() error {
+	<-bc.unblock
+	return bc.testConn.Close()
+}
+
 var _ = Describe("Driver", func() {
 	var pctx context.Context
 	var ctx context.Context
@@ -65,6 +339,84 @@ var _ = Describe("Driver", func() {
 			Expect(cg.value).To(Equal(newVal))
 		})
 
+		It("Should apply values once they were stable for stabilizeFor", func() {
+			clk := newFakeClock()
+			cg.clock = clk
+			cg.value = "dbname=a"
+			cg.parseStabilize(url.Values{stabilizeForKey: {"10s"}})
+			go cg.run()
+			// a value is handled once the next one is received
+			send := func(v string) {
+				values <- v
+				values <- v
+			}
+
+			send("dbname=b")
+			clk.Advance(5 * time.Second)
+			Expect(cg.currentValue()).To(Equal("dbname=a"))
+			send("dbname=c")
+			clk.Advance(5 * time.Second)
+			Expect(cg.currentValue()).To(Equal("dbname=a"), "a newer value restarts the wait")
+			clk.Advance(5 * time.Second)
+			Expect(cg.currentValue()).To(Equal("dbname=c"))
+
+			// an intermediate state the source reverts is never applied
+			send("dbname=d")
+			send("dbname=c")
+			clk.Advance(time.Minute)
+			Expect(cg.currentValue()).To(Equal("dbname=c"))
+		})
+
+		It("Should stop the stabilizeFor timer when the group is torn down", func() {
+			parent, stop := context.WithCancel(context.Background())
+			cg.parentCtx = parent
+			clk := newFakeClock()
+			cg.clock = clk
+			cg.value = "dbname=a"
+			cg.parseStabilize(url.Values{stabilizeForKey: {"10s"}})
+			done := make(chan struct{})
+			go func() {
+				cg.run()
+				close(done)
+			}()
+			values <- "dbname=b"
+			values <- "dbname=b"
+			stop()
+			Eventually(done).Should(BeClosed())
+			cg.mu.RLock()
+			Expect(cg.stabilizer.timer).To(BeNil())
+			cg.mu.RUnlock()
+			clk.Advance(time.Minute)
+			Expect(cg.currentValue()).To(Equal("dbname=a"))
+		})
+
+		It("Should reject values exceeding the maximum size", func() {
+			cg.value = "dbname=a"
+			cg.parseMaxValueSize(url.Values{maxValueSizeKey: {"4096"}})
+			go cg.run()
+
+			var before, after runtime.MemStats
+			runtime.GC()
+			runtime.ReadMemStats(&before)
+			values <- strings.Repeat("x", 32<<20)
+			// the same value again, once it is received the big one was handled
+			values <- "dbname=a"
+			Expect(cg.currentValue()).To(Equal("dbname=a"))
+			for _, c := range cg.conns {
+				Expect(c.GetReset()).To(BeFalse())
+			}
+			runtime.GC()
+			runtime.ReadMemStats(&after)
+			Expect(after.HeapAlloc).To(BeNumerically("<", before.HeapAlloc+8<<20), "the rejected value is not retained")
+
+			_, _, err := cg.prepareValue(strings.Repeat("x", 4097))
+			Expect(err).To(MatchError(ErrValueTooLarge))
+			Expect(len(cg.redact(strings.Repeat("x", 4000)))).To(BeNumerically("<", 1100), "logged values are capped")
+
+			values <- "dbname=b"
+			Eventually(cg.currentValue).Should(Equal("dbname=b"))
+		})
+
 		It("Should not reset conns when the same value is pushed to the values channel", func() {
 			sameVal := ""
 			go cg.run()
@@ -75,6 +427,36 @@ var _ = Describe("Driver", func() {
 			}
 		})
 
+		It("Should not reset conns when a normalized-equal value is pushed", func() {
+			cg.value = "postgres://host:5432/db?a=1&b=2"
+			cg.normalize = normalizeURL
+			go cg.run()
+			values <- "postgres://HOST:5432/db?b=2&a=1"
+			values <- "postgres://HOST:5432/db?b=2&a=1"
+			cg.mu.RLock()
+			defer cg.mu.RUnlock()
+			Expect(cg.value).To(Equal("postgres://host:5432/db?a=1&b=2"))
+			for _, c := range cg.conns {
+				Expect(c.reset).To(BeFalse())
+			}
+		})
+
+		It("Should compare and open with the driver's normalizer", func() {
+			rd := &recordingDriver{}
+			cg.sqlDriver = &driverInstance{driver: rd}
+			WithNormalizer(NormalizePostgres)(cg.sqlDriver)
+			cg.value = "host=db dbname=app"
+			go cg.run()
+			values <- "dbname=app  Host=db"
+			values <- "dbname=app  Host=db"
+			for _, c := range cg.conns {
+				Expect(c.GetReset()).To(BeFalse())
+			}
+			_, err := cg.Open()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(rd.count("dbname=app host=db")).To(Equal(1))
+		})
+
 		It("Should change value and reset connections", func() {
 			newVal := "new DSN"
 			cg.valueChanged(newVal)
@@ -90,7 +472,7 @@ var _ = Describe("Driver", func() {
 		})
 
 		It("Should kill all connections when specified", func() {
-			cg.forceKill = true
+			cg.resetPolicy = ResetPolicyForce
 			testConns := make([]*testConn, 0)
 			for _, c := range cg.conns {
 				tc := &testConn{}
@@ -107,5 +489,1274 @@ var _ = Describe("Driver", func() {
 				Expect(tc.closed).To(BeTrue(), "Closed() should have been called on the underlying connection")
 			}
 		})
+
+		It("Should not deadlock when force killing connections opened by the group", func() {
+			cg.resetPolicy = ResetPolicyForce
+			tc := &testConn{}
+			cg.conns = []*managedConn{newManagedConn(ctx, "", tc, cg.remove)}
+			done := make(chan struct{})
+			go func() {
+				cg.valueChanged("new DSN")
+				close(done)
+			}()
+			Eventually(done).Should(BeClosed())
+			Expect(tc.closed).To(BeTrue())
+		})
+
+		It("Should close idle connections and drain connections in a transaction", func() {
+			cg.resetPolicy = ResetPolicyDrain
+			idle, busy := &testConn{}, &testConn{}
+			cg.conns = []*managedConn{{ctx: ctx, conn: idle}, {ctx: ctx, conn: busy, inTx: true}}
+			busyConn := cg.conns[1]
+			cg.resetConnections()
+
+			Expect(idle.closed).To(BeTrue(), "idle connection should be closed immediately")
+			Expect(busy.closed).To(BeFalse(), "connection in a transaction should not be closed yet")
+
+			busyConn.endTx()
+			Expect(busy.closed).To(BeTrue(), "connection should be closed once the transaction ends")
+		})
+
+		It("Should leave existing connections alone with the soft policy", func() {
+			cg.resetPolicy = ResetPolicySoft
+			cg.valueChanged("new DSN")
+
+			Expect(cg.value).To(Equal("new DSN"))
+			Expect(cg.conns).To(HaveLen(len(conns)))
+			Expect(ctx.Err()).ToNot(HaveOccurred())
+			for _, c := range conns {
+				Expect(c.reset).To(BeFalse())
+			}
+		})
+
+		It("Should tag opened connections with the location name", func() {
+			cg.name = "fsnotify://test/tmp/config.txt"
+			cg.sqlDriver = &driverInstance{driver: &testConn{}}
+			conn, err := cg.Open()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(conn.(interface{ Location() string }).Location()).To(Equal(cg.name))
+		})
+
+		It("Should expand env variables in pushed values", func() {
+			os.Setenv("HOTLOAD_TEST_DB_NAME", "expanded")
+			defer os.Unsetenv("HOTLOAD_TEST_DB_NAME")
+			cg.parseValues(url.Values{"expandEnv": []string{"true"}})
+			go cg.run()
+			values <- "dbname=${HOTLOAD_TEST_DB_NAME}"
+			values <- "dbname=${HOTLOAD_TEST_DB_NAME}"
+			cg.mu.RLock()
+			defer cg.mu.RUnlock()
+			Expect(cg.value).To(Equal("dbname=expanded"))
+		})
+
+		It("Should retain the previous value when a strict expansion fails", func() {
+			cg.value = "dbname=old"
+			cg.parseValues(url.Values{"expandEnv": []string{"strict"}})
+			go cg.run()
+			values <- "dbname=${HOTLOAD_TEST_UNDEFINED}"
+			values <- "dbname=${HOTLOAD_TEST_UNDEFINED}"
+			cg.mu.RLock()
+			defer cg.mu.RUnlock()
+			Expect(cg.value).To(Equal("dbname=old"))
+			for _, c := range cg.conns {
+				Expect(c.reset).To(BeFalse())
+			}
+		})
+
+		It("Should retain the previous value when a blank value is pushed with ignoreBlank=true", func() {
+			cg.value = "dbname=old"
+			cg.parseValues(url.Values{"ignoreBlank": []string{"true"}})
+			go cg.run()
+			values <- ""
+			values <- " \n\t"
+			cg.mu.RLock()
+			Expect(cg.value).To(Equal("dbname=old"))
+			for _, c := range cg.conns {
+				Expect(c.reset).To(BeFalse())
+			}
+			cg.mu.RUnlock()
+
+			values <- "dbname=new"
+			values <- "dbname=new"
+			cg.mu.RLock()
+			defer cg.mu.RUnlock()
+			Expect(cg.value).To(Equal("dbname=new"))
+		})
+
+		It("Should re-watch a strategy that closed its values channel", func() {
+			backoff := rewatchBackoff
+			rewatchBackoff = time.Millisecond
+			defer func() { rewatchBackoff = backoff }()
+			in := make(chan string)
+			next := make(chan string)
+			var attempts int32
+			rewatch := func(ctx context.Context) (string, <-chan string, error) {
+				if atomic.AddInt32(&attempts, 1) == 1 {
+					return "", nil, errors.New("source unavailable")
+				}
+				return "dbname=rewatched", next, nil
+			}
+			out := coalesce(pctx, cg.name, in, rewatch, cg.log, nil)
+
+			close(in)
+			Eventually(out).Should(Receive(Equal("dbname=rewatched")))
+			Expect(atomic.LoadInt32(&attempts)).To(BeEquivalentTo(2))
+			next <- "dbname=next"
+			Eventually(out).Should(Receive(Equal("dbname=next")))
+		})
+
+		It("Should buffer channelBuffer values in order and report the backlog", func() {
+			cg.name = "test://postgres/buffer"
+			cg.parseValues(url.Values{channelBufferKey: {"3"}})
+			Expect(cg.stats().ChannelBuffer).To(Equal(3))
+			coalesced := metrics.HotloadCoalescedUpdatesCounter.WithLabelValues(cg.name)
+			start := testutil.ToFloat64(coalesced)
+			in := make(chan string)
+			out := coalesce(pctx, cg.name, in, nil, cg.log, &cg.buffer)
+
+			for _, v := range []string{"a", "b", "c", "d", "e"} {
+				in <- v
+			}
+			// the oldest values were replaced once three were waiting
+			Eventually(func() float64 { return testutil.ToFloat64(coalesced) - start }).Should(Equal(2.0))
+			Expect(cg.stats().MaxBacklog).To(Equal(3))
+			for _, v := range []string{"c", "d", "e"} {
+				Eventually(out).Should(Receive(Equal(v)))
+			}
+			Consistently(out, 20*time.Millisecond).ShouldNot(Receive())
+			in <- "f"
+			Eventually(out).Should(Receive(Equal("f")))
+			Expect(cg.stats().MaxBacklog).To(Equal(3))
+		})
+
+		It("Should buffer only the latest value by default", func() {
+			cg.parseValues(url.Values{channelBufferKey: {"0"}})
+			Expect(cg.stats().ChannelBuffer).To(Equal(DefaultChannelBuffer))
+			Expect(cg.stats().MaxBacklog).To(BeZero())
+		})
+
+		It("Should not back-pressure the strategy during a slow reset", func() {
+			bc := &blockingConn{unblock: make(chan struct{})}
+			cg.resetPolicy = ResetPolicyForce
+			cg.conns = []*managedConn{{ctx: ctx, conn: bc}}
+			cg.name = "test://postgres/coalesce"
+			coalesced := metrics.HotloadCoalescedUpdatesCounter.WithLabelValues(cg.name)
+			pending := metrics.HotloadPendingUpdatesGauge.WithLabelValues(cg.name)
+			cg.values = coalesce(pctx, cg.name, values, nil, cg.log, nil)
+			go cg.run()
+
+			// the first change blocks the run loop inside the reset
+			values <- "first"
+			flooded := make(chan struct{})
+			go func() {
+				for i := 0; i < 100; i++ {
+					values <- fmt.Sprintf("value %d", i)
+				}
+				close(flooded)
+			}()
+			Eventually(flooded).Should(BeClosed(), "strategy sends should not block on a slow reset")
+			// a value waits, every later value replaced the waiting one
+			Eventually(func() float64 { return testutil.ToFloat64(coalesced) }).Should(BeNumerically(">=", 99))
+			Expect(testutil.ToFloat64(pending)).To(Equal(1.0))
+
+			close(bc.unblock)
+			Eventually(func() float64 { return testutil.ToFloat64(pending) }).Should(BeZero())
+			Eventually(func() string {
+				cg.mu.RLock()
+				defer cg.mu.RUnlock()
+				return cg.value
+			}).Should(Equal("value 99"))
+		})
+
+		It("Should kill all connections on demand without changing the value", func() {
+			cg.value = "dsn"
+			testConns := make([]*testConn, 0)
+			for _, c := range cg.conns {
+				tc := &testConn{}
+				c.conn = tc
+				testConns = append(testConns, tc)
+			}
+			mu.Lock()
+			hotloadDriver.cgroup["kill-test"] = cg
+			mu.Unlock()
+			defer func() {
+				mu.Lock()
+				delete(hotloadDriver.cgroup, "kill-test")
+				mu.Unlock()
+			}()
+
+			Expect(KillConnections("kill-test")).To(Equal(3))
+			Expect(KillConnections("not-a-location")).To(Equal(0))
+
+			Expect(cg.value).To(Equal("dsn"))
+			Expect(cg.conns).To(BeEmpty())
+			Expect(ctx.Err()).To(HaveOccurred(), "old connections' context should be canceled")
+			for _, tc := range testConns {
+				Expect(tc.closed).To(BeTrue())
+			}
+		})
+
+		It("Should count closed connections by reason", func() {
+			cg.name = "fsnotify://test/close-reason"
+			cg.conns = nil
+			cg.sqlDriver = &driverInstance{driver: &recordingDriver{}}
+			closed := func(reason CloseReason) float64 {
+				return testutil.ToFloat64(metrics.HotloadConnectionsClosedCounter.WithLabelValues(cg.name, string(reason)))
+			}
+			open := func() driver.Conn {
+				conn, err := cg.Open()
+				Expect(err).ToNot(HaveOccurred())
+				return conn
+			}
+
+			open()
+			open()
+			cg.resetPolicy = ResetPolicyForce
+			cg.valueChanged("dbname=force")
+			Expect(closed(CloseReasonForce)).To(BeEquivalentTo(2))
+
+			lazy := open()
+			cg.resetPolicy = ResetPolicyLazy
+			cg.valueChanged("dbname=lazy")
+			Expect(lazy.Close()).To(Succeed())
+			Expect(closed(CloseReasonLazy)).To(BeEquivalentTo(1))
+
+			Expect(open().Close()).To(Succeed())
+			Expect(closed(CloseReasonPool)).To(BeEquivalentTo(1))
+
+			open()
+			Expect(cg.killConnections()).To(Equal(1))
+			Expect(closed(CloseReasonKill)).To(BeEquivalentTo(1))
+			Expect(closed(CloseReasonLazy)).To(BeEquivalentTo(1))
+		})
+
+		It("Should report when the location becomes active and idle", func() {
+			cg.name = "fsnotify://test/active-idle"
+			cg.conns = nil
+			cg.sqlDriver = &driverInstance{driver: &recordingDriver{}}
+			var hooks []string
+			record := func(hook string) func(string) {
+				return func(location string) {
+					if location == cg.name {
+						// hooks run outside cg.mu, calling back in must not deadlock
+						cg.stats()
+						hooks = append(hooks, hook)
+					}
+				}
+			}
+			OnLocationActive(record("active"))
+			OnLocationIdle(func(location string, reason CloseReason) {
+				record("idle:" + string(reason))(location)
+			})
+			defer OnLocationActive(nil)
+			defer OnLocationIdle(nil)
+			open := func() driver.Conn {
+				conn, err := cg.Open()
+				Expect(err).ToNot(HaveOccurred())
+				return conn
+			}
+
+			first, second := open(), open()
+			Expect(hooks).To(Equal([]string{"active"}))
+			Expect(first.Close()).To(Succeed())
+			Expect(hooks).To(Equal([]string{"active"}))
+			Expect(second.Close()).To(Succeed())
+			Expect(hooks).To(Equal([]string{"active", "idle:pool"}))
+
+			// a change drops the connections it resets
+			open()
+			cg.valueChanged("dbname=changed")
+			Expect(hooks).To(Equal([]string{"active", "idle:pool", "active", "idle:lazy"}))
+
+			open()
+			cg.parseValues(url.Values{"resetPolicy": {"force"}})
+			cg.valueChanged("dbname=forced")
+			Expect(hooks).To(Equal([]string{"active", "idle:pool", "active", "idle:lazy", "active", "idle:force"}))
+
+			open()
+			Expect(cg.killConnections()).To(Equal(1))
+			Expect(hooks[len(hooks)-2:]).To(Equal([]string{"active", "idle:kill"}))
+		})
+
+		It("Should open connections through a tunnel and replace it on changes", func() {
+			ft := &fakeTunneler{}
+			SetTunneler(ft)
+			defer SetTunneler(nil)
+			rd := &recordingDriver{}
+			cg.sqlDriver = &driverInstance{driver: rd}
+			cg.conns = nil
+			cg.value = "host=db1 port=5432 dbname=app"
+			cg.parseValues(url.Values{"tunnelHost": {"bastion:22"}, "tunnelUser": {"ops"}, "tunnelKey": {"/keys/id"}})
+			Expect(cg.tunnel.cfg).To(Equal(TunnelConfig{Host: "bastion:22", User: "ops", KeyFile: "/keys/id"}))
+
+			first, err := cg.Open()
+			Expect(err).ToNot(HaveOccurred())
+			_, err = cg.Open()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(rd.count("host=127.0.0.1 port=40000 dbname=app")).To(Equal(2))
+			Expect(ft.tunnels).To(HaveLen(1))
+			Expect(ft.tunnels[0].remote).To(Equal("db1:5432"))
+
+			// the old tunnel stays up until its connections are closed
+			cg.valueChanged("host=db2 port=5432 dbname=app")
+			_, err = cg.Open()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(rd.count("host=127.0.0.1 port=40001 dbname=app")).To(Equal(1))
+			Expect(ft.tunnels[1].remote).To(Equal("db2:5432"))
+			Expect(first.Close()).To(Succeed())
+			Expect(ft.tunnels[0].isClosed()).To(BeFalse())
+			Expect(cg.killConnections()).To(Equal(1))
+			Expect(ft.tunnels[1].isClosed()).To(BeTrue())
+
+			// a failed tunnel is re-established by the next open
+			_, err = cg.Open()
+			Expect(err).ToNot(HaveOccurred())
+			close(ft.tunnels[2].done)
+			_, err = cg.Open()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(ft.tunnels).To(HaveLen(4))
+		})
+
+		It("Should fail opens through a tunnel without a tunneler", func() {
+			cg.sqlDriver = &driverInstance{driver: &recordingDriver{}}
+			cg.value = "postgres://db1:5432/app"
+			cg.parseValues(url.Values{"tunnelHost": {"bastion"}})
+			_, err := cg.Open()
+			Expect(err).To(MatchError(ErrNoTunneler))
+		})
+
+		It("Should trace decisions with redacted values when debug is enabled", func() {
+			var logMu sync.Mutex
+			var lines []string
+			cg.log = func(args ...interface{}) {
+				logMu.Lock()
+				defer logMu.Unlock()
+				lines = append(lines, fmt.Sprint(args...))
+			}
+			cg.parseValues(url.Values{"debug": []string{"true"}})
+			go cg.run()
+			values <- "user=app password=s3cret"
+			values <- "user=app password=s3cret"
+
+			logged := func() []string {
+				logMu.Lock()
+				defer logMu.Unlock()
+				return append([]string(nil), lines...)
+			}
+			Eventually(logged).Should(ContainElement(ContainSubstring("value unchanged")))
+			Expect(logged()).To(ContainElement(ContainSubstring("value changed")))
+			Expect(logged()).To(ContainElement(ContainSubstring("resetting")))
+			for _, l := range logged() {
+				Expect(l).ToNot(ContainSubstring("s3cret"))
+			}
+		})
+
+		It("Should not trace when debug is disabled", func() {
+			var lines []string
+			cg.log = func(args ...interface{}) {
+				lines = append(lines, fmt.Sprint(args...))
+			}
+			cg.trace("something")
+			Expect(lines).To(BeEmpty())
+		})
+
+		It("Should track LastFetch for every value and LastChange only for changes", func() {
+			clk := newFakeClock()
+			cg.clock = clk
+			cg.name = "stats-test"
+			mu.Lock()
+			hotloadDriver.cgroup[cg.name] = cg
+			mu.Unlock()
+			defer func() {
+				mu.Lock()
+				delete(hotloadDriver.cgroup, cg.name)
+				mu.Unlock()
+			}()
+			go cg.run()
+
+			values <- "v1"
+			values <- "v1"
+			start := clk.Now()
+			Eventually(func() time.Time { return Stats()[cg.name].LastChange }).Should(Equal(start))
+
+			clk.Advance(time.Minute)
+			values <- "v1"
+			values <- "v1"
+			st := Stats()[cg.name]
+			Expect(st.LastFetch).To(Equal(start.Add(time.Minute)))
+			Expect(st.LastChange).To(Equal(start))
+			Expect(st.Connections).To(BeZero(), "the change reset all connections")
+		})
+
+		It("Should only count a flood of identical values as fetches", func() {
+			clk := newFakeClock()
+			cg.clock = clk
+			cg.name = "fsnotify://test/keepalive"
+			cg.value = "v1"
+			hooksMu.RLock()
+			sinks := auditSinks
+			hooksMu.RUnlock()
+			sink := &recordingSink{}
+			RegisterAuditSink(sink)
+			defer func() {
+				hooksMu.Lock()
+				auditSinks = sinks
+				hooksMu.Unlock()
+			}()
+			go cg.run()
+			gauge := metrics.HotloadLastFetchGauge.WithLabelValues(cg.name)
+
+			start := clk.Now()
+			for i := 0; i < 100; i++ {
+				clk.Advance(time.Second)
+				values <- "v1"
+			}
+			values <- "v1"
+			st := cg.stats()
+			Expect(st.LastFetch).To(Equal(start.Add(100 * time.Second)))
+			Expect(testutil.ToFloat64(gauge)).To(BeNumerically("==", float64(st.LastFetch.UnixNano())/1e9))
+			Expect(st.LastChange).To(BeZero())
+			Expect(ctx.Err()).ToNot(HaveOccurred(), "connections must not be reset")
+			for _, c := range conns {
+				Expect(c.GetReset()).To(BeFalse())
+			}
+			cg.mu.RLock()
+			Expect(cg.history).To(BeEmpty())
+			cg.mu.RUnlock()
+			sink.mu.Lock()
+			defer sink.mu.Unlock()
+			Expect(sink.events).To(BeEmpty())
+		})
+
+		It("Should gradually shift opens to the new value over the ramp window", func() {
+			clk := newFakeClock()
+			rd := &recordingDriver{}
+			cg.clock = clk
+			cg.sqlDriver = &driverInstance{driver: rd}
+			cg.value = "old"
+			cg.parseValues(url.Values{"rampWindow": []string{"100s"}})
+			cg.canary.random = rand.New(rand.NewSource(1)).Float64
+			cg.valueChanged("new")
+
+			openN := func(n int) {
+				for i := 0; i < n; i++ {
+					_, err := cg.Open()
+					Expect(err).ToNot(HaveOccurred())
+				}
+			}
+			openN(1000)
+			Expect(rd.count("new")).To(BeNumerically("<", 50))
+
+			clk.Advance(50 * time.Second)
+			openN(1000)
+			Expect(rd.count("new")).To(BeNumerically("~", 500, 60))
+
+			clk.Advance(40 * time.Second)
+			openN(1000)
+			Expect(rd.count("new")).To(BeNumerically("~", 900, 40))
+
+			clk.Advance(10 * time.Second)
+			openN(1000)
+			Expect(rd.count("new")).To(Equal(1000))
+		})
+
+		It("Should reset connections opened with the previous value once the ramp completes", func() {
+			clk := newFakeClock()
+			rd := &recordingDriver{}
+			cg.clock = clk
+			cg.sqlDriver = &driverInstance{driver: rd}
+			cg.value = "old"
+			cg.parseValues(url.Values{"rampWindow": []string{"100s"}})
+			cg.canary.random = rand.New(rand.NewSource(1)).Float64
+			cg.valueChanged("new")
+			clk.Advance(50 * time.Second)
+
+			var previous, current []*managedConn
+			for i := 0; i < 20; i++ {
+				conn, err := cg.Open()
+				Expect(err).ToNot(HaveOccurred())
+				if rd.count("old") == 1 {
+					previous = append(previous, conn.(*managedConn))
+				} else {
+					current = append(current, conn.(*managedConn))
+				}
+			}
+			Expect(previous).ToNot(BeEmpty())
+			Expect(current).ToNot(BeEmpty())
+
+			clk.Advance(50 * time.Second)
+			for _, c := range previous {
+				Expect(c.GetReset()).To(BeTrue())
+			}
+			for _, c := range current {
+				Expect(c.GetReset()).To(BeFalse())
+			}
+			Expect(cg.stats().Connections).To(Equal(len(current)))
+		})
+
+		It("Should use the new value for every open without a ramp window", func() {
+			rd := &recordingDriver{}
+			cg.sqlDriver = &driverInstance{driver: rd}
+			cg.valueChanged("new")
+			_, err := cg.Open()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(rd.count("new")).To(Equal(1))
+		})
+
+		It("Should retain the previous value when the driver's validator rejects the new one", func() {
+			cg.driverName = "validated-test"
+			cg.value = "host=db user=app dbname=app"
+			RegisterDSNValidator(cg.driverName, PostgresDSNValidator{})
+			defer RegisterDSNValidator(cg.driverName, nil)
+			go cg.run()
+
+			values <- "host=db user=app"
+			values <- "host=db user=app"
+			cg.mu.RLock()
+			Expect(cg.value).To(Equal("host=db user=app dbname=app"))
+			cg.mu.RUnlock()
+			for _, c := range cg.conns {
+				Expect(c.GetReset()).To(BeFalse())
+			}
+
+			values <- "host=db2 user=app dbname=app"
+			Eventually(func() string {
+				cg.mu.RLock()
+				defer cg.mu.RUnlock()
+				return cg.value
+			}).Should(Equal("host=db2 user=app dbname=app"))
+		})
+
+		It("Should map forceKill=true to the force policy", func() {
+			cg.parseValues(url.Values{"forceKill": []string{"true"}})
+			Expect(cg.resetPolicy).To(Equal(ResetPolicyForce))
+		})
+
+		It("Should prefer an explicit resetPolicy over forceKill", func() {
+			cg.parseValues(url.Values{"forceKill": []string{"true"}, "resetPolicy": []string{"drain"}})
+			Expect(cg.resetPolicy).To(Equal(ResetPolicyDrain))
+		})
+
+		It("Should retry failed opens up to openRetries times", func() {
+			fd := &flakyDriver{failures: 2}
+			cg.sqlDriver = &driverInstance{driver: fd}
+			cg.parseValues(url.Values{"openRetries": []string{"2"}, "openRetryBackoff": []string{"1ms"}})
+			Expect(cg.retry).To(Equal(openRetry{retries: 2, backoff: time.Millisecond}))
+			_, err := cg.Open()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(fd.opens).To(Equal(3))
+
+			fd.opens, fd.failures = 0, 5
+			_, err = cg.Open()
+			Expect(err).To(MatchError(errBackendNotReady))
+			Expect(fd.opens).To(Equal(3))
+		})
+
+		It("Should stop retrying once the context of the open is done", func() {
+			fd := &flakyDriver{failures: 5}
+			cg.sqlDriver = &driverInstance{driver: fd}
+			cg.parseValues(url.Values{"openRetries": []string{"3"}, "openRetryBackoff": []string{"1h"}})
+			ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+			defer cancel()
+			_, err := cg.open(ctx)
+			Expect(err).To(MatchError(errBackendNotReady))
+			Expect(fd.opens).To(Equal(1))
+		})
+
+		It("Should pass the application name to the driver", func() {
+			rd := &recordingDriver{}
+			cg.name = "fsnotify://postgres/etc/dsn?appName="
+			cg.value = "postgres://db:5432/app"
+			cg.sqlDriver = &driverInstance{driver: rd}
+			cg.parseValues(url.Values{"appName": {""}})
+			_, err := cg.Open()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(rd.count("postgres://db:5432/app?application_name=fsnotify%3A%2F%2Fpostgres%2Fetc%2Fdsn")).To(Equal(1))
+
+			cg.sqlDriver = &driverInstance{driver: rd, options: map[string]string{"sslmode": "disable"}}
+			WithAppNameKey("program_name")(cg.sqlDriver)
+			cg.parseValues(url.Values{"appName": {"orders"}})
+			_, err = cg.Open()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(rd.count("postgres://db:5432/app?program_name=orders&sslmode=disable")).To(Equal(1))
+
+			// key/value connection strings get it appended, quoted
+			cg.sqlDriver = &driverInstance{driver: rd}
+			cg.value = "host=db dbname=app application_name=other"
+			cg.parseValues(url.Values{"appName": {"o'rders app"}})
+			_, err = cg.Open()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(rd.count(`host=db dbname=app application_name='o\'rders app'`)).To(Equal(1))
+		})
+
+		It("Should send measurements to the metrics recorder", func() {
+			rec := &recordingRecorder{location: "fsnotify://postgres/recorder", values: map[string][]float64{}}
+			metrics.SetRecorder(rec)
+			defer metrics.SetRecorder(nil)
+			cg.name = rec.location
+			cg.conns = nil
+			cg.sqlDriver = &driverInstance{driver: &flakyDriver{failures: 1}}
+			_, err := cg.Open()
+			Expect(err).To(HaveOccurred())
+			conn, err := cg.Open()
+			Expect(err).ToNot(HaveOccurred())
+			cg.valueChanged("dbname=new")
+			conn.Close()
+
+			Expect(rec.get(metrics.HotloadOpenFailuresCounterName)).To(Equal([]float64{1}))
+			Expect(rec.get(metrics.HotloadChangesCounterName)).To(Equal([]float64{1}))
+			Expect(rec.get(metrics.HotloadConnectionsGaugeName)).To(Equal([]float64{1, 0}))
+			Expect(rec.get(metrics.HotloadConnectionsClosedCounterName)).To(Equal([]float64{1}))
+		})
+
+		It("Should wrap open errors with the location", func() {
+			cg.name = "fsnotify://postgres/etc/dsn"
+			cg.driverName = "postgres"
+			cg.value = "host=db password=secret"
+			cg.sqlDriver = &driverInstance{driver: &flakyDriver{failures: 1}}
+			_, err := cg.Open()
+			Expect(err).To(MatchError(errBackendNotReady))
+			Expect(err.Error()).To(Equal("hotload: could not open fsnotify://postgres/etc/dsn (strategy fsnotify, driver postgres, hash " +
+				HashValue("host=db password=secret") + "): backend not ready"))
+			Expect(err.Error()).ToNot(ContainSubstring("secret"))
+		})
+
+		It("Should close a connection the driver returns along with an error", func() {
+			ld := &leakyDriver{}
+			cg.sqlDriver = &driverInstance{driver: ld}
+			conn, err := cg.Open()
+			Expect(err).To(MatchError(HaveSuffix(": half open")))
+			Expect(conn).To(BeNil())
+			Expect(ld.conn.closed).To(BeTrue())
+		})
+
+		It("Should strip changeTimeField and observe the change latency", func() {
+			clk := newFakeClock()
+			cg.clock = clk
+			cg.name = "fsnotify://test/change-latency"
+			cg.parseValues(url.Values{"changeTimeField": []string{"changed_at"}})
+			go cg.run()
+			changed := clk.Now().Add(-3 * time.Second).Unix()
+			values <- fmt.Sprintf("dbname=new changed_at=%d", changed)
+			values <- fmt.Sprintf("dbname=new changed_at=%d", changed)
+			cg.mu.RLock()
+			Expect(cg.value).To(Equal("dbname=new"))
+			cg.mu.RUnlock()
+			h := metrics.HotloadChangeLatencyHistogram.WithLabelValues(cg.name).(prometheus.Histogram)
+			m := &dto.Metric{}
+			Expect(h.Write(m)).To(Succeed())
+			Expect(m.GetHistogram().GetSampleCount()).To(BeEquivalentTo(1))
+			Expect(m.GetHistogram().GetSampleSum()).To(BeNumerically(">=", 3))
+		})
+
+		It("Should reject writes on connections opened while the value is read-only", func() {
+			rd := &recordingDriver{}
+			cg.sqlDriver = &driverInstance{driver: rd}
+			cg.parseValues(url.Values{"readOnly": []string{"directive"}})
+			cg.value = ReadOnlyDirective + "\nhost=replica"
+			conn, err := cg.Open()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(rd.count("host=replica")).To(Equal(1))
+			_, err = conn.(driver.ExecerContext).ExecContext(context.Background(), "INSERT INTO t VALUES (1)", nil)
+			Expect(err).To(MatchError(ErrReadOnly))
+			_, err = conn.(driver.QueryerContext).QueryContext(context.Background(), "INSERT INTO t VALUES (1) RETURNING id", nil)
+			Expect(err).To(MatchError(ErrReadOnly))
+			_, err = conn.(driver.Queryer).Query("WITH n AS (DELETE FROM t RETURNING id) SELECT * FROM n", nil)
+			Expect(err).To(MatchError(ErrReadOnly))
+
+			cg.value = "host=primary"
+			conn, err = cg.Open()
+			Expect(err).ToNot(HaveOccurred())
+			_, err = conn.(driver.ExecerContext).ExecContext(context.Background(), "INSERT INTO t VALUES (1)", nil)
+			Expect(err).To(Equal(driver.ErrSkip))
+		})
+
+		It("Should reset connections when a cert file changes", func() {
+			dir, err := os.MkdirTemp("", "hotload-certs")
+			Expect(err).ToNot(HaveOccurred())
+			defer os.RemoveAll(dir)
+			cert := filepath.Join(dir, "client.crt")
+			Expect(os.WriteFile(cert, []byte("cert"), 0o600)).To(Succeed())
+
+			cg.parseValues(url.Values{"certFiles": []string{cert}, "certPollInterval": []string{"10ms"}})
+			Expect(cg.certFiles).To(Equal([]string{cert}))
+			wctx, stop := context.WithCancel(pctx)
+			defer stop()
+			cg.parentCtx = wctx
+			oldCtx := cg.ctx
+			go cg.watchCerts()
+			Consistently(oldCtx.Done(), "50ms").ShouldNot(BeClosed())
+
+			later := time.Now().Add(time.Minute)
+			Expect(os.Chtimes(cert, later, later)).To(Succeed())
+			Eventually(oldCtx.Done()).Should(BeClosed())
+			cg.mu.RLock()
+			defer cg.mu.RUnlock()
+			Expect(cg.conns).To(BeEmpty())
+			Expect(cg.value).To(Equal(""))
+		})
+
+		It("Should report connection details", func() {
+			clk := newFakeClock()
+			cg.clock = clk
+			cg.sqlDriver = &driverInstance{driver: &testConn{}}
+			cg.conns = nil
+			_, err := cg.Open()
+			Expect(err).ToNot(HaveOccurred())
+			clk.Advance(time.Second)
+			_, err = cg.Open()
+			Expect(err).ToNot(HaveOccurred())
+			cg.conns[1].setInTx(true)
+			opened := cg.conns[0]
+			Expect(opened.Stale()).To(BeFalse())
+			Expect(cg.connectionDetails()).To(Equal([]ConnInfo{
+				{Created: clk.Now().Add(-time.Second)},
+				{Created: clk.Now(), InTx: true},
+			}))
+
+			cg.valueChanged("new")
+			Expect(opened.Stale()).To(BeTrue())
+			// listed until they are closed
+			Expect(cg.connectionDetails()).To(Equal([]ConnInfo{
+				{Created: clk.Now().Add(-time.Second), Stale: true},
+				{Created: clk.Now(), Stale: true, InTx: true},
+			}))
+			Expect(opened.Close()).To(Succeed())
+			Expect(cg.connectionDetails()).To(Equal([]ConnInfo{
+				{Created: clk.Now(), Stale: true, InTx: true},
+			}))
+		})
+
+		It("Should count queries within the rotation window", func() {
+			clk := newFakeClock()
+			cg.clock = clk
+			cg.name = "test://postgres/rotation-window"
+			counter := metrics.HotloadQueriesAfterRotationCounter.WithLabelValues(cg.name)
+			mc := newManagedConn(ctx, cg.name, mockDriverConn{}, nil)
+			mc.rotation = &cg.rotationWindow
+			mc.clock = cg.now
+
+			mc.Query("SELECT 1", nil)
+			Expect(testutil.ToFloat64(counter)).To(BeZero(), "no rotation yet")
+
+			cg.valueChanged("new")
+			gauge := metrics.HotloadLastRotationGauge.WithLabelValues(cg.name)
+			Expect(testutil.ToFloat64(gauge)).To(BeNumerically("==", float64(clk.Now().UnixNano())/1e9))
+			mc.Query("SELECT 1", nil)
+			mc.ExecContext(context.Background(), "UPDATE t SET a = 1", nil)
+			Expect(testutil.ToFloat64(counter)).To(Equal(2.0))
+
+			clk.Advance(DefaultRotationWindow)
+			mc.Query("SELECT 1", nil)
+			Expect(testutil.ToFloat64(counter)).To(Equal(2.0), "the window has passed")
+
+			cg.parseRotationWindow(url.Values{rotationWindowKey: {"0"}})
+			cg.valueChanged("newer")
+			mc.Query("SELECT 1", nil)
+			Expect(testutil.ToFloat64(counter)).To(Equal(2.0), "counting is off")
+		})
+
+		It("Should count the run goroutine while it is active", func() {
+			gauge := metrics.HotloadWatchGoroutinesGauge.WithLabelValues(runStrategy)
+			before := testutil.ToFloat64(gauge)
+			rctx, stop := context.WithCancel(pctx)
+			cg.parentCtx = rctx
+			done := make(chan struct{})
+			go func() {
+				cg.run()
+				close(done)
+			}()
+			values <- "new"
+			Expect(testutil.ToFloat64(gauge)).To(Equal(before + 1))
+			stop()
+			Eventually(done).Should(BeClosed())
+			Expect(testutil.ToFloat64(gauge)).To(Equal(before))
+		})
+
+		It("Should limit concurrent opens to maxConcurrentOpens", func() {
+			gd := &gatedDriver{release: make(chan struct{})}
+			cg.sqlDriver = &driverInstance{driver: gd}
+			cg.parseValues(url.Values{"maxConcurrentOpens": []string{"2"}})
+			var wg sync.WaitGroup
+			for i := 0; i < 5; i++ {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					cg.Open()
+				}()
+			}
+			Eventually(func() int { return cg.stats().OpensInFlight }).Should(Equal(5))
+			Eventually(gd.getActive).Should(Equal(2))
+			Consistently(gd.getActive, "50ms").Should(Equal(2))
+			close(gd.release)
+			wg.Wait()
+			Expect(cg.stats().OpensInFlight).To(BeZero())
+			Expect(cg.stats().Connections).To(Equal(len(conns) + 5))
+		})
+
+		It("Should retain the previous value when a transform fails", func() {
+			cg.value = "dbname=old"
+			cg.parseValues(url.Values{"transforms": []string{"trim,base64"}})
+			go cg.run()
+			values <- "not base64!"
+			values <- "not base64!"
+			cg.mu.RLock()
+			Expect(cg.value).To(Equal("dbname=old"))
+			cg.mu.RUnlock()
+			values <- " ZGJuYW1lPW5ldw== "
+			values <- " ZGJuYW1lPW5ldw== "
+			cg.mu.RLock()
+			defer cg.mu.RUnlock()
+			Expect(cg.value).To(Equal("dbname=new"))
+		})
+
+		It("Should roll back through a bounded history", func() {
+			cg.parseValues(url.Values{"historyDepth": []string{"2"}})
+			cg.value = "dbname=a"
+			for _, v := range []string{"dbname=b", "dbname=c", "dbname=d"} {
+				cg.valueChanged(v)
+			}
+			Expect(cg.history).To(HaveLen(2))
+			Expect(cg.history[0].Hash).To(Equal(HashValue("dbname=b")))
+
+			Expect(cg.rollback()).To(Succeed())
+			Expect(cg.value).To(Equal("dbname=c"))
+			Expect(cg.rollback()).To(Succeed())
+			Expect(cg.value).To(Equal("dbname=b"))
+			Expect(cg.rollback()).To(MatchError(ErrNoHistory))
+		})
+
+		It("Should ignore the rolled back value until the source changes", func() {
+			cg.parseValues(url.Values{})
+			cg.value = "dbname=good"
+			cg.valueChanged("dbname=bad")
+			Expect(cg.rollback()).To(Succeed())
+			go cg.run()
+			values <- "dbname=bad"
+			values <- "dbname=bad"
+			cg.mu.RLock()
+			Expect(cg.value).To(Equal("dbname=good"))
+			cg.mu.RUnlock()
+			values <- "dbname=fixed"
+			values <- "dbname=fixed"
+			cg.mu.RLock()
+			defer cg.mu.RUnlock()
+			Expect(cg.value).To(Equal("dbname=fixed"))
+			Expect(cg.rolledBack).To(BeEmpty())
+		})
+
+		It("Should pass rollbacks through the change pipeline", func() {
+			hooksMu.RLock()
+			sinks := auditSinks
+			hooksMu.RUnlock()
+			defer func() {
+				hooksMu.Lock()
+				auditSinks = sinks
+				hooksMu.Unlock()
+			}()
+			rs := &recordingSink{}
+			RegisterAuditSink(rs)
+
+			cg.parseValues(url.Values{})
+			cg.value = "dbname=good"
+			cg.valueChanged("dbname=bad")
+			release := cg.acquireNoRotate()
+			defer release()
+			resetCtx := cg.ctx
+
+			Expect(cg.rollback()).To(Succeed())
+			Expect(cg.currentValue()).To(Equal("dbname=bad"), "a no-rotate lease holds the rollback back")
+			Expect(resetCtx.Err()).ToNot(HaveOccurred())
+
+			release()
+			Expect(cg.currentValue()).To(Equal("dbname=good"))
+			Expect(resetCtx.Err()).To(HaveOccurred())
+			cg.mu.RLock()
+			Expect(cg.history).To(BeEmpty())
+			Expect(cg.rolledBack).To(Equal("dbname=bad"))
+			cg.mu.RUnlock()
+			rs.mu.Lock()
+			defer rs.mu.Unlock()
+			Expect(rs.events).To(HaveLen(2))
+			Expect(rs.events[1].NewHash).To(Equal(HashValue("dbname=good")))
+		})
+
+		It("Should release flapping changes on the clock of the location", func() {
+			clk := newFakeClock()
+			cg.clock = clk
+			cg.value = "dbname=a"
+			cg.parseValues(url.Values{"flapLimit": []string{"1"}, "flapWindow": []string{"1m"}})
+			cg.valueChanged("dbname=b")
+			cg.valueChanged("dbname=c")
+			Expect(cg.currentValue()).To(Equal("dbname=b"))
+			clk.Advance(59 * time.Second)
+			Expect(cg.currentValue()).To(Equal("dbname=b"))
+			clk.Advance(time.Second)
+			Expect(cg.currentValue()).To(Equal("dbname=c"))
+		})
+
+		It("Should hold back changes while the source is flapping", func() {
+			cg.parseValues(url.Values{"flapLimit": []string{"2"}, "flapWindow": []string{"100ms"}})
+			for _, v := range []string{"dbname=a", "dbname=b", "dbname=c", "dbname=d"} {
+				cg.valueChanged(v)
+			}
+			Expect(cg.stats().Flapping).To(BeTrue())
+			cg.mu.RLock()
+			Expect(cg.value).To(Equal("dbname=b"))
+			cg.mu.RUnlock()
+
+			Eventually(func() string {
+				cg.mu.RLock()
+				defer cg.mu.RUnlock()
+				return cg.value
+			}).Should(Equal("dbname=d"))
+			Expect(cg.stats().Flapping).To(BeFalse())
+		})
+
+		It("Should not apply a change held while flapping once the source reverted", func() {
+			parent, stop := context.WithCancel(context.Background())
+			defer stop()
+			cg.parentCtx = parent
+			cg.value = "dbname=a"
+			cg.parseValues(url.Values{"flapLimit": []string{"1"}, "flapWindow": []string{"100ms"}})
+			go cg.run()
+			// b is applied, c is held, then the source goes back to b
+			for _, v := range []string{"dbname=b", "dbname=c", "dbname=b", "dbname=b"} {
+				values <- v
+			}
+			Expect(cg.stats().Flapping).To(BeTrue())
+			Eventually(func() bool { return cg.stats().Flapping }).Should(BeFalse())
+			Consistently(cg.currentValue, 50*time.Millisecond).Should(Equal("dbname=b"))
+		})
+
+		It("Should stop the flapping timer when the group is torn down", func() {
+			parent, stop := context.WithCancel(context.Background())
+			cg.parentCtx = parent
+			cg.value = "dbname=a"
+			cg.parseValues(url.Values{"flapLimit": []string{"1"}, "flapWindow": []string{"50ms"}})
+			done := make(chan struct{})
+			go func() {
+				cg.run()
+				close(done)
+			}()
+			values <- "dbname=b"
+			values <- "dbname=c"
+			values <- "dbname=c"
+			stop()
+			Eventually(done).Should(BeClosed())
+			cg.mu.RLock()
+			Expect(cg.flap.timer).To(BeNil())
+			cg.mu.RUnlock()
+			Consistently(cg.currentValue, 100*time.Millisecond).Should(Equal("dbname=b"))
+		})
+
+		It("Should apply only the latest change at the minRotateInterval boundary", func() {
+			hooksMu.RLock()
+			sinks := auditSinks
+			hooksMu.RUnlock()
+			sink := &recordingSink{}
+			RegisterAuditSink(sink)
+			defer func() {
+				hooksMu.Lock()
+				auditSinks = sinks
+				hooksMu.Unlock()
+			}()
+			resets := func() []AuditEvent {
+				sink.mu.Lock()
+				defer sink.mu.Unlock()
+				return append([]AuditEvent(nil), sink.events...)
+			}
+			cg.parseValues(url.Values{"minRotateInterval": []string{"200ms"}})
+			cg.valueChanged("dbname=a")
+			Expect(resets()).To(HaveLen(1), "the first change is applied right away")
+			for _, v := range []string{"dbname=b", "dbname=c", "dbname=d"} {
+				cg.valueChanged(v)
+			}
+			Consistently(resets, 100*time.Millisecond).Should(HaveLen(1))
+			cg.mu.RLock()
+			Expect(cg.value).To(Equal("dbname=a"))
+			cg.mu.RUnlock()
+
+			Eventually(resets).Should(HaveLen(2))
+			Expect(resets()[1].NewHash).To(Equal(HashValue("dbname=d")))
+			cg.mu.RLock()
+			defer cg.mu.RUnlock()
+			Expect(cg.value).To(Equal("dbname=d"))
+			Expect(cg.rotateLimit.held).To(BeFalse())
+		})
+
+		It("Should reset connections at the times of rotateSchedule", func() {
+			clk := newFakeClock()
+			cg.clock = clk
+			cg.value = "dbname=a"
+			// midnight and noon, the clock starts at midnight
+			cg.parseValues(url.Values{"rotateSchedule": []string{"0 0,12 * * *"}})
+			Expect(cg.nextScheduledRotation()).To(Equal(clk.Now().Add(12 * time.Hour)))
+			Expect(cg.rotateIfDue()).To(BeFalse())
+			Expect(ctx.Err()).ToNot(HaveOccurred())
+
+			clk.Advance(12 * time.Hour)
+			Expect(cg.rotateIfDue()).To(BeTrue())
+			Expect(ctx.Err()).To(HaveOccurred(), "connections should be reset")
+			for _, c := range conns {
+				Expect(c.GetReset()).To(BeTrue())
+			}
+			Expect(cg.conns).To(BeEmpty())
+			Expect(cg.value).To(Equal("dbname=a"), "the value is unchanged")
+			Expect(cg.nextScheduledRotation()).To(Equal(clk.Now().Add(12 * time.Hour)))
+			Expect(cg.rotateIfDue()).To(BeFalse(), "a rotation is due once per scheduled time")
+
+			// a late check still rotates once, then waits for the next time
+			clk.Advance(13 * time.Hour)
+			Expect(cg.rotateIfDue()).To(BeTrue())
+			Expect(cg.rotateIfDue()).To(BeFalse())
+			Expect(cg.nextScheduledRotation()).To(Equal(clk.Now().Add(11 * time.Hour)))
+		})
+
+		It("Should only apply changes that pass the health check with healthGate", func() {
+			hooksMu.RLock()
+			sinks := auditSinks
+			hooksMu.RUnlock()
+			sink := &recordingSink{}
+			RegisterAuditSink(sink)
+			defer func() {
+				hooksMu.Lock()
+				auditSinks = sinks
+				hooksMu.Unlock()
+			}()
+			hd := &healthDriver{}
+			cg.sqlDriver = &driverInstance{driver: hd}
+			cg.value = "dbname=a"
+			cg.parseValues(url.Values{"healthGate": {"true"}, "healthQuery": {"SELECT 1 FROM orders"}})
+
+			cg.valueChanged("dbname=b unhealthy")
+			Expect(cg.value).To(Equal("dbname=a"), "the old value is retained")
+			Expect(ctx.Err()).ToNot(HaveOccurred(), "connections are not reset")
+			Expect(hd.probes()).To(Equal([]string{"SELECT 1 FROM orders"}))
+			sink.mu.Lock()
+			Expect(sink.events).To(HaveLen(1))
+			Expect(sink.events[0].Rejected).To(MatchError(ErrHealthCheckFailed))
+			Expect(sink.events[0].NewHash).To(Equal(HashValue("dbname=b unhealthy")))
+			sink.mu.Unlock()
+
+			cg.valueChanged("dbname=c")
+			Expect(cg.value).To(Equal("dbname=c"))
+			Expect(ctx.Err()).To(HaveOccurred(), "connections are reset")
+			Expect(hd.probes()).To(HaveLen(2))
+			sink.mu.Lock()
+			defer sink.mu.Unlock()
+			Expect(sink.events).To(HaveLen(2))
+			Expect(sink.events[1].Rejected).ToNot(HaveOccurred())
+		})
+
+		It("Should not probe changes without healthGate", func() {
+			hd := &healthDriver{}
+			cg.sqlDriver = &driverInstance{driver: hd}
+			cg.valueChanged("dbname=b unhealthy")
+			Expect(cg.value).To(Equal("dbname=b unhealthy"))
+			Expect(hd.probes()).To(BeEmpty())
+		})
+
+		It("Should not apply a change held by minRotateInterval once the source reverted", func() {
+			parent, stop := context.WithCancel(context.Background())
+			defer stop()
+			cg.parentCtx = parent
+			cg.value = "dbname=a"
+			cg.parseValues(url.Values{"minRotateInterval": []string{"100ms"}})
+			go cg.run()
+			// b is applied, c is held, then the source goes back to b
+			for _, v := range []string{"dbname=b", "dbname=c", "dbname=b", "dbname=b"} {
+				values <- v
+			}
+			Consistently(cg.currentValue, 200*time.Millisecond).Should(Equal("dbname=b"))
+		})
+
+		It("Should release changes held by minRotateInterval on the clock of the location", func() {
+			clk := newFakeClock()
+			cg.clock = clk
+			cg.value = "dbname=a"
+			cg.parseValues(url.Values{"minRotateInterval": []string{"1h"}})
+			cg.valueChanged("dbname=b")
+			cg.valueChanged("dbname=c")
+			clk.Advance(59 * time.Minute)
+			Expect(cg.currentValue()).To(Equal("dbname=b"))
+			clk.Advance(time.Minute)
+			Expect(cg.currentValue()).To(Equal("dbname=c"))
+		})
+
+		It("Should stop the minRotateInterval timer when the group is torn down", func() {
+			parent, stop := context.WithCancel(context.Background())
+			cg.parentCtx = parent
+			cg.value = "dbname=a"
+			cg.parseValues(url.Values{"minRotateInterval": []string{"50ms"}})
+			done := make(chan struct{})
+			go func() {
+				cg.run()
+				close(done)
+			}()
+			values <- "dbname=b"
+			values <- "dbname=c"
+			values <- "dbname=c"
+			stop()
+			Eventually(done).Should(BeClosed())
+			cg.mu.RLock()
+			Expect(cg.rotateLimit.timer).To(BeNil())
+			cg.mu.RUnlock()
+			Consistently(cg.currentValue, 100*time.Millisecond).Should(Equal("dbname=b"))
+		})
+
+		It("Should expire no-rotate leases on the clock of the location", func() {
+			clk := newFakeClock()
+			cg.clock = clk
+			cg.value = "dbname=a"
+			release := cg.acquireNoRotate()
+			defer release()
+			cg.valueChanged("dbname=b")
+			clk.Advance(MaxNoRotateHold - time.Second)
+			Expect(cg.currentValue()).To(Equal("dbname=a"))
+			clk.Advance(time.Second)
+			Expect(cg.currentValue()).To(Equal("dbname=b"))
+		})
+
+		It("Should hold back changes while a no-rotate lease is active", func() {
+			parent, stop := context.WithCancel(context.Background())
+			defer stop()
+			cg.parentCtx = parent
+			cg.value = "dbname=a"
+			first := cg.acquireNoRotate()
+			second := cg.acquireNoRotate()
+			go cg.run()
+			values <- "dbname=b"
+			values <- "dbname=c"
+			values <- "dbname=c"
+			Expect(cg.currentValue()).To(Equal("dbname=a"))
+			Expect(ctx.Err()).ToNot(HaveOccurred(), "connections are not reset")
+
+			first()
+			first()
+			Expect(cg.currentValue()).To(Equal("dbname=a"), "a lease is still active")
+			second()
+			Expect(cg.currentValue()).To(Equal("dbname=c"), "the latest change is applied after the last release")
+			Expect(ctx.Err()).To(HaveOccurred())
+
+			values <- "dbname=d"
+			values <- "dbname=d"
+			Expect(cg.currentValue()).To(Equal("dbname=d"), "without leases changes apply right away")
+		})
+
+		It("Should not apply a change held by a lease once the source reverted", func() {
+			parent, stop := context.WithCancel(context.Background())
+			defer stop()
+			cg.parentCtx = parent
+			cg.value = "dbname=a"
+			release := cg.acquireNoRotate()
+			go cg.run()
+			values <- "dbname=b"
+			values <- "dbname=a"
+			values <- "dbname=a"
+			release()
+			Expect(cg.currentValue()).To(Equal("dbname=a"))
+			Expect(ctx.Err()).ToNot(HaveOccurred(), "connections are not reset")
+		})
+
+		It("Should expire no-rotate leases that are never released", func() {
+			defer func(d time.Duration) { MaxNoRotateHold = d }(MaxNoRotateHold)
+			MaxNoRotateHold = 50 * time.Millisecond
+			cg.value = "dbname=a"
+			cg.acquireNoRotate()
+			cg.valueChanged("dbname=b")
+			Expect(cg.currentValue()).To(Equal("dbname=a"))
+			Eventually(cg.currentValue).Should(Equal("dbname=b"))
+			cg.mu.RLock()
+			defer cg.mu.RUnlock()
+			Expect(cg.leases.active).To(BeEmpty())
+		})
+
+		It("Should hold back changes while the location is quiesced", func() {
+			cg.value = "dbname=a"
+			cg.quiesceFor(100 * time.Millisecond)
+			Expect(cg.stats().QuiescedUntil).ToNot(BeZero())
+			go cg.run()
+			values <- "dbname=b"
+			values <- "dbname=c"
+			values <- "dbname=c"
+			cg.mu.RLock()
+			Expect(cg.value).To(Equal("dbname=a"))
+			for _, c := range cg.conns {
+				Expect(c.reset).To(BeFalse())
+			}
+			cg.mu.RUnlock()
+
+			Eventually(func() string {
+				cg.mu.RLock()
+				defer cg.mu.RUnlock()
+				return cg.value
+			}).Should(Equal("dbname=c"))
+			cg.mu.RLock()
+			defer cg.mu.RUnlock()
+			for _, c := range cg.conns {
+				Expect(c.reset).To(BeTrue())
+			}
+			Expect(cg.quiesce.active).To(BeFalse())
+		})
+
+		It("Should end a quiesce window early and not apply a value the source reverted", func() {
+			parent, stop := context.WithCancel(context.Background())
+			defer stop()
+			cg.parentCtx = parent
+			cg.value = "dbname=a"
+			cg.quiesceFor(time.Hour)
+			go cg.run()
+			// the source goes from a to b and back to a during the window
+			values <- "dbname=b"
+			values <- "dbname=a"
+			values <- "dbname=a"
+			cg.quiesceFor(0)
+			Eventually(func() bool { return cg.stats().QuiescedUntil.IsZero() }).Should(BeTrue())
+			cg.mu.RLock()
+			defer cg.mu.RUnlock()
+			Expect(cg.value).To(Equal("dbname=a"))
+			for _, c := range cg.conns {
+				Expect(c.reset).To(BeFalse())
+			}
+			Expect(QuiesceFor("not-a-location", time.Minute)).To(MatchError(ErrUnknownLocation))
+		})
+
+		It("Should end the quiesce window on the clock of the location", func() {
+			clk := newFakeClock()
+			cg.clock = clk
+			cg.value = "dbname=a"
+			cg.quiesceFor(10 * time.Minute)
+			cg.valueChanged("dbname=b")
+			clk.Advance(9 * time.Minute)
+			Expect(cg.currentValue()).To(Equal("dbname=a"))
+			clk.Advance(time.Minute)
+			Expect(cg.currentValue()).To(Equal("dbname=b"))
+		})
+
+		It("Should stop the quiesce timer when the group is torn down", func() {
+			parent, stop := context.WithCancel(context.Background())
+			cg.parentCtx = parent
+			cg.value = "dbname=a"
+			cg.quiesceFor(50 * time.Millisecond)
+			done := make(chan struct{})
+			go func() {
+				cg.run()
+				close(done)
+			}()
+			values <- "dbname=b"
+			values <- "dbname=b"
+			stop()
+			Eventually(done).Should(BeClosed())
+			Expect(cg.stats().QuiescedUntil).To(BeZero())
+			Consistently(cg.currentValue, 100*time.Millisecond).Should(Equal("dbname=a"))
+		})
+
+		It("Should fall back to defaults on malformed retry options", func() {
+			cg.parseValues(url.Values{"openRetries": []string{"-1"}, "openRetryBackoff": []string{"soon"}})
+			Expect(cg.retry).To(Equal(openRetry{}))
+			Expect(cg.retry.delay(0)).To(Equal(DefaultOpenRetryBackoff))
+			Expect(cg.retry.delay(2)).To(Equal(4 * DefaultOpenRetryBackoff))
+		})
 	})
 })
@@ -0,0 +1,85 @@
+package hotload
+
+import (
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/infobloxopen/hotload/metrics"
+)
+
+const changeTimeFieldKey = "changeTimeField"
+
+// splitChangeTime removes field from the connection string v and returns the
+// remaining connection string and the time the field held. The field is a
+// query parameter of URL style connection strings or a keyword of key/value
+// style ones, its value is an RFC 3339 time or unix seconds. ok is false if
+// the field is missing or its value is not a time.
+func splitChangeTime(v, field string) (dsn string, t time.Time, ok bool) {
+	if field == "" {
+		return v, time.Time{}, false
+	}
+	var raw string
+	if strings.Contains(v, "://") {
+		if u, err := url.Parse(v); err == nil {
+			var kept []string
+			for _, p := range strings.Split(u.RawQuery, "&") {
+				k, val, _ := strings.Cut(p, "=")
+				if k == field {
+					raw, _ = url.QueryUnescape(val)
+					continue
+				}
+				if p != "" {
+					kept = append(kept, p)
+				}
+			}
+			u.RawQuery = strings.Join(kept, "&")
+			v = u.String()
+		}
+	} else {
+		re := regexp.MustCompile(`(?:^|\s)` + regexp.QuoteMeta(field) + `\s*=\s*(\S*)\s*`)
+		if m := re.FindStringSubmatch(v); m != nil {
+			raw = m[1]
+			v = strings.TrimSpace(strings.Replace(v, m[0], " ", 1))
+		}
+	}
+	t, ok = parseChangeTime(raw)
+	return v, t, ok
+}
+
+func parseChangeTime(s string) (time.Time, bool) {
+	if s == "" {
+		return time.Time{}, false
+	}
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, true
+	}
+	if n, err := strconv.ParseInt(s, 10, 64); err == nil {
+		return time.Unix(n, 0), true
+	}
+	return time.Time{}, false
+}
+
+// changeTime returns the change time embedded in the value received from the
+// strategy, if changeTimeField is set.
+func (cg *chanGroup) changeTime(v string) (time.Time, bool) {
+	if cg.changeTimeField == "" {
+		return time.Time{}, false
+	}
+	v, err := cg.transforms.apply(v)
+	if err != nil {
+		return time.Time{}, false
+	}
+	_, t, ok := splitChangeTime(v, cg.changeTimeField)
+	return t, ok
+}
+
+// observeChangeLatency records the time from changed, the embedded change
+// time or when the value was received, to now when the value was applied.
+func (cg *chanGroup) observeChangeLatency(changed time.Time) {
+	latency := cg.now().Sub(changed)
+	cg.trace("change applied after", latency)
+	metrics.ObserveHotloadChangeLatencyHistogram(cg.name, latency.Seconds())
+}
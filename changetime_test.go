@@ -0,0 +1,60 @@
+package hotload
+
+import (
+	"testing"
+	"time"
+)
+
+func Test_splitChangeTime(t *testing.T) {
+	when := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name  string
+		v     string
+		field string
+		dsn   string
+		ok    bool
+	}{
+		{
+			name:  "url rfc3339",
+			v:     "postgres://localhost/db?sslmode=disable&changed_at=2024-05-01T12%3A00%3A00Z",
+			field: "changed_at",
+			dsn:   "postgres://localhost/db?sslmode=disable",
+			ok:    true,
+		},
+		{
+			name:  "key/value unix seconds",
+			v:     "host=localhost changed_at=" + "1714564800" + " dbname=db",
+			field: "changed_at",
+			dsn:   "host=localhost dbname=db",
+			ok:    true,
+		},
+		{
+			name:  "missing field",
+			v:     "host=localhost dbname=db",
+			field: "changed_at",
+			dsn:   "host=localhost dbname=db",
+		},
+		{
+			name:  "malformed time is still removed",
+			v:     "host=localhost changed_at=yesterday",
+			field: "changed_at",
+			dsn:   "host=localhost",
+		},
+		{
+			name: "no field configured",
+			v:    "host=localhost changed_at=1714564800",
+			dsn:  "host=localhost changed_at=1714564800",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dsn, got, ok := splitChangeTime(tt.v, tt.field)
+			if dsn != tt.dsn || ok != tt.ok {
+				t.Fatalf("splitChangeTime(%q, %q) = %q, %v, want %q, %v", tt.v, tt.field, dsn, ok, tt.dsn, tt.ok)
+			}
+			if ok && !got.Equal(when) {
+				t.Errorf("splitChangeTime(%q, %q) time = %v, want %v", tt.v, tt.field, got, when)
+			}
+		})
+	}
+}
@@ -0,0 +1,38 @@
+package hotload
+
+import "time"
+
+// clock abstracts time so time based behavior can be tested.
+type clock interface {
+	Now() time.Time
+	// AfterFunc calls f in its own goroutine once d has passed.
+	AfterFunc(d time.Duration, f func()) clockTimer
+}
+
+// clockTimer is a timer started by clock.AfterFunc.
+type clockTimer interface {
+	// Stop prevents the timer from firing, it reports whether it did.
+	Stop() bool
+}
+
+type realClock struct{}
+
+func (realClock) Now() time.Time { return time.Now() }
+
+func (realClock) AfterFunc(d time.Duration, f func()) clockTimer { return time.AfterFunc(d, f) }
+
+// now returns the current time from the group's clock.
+func (cg *chanGroup) now() time.Time {
+	if cg.clock == nil {
+		return time.Now()
+	}
+	return cg.clock.Now()
+}
+
+// afterFunc calls f once d has passed on the group's clock.
+func (cg *chanGroup) afterFunc(d time.Duration, f func()) clockTimer {
+	if cg.clock == nil {
+		return time.AfterFunc(d, f)
+	}
+	return cg.clock.AfterFunc(d, f)
+}
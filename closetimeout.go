@@ -0,0 +1,72 @@
+package hotload
+
+import (
+	"net/url"
+	"time"
+
+	"github.com/infobloxopen/hotload/metrics"
+)
+
+const closeTimeoutKey = "closeTimeout"
+
+// parseCloseTimeout reads closeTimeout. Without it resets, KillConnections
+// and Shutdown wait for every connection to close.
+func (cg *chanGroup) parseCloseTimeout(vs url.Values) {
+	v := vs.Get(closeTimeoutKey)
+	if v == "" {
+		return
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil || d <= 0 {
+		cg.log("invalid closeTimeout, ignoring", v)
+		return
+	}
+	cg.closeTimeout = d
+	cg.log("closeTimeout set to", d)
+}
+
+// closeConns closes the connections hotload closes itself: those dropped by
+// a reset with resetPolicy=force or drain, killed by KillConnections or
+// closed by Shutdown. With closeTimeout the connections are closed
+// concurrently and those whose close has not returned once it passed are
+// abandoned, so a driver that hangs in Close does not stall the caller.
+// Abandoned connections leak, with the goroutine closing them, until the
+// driver returns. Connections that are not detached call back into
+// cg.remove, cg.mu must not be held for them.
+func (cg *chanGroup) closeConns(conns []*managedConn) {
+	if cg.closeTimeout <= 0 {
+		for _, c := range conns {
+			// ignore errors from close
+			c.Close()
+		}
+		return
+	}
+	done := make([]chan struct{}, len(conns))
+	for i, c := range conns {
+		done[i] = make(chan struct{})
+		go func(c *managedConn, done chan struct{}) {
+			defer close(done)
+			c.closeUnlocked()
+		}(c, done[i])
+	}
+	timeout := make(chan struct{})
+	t := cg.afterFunc(cg.closeTimeout, func() { close(timeout) })
+	defer t.Stop()
+	abandoned := 0
+	for _, d := range done {
+		select {
+		case <-d:
+			continue
+		case <-timeout:
+		}
+		select {
+		case <-d:
+		default:
+			abandoned++
+		}
+	}
+	if abandoned > 0 {
+		metrics.AddHotloadConnectionsAbandonedCounter(cg.name, abandoned)
+		cg.log("abandoned", abandoned, "connections not closed within closeTimeout", cg.closeTimeout)
+	}
+}
@@ -0,0 +1,128 @@
+package hotload
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/infobloxopen/hotload/logger"
+	"github.com/infobloxopen/hotload/metrics"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+// hangingConn is a connection whose Close blocks until release is closed.
+type hangingConn struct {
+	testConn
+	release chan struct{}
+}
+
+func (hc *hangingConn) Close() error {
+	<-hc.release
+	return nil
+}
+
+func TestCloseTimeout(t *testing.T) {
+	const name = "test-close-timeout"
+	metrics.ResetCollectors()
+	hung := &hangingConn{release: make(chan struct{})}
+	defer close(hung.release)
+	closed := &testConn{}
+	ctx := context.Background()
+	cg := &chanGroup{
+		name:         name,
+		ctx:          ctx,
+		resetPolicy:  ResetPolicyForce,
+		closeTimeout: 50 * time.Millisecond,
+		log:          logger.DefaultLogger,
+	}
+	cg.conns = []*managedConn{newManagedConn(ctx, name, hung, cg.remove), newManagedConn(ctx, name, closed, cg.remove)}
+	hungConn := cg.conns[0]
+
+	start := time.Now()
+	cg.mu.Lock()
+	cg.resetConnections()
+	cg.mu.Unlock()
+	if d := time.Since(start); d > time.Second {
+		t.Fatalf("reset took %v with a hanging close", d)
+	}
+	if !closed.closed {
+		t.Error("connection that closes normally was not closed")
+	}
+	if len(cg.conns) != 0 {
+		t.Errorf("group kept %d connections", len(cg.conns))
+	}
+	if n := testutil.ToFloat64(metrics.HotloadConnectionsAbandonedCounter.WithLabelValues(name)); n != 1 {
+		t.Errorf("abandoned %v connections, want 1", n)
+	}
+
+	// the abandoned connection does not block its other callers
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		hungConn.Close()
+		hungConn.IsValid()
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("abandoned connection blocks its callers")
+	}
+}
+
+func TestCloseTimeoutOtherClosePaths(t *testing.T) {
+	tests := []struct {
+		name  string
+		inTx  bool
+		close func(cg *chanGroup, c *managedConn)
+	}{
+		{name: "kill", close: func(cg *chanGroup, c *managedConn) { cg.killConnections() }},
+		{name: "drain", close: func(cg *chanGroup, c *managedConn) {
+			cg.mu.Lock()
+			cg.resetPolicy = ResetPolicyDrain
+			cg.resetConnections()
+			cg.mu.Unlock()
+		}},
+		{name: "drained transaction", inTx: true, close: func(cg *chanGroup, c *managedConn) {
+			cg.mu.Lock()
+			cg.resetPolicy = ResetPolicyDrain
+			cg.resetConnections()
+			cg.mu.Unlock()
+			c.endTx()
+		}},
+		{name: "shutdown", close: func(cg *chanGroup, c *managedConn) { cg.drainForShutdown() }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			name := "test-close-timeout-" + tt.name
+			metrics.ResetCollectors()
+			hung := &hangingConn{release: make(chan struct{})}
+			defer close(hung.release)
+			cg := &chanGroup{
+				name:         name,
+				resetPolicy:  ResetPolicyForce,
+				closeTimeout: 50 * time.Millisecond,
+				log:          logger.DefaultLogger,
+			}
+			cg.ctx, cg.cancel = noopContext()
+			cg.parentCtx = cg.ctx
+			c := newManagedConn(cg.ctx, name, hung, cg.remove)
+			c.closeDrained = func(c *managedConn) { cg.closeConns([]*managedConn{c}) }
+			c.setInTx(tt.inTx)
+			cg.conns = []*managedConn{c}
+
+			done := make(chan struct{})
+			go func() {
+				defer close(done)
+				tt.close(cg, c)
+			}()
+			select {
+			case <-done:
+			case <-time.After(time.Second):
+				t.Fatal("close path blocks on a hanging close")
+			}
+			if n := testutil.ToFloat64(metrics.HotloadConnectionsAbandonedCounter.WithLabelValues(name)); n != 1 {
+				t.Errorf("abandoned %v connections, want 1", n)
+			}
+		})
+	}
+}
@@ -0,0 +1,170 @@
+package hotload
+
+import (
+	"context"
+	"net/url"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/infobloxopen/hotload/logger"
+	"github.com/infobloxopen/hotload/metrics"
+)
+
+// rewatchFunc re-establishes the watch of a location, see Rewatcher.
+type rewatchFunc func(ctx context.Context) (string, <-chan string, error)
+
+// rewatchBackoff is the delay before the first re-watch attempt, it doubles
+// with every failed attempt up to rewatchMaxBackoff.
+var (
+	rewatchBackoff    = 100 * time.Millisecond
+	rewatchMaxBackoff = 30 * time.Second
+)
+
+const channelBufferKey = "channelBuffer"
+
+// DefaultChannelBuffer is the number of strategy values buffered for the run
+// loop of a location without channelBuffer=: only the latest one.
+const DefaultChannelBuffer = 1
+
+// maxChannelBuffer bounds channelBuffer, values may be large.
+const maxChannelBuffer = 1024
+
+// valueBuffer holds the values of the strategy of a location that the run
+// loop has not received yet.
+type valueBuffer struct {
+	// size is the most values buffered, older ones are replaced beyond it
+	size int
+	// maxBacklog is the most values that were buffered at once
+	maxBacklog atomic.Int64
+}
+
+// capacity returns the most values buffered.
+func (b *valueBuffer) capacity() int {
+	if b.size <= 0 {
+		return DefaultChannelBuffer
+	}
+	return b.size
+}
+
+// parseChannelBuffer reads channelBuffer. Chatty sources whose intermediate
+// values matter, e.g. for audit sinks and Events streams, buffer more of
+// them instead of only the latest.
+func (cg *chanGroup) parseChannelBuffer(vs url.Values) {
+	v := vs.Get(channelBufferKey)
+	if v == "" {
+		return
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil || n <= 0 || n > maxChannelBuffer {
+		cg.log("invalid channelBuffer, ignoring", v)
+		return
+	}
+	cg.buffer.size = n
+	cg.log("channelBuffer set to", n)
+}
+
+type watchResult struct {
+	value  string
+	values <-chan string
+}
+
+// coalesce reads from in as fast as the strategy sends and forwards the
+// values in order on the returned channel. A slow consumer, e.g. a run loop
+// busy tearing down many connections, never back-pressures the strategy:
+// values received while the consumer is busy are buffered in buf, up to
+// buf.size of them, DefaultChannelBuffer if buf is nil. Once it is full the
+// oldest buffered value is replaced, so the most recent ones are delivered.
+//
+// If in is closed the last pending value is still delivered, but the returned
+// channel is never closed so the consumer won't mistake a closed channel for
+// an empty value. If rewatch is not nil the watch is re-established with
+// backoff and values are read from the new channel, its initial value is
+// delivered like any other.
+//
+// Values replaced before delivery are counted in
+// hotload_coalesced_updates_total of location and the buffered values in
+// hotload_pending_updates.
+func coalesce(ctx context.Context, location string, in <-chan string, rewatch rewatchFunc, log logger.Logger, buf *valueBuffer) <-chan string {
+	if buf == nil {
+		buf = &valueBuffer{}
+	}
+	size := buf.capacity()
+	out := make(chan string)
+	go func() {
+		var pending []string
+		var rewatched chan watchResult
+		push := func(v string) {
+			if len(pending) == size {
+				pending = pending[1:]
+				metrics.IncHotloadCoalescedUpdatesCounter(location)
+			}
+			pending = append(pending, v)
+			metrics.SetHotloadPendingUpdates(location, len(pending))
+			if n := int64(len(pending)); n > buf.maxBacklog.Load() {
+				buf.maxBacklog.Store(n)
+			}
+		}
+		for {
+			// a nil channel blocks forever, so only try to send when
+			// there is something pending
+			var send chan<- string
+			var next string
+			if len(pending) > 0 {
+				send, next = out, pending[0]
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case v, ok := <-in:
+				if !ok {
+					in = nil
+					if rewatch == nil {
+						log("strategy closed its values channel, no further updates will be received")
+						continue
+					}
+					log("strategy closed its values channel, re-watching")
+					rewatched = make(chan watchResult, 1)
+					go retryWatch(ctx, rewatch, log, rewatched)
+					continue
+				}
+				push(v)
+			case r := <-rewatched:
+				rewatched = nil
+				in = r.values
+				if r.value != "" {
+					push(r.value)
+				}
+			case send <- next:
+				pending = pending[1:]
+				metrics.SetHotloadPendingUpdates(location, len(pending))
+			}
+		}
+	}()
+	return out
+}
+
+// retryWatch calls rewatch with backoff until it succeeds or ctx is done and
+// sends the new watch on done.
+func retryWatch(ctx context.Context, rewatch rewatchFunc, log logger.Logger, done chan<- watchResult) {
+	delay := rewatchBackoff
+	for attempt := 1; ; attempt++ {
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+		log("re-watching strategy, attempt", attempt)
+		value, values, err := rewatch(ctx)
+		if err == nil {
+			done <- watchResult{value: value, values: values}
+			return
+		}
+		if delay *= 2; delay > rewatchMaxBackoff {
+			delay = rewatchMaxBackoff
+		}
+		log("re-watch failed, retrying in", delay, err)
+	}
+}
@@ -6,19 +6,77 @@ import (
 	"database/sql/driver"
 	"errors"
 	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/infobloxopen/hotload/logger"
+	"github.com/infobloxopen/hotload/metrics"
+)
+
+// CloseReason tells why a hotload connection was closed. It is the reason
+// label of the hotload_connections_closed_total metric.
+type CloseReason string
+
+const (
+	// CloseReasonForce is a connection closed right after a change with
+	// resetPolicy=force.
+	CloseReasonForce CloseReason = "force"
+	// CloseReasonDrain is a connection closed after a change with
+	// resetPolicy=drain, once it was idle.
+	CloseReasonDrain CloseReason = "drain"
+	// CloseReasonLazy is a connection reset by a change and closed when
+	// database/sql discarded it.
+	CloseReasonLazy CloseReason = "lazy"
+	// CloseReasonKill is a connection closed by KillConnections.
+	CloseReasonKill CloseReason = "kill"
+	// CloseReasonShutdown is a connection closed by Shutdown.
+	CloseReasonShutdown CloseReason = "shutdown"
+	// CloseReasonPool is a connection database/sql closed on its own, e.g.
+	// due to SetConnMaxLifetime or sql.DB.Close.
+	CloseReasonPool CloseReason = "pool"
 )
 
 // managedConn wraps a sql/driver.Conn so that it can be closed by
 // a supervising context.
 type managedConn struct {
-	ctx    context.Context
-	conn   driver.Conn
-	reset  bool
-	killed bool
-	mu     sync.RWMutex
+	ctx      context.Context
+	location string
+	conn     driver.Conn
+	created  time.Time
+	reset    bool
+	killed   bool
+	inTx     bool
+	drain    bool
+	mu       sync.RWMutex
+
+	// closeReason is set by hotload before it closes the connection, empty
+	// if database/sql closes it
+	closeReason CloseReason
+	// trace logs if debug tracing is enabled for the location, may be nil
+	trace func(...interface{})
+	// release frees the tunnel the connection was opened through, may be nil
+	release func()
+	// rotation is the last rotation of the location, may be nil
+	rotation *rotationWindow
+	// clock is the clock of the location, may be nil
+	clock func() time.Time
+	// rampGen is the ramp the connection was opened with the previous value
+	// in, 0 if it uses the current one
+	rampGen int
+	// closed is set once the connection is closed, for readers not holding
+	// mu
+	closed atomic.Bool
 
 	// callback function to be called after the connection is closed
-	afterClose func(*managedConn)
+	afterClose func(*managedConn, CloseReason)
+	// closeDrained closes the connection once the transaction it was
+	// draining in completes, with the close timeout of the location. May be
+	// nil, the connection is then closed directly.
+	closeDrained func(*managedConn)
+
+	// writeKeywords are the leading keywords of rejected statements if the
+	// location is read-only, nil otherwise
+	writeKeywords []string
 
 	execStmtsCounter  int // count the number of exec calls in a transaction
 	queryStmtsCounter int // count the number of query calls in a transaction
@@ -34,8 +92,8 @@ type managedConn struct {
 func (c *managedConn) BeginTx(ctx context.Context, opts driver.TxOptions) (driver.Tx, error) {
 	select {
 	case <-c.ctx.Done():
-		c.close()
-		return nil, driver.ErrBadConn
+		c.closeStale()
+		return nil, c.resetBadConn()
 	default:
 	}
 
@@ -45,6 +103,7 @@ func (c *managedConn) BeginTx(ctx context.Context, opts driver.TxOptions) (drive
 			return nil, err
 		}
 
+		c.setInTx(true)
 		return &managedTx{tx: tx, conn: c, ctx: ctx}, nil
 	}
 
@@ -70,29 +129,92 @@ func (c *managedConn) BeginTx(ctx context.Context, opts driver.TxOptions) (drive
 	return tx, err
 }
 
-func newManagedConn(ctx context.Context, conn driver.Conn, afterClose func(*managedConn)) *managedConn {
+func newManagedConn(ctx context.Context, location string, conn driver.Conn, afterClose func(*managedConn, CloseReason)) *managedConn {
 	return &managedConn{
 		ctx:        ctx,
+		location:   location,
 		conn:       conn,
 		afterClose: afterClose,
 	}
 }
 
+// Location returns the hotload connection string of the location this
+// connection belongs to. It can be reached through sql.Conn.Raw:
+//
+//	conn.Raw(func(dc any) error {
+//	    l := dc.(interface{ Location() string }).Location()
+//	    ...
+//	})
+func (c *managedConn) Location() string {
+	return c.location
+}
+
+// closeStale closes a connection whose supervising context was canceled
+// because the connection information changed.
+func (c *managedConn) closeStale() error {
+	logger.GetLogger()("hotload: closing stale connection for location", c.location)
+	return c.Close()
+}
+
+// ResetError is the error of operations on a connection hotload reset, after
+// a change of the connection information of its location or by
+// KillConnections. It wraps driver.ErrBadConn, so database/sql transparently
+// retries on a new connection where it can. Where it cannot, e.g. for
+// statements of a transaction begun before the reset, the application gets
+// the error and can tell a rotation from a failure of the database:
+//
+//	var reset *hotload.ResetError
+//	if errors.As(err, &reset) {
+//	    // the connection information changed, retry the transaction
+//	}
+type ResetError struct {
+	// Location is the hotload connection string of the connection's location.
+	Location string
+}
+
+func (e *ResetError) Error() string {
+	return "hotload: connection of " + e.Location + " was reset after a configuration change: " + driver.ErrBadConn.Error()
+}
+
+// Unwrap returns driver.ErrBadConn.
+func (e *ResetError) Unwrap() error {
+	return driver.ErrBadConn
+}
+
+// resetBadConn reports that the connection is unusable because hotload reset
+// it, and returns a *ResetError wrapping driver.ErrBadConn so database/sql
+// retries on a new one.
+func (c *managedConn) resetBadConn() error {
+	metrics.IncHotloadResetBadConnCounter(c.location)
+	if fn := getResetBadConnHook(); fn != nil {
+		fn(c.location)
+	}
+	return &ResetError{Location: c.location}
+}
+
 func (c *managedConn) Exec(query string, args []driver.Value) (driver.Result, error) {
+	if err := checkWrite(query, c.writeKeywords); err != nil {
+		return nil, err
+	}
 	conn, ok := c.conn.(driver.Execer)
 	if !ok {
 		return nil, driver.ErrSkip
 	}
 	c.incExecStmtsCounter() //increment the exec counter to keep track of the number of exec calls
+	c.countAfterRotation()
 	return conn.Exec(query, args)
 }
 
 func (c *managedConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	if err := checkWrite(query, c.writeKeywords); err != nil {
+		return nil, err
+	}
 	conn, ok := c.conn.(driver.ExecerContext)
 	if !ok {
 		return nil, driver.ErrSkip
 	}
 	c.incExecStmtsCounter() //increment the exec counter to keep track of the number of exec calls
+	c.countAfterRotation()
 	return conn.ExecContext(ctx, query, args)
 }
 
@@ -105,30 +227,64 @@ func (c *managedConn) CheckNamedValue(namedValue *driver.NamedValue) error {
 }
 
 func (c *managedConn) Query(query string, args []driver.Value) (driver.Rows, error) {
+	if err := checkWrite(query, c.writeKeywords); err != nil {
+		return nil, err
+	}
 	conn, ok := c.conn.(driver.Queryer)
 	if !ok {
 		return nil, driver.ErrSkip
 	}
 	c.incQueryStmtsCounter() //increment the query counter to keep track of the number of query calls
+	c.countAfterRotation()
 	return conn.Query(query, args)
 }
 
 func (c *managedConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	if err := checkWrite(query, c.writeKeywords); err != nil {
+		return nil, err
+	}
 	conn, ok := c.conn.(driver.QueryerContext)
 	if !ok {
 		return nil, driver.ErrSkip
 	}
 	c.incQueryStmtsCounter() //increment the query counter to keep track of the number of query calls
+	c.countAfterRotation()
 	return conn.QueryContext(ctx, query, args)
 }
 
 func (c *managedConn) Prepare(query string) (driver.Stmt, error) {
 	select {
 	case <-c.ctx.Done():
-		c.close()
-		return nil, driver.ErrBadConn
+		c.closeStale()
+		return nil, c.resetBadConn()
 	default:
 	}
+	if err := checkWrite(query, c.writeKeywords); err != nil {
+		return nil, err
+	}
+	return c.conn.Prepare(query)
+}
+
+// PrepareContext calls the underlying PrepareContext, or Prepare if the
+// driver does not implement driver.ConnPrepareContext, unless the supervising
+// context is closed. A *sql.Stmt prepared before a change re-prepares itself
+// through this method on the replacement connection.
+func (c *managedConn) PrepareContext(ctx context.Context, query string) (driver.Stmt, error) {
+	select {
+	case <-c.ctx.Done():
+		c.closeStale()
+		return nil, c.resetBadConn()
+	default:
+	}
+	if err := checkWrite(query, c.writeKeywords); err != nil {
+		return nil, err
+	}
+	if conn, ok := c.conn.(driver.ConnPrepareContext); ok {
+		return conn.PrepareContext(ctx, query)
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
 	return c.conn.Prepare(query)
 }
 
@@ -137,20 +293,28 @@ func (c *managedConn) Prepare(query string) (driver.Stmt, error) {
 func (c *managedConn) Begin() (driver.Tx, error) {
 	select {
 	case <-c.ctx.Done():
-		c.close()
-		return nil, driver.ErrBadConn
+		c.closeStale()
+		return nil, c.resetBadConn()
 	default:
 	}
 	return c.conn.Begin()
 }
 
+// IsValid is called by database/sql before a connection is reused. It
+// reports false for connections hotload reset, so database/sql discards them
+// at this safe point, between statements, instead of failing a statement
+// that is already running. It returns no error, so it is not counted as a
+// bad connection.
 func (c *managedConn) IsValid() bool {
 	select {
 	case <-c.ctx.Done():
-		c.close()
+		c.closeStale()
 		return false
 	default:
 	}
+	if c.GetReset() {
+		return false
+	}
 	s, ok := c.conn.(driver.Validator)
 	if !ok {
 		return true
@@ -158,9 +322,13 @@ func (c *managedConn) IsValid() bool {
 	return s.IsValid()
 }
 
+// ResetSession is called by database/sql before a used connection is reused.
+// It returns driver.ErrBadConn for connections hotload reset, so they are
+// discarded and statements are re-prepared on a new connection.
 func (c *managedConn) ResetSession(ctx context.Context) error {
 	if c.GetReset() {
-		return driver.ErrBadConn
+		logger.GetLogger()("hotload: connection reset for location", c.location)
+		return c.resetBadConn()
 	}
 
 	s, ok := c.conn.(driver.SessionResetter)
@@ -174,6 +342,10 @@ func (c *managedConn) ResetSession(ctx context.Context) error {
 func (c *managedConn) Close() error {
 	c.mu.Lock()
 	defer c.mu.Unlock()
+	if c.killed {
+		// already closed by hotload, don't close the underlying conn twice
+		return nil
+	}
 	err := c.close()
 
 	if err == nil {
@@ -184,12 +356,50 @@ func (c *managedConn) Close() error {
 }
 
 func (c *managedConn) close() error {
+	c.closed.Store(true)
+	reason := c.closeReason
+	if reason == "" {
+		reason = CloseReasonPool
+		if c.reset || (c.ctx != nil && c.ctx.Err() != nil) {
+			reason = CloseReasonLazy
+		}
+	}
 	if c.afterClose != nil {
-		defer c.afterClose(c)
+		defer c.afterClose(c, reason)
+	}
+	metrics.IncHotloadConnectionsClosedCounter(c.location, string(reason))
+	if c.trace != nil {
+		c.trace("closing connection, reason:", reason)
+	}
+	if c.release != nil {
+		defer c.release()
 	}
 	return c.conn.Close()
 }
 
+// closeUnlocked closes the connection like Close but without holding c.mu
+// while the underlying connection closes, so callers of the connection are
+// not blocked by a close that hangs. The connection is marked killed first,
+// later closes are no-ops.
+func (c *managedConn) closeUnlocked() {
+	c.mu.Lock()
+	if c.killed {
+		c.mu.Unlock()
+		return
+	}
+	c.killed = true
+	c.mu.Unlock()
+	// ignore errors from close
+	c.close()
+}
+
+// setCloseReason records why hotload is about to close the connection.
+func (c *managedConn) setCloseReason(reason CloseReason) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.closeReason = reason
+}
+
 func (c *managedConn) GetReset() bool {
 	c.mu.RLock()
 	defer c.mu.RUnlock()
@@ -202,6 +412,80 @@ func (c *managedConn) Reset(v bool) {
 	c.reset = v
 }
 
+// detach stops the connection from calling back into its chanGroup when it
+// is closed. Used when the group is dropping the connection itself.
+func (c *managedConn) detach() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.afterClose = nil
+}
+
+// drainWhenIdle reports whether the connection is idle and the caller must
+// close it now. A connection in a transaction is closed once the transaction
+// completes instead.
+func (c *managedConn) drainWhenIdle() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.inTx {
+		c.drain = true
+		return false
+	}
+	return true
+}
+
+// now returns the current time from the clock of the location.
+func (c *managedConn) now() time.Time {
+	if c.clock == nil {
+		return time.Now()
+	}
+	return c.clock()
+}
+
+// Created returns when the connection was opened.
+func (c *managedConn) Created() time.Time {
+	return c.created
+}
+
+// Stale reports whether the connection was reset by hotload and will be
+// discarded by database/sql.
+func (c *managedConn) Stale() bool {
+	if c.ctx != nil && c.ctx.Err() != nil {
+		return true
+	}
+	return c.GetReset()
+}
+
+// InTx reports whether the connection is in a transaction.
+func (c *managedConn) InTx() bool {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.inTx
+}
+
+func (c *managedConn) setInTx(v bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.inTx = v
+}
+
+// endTx marks the transaction as complete and closes the connection if it
+// was waiting to be drained.
+func (c *managedConn) endTx() {
+	c.mu.Lock()
+	c.inTx = false
+	drain := c.drain
+	c.mu.Unlock()
+	if !drain {
+		return
+	}
+	if c.closeDrained != nil {
+		c.closeDrained(c)
+		return
+	}
+	// ignore errors from close
+	c.Close()
+}
+
 func (c *managedConn) GetKill() bool {
 	c.mu.RLock()
 	defer c.mu.RUnlock()
@@ -3,6 +3,7 @@ package hotload
 import (
 	"context"
 	"database/sql/driver"
+	"errors"
 	"io"
 	"strings"
 	"sync"
@@ -43,6 +44,60 @@ var _ = Describe("managedConn", func() {
 	})
 })
 
+var _ = Describe("resetBadConn", func() {
+	It("Should count and report bad connections caused by a reset", func() {
+		const location = "fsnotify://test/bad-conn"
+		var reported []string
+		OnResetBadConn(func(l string) { reported = append(reported, l) })
+		defer OnResetBadConn(nil)
+		before := testutil.ToFloat64(metrics.HotloadResetBadConnCounter.WithLabelValues(location))
+
+		ctx, cancel := context.WithCancel(context.Background())
+		mc := newManagedConn(ctx, location, mockDriverConn{}, nil)
+		cancel()
+		_, err := mc.Prepare("SELECT 1")
+		Expect(err).To(MatchError(driver.ErrBadConn))
+		var reset *ResetError
+		Expect(errors.As(err, &reset)).To(BeTrue())
+		Expect(reset.Location).To(Equal(location))
+
+		mc.Reset(true)
+		Expect(mc.IsValid()).To(BeFalse(), "IsValid returns no ErrBadConn and is not counted")
+		Expect(mc.ResetSession(context.Background())).To(MatchError(driver.ErrBadConn))
+
+		Expect(testutil.ToFloat64(metrics.HotloadResetBadConnCounter.WithLabelValues(location))).To(Equal(before + 2))
+		Expect(reported).To(Equal([]string{location, location}))
+	})
+})
+
+var _ = Describe("Prepared statements", func() {
+	It("Should report reset connections as invalid", func() {
+		mc := newManagedConn(context.Background(), "fsnotify://test/stmt", mockDriverConn{}, nil)
+		Expect(mc.IsValid()).To(BeTrue())
+		mc.Reset(true)
+		Expect(mc.IsValid()).To(BeFalse())
+	})
+
+	It("Should refuse to prepare on a stale connection", func() {
+		ctx, cancel := context.WithCancel(context.Background())
+		mc := newManagedConn(ctx, "fsnotify://test/stmt", mockDriverConn{}, nil)
+		_, err := mc.PrepareContext(context.Background(), "SELECT 1")
+		Expect(err).ToNot(HaveOccurred())
+		cancel()
+		_, err = mc.PrepareContext(context.Background(), "SELECT 1")
+		Expect(err).To(MatchError(driver.ErrBadConn))
+		Expect(err).To(BeAssignableToTypeOf(&ResetError{}))
+	})
+
+	It("Should honor the statement context when falling back to Prepare", func() {
+		mc := newManagedConn(context.Background(), "fsnotify://test/stmt", mockDriverConn{}, nil)
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		_, err := mc.PrepareContext(ctx, "SELECT 1")
+		Expect(err).To(Equal(context.Canceled))
+	})
+})
+
 /**** Mocks for Prometheus Metrics ****/
 
 type mockDriverConn struct{}
@@ -130,7 +185,7 @@ var _ = Describe("PrometheusMetrics", func() {
 	`
 
 	It("Should emit the correct metrics", func() {
-		mc := newManagedConn(context.Background(), mockDriverConn{}, nil)
+		mc := newManagedConn(context.Background(), "", mockDriverConn{}, nil)
 
 		ctx := ContextWithExecLabels(context.Background(), map[string]string{"grpc_method": "method_1", "grpc_service": "service_1"})
 
@@ -0,0 +1,49 @@
+package hotload
+
+import (
+	"context"
+	"database/sql/driver"
+	"net/url"
+)
+
+// OpenConnector implements driver.DriverContext, so database/sql opens every
+// connection of a sql.DB through a connector bound to the hotload location
+// name. The connector holds no connection information of its own, each
+// Connect opens with the value current at that moment, so a single sql.DB
+// follows every change for as long as it lives.
+//
+// Errors in name, e.g. an unsupported strategy, are returned by Connect, not
+// by sql.Open.
+func (h *hdriver) OpenConnector(name string) (driver.Connector, error) {
+	return &connector{name: name, driver: h}, nil
+}
+
+type connector struct {
+	name   string
+	driver *hdriver
+}
+
+// Connect opens a connection of the location. ctx bounds the wait for another
+// Connect starting to watch the location and for a slot of
+// maxConcurrentOpens, mu itself is only held briefly.
+func (c *connector) Connect(ctx context.Context) (driver.Conn, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return c.driver.openContext(ctx, c.name)
+}
+
+func (c *connector) Driver() driver.Driver {
+	return c.driver
+}
+
+// Close is called by sql.DB.Close. The location itself is shared with other
+// sql.DBs and retired by the idle watcher, only a location created by
+// OpenWithValue belongs to this sql.DB alone and is stopped and forgotten.
+func (c *connector) Close() error {
+	if u, err := url.Parse(c.name); err == nil && u.Scheme == valueStrategyName {
+		c.driver.stopLocation(c.name)
+		fixedValues.forget(u.Path)
+	}
+	return nil
+}
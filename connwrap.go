@@ -0,0 +1,39 @@
+package hotload
+
+import "database/sql/driver"
+
+var connWrappers = make(map[string][]func(driver.Conn) driver.Conn)
+
+// RegisterConnWrapper registers fn to wrap every connection hotload opens with
+// the named driver, e.g. to log or measure queries, before hotload wraps it
+// for reset management. Wrappers of a driver apply in the order they were
+// registered, each one wraps the result of the previous one, so the last one
+// registered is outermost:
+//
+//	database/sql -> hotload -> last wrapper -> ... -> first wrapper -> driver
+//
+// Wrappers see the queries, execs, prepares and transactions of the
+// application, not the init statements of initSQL or the probes of the health
+// gate. hotload calls the optional interfaces of the connection, e.g.
+// driver.QueryerContext, on the outermost wrapper, a wrapper that does not
+// implement them makes database/sql fall back to prepared statements. A nil
+// fn is ignored.
+func RegisterConnWrapper(driver string, fn func(driver.Conn) driver.Conn) {
+	if fn == nil {
+		return
+	}
+	hooksMu.Lock()
+	defer hooksMu.Unlock()
+	connWrappers[driver] = append(connWrappers[driver], fn)
+}
+
+// wrapConn wraps conn with the wrappers registered for the group's driver.
+func (cg *chanGroup) wrapConn(conn driver.Conn) driver.Conn {
+	hooksMu.RLock()
+	wrappers := connWrappers[cg.driverName]
+	hooksMu.RUnlock()
+	for _, wrap := range wrappers {
+		conn = wrap(conn)
+	}
+	return conn
+}
@@ -0,0 +1,71 @@
+package hotload
+
+import (
+	"context"
+	"database/sql/driver"
+	"reflect"
+	"sync"
+	"testing"
+)
+
+// recordingConn records the execs it sees under its name before passing them
+// on.
+type recordingConn struct {
+	driver.Conn
+	name string
+	mu   *sync.Mutex
+	seen *[]string
+}
+
+func (c *recordingConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	c.mu.Lock()
+	*c.seen = append(*c.seen, c.name+": "+query)
+	c.mu.Unlock()
+	return c.Conn.(driver.ExecerContext).ExecContext(ctx, query, args)
+}
+
+func TestRegisterConnWrapper(t *testing.T) {
+	d := &execDriver{}
+	RegisterSQLDriver("test-connwrap", d)
+	RegisterStrategy("test-connwrap", fixedStrategy{value: "dbname=app"})
+	var seenMu sync.Mutex
+	var seen []string
+	wrapper := func(name string) func(driver.Conn) driver.Conn {
+		return func(conn driver.Conn) driver.Conn {
+			return &recordingConn{Conn: conn, name: name, mu: &seenMu, seen: &seen}
+		}
+	}
+	RegisterConnWrapper("test-connwrap", wrapper("first"))
+	RegisterConnWrapper("test-connwrap", wrapper("second"))
+	RegisterConnWrapper("test-connwrap", nil)
+	defer func() {
+		UnregisterStrategy("test-connwrap")
+		mu.Lock()
+		delete(sqlDrivers, "test-connwrap")
+		mu.Unlock()
+		hooksMu.Lock()
+		delete(connWrappers, "test-connwrap")
+		hooksMu.Unlock()
+	}()
+	h := newHdriver()
+	defer h.stop()
+
+	conn, err := h.Open("test-connwrap://test-connwrap/dsn?initSQL=SET+a+%3D+1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	mc := conn.(*managedConn)
+	if _, ok := mc.conn.(*recordingConn); !ok {
+		t.Fatalf("managedConn wraps %T, want the wrapped connection", mc.conn)
+	}
+	if _, err := mc.ExecContext(context.Background(), "UPDATE t SET a = 2", nil); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"second: UPDATE t SET a = 2", "first: UPDATE t SET a = 2"}
+	if !reflect.DeepEqual(seen, want) {
+		t.Errorf("wrappers saw %q, want %q", seen, want)
+	}
+	if stmts, _ := d.executed(); !reflect.DeepEqual(stmts, []string{"SET a = 1", "UPDATE t SET a = 2"}) {
+		t.Errorf("driver executed %q", stmts)
+	}
+}
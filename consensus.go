@@ -0,0 +1,222 @@
+package hotload
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/infobloxopen/hotload/logger"
+	"github.com/infobloxopen/hotload/metrics"
+)
+
+// consensusStrategyName is the scheme of locations that only accept a value
+// a quorum of sources agree on. It is built in and not registered with
+// RegisterStrategy, its sources are.
+const consensusStrategyName = "consensus"
+
+const quorumKey = "quorum"
+const sourceKey = "source"
+const weightsKey = "weights"
+
+// ErrNoConsensus is returned by opens of a consensus location whose sources
+// report initial values that do not reach the quorum, and are not waited for
+// with initialValueTimeout.
+var ErrNoConsensus = errors.New("hotload: sources did not reach a quorum")
+
+// consensusStrategy watches the source= locations of a consensus location
+// and emits a value once sources with a combined weight of at least quorum
+// report it.
+type consensusStrategy struct {
+	sources []consensusSource
+	quorum  int
+	// waitInitial is set if initialValueTimeout waits for the first
+	// consensus value while sources start empty
+	waitInitial bool
+}
+
+type consensusSource struct {
+	strategy Strategy
+	scheme   string
+	path     string
+	options  url.Values
+	weight   int
+}
+
+// newConsensus returns the consensusStrategy of the options of a consensus
+// location, waitInitial tells if its initial value is waited for. mu must be
+// held, it guards the lookup of the source strategies.
+func newConsensus(options url.Values, waitInitial bool) (consensusStrategy, error) {
+	sources, quorum, err := parseConsensus(options)
+	return consensusStrategy{sources: sources, quorum: quorum, waitInitial: waitInitial}, err
+}
+
+// Watch implements Strategy. It watches the sources looked up by
+// newConsensus, the options were parsed there, so mu need not be held.
+func (c consensusStrategy) Watch(ctx context.Context, pth string, options url.Values) (string, <-chan string, error) {
+	sources, quorum := c.sources, c.quorum
+	log := logger.GetLogger()
+	ctx, cancel := context.WithCancel(ctx)
+	votes := make([]string, len(sources))
+	chans := make([]<-chan string, len(sources))
+	pending := false
+	for i, src := range sources {
+		v, ch, err := src.strategy.Watch(ctx, src.path, src.options)
+		if err != nil {
+			// the source does not vote, the others may still reach the quorum
+			log("consensus: could not watch source", i, src.scheme, err)
+			continue
+		}
+		votes[i], chans[i] = v, ch
+		pending = pending || v == ""
+	}
+	value, ok := tally(sources, votes, quorum)
+	if !ok && !pending {
+		cancel()
+		return "", nil, fmt.Errorf("%w of %d", ErrNoConsensus, quorum)
+	}
+	if !ok && !c.waitInitial {
+		// the location would start without connection information
+		cancel()
+		return "", nil, fmt.Errorf("%w of %d, sources start empty and initialValueTimeout is not set", ErrNoConsensus, quorum)
+	}
+	out := make(chan string)
+	go runConsensus(ctx, cancel, sources, quorum, votes, chans, value, out, log)
+	return value, out, nil
+}
+
+// parseConsensus parses the source=, quorum= and weights= options. Sources
+// are URL escaped hotload locations without a driver, e.g.
+// fsnotify%3A%2F%2F%2Fetc%2Fdb%2Fdsn, weights a comma separated list in the
+// order of the sources, 1 each by default. The quorum must be a majority of
+// the total weight, so two values can never both reach it.
+func parseConsensus(options url.Values) ([]consensusSource, int, error) {
+	var sources []consensusSource
+	for _, s := range options[sourceKey] {
+		u, err := url.Parse(s)
+		if err != nil {
+			return nil, 0, fmt.Errorf("hotload: invalid consensus source %q: %w", Redact(s), err)
+		}
+		strategy, ok := strategies[u.Scheme]
+		if !ok {
+			return nil, 0, fmt.Errorf("%w: consensus source %s", ErrUnsupportedStrategy, u.Scheme)
+		}
+		sources = append(sources, consensusSource{
+			strategy: strategy,
+			scheme:   u.Scheme,
+			path:     u.Path,
+			options:  u.Query(),
+			weight:   1,
+		})
+	}
+	if len(sources) < 2 {
+		return nil, 0, errors.New("hotload: consensus requires at least two sources")
+	}
+	if w := options.Get(weightsKey); w != "" {
+		weights := strings.Split(w, ",")
+		if len(weights) != len(sources) {
+			return nil, 0, fmt.Errorf("hotload: %d consensus weights for %d sources", len(weights), len(sources))
+		}
+		for i, s := range weights {
+			n, err := strconv.Atoi(strings.TrimSpace(s))
+			if err != nil || n <= 0 {
+				return nil, 0, fmt.Errorf("hotload: invalid consensus weight %q", s)
+			}
+			sources[i].weight = n
+		}
+	}
+	total := 0
+	for _, src := range sources {
+		total += src.weight
+	}
+	quorum, err := strconv.Atoi(options.Get(quorumKey))
+	if err != nil || 2*quorum <= total || quorum > total {
+		return nil, 0, fmt.Errorf("hotload: consensus quorum %q must be a majority of the total weight %d", options.Get(quorumKey), total)
+	}
+	return sources, quorum, nil
+}
+
+// tally returns the value the sources with votes agree on, if any.
+func tally(sources []consensusSource, votes []string, quorum int) (string, bool) {
+	weights := make(map[string]int)
+	for i, v := range votes {
+		if v == "" {
+			continue
+		}
+		weights[v] += sources[i].weight
+		if weights[v] >= quorum {
+			return v, true
+		}
+	}
+	return "", false
+}
+
+type consensusVote struct {
+	source int
+	value  string
+	closed bool
+}
+
+func runConsensus(ctx context.Context, cancel context.CancelFunc, sources []consensusSource, quorum int, votes []string, chans []<-chan string, last string, out chan<- string, log logger.Logger) {
+	metrics.IncHotloadWatchGoroutines(consensusStrategyName)
+	defer metrics.DecHotloadWatchGoroutines(consensusStrategyName)
+	defer cancel()
+	in := make(chan consensusVote)
+	for i, ch := range chans {
+		if ch != nil {
+			go forwardVotes(ctx, i, ch, in)
+		}
+	}
+	for {
+		var vote consensusVote
+		select {
+		case <-ctx.Done():
+			return
+		case vote = <-in:
+		}
+		if vote.closed {
+			// a source that stopped watching may go stale, drop its vote
+			log("consensus: source", vote.source, sources[vote.source].scheme, "stopped")
+			votes[vote.source] = ""
+		} else {
+			votes[vote.source] = vote.value
+		}
+		v, ok := tally(sources, votes, quorum)
+		if !ok {
+			// values hold credentials, only log that they differ
+			log("consensus: sources disagree, keeping the last consensus value")
+			continue
+		}
+		if v == last {
+			continue
+		}
+		select {
+		case out <- v:
+			last = v
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func forwardVotes(ctx context.Context, source int, ch <-chan string, in chan<- consensusVote) {
+	for {
+		var v string
+		var ok bool
+		select {
+		case v, ok = <-ch:
+		case <-ctx.Done():
+			return
+		}
+		select {
+		case in <- consensusVote{source: source, value: v, closed: !ok}:
+		case <-ctx.Done():
+			return
+		}
+		if !ok {
+			return
+		}
+	}
+}
@@ -0,0 +1,175 @@
+package hotload
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"testing"
+	"time"
+)
+
+// voteStrategy reports the initial value of each path and its later values
+// on the path's channel.
+type voteStrategy struct {
+	initial map[string]string
+	values  map[string]chan string
+}
+
+func (s *voteStrategy) Watch(ctx context.Context, pth string, options url.Values) (string, <-chan string, error) {
+	ch, ok := s.values[pth]
+	if !ok {
+		return "", nil, errors.New("no source")
+	}
+	return s.initial[pth], ch, nil
+}
+
+func newVoteStrategy(initial ...string) *voteStrategy {
+	s := &voteStrategy{initial: make(map[string]string), values: make(map[string]chan string)}
+	for i, v := range initial {
+		pth := "/" + string(rune('a'+i))
+		s.initial[pth] = v
+		s.values[pth] = make(chan string)
+	}
+	return s
+}
+
+func consensusOptions(quorum, weights string, paths ...string) url.Values {
+	vs := url.Values{quorumKey: {quorum}}
+	if weights != "" {
+		vs.Set(weightsKey, weights)
+	}
+	for _, p := range paths {
+		vs.Add(sourceKey, "test-consensus://"+p)
+	}
+	return vs
+}
+
+func watchConsensus(t *testing.T, ctx context.Context, s *voteStrategy, options url.Values, waitInitial bool) (string, <-chan string, error) {
+	t.Helper()
+	mu.Lock()
+	strategies["test-consensus"] = s
+	c, err := newConsensus(options, waitInitial)
+	delete(strategies, "test-consensus")
+	mu.Unlock()
+	if err != nil {
+		return "", nil, err
+	}
+	// the sources are watched without mu
+	return c.Watch(ctx, "/", options)
+}
+
+func Test_parseConsensus(t *testing.T) {
+	mu.Lock()
+	strategies["test-consensus"] = newVoteStrategy()
+	defer func() {
+		delete(strategies, "test-consensus")
+		mu.Unlock()
+	}()
+	tests := []struct {
+		name       string
+		options    url.Values
+		wantQuorum int
+		wantErr    bool
+	}{
+		{name: "majority of sources", options: consensusOptions("2", "", "/a", "/b", "/c"), wantQuorum: 2},
+		{name: "weighted majority", options: consensusOptions("3", "2,1,1", "/a", "/b", "/c"), wantQuorum: 3},
+		{name: "single source", options: consensusOptions("1", "", "/a"), wantErr: true},
+		{name: "quorum not a majority", options: consensusOptions("1", "", "/a", "/b"), wantErr: true},
+		{name: "quorum above total weight", options: consensusOptions("4", "", "/a", "/b", "/c"), wantErr: true},
+		{name: "missing quorum", options: consensusOptions("", "", "/a", "/b"), wantErr: true},
+		{name: "weights mismatch", options: consensusOptions("2", "1,1", "/a", "/b", "/c"), wantErr: true},
+		{name: "invalid weight", options: consensusOptions("2", "1,0,1", "/a", "/b", "/c"), wantErr: true},
+		{name: "unknown strategy", options: url.Values{quorumKey: {"2"}, sourceKey: {"nope:///a", "nope:///b"}}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sources, quorum, err := parseConsensus(tt.options)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseConsensus() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && (quorum != tt.wantQuorum || len(sources) != len(tt.options[sourceKey])) {
+				t.Errorf("parseConsensus() = %d sources, quorum %d, want %d, %d", len(sources), quorum, len(tt.options[sourceKey]), tt.wantQuorum)
+			}
+		})
+	}
+}
+
+func TestConsensusWatch(t *testing.T) {
+	tests := []struct {
+		name    string
+		initial []string
+		options url.Values
+		wait    bool
+		want    string
+		wantErr error
+	}{
+		{name: "quorum", initial: []string{"dbname=a", "dbname=b", "dbname=a"}, options: consensusOptions("2", "", "/a", "/b", "/c"), want: "dbname=a"},
+		{name: "split", initial: []string{"dbname=a", "dbname=b", "dbname=c"}, options: consensusOptions("2", "", "/a", "/b", "/c"), wantErr: ErrNoConsensus},
+		{name: "weighted quorum", initial: []string{"dbname=a", "dbname=b", "dbname=b"}, options: consensusOptions("3", "3,1,1", "/a", "/b", "/c"), want: "dbname=a"},
+		{name: "weighted split", initial: []string{"dbname=a", "dbname=b", "dbname=b"}, options: consensusOptions("5", "3,2,2", "/a", "/b", "/c"), wantErr: ErrNoConsensus},
+		{name: "failed source", initial: []string{"dbname=a", "dbname=a"}, options: consensusOptions("2", "", "/a", "/b", "/c"), want: "dbname=a"},
+		{name: "pending source", initial: []string{"dbname=a", "", "dbname=b"}, options: consensusOptions("2", "", "/a", "/b", "/c"), wantErr: ErrNoConsensus},
+		{name: "pending source waited for", initial: []string{"dbname=a", "", "dbname=b"}, options: consensusOptions("2", "", "/a", "/b", "/c"), wait: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			got, _, err := watchConsensus(t, ctx, newVoteStrategy(tt.initial...), tt.options, tt.wait)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Watch() error = %v, want %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("Watch() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestConsensusChanges(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	s := newVoteStrategy("dbname=old", "dbname=old", "dbname=old")
+	_, values, err := watchConsensus(t, ctx, s, consensusOptions("2", "", "/a", "/b", "/c"), false)
+	if err != nil {
+		t.Fatalf("Watch() error = %v", err)
+	}
+	expectNone := func() {
+		t.Helper()
+		select {
+		case v := <-values:
+			t.Fatalf("got %q without a quorum", v)
+		case <-time.After(20 * time.Millisecond):
+		}
+	}
+	expect := func(want string) {
+		t.Helper()
+		select {
+		case v := <-values:
+			if v != want {
+				t.Fatalf("got %q, want %q", v, want)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("no value, want %q", want)
+		}
+	}
+
+	// a single source, e.g. a compromised one, cannot rotate
+	s.values["/a"] <- "dbname=evil"
+	expectNone()
+	// the sources disagree, the last consensus value is kept
+	s.values["/b"] <- "dbname=new"
+	expectNone()
+	// a quorum agrees on the new value
+	s.values["/c"] <- "dbname=new"
+	expect("dbname=new")
+	// the stale source catching up changes nothing
+	s.values["/a"] <- "dbname=new"
+	expectNone()
+	// a closed source loses its vote
+	close(s.values["/c"])
+	s.values["/b"] <- "dbname=newer"
+	expectNone()
+	s.values["/a"] <- "dbname=newer"
+	expect("dbname=newer")
+}
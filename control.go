@@ -0,0 +1,117 @@
+package hotload
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"time"
+)
+
+// HotloadDriver is the hotload driver registered with database/sql as
+// "hotload". Its methods are also available as package functions.
+type HotloadDriver interface {
+	driver.Driver
+	driver.DriverContext
+	// Stats is the method form of the package function Stats.
+	Stats() map[string]LocationStats
+	// ConnectionDetails is the method form of the package function
+	// ConnectionDetails.
+	ConnectionDetails(name string) []ConnInfo
+	// KillConnections is the method form of the package function
+	// KillConnections.
+	KillConnections(name string) int
+	// Shutdown is the method form of the package function Shutdown.
+	Shutdown(ctx context.Context) error
+	// Rollback is the method form of the package function Rollback.
+	Rollback(name string) error
+	// History is the method form of the package function History.
+	History(name string) []HistoryEntry
+	// WaitForValue is the method form of the package function WaitForValue.
+	WaitForValue(ctx context.Context, name string) (string, error)
+	// QuiesceFor is the method form of the package function QuiesceFor.
+	QuiesceFor(name string, d time.Duration) error
+	// ExportSnapshot is the method form of the package function
+	// ExportSnapshot.
+	ExportSnapshot(includeSecrets bool) map[string]string
+	// ReloadOverrides is the method form of the package function
+	// ReloadOverrides.
+	ReloadOverrides()
+	// AcquireNoRotate is the method form of the package function
+	// AcquireNoRotate.
+	AcquireNoRotate(name string) (release func())
+	// OpenShard is the method form of the package function OpenShard.
+	OpenShard(name, shard string) (*sql.DB, error)
+	// ExportState is the method form of the package function ExportState.
+	ExportState() ([]byte, error)
+	// ImportState is the method form of the package function ImportState.
+	ImportState(data []byte) error
+	// PreviewRotation is the method form of the package function
+	// PreviewRotation.
+	PreviewRotation(name, candidate string) (RotationPlan, error)
+}
+
+// Driver returns the hotload driver, the same instance sql.Open("hotload",
+// ...) uses.
+func Driver() HotloadDriver {
+	return hotloadDriver
+}
+
+// group returns the chanGroup for the hotload connection string name.
+func (h *hdriver) group(name string) (*chanGroup, bool) {
+	mu.RLock()
+	defer mu.RUnlock()
+	cg, ok := h.cgroup[name]
+	return cg, ok
+}
+
+// groups returns every chanGroup.
+func (h *hdriver) groups() []*chanGroup {
+	mu.RLock()
+	defer mu.RUnlock()
+	groups := make([]*chanGroup, 0, len(h.cgroup))
+	for _, cg := range h.cgroup {
+		groups = append(groups, cg)
+	}
+	return groups
+}
+
+// KillConnections closes all connections of the hotload location name, the
+// connection string given to sql.Open, regardless of its reset policy. It
+// returns the number of connections closed. The connection information is
+// not changed, database/sql simply opens fresh connections.
+//
+// This is meant for incident response, when a backend misbehaves and fresh
+// connections are wanted now.
+func KillConnections(name string) int {
+	return hotloadDriver.KillConnections(name)
+}
+
+func (h *hdriver) KillConnections(name string) int {
+	cg, ok := h.group(name)
+	if !ok {
+		return 0
+	}
+	return cg.killConnections()
+}
+
+func (cg *chanGroup) killConnections() int {
+	defer cg.fireConnsHooks()
+	cg.mu.Lock()
+	defer cg.mu.Unlock()
+	// fail the connections database/sql still holds so it discards them
+	cg.cancel()
+	cg.ctx, cg.cancel = context.WithCancel(cg.parentCtx)
+
+	n := len(cg.conns)
+	for _, c := range cg.conns {
+		c.Reset(true)
+		c.detach()
+		c.setCloseReason(CloseReasonKill)
+	}
+	cg.closeConns(cg.conns)
+	cg.conns = make([]*managedConn, 0)
+	cg.connsChanged(CloseReasonKill)
+	cg.tunnel.retire()
+	cg.log("killed connections for location", cg.name, n)
+	return n
+}
@@ -0,0 +1,118 @@
+// Package credfile implements a hotload strategy for the common Kubernetes
+// pattern of a static connection string in a ConfigMap plus a password in a
+// mounted Secret file. Both files are watched with fsnotify and the
+// credential is injected into the connection string whenever either changes.
+//
+//	db, err := sql.Open("hotload", "credfile://postgres/etc/config/dsn?credFile=/etc/secret/password")
+//
+// By default the credential replaces the password of the connection string,
+// which may be URL style (postgres://user@host/db) or key/value style
+// (user=app host=db). If the placeholder query parameter is set, every
+// occurrence of the placeholder in the connection string is replaced by the
+// credential instead.
+package credfile
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/infobloxopen/hotload"
+	"github.com/infobloxopen/hotload/fsnotify"
+	"github.com/infobloxopen/hotload/logger"
+	"github.com/infobloxopen/hotload/metrics"
+	"github.com/infobloxopen/hotload/strategy"
+)
+
+func init() {
+	hotload.RegisterStrategy(strategyName, NewStrategy())
+}
+
+const strategyName = "credfile"
+
+const (
+	// CredFileKey is the query parameter with the path of the credential file.
+	CredFileKey = "credFile"
+	// PlaceholderKey is the query parameter with the placeholder to replace
+	// with the credential.
+	PlaceholderKey = "placeholder"
+)
+
+// ErrMissingCredFile is returned by Watch when the credFile query parameter is not set.
+// It wraps strategy.ErrMissingOption.
+var ErrMissingCredFile = fmt.Errorf("credfile: %w", strategy.MissingOption(CredFileKey))
+
+// NewStrategy returns a strategy that watches files with fsnotify.
+func NewStrategy() *Strategy {
+	return &Strategy{
+		files: fsnotify.NewStrategy(),
+	}
+}
+
+// Strategy implements the hotload Strategy interface by combining a
+// connection string file with a credential file.
+type Strategy struct {
+	files hotload.Strategy
+}
+
+// Watch implements the hotload.Strategy interface.
+func (s *Strategy) Watch(ctx context.Context, pth string, options url.Values) (value string, values <-chan string, err error) {
+	credPath := options.Get(CredFileKey)
+	if credPath == "" {
+		return "", nil, ErrMissingCredFile
+	}
+	placeholder := options.Get(PlaceholderKey)
+
+	dsn, dsnValues, err := s.files.Watch(ctx, pth, options)
+	if err != nil {
+		return "", nil, err
+	}
+	cred, credValues, err := s.files.Watch(ctx, credPath, options)
+	if err != nil {
+		return "", nil, err
+	}
+	value, err = inject(dsn, cred, placeholder)
+	if err != nil {
+		return "", nil, err
+	}
+	out := make(chan string)
+	go run(ctx, dsn, cred, placeholder, value, dsnValues, credValues, out)
+	return value, out, nil
+}
+
+func run(ctx context.Context, dsn, cred, placeholder, last string, dsnValues, credValues <-chan string, out chan<- string) {
+	metrics.IncHotloadWatchGoroutines(strategyName)
+	defer metrics.DecHotloadWatchGoroutines(strategyName)
+	log := logger.GetLogger()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case dsn = <-dsnValues:
+		case cred = <-credValues:
+		}
+		v, err := inject(dsn, cred, placeholder)
+		if err != nil {
+			log("credfile: could not inject credential", err)
+			continue
+		}
+		if v == last {
+			continue
+		}
+		select {
+		case out <- v:
+			last = v
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// inject puts cred into dsn, either at the placeholder or as the password.
+func inject(dsn, cred, placeholder string) (string, error) {
+	if placeholder != "" {
+		return strings.ReplaceAll(dsn, placeholder, cred), nil
+	}
+	return strategy.SetPassword(dsn, cred)
+}
@@ -0,0 +1,13 @@
+package credfile
+
+import (
+	"testing"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+func TestCredfile(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Credfile Suite")
+}
@@ -0,0 +1,39 @@
+package hotload
+
+import (
+	"context"
+)
+
+// WithContextOptions registers fn to derive driver options from the context
+// of each connection database/sql opens through the hotload connector, e.g. a
+// request scoped application_name or statement_timeout:
+//
+//	hotload.RegisterSQLDriver("postgres", pq.Driver{}, hotload.WithContextOptions(func(ctx context.Context) map[string]string {
+//	    if tenant, ok := ctx.Value(tenantKey{}).(string); ok {
+//	        return map[string]string{"application_name": "orders-" + tenant}
+//	    }
+//	    return nil
+//	}))
+//
+// The options are merged on top of the connection string, the options of
+// WithDriverOptions and appName, and win over all of them. Like
+// WithDriverOptions it requires URL style connection strings. database/sql
+// passes the context of the call that needed a new connection, which may be
+// a background context for connections it opens on its own, and the pool
+// reuses the connection for later calls with other contexts. Connections
+// opened through driver.Driver.Open derive their options from
+// context.Background().
+func WithContextOptions(fn func(ctx context.Context) map[string]string) driverOption {
+	return func(d *driverInstance) {
+		d.contextOptions = fn
+	}
+}
+
+// mergeContextOptions merges the options the driver derives from ctx into
+// dsn.
+func (cg *chanGroup) mergeContextOptions(ctx context.Context, dsn string) (string, error) {
+	if cg.sqlDriver == nil || cg.sqlDriver.contextOptions == nil {
+		return dsn, nil
+	}
+	return mergeConnectionStringOptions(dsn, cg.sqlDriver.contextOptions(ctx))
+}
@@ -0,0 +1,68 @@
+package hotload
+
+import (
+	"context"
+	"testing"
+)
+
+type tenantKey struct{}
+
+func TestWithContextOptions(t *testing.T) {
+	rd := &recordingDriver{}
+	RegisterStrategy("test-ctxoptions", fixedStrategy{value: "postgres://app@db/app?application_name=source&sslmode=disable"})
+	RegisterSQLDriver("test-ctxoptions", rd,
+		WithDriverOptions(map[string]string{"application_name": "static", "statement_timeout": "30s"}),
+		WithContextOptions(func(ctx context.Context) map[string]string {
+			if tenant, ok := ctx.Value(tenantKey{}).(string); ok {
+				return map[string]string{"application_name": "orders-" + tenant}
+			}
+			return nil
+		}))
+	defer func() {
+		UnregisterStrategy("test-ctxoptions")
+		mu.Lock()
+		delete(sqlDrivers, "test-ctxoptions")
+		mu.Unlock()
+	}()
+	h := newHdriver()
+	defer h.stop()
+	c, err := h.OpenConnector("test-ctxoptions://test-ctxoptions/dsn")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		ctx  context.Context
+		want string
+	}{
+		{
+			name: "context options win",
+			ctx:  context.WithValue(context.Background(), tenantKey{}, "acme"),
+			want: "postgres://app@db/app?application_name=orders-acme&sslmode=disable&statement_timeout=30s",
+		},
+		{
+			name: "static options without context options",
+			ctx:  context.Background(),
+			want: "postgres://app@db/app?application_name=static&sslmode=disable&statement_timeout=30s",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := c.Connect(tt.ctx); err != nil {
+				t.Fatalf("Connect() error = %v", err)
+			}
+			if n := rd.count(tt.want); n != 1 {
+				t.Errorf("opened %q %d times, want once", tt.want, n)
+			}
+		})
+	}
+
+	// driver.Driver.Open has no request context
+	if _, err := h.Open("test-ctxoptions://test-ctxoptions/dsn"); err != nil {
+		t.Fatal(err)
+	}
+	if n := rd.count("postgres://app@db/app?application_name=static&sslmode=disable&statement_timeout=30s"); n != 1 {
+		t.Errorf("Open() did not open with the static options")
+	}
+}
@@ -0,0 +1,23 @@
+package hotload
+
+import "sync/atomic"
+
+const debugKey = "debug"
+
+var debugAll atomic.Bool
+
+// SetDebug turns verbose tracing of every hotload decision on or off for
+// all locations. It can also be enabled per location with debug=true. The
+// trace goes to the configured logger, connection strings are passed through
+// Redact first.
+func SetDebug(enabled bool) {
+	debugAll.Store(enabled)
+}
+
+// trace logs args if debug tracing is enabled for the location.
+func (cg *chanGroup) trace(args ...interface{}) {
+	if !cg.debug && !debugAll.Load() {
+		return
+	}
+	cg.log(append([]interface{}{"hotload debug:", cg.name}, args...)...)
+}
@@ -0,0 +1,144 @@
+package hotload
+
+import (
+	"net/url"
+	"strings"
+)
+
+// DirectivePrefix starts an optional first line of the watched value that
+// sets hotload options for the location, e.g.
+//
+//	#hotload: resetPolicy=drain forceKill=false
+//	postgres://app@db.internal/app
+//
+// The line is removed before the value is passed on to the transforms and
+// the driver.
+const DirectivePrefix = "#hotload:"
+
+// directiveKeys are the options a directive line may set. They override the
+// hotload URL until a value without them arrives.
+var directiveKeys = map[string]bool{
+	forceKill:      true,
+	resetPolicy:    true,
+	ignoreBlankKey: true,
+	initSQLKey:     true,
+}
+
+// maxDirectiveValues bounds the prepared values whose directive lines are
+// remembered until they are applied.
+const maxDirectiveValues = 16
+
+// directiveState tracks the options set by directive lines. Directives take
+// effect with the change that carries them, a value vetoed or held by the
+// change pipeline does not change the options. Callers must hold cg.mu
+// except for url, which is only set before the group is shared.
+type directiveState struct {
+	// url holds the directive keys set in the hotload URL
+	url url.Values
+	// line is the directive line applied last
+	line string
+	// lines are the directive lines of the recently prepared values, by
+	// value, oldest first in order
+	lines map[string]string
+	order []string
+}
+
+// splitDirectives removes a leading directive line from v and returns the
+// directives it holds.
+func splitDirectives(v string) (dsn, line string) {
+	trimmed := strings.TrimLeft(v, " \t\r\n")
+	if !strings.HasPrefix(trimmed, DirectivePrefix) {
+		return v, ""
+	}
+	line, dsn, _ = strings.Cut(trimmed, "\n")
+	return dsn, strings.TrimSpace(strings.TrimPrefix(line, DirectivePrefix))
+}
+
+// parseURLDirectives remembers the directive keys set in the hotload URL,
+// restored once a value drops its directives.
+func (cg *chanGroup) parseURLDirectives(vs url.Values) {
+	cg.directives.url = make(url.Values)
+	for k := range directiveKeys {
+		if v, ok := vs[k]; ok {
+			cg.directives.url[k] = v
+		}
+	}
+}
+
+// noteDirectives remembers line as the directive line of the prepared value
+// v, applied by applyChangeLocked once v is.
+func (cg *chanGroup) noteDirectives(v, line string) {
+	cg.mu.Lock()
+	defer cg.mu.Unlock()
+	d := &cg.directives
+	if d.lines == nil {
+		d.lines = make(map[string]string)
+	}
+	if _, ok := d.lines[v]; !ok {
+		d.order = append(d.order, v)
+		if len(d.order) > maxDirectiveValues {
+			delete(d.lines, d.order[0])
+			d.order = d.order[1:]
+		}
+	}
+	d.lines[v] = line
+}
+
+// applyDirectivesOf applies the directive line noted for v, the value being
+// applied. Values hotload did not prepare leave the options alone. cg.mu must
+// be held.
+func (cg *chanGroup) applyDirectivesOf(v string) {
+	if line, ok := cg.directives.lines[v]; ok {
+		cg.applyDirectives(line)
+	}
+}
+
+// applyDirectives applies the directive line, if it differs from the last
+// one. Unknown directives are logged and ignored. cg.mu must be held unless
+// the group is not shared yet.
+func (cg *chanGroup) applyDirectives(line string) {
+	if line == cg.directives.line {
+		return
+	}
+	cg.directives.line = line
+	set := make(url.Values)
+	for _, field := range strings.Fields(line) {
+		k, val, ok := strings.Cut(field, "=")
+		if !ok || !directiveKeys[k] {
+			cg.log("unknown hotload directive, ignoring", field)
+			continue
+		}
+		// values are query escaped, e.g. initSQL=SET+search_path+TO+app
+		unescaped, err := url.QueryUnescape(val)
+		if err != nil {
+			cg.log("invalid hotload directive, ignoring", field)
+			continue
+		}
+		set.Set(k, unescaped)
+	}
+	vs := make(url.Values)
+	for k, val := range cg.directives.url {
+		vs[k] = val
+	}
+	if set.Has(forceKill) || set.Has(resetPolicy) {
+		// the directive decides the policy, not a mix with the URL
+		vs.Del(forceKill)
+		vs.Del(resetPolicy)
+	}
+	for k, val := range set {
+		vs[k] = val
+	}
+	cg.log("applying hotload directives for location", cg.name, line)
+	cg.parseDirectives(vs)
+}
+
+// parseDirectives sets the options of the directive keys from vs, those
+// missing in vs to their defaults. The other options of the hotload URL are
+// left alone, parsing them again would reset the ones not given in vs.
+func (cg *chanGroup) parseDirectives(vs url.Values) {
+	cg.resetPolicy = ResetPolicyLazy
+	cg.ignoreBlank = false
+	cg.parseResetOptions(vs)
+	cg.parseIgnoreBlank(vs)
+	cg.parseInitSQL(vs)
+}
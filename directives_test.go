@@ -0,0 +1,142 @@
+package hotload
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSplitDirectives(t *testing.T) {
+	tests := []struct {
+		name     string
+		v        string
+		wantDSN  string
+		wantLine string
+	}{
+		{name: "no directives", v: "host=db dbname=app", wantDSN: "host=db dbname=app"},
+		{name: "directive line", v: "#hotload: resetPolicy=drain\nhost=db", wantDSN: "host=db", wantLine: "resetPolicy=drain"},
+		{name: "crlf and leading blank lines", v: "\n#hotload:  forceKill=true \r\nhost=db", wantDSN: "host=db", wantLine: "forceKill=true"},
+		{name: "only directives", v: "#hotload: forceKill=true", wantLine: "forceKill=true"},
+		{name: "other comment", v: "# primary\nhost=db", wantDSN: "# primary\nhost=db"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dsn, line := splitDirectives(tt.v)
+			if dsn != tt.wantDSN || line != tt.wantLine {
+				t.Errorf("splitDirectives() = %q, %q, want %q, %q", dsn, line, tt.wantDSN, tt.wantLine)
+			}
+		})
+	}
+}
+
+func TestApplyDirectives(t *testing.T) {
+	var logs []string
+	cg := &chanGroup{
+		name:        "fsnotify://postgres/directives",
+		resetPolicy: ResetPolicyLazy,
+		log:         func(args ...interface{}) { logs = append(logs, fmt.Sprintln(args...)) },
+	}
+	vs := url.Values{resetPolicy: {"soft"}, ignoreBlankKey: {"true"}}
+	cg.parseValues(vs)
+	cg.parseURLDirectives(vs)
+
+	v, line, err := cg.prepareValue("#hotload: resetPolicy=drain bogus=1 forceKill\nhost=db")
+	if err != nil {
+		t.Fatalf("prepareValue() error = %v", err)
+	}
+	if v != "host=db" {
+		t.Errorf("prepareValue() = %q, want the value without directives", v)
+	}
+	if cg.resetPolicy != ResetPolicySoft {
+		t.Errorf("resetPolicy = %s, want the directives applied only with the value", cg.resetPolicy)
+	}
+	cg.applyDirectives(line)
+	if cg.resetPolicy != ResetPolicyDrain || !cg.ignoreBlank {
+		t.Errorf("resetPolicy, ignoreBlank = %s, %v, want drain from the directive, true from the URL", cg.resetPolicy, cg.ignoreBlank)
+	}
+	joined := strings.Join(logs, "")
+	for _, unknown := range []string{"bogus=1", "forceKill\n"} {
+		if !strings.Contains(joined, "unknown hotload directive, ignoring "+unknown) {
+			t.Errorf("logs = %q, want %q logged as unknown", joined, unknown)
+		}
+	}
+
+	cg.applyDirectives("forceKill=true ignoreBlank=false")
+	if cg.resetPolicy != ResetPolicyForce || cg.ignoreBlank {
+		t.Errorf("resetPolicy, ignoreBlank = %s, %v, want force, false from the directive", cg.resetPolicy, cg.ignoreBlank)
+	}
+
+	cg.applyDirectives("")
+	if cg.resetPolicy != ResetPolicySoft || !cg.ignoreBlank {
+		t.Errorf("resetPolicy, ignoreBlank = %s, %v, want the URL settings restored", cg.resetPolicy, cg.ignoreBlank)
+	}
+}
+
+func TestApplyDirectivesKeepsURLSettings(t *testing.T) {
+	cg := &chanGroup{
+		name:        "fsnotify://postgres/directives",
+		resetPolicy: ResetPolicyLazy,
+		log:         func(args ...interface{}) {},
+	}
+	vs := url.Values{historyDepthKey: {"50"}, certPollIntervalKey: {"5s"}, openRetriesKey: {"3"}}
+	cg.parseValues(vs)
+	cg.parseURLDirectives(vs)
+
+	_, line, err := cg.prepareValue("#hotload: resetPolicy=drain\nhost=db")
+	if err != nil {
+		t.Fatalf("prepareValue() error = %v", err)
+	}
+	cg.applyDirectives(line)
+	if cg.resetPolicy != ResetPolicyDrain {
+		t.Errorf("resetPolicy = %s, want drain from the directive", cg.resetPolicy)
+	}
+	if cg.historyDepth != 50 || cg.certPollInterval != 5*time.Second || cg.retry.retries != 3 {
+		t.Errorf("historyDepth, certPollInterval, openRetries = %d, %s, %d, want 50, 5s, 3 from the URL", cg.historyDepth, cg.certPollInterval, cg.retry.retries)
+	}
+}
+
+func TestDirectivesAppliedWithChange(t *testing.T) {
+	di := &driverInstance{}
+	WithAllowedHosts("*.db.internal")(di)
+	cg := &chanGroup{
+		name:        "fsnotify://postgres/directives",
+		driverName:  "postgres",
+		sqlDriver:   di,
+		value:       "host=a.db.internal",
+		resetPolicy: ResetPolicyLazy,
+		log:         func(...interface{}) {},
+	}
+	cg.ctx, cg.cancel = noopContext()
+	cg.parentCtx = cg.ctx
+	cg.parseURLDirectives(url.Values{})
+	change := func(raw string) {
+		t.Helper()
+		v, line, err := cg.prepareValue(raw)
+		if err != nil {
+			t.Fatalf("prepareValue() error = %v", err)
+		}
+		cg.noteDirectives(v, line)
+		cg.valueChanged(v)
+	}
+
+	change("#hotload: resetPolicy=force\nhost=attacker.example.com")
+	if cg.resetPolicy != ResetPolicyLazy {
+		t.Errorf("resetPolicy = %s, want the directives of the vetoed value ignored", cg.resetPolicy)
+	}
+
+	cg.quiesceFor(time.Hour)
+	change("#hotload: resetPolicy=drain\nhost=b.db.internal")
+	if cg.resetPolicy != ResetPolicyLazy {
+		t.Errorf("resetPolicy = %s, want the directives of the held value ignored", cg.resetPolicy)
+	}
+	cg.quiesceFor(0)
+	waitFor(t, func() bool { return cg.currentValue() == "host=b.db.internal" })
+	cg.mu.RLock()
+	policy := cg.resetPolicy
+	cg.mu.RUnlock()
+	if policy != ResetPolicyDrain {
+		t.Errorf("resetPolicy = %s, want drain applied with the held value", policy)
+	}
+}
@@ -0,0 +1,181 @@
+// Package dnstxt implements a hotload strategy that reads the connection
+// string from a DNS TXT record and polls it for changes. The path is the name
+// of the record:
+//
+//	db, err := sql.Open("hotload", "dns://postgres/_dsn.orders.example.com?pollInterval=30s")
+//
+// The name must have a single TXT record, its character strings are joined.
+// Anyone who can resolve the name can read the record, publish connection
+// strings without credentials and combine the strategy with e.g.
+// expandEnv=true for the password.
+package dnstxt
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/infobloxopen/hotload"
+	"github.com/infobloxopen/hotload/logger"
+	"github.com/infobloxopen/hotload/metrics"
+	"github.com/infobloxopen/hotload/strategy"
+)
+
+func init() {
+	hotload.RegisterStrategy(strategyName, NewStrategy(nil))
+}
+
+const strategyName = "dns"
+
+// PollIntervalKey is the query parameter with the poll interval used when the
+// resolver does not report the TTL of the record, e.g. 30s.
+const PollIntervalKey = "pollInterval"
+
+// DefaultPollInterval is the poll interval without pollInterval=.
+var DefaultPollInterval = time.Minute
+
+// minPollInterval bounds the poll interval, records with a TTL of 0 are not
+// polled in a busy loop.
+var minPollInterval = 5 * time.Second
+
+// ErrMultipleRecords is wrapped by the errors of lookups that returned more
+// than one TXT record.
+var ErrMultipleRecords = errors.New("dns: more than one TXT record")
+
+// Resolver looks up the TXT records of name. ttl is how long the records may
+// be cached, 0 if unknown.
+type Resolver interface {
+	LookupTXT(ctx context.Context, name string) (records []string, ttl time.Duration, err error)
+}
+
+// NetResolver adapts a net.Resolver, net.DefaultResolver if nil. It does not
+// report TTLs, records are polled every pollInterval.
+type NetResolver struct {
+	Resolver *net.Resolver
+}
+
+// LookupTXT implements Resolver.
+func (r NetResolver) LookupTXT(ctx context.Context, name string) ([]string, time.Duration, error) {
+	res := r.Resolver
+	if res == nil {
+		res = net.DefaultResolver
+	}
+	records, err := res.LookupTXT(ctx, name)
+	return records, 0, err
+}
+
+// NewStrategy returns a strategy that resolves TXT records with r, a
+// NetResolver if r is nil. Applications that need TTLs adapt a DNS client
+// library to Resolver and register the strategy themselves.
+func NewStrategy(r Resolver) *Strategy {
+	if r == nil {
+		r = NetResolver{}
+	}
+	return &Strategy{resolver: r}
+}
+
+// Strategy implements the hotload Strategy interface with DNS TXT records.
+type Strategy struct {
+	resolver Resolver
+}
+
+// Watch implements the hotload.Strategy interface. Errors of the first lookup
+// are returned, a name that does not exist wraps strategy.ErrResourceNotFound.
+// Later errors are logged and the lookup is retried while the previous value
+// is kept. The record is polled again once its TTL passed, the poll loop
+// stops when ctx is canceled.
+func (s *Strategy) Watch(ctx context.Context, pth string, options url.Values) (value string, values <-chan string, err error) {
+	name := strings.Trim(pth, "/")
+	if name == "" {
+		return "", nil, errors.New("dns: missing record name in path")
+	}
+	fallback := DefaultPollInterval
+	if v := options.Get(PollIntervalKey); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d <= 0 {
+			return "", nil, fmt.Errorf("dns: invalid %s %q", PollIntervalKey, v)
+		}
+		fallback = d
+	}
+	value, ttl, err := s.lookup(ctx, name)
+	if err != nil {
+		return "", nil, err
+	}
+	out := make(chan string)
+	go s.run(ctx, name, fallback, pollInterval(ttl, fallback), value, out)
+	return value, out, nil
+}
+
+// lookup returns the value of the TXT record of name and its TTL.
+func (s *Strategy) lookup(ctx context.Context, name string) (string, time.Duration, error) {
+	records, ttl, err := s.resolver.LookupTXT(ctx, name)
+	if err != nil {
+		var dnsErr *net.DNSError
+		if errors.As(err, &dnsErr) && dnsErr.IsNotFound {
+			return "", 0, notFound(name, err)
+		}
+		return "", 0, strategy.ReadError(name, err)
+	}
+	switch len(records) {
+	case 0:
+		return "", 0, notFound(name, errors.New("no TXT record"))
+	case 1:
+		return strings.TrimSpace(records[0]), ttl, nil
+	}
+	return "", 0, strategy.ReadError(name, fmt.Errorf("%w: got %d", ErrMultipleRecords, len(records)))
+}
+
+// notFound wraps err, e.g. NXDOMAIN, with strategy.ErrResourceNotFound.
+func notFound(name string, err error) error {
+	return fmt.Errorf("could not resolve %v: %w: %w", name, strategy.ErrResourceNotFound, err)
+}
+
+// pollInterval returns when to poll a record with ttl again.
+func pollInterval(ttl, fallback time.Duration) time.Duration {
+	d := fallback
+	if ttl > 0 {
+		d = ttl
+	}
+	if d < minPollInterval {
+		d = minPollInterval
+	}
+	return d
+}
+
+func (s *Strategy) run(ctx context.Context, name string, fallback, next time.Duration, last string, out chan<- string) {
+	metrics.IncHotloadWatchGoroutines(strategyName)
+	defer metrics.DecHotloadWatchGoroutines(strategyName)
+	log := logger.GetLogger()
+	timer := time.NewTimer(next)
+	defer timer.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-timer.C:
+		}
+		v, ttl, err := s.lookup(ctx, name)
+		if err != nil {
+			// e.g. a timeout of the resolver, keep the previous value
+			log("dns:", err)
+			timer.Reset(pollInterval(0, fallback))
+			continue
+		}
+		timer.Reset(pollInterval(ttl, fallback))
+		if v == last {
+			continue
+		}
+		// the value may hold credentials, only log that it changed
+		log("dns: record changed", name)
+		select {
+		case out <- v:
+			last = v
+		case <-ctx.Done():
+			return
+		}
+	}
+}
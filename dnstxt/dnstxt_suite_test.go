@@ -0,0 +1,18 @@
+package dnstxt
+
+import (
+	"testing"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+func TestDNSTXT(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "DNSTXT Suite")
+}
+
+var _ = BeforeSuite(func() {
+	minPollInterval = time.Millisecond
+})
@@ -0,0 +1,133 @@
+package dnstxt
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/infobloxopen/hotload/strategy"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+// fakeResolver serves records from a map, failing while err is set.
+type fakeResolver struct {
+	mu      sync.Mutex
+	records map[string][]string
+	ttl     time.Duration
+	err     error
+	lookups int
+}
+
+func (r *fakeResolver) LookupTXT(ctx context.Context, name string) ([]string, time.Duration, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.lookups++
+	if r.err != nil {
+		return nil, 0, r.err
+	}
+	records, ok := r.records[name]
+	if !ok {
+		return nil, 0, &net.DNSError{Err: "no such host", Name: name, IsNotFound: true}
+	}
+	return records, r.ttl, nil
+}
+
+func (r *fakeResolver) set(name string, records []string, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.records[name] = records
+	r.err = err
+}
+
+func (r *fakeResolver) count() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.lookups
+}
+
+var _ = Describe("Strategy", func() {
+	var (
+		ctx    context.Context
+		cancel context.CancelFunc
+		res    *fakeResolver
+	)
+
+	BeforeEach(func() {
+		ctx, cancel = context.WithCancel(context.Background())
+		res = &fakeResolver{
+			records: map[string][]string{"_dsn.example.com": {" host=db1 dbname=app "}},
+			ttl:     10 * time.Millisecond,
+		}
+	})
+
+	AfterEach(func() {
+		cancel()
+	})
+
+	It("Should return the record and emit changes after the TTL", func() {
+		v, values, err := NewStrategy(res).Watch(ctx, "/_dsn.example.com", url.Values{})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(v).To(Equal("host=db1 dbname=app"))
+
+		res.set("_dsn.example.com", []string{"host=db2 dbname=app"}, nil)
+		Eventually(values).Should(Receive(Equal("host=db2 dbname=app")))
+	})
+
+	It("Should fail the first fetch of a name that does not exist", func() {
+		_, _, err := NewStrategy(res).Watch(ctx, "/missing.example.com", url.Values{})
+		Expect(err).To(MatchError(strategy.ErrResourceNotFound))
+
+		res.set("empty.example.com", nil, nil)
+		_, _, err = NewStrategy(res).Watch(ctx, "/empty.example.com", url.Values{})
+		Expect(err).To(MatchError(strategy.ErrResourceNotFound))
+	})
+
+	It("Should fail for several records and bad options", func() {
+		res.set("many.example.com", []string{"a", "b"}, nil)
+		_, _, err := NewStrategy(res).Watch(ctx, "/many.example.com", url.Values{})
+		Expect(err).To(MatchError(ErrMultipleRecords))
+		_, _, err = NewStrategy(res).Watch(ctx, "/_dsn.example.com", url.Values{PollIntervalKey: {"often"}})
+		Expect(err).To(HaveOccurred())
+		_, _, err = NewStrategy(res).Watch(ctx, "/", url.Values{})
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("Should keep polling after transient failures", func() {
+		_, values, err := NewStrategy(res).Watch(ctx, "/_dsn.example.com", url.Values{PollIntervalKey: {"10ms"}})
+		Expect(err).ToNot(HaveOccurred())
+		res.set("_dsn.example.com", nil, &net.DNSError{Err: "i/o timeout", IsTimeout: true})
+		start := res.count()
+		Eventually(res.count).Should(BeNumerically(">", start+2))
+		Consistently(values, 50*time.Millisecond).ShouldNot(Receive())
+
+		res.set("_dsn.example.com", []string{"host=db3"}, nil)
+		Eventually(values).Should(Receive(Equal("host=db3")))
+	})
+
+	It("Should use pollInterval without a TTL", func() {
+		res.ttl = 0
+		_, _, err := NewStrategy(res).Watch(ctx, "/_dsn.example.com", url.Values{PollIntervalKey: {"1h"}})
+		Expect(err).ToNot(HaveOccurred())
+		Consistently(res.count, 50*time.Millisecond).Should(Equal(1))
+	})
+
+	It("Should stop polling when ctx is canceled", func() {
+		_, _, err := NewStrategy(res).Watch(ctx, "/_dsn.example.com", url.Values{})
+		Expect(err).ToNot(HaveOccurred())
+		Eventually(res.count).Should(BeNumerically(">", 2))
+		cancel()
+		time.Sleep(20 * time.Millisecond)
+		stopped := res.count()
+		Consistently(res.count, 50*time.Millisecond).Should(Equal(stopped))
+	})
+
+	It("Should wrap other resolver errors with ErrReadFailed", func() {
+		res.err = errors.New("server misbehaving")
+		_, _, err := NewStrategy(res).Watch(ctx, "/_dsn.example.com", url.Values{})
+		Expect(err).To(MatchError(strategy.ErrReadFailed))
+	})
+})
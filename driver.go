@@ -50,38 +50,94 @@ import (
 	"context"
 	"database/sql"
 	"database/sql/driver"
+	"errors"
 	"fmt"
+	"io"
 	"net/url"
+	"runtime/debug"
 	"sort"
+	"strconv"
+	"strings"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/infobloxopen/hotload/logger"
+	"github.com/infobloxopen/hotload/metrics"
 )
 
-// Strategy is the plugin interface for hotload.
+// Strategy is the plugin interface for hotload. Strategies that hold clients
+// or goroutines may also implement io.Closer, UnregisterStrategy closes them.
 type Strategy interface {
 	// Watch returns back the contents of the resource as well as a channel
 	// for subsequent updates (if the value has changed). If there is an error
 	// getting the initial value, an error is returned.
+	//
+	// Push based strategies that cannot provide the initial value
+	// synchronously may return an empty value and send it on the channel
+	// instead, if the location sets initialValueTimeout.
+	//
+	// The values channel may be unbuffered. Hotload reads it continuously and
+	// only keeps the latest value, so a send blocks only briefly even while
+	// hotload is busy resetting connections. Values sent in quick succession
+	// are coalesced and only the most recent one is applied.
 	Watch(ctx context.Context, pth string, options url.Values) (value string, values <-chan string, err error)
 }
 
+// Rewatcher is implemented by strategies that can re-establish a watch after
+// losing their connection to the source. When the values channel of such a
+// strategy is closed, hotload calls Rewatch with backoff until it succeeds and
+// then reads from the new channel. Strategies without it leave the location
+// on its last value.
+type Rewatcher interface {
+	Rewatch(ctx context.Context, pth string, options url.Values) (value string, values <-chan string, err error)
+}
+
 const forceKill = "forceKill"
 const driverOptions = "driverOptions"
+const normalize = "normalize"
+const resetPolicy = "resetPolicy"
+const expandEnvKey = "expandEnv"
+const driverKey = "driver"
+const maxConcurrentOpensKey = "maxConcurrentOpens"
+const ignoreBlankKey = "ignoreBlank"
+
+// runStrategy is the strategy label of the run loop in the watch goroutine
+// metrics.
+const runStrategy = "hotload"
 
 var (
 	ErrUnsupportedStrategy       = fmt.Errorf("unsupported hotload strategy")
 	ErrMalformedConnectionString = fmt.Errorf("malformed hotload connection string")
 	ErrUnknownDriver             = fmt.Errorf("target driver is not registered with hotload")
+	// ErrDriverPanic is wrapped by the errors of opens the underlying driver
+	// panicked in.
+	ErrDriverPanic = errors.New("hotload: driver panicked opening a connection")
 
 	mu         sync.RWMutex
 	sqlDrivers = make(map[string]*driverInstance)
 	strategies = make(map[string]Strategy)
+	// driverAliases maps alternative names to registered driver names
+	driverAliases = make(map[string]string)
 )
 
 type driverInstance struct {
-	driver  driver.Driver
+	driver driver.Driver
+	// open replaces driver.Open if the driver was registered with
+	// RegisterSQLDriverFunc
+	open    ConnFactory
 	options map[string]string
+	// appNameKey is the connection string option appName sets
+	appNameKey string
+	// normalizer canonicalizes connection strings of the driver, may be nil
+	normalizer normalizer
+	// hosts restricts the hosts connection strings may point at
+	hosts hostPolicy
+	// pooler rewrites connection strings to a pooling proxy, may be nil
+	pooler *PoolerConfig
+	// contextOptions derives driver options from the context of Connect,
+	// may be nil
+	contextOptions func(context.Context) map[string]string
 }
 
 type driverOption func(*driverInstance)
@@ -100,6 +156,23 @@ func WithDriverOptions(options map[string]string) driverOption {
 	}
 }
 
+// WithAppNameKey sets the connection string option the appName hotload
+// option is passed to the driver as, DefaultAppNameKey if not set.
+func WithAppNameKey(key string) driverOption {
+	return func(d *driverInstance) {
+		d.appNameKey = key
+	}
+}
+
+// WithNormalizer sets a function that canonicalizes connection strings of the
+// driver, e.g. NormalizePostgres. Values that are equal once normalized are
+// not a change, and connections are opened with the normalized value.
+func WithNormalizer(fn func(string) string) driverOption {
+	return func(d *driverInstance) {
+		d.normalizer = fn
+	}
+}
+
 // RegisterSQLDriver makes a database driver available by the provided name.
 // If RegisterSQLDriver is called twice with the same name or if driver is nil,
 // it panics.
@@ -109,14 +182,40 @@ func RegisterSQLDriver(name string, driver driver.Driver, options ...driverOptio
 	if driver == nil {
 		panic("hotload: Register driver is nil")
 	}
+	registerSQLDriverLocked(name, &driverInstance{driver: driver}, options)
+}
+
+// ConnFactory opens a connection to the database with the connection string
+// dsn. ctx is canceled when the connection information of the location
+// changes, unless its reset policy is soft.
+type ConnFactory func(ctx context.Context, dsn string) (driver.Conn, error)
+
+// RegisterSQLDriverFunc makes a database driver available by the provided
+// name that opens connections with fn instead of a driver.Driver, for drivers
+// that need custom dialers or other setup before connecting. fn receives the
+// connection string after the driver options are merged and any tunnel
+// rewrites are applied. If RegisterSQLDriverFunc is called twice with the same
+// name, or with the name of a driver registered with RegisterSQLDriver, or if
+// fn is nil, it panics.
+func RegisterSQLDriverFunc(name string, fn ConnFactory, options ...driverOption) {
+	mu.Lock()
+	defer mu.Unlock()
+	if fn == nil {
+		panic("hotload: Register driver func is nil")
+	}
+	registerSQLDriverLocked(name, &driverInstance{open: fn}, options)
+}
+
+func registerSQLDriverLocked(name string, di *driverInstance, options []driverOption) {
 	if _, dup := sqlDrivers[name]; dup {
 		panic("hotload: Register called twice for driver " + name)
 	}
-	di := &driverInstance{driver: driver}
+	if _, dup := driverAliases[name]; dup {
+		panic("hotload: Register called with the name of driver alias " + name)
+	}
 	for _, opt := range options {
 		opt(di)
 	}
-
 	sqlDrivers[name] = di
 }
 
@@ -126,6 +225,42 @@ func unregisterAll() {
 	// For tests.
 	sqlDrivers = make(map[string]*driverInstance)
 	strategies = make(map[string]Strategy)
+	validators = make(map[string]DSNValidator)
+	driverAliases = make(map[string]string)
+}
+
+// RegisterDriverAlias makes the driver registered as target available as
+// alias too, e.g. fsnotify://pg/... for a driver registered as postgres.
+// Locations using the alias behave exactly like ones using target, validators
+// and stats use the name target. target does not have to be registered yet.
+// If alias is already a driver or an alias, or if alias and target are the
+// same, it panics.
+func RegisterDriverAlias(alias, target string) {
+	mu.Lock()
+	defer mu.Unlock()
+	if alias == target {
+		panic("hotload: RegisterDriverAlias alias and target are both " + alias)
+	}
+	if _, dup := sqlDrivers[alias]; dup {
+		panic("hotload: RegisterDriverAlias called with the name of driver " + alias)
+	}
+	if _, dup := driverAliases[alias]; dup {
+		panic("hotload: RegisterDriverAlias called twice for alias " + alias)
+	}
+	driverAliases[alias] = target
+}
+
+// lookupDriver returns the driver registered as name, or as the target of
+// the alias name, and the name it is registered as. Callers must hold mu.
+func lookupDriver(name string) (*driverInstance, string, bool) {
+	if d, ok := sqlDrivers[name]; ok {
+		return d, name, true
+	}
+	if target, ok := driverAliases[name]; ok {
+		d, ok := sqlDrivers[target]
+		return d, target, ok
+	}
+	return nil, name, false
 }
 
 // SQLDrivers returns a sorted list of the names of the registered drivers.
@@ -167,172 +302,993 @@ func Strategies() []string {
 	return list
 }
 
+// RequireRegistered returns an error listing the drivers and strategies that
+// are not registered, nil if all are. Applications call it at startup to catch
+// a missing blank import before the first Open. The error wraps
+// ErrUnknownDriver and ErrUnsupportedStrategy. Driver aliases count as
+// registered if their target is.
+func RequireRegistered(drivers []string, strategies []string) error {
+	var errs []error
+	if missing := missingNames(resolvableDrivers(), drivers); len(missing) > 0 {
+		errs = append(errs, fmt.Errorf("%w: %s", ErrUnknownDriver, strings.Join(missing, ", ")))
+	}
+	if missing := missingNames(Strategies(), strategies); len(missing) > 0 {
+		errs = append(errs, fmt.Errorf("%w: %s", ErrUnsupportedStrategy, strings.Join(missing, ", ")))
+	}
+	return errors.Join(errs...)
+}
+
+// resolvableDrivers returns a sorted list of the names of the registered
+// drivers and of the aliases whose target is registered.
+func resolvableDrivers() []string {
+	list := SQLDrivers()
+	mu.RLock()
+	for alias, target := range driverAliases {
+		if _, ok := sqlDrivers[target]; ok {
+			list = append(list, alias)
+		}
+	}
+	mu.RUnlock()
+	sort.Strings(list)
+	return list
+}
+
+// missingNames returns the names of want that are not in the sorted list
+// registered.
+func missingNames(registered, want []string) []string {
+	var missing []string
+	for _, name := range want {
+		i := sort.SearchStrings(registered, name)
+		if i == len(registered) || registered[i] != name {
+			missing = append(missing, name)
+		}
+	}
+	return missing
+}
+
+// UnregisterStrategy removes the strategy registered as name, so that a
+// different strategy can be registered in its place. A strategy implementing
+// io.Closer, e.g. the appconfig one whose Close stops the poll loops of all
+// its watches, is closed and the error of Close returned. Strategies whose
+// watches only hold resources until their context is canceled need no Close.
+// Locations that are already open keep their watch, unless closing the
+// strategy stops it. Unregistering a name that is not registered does
+// nothing.
+func UnregisterStrategy(name string) error {
+	mu.Lock()
+	strategy, ok := strategies[name]
+	delete(strategies, name)
+	mu.Unlock()
+	if !ok {
+		return nil
+	}
+	if c, ok := strategy.(io.Closer); ok {
+		return c.Close()
+	}
+	return nil
+}
+
+// hotloadDriver is the driver instance registered with database/sql.
+var hotloadDriver = newHdriver()
+
 func init() {
-	sql.Register("hotload", &hdriver{ctx: context.Background(), cgroup: make(map[string]*chanGroup)})
+	sql.Register("hotload", hotloadDriver)
 }
 
 // hdriver is the hotload driver.
 type hdriver struct {
-	ctx    context.Context
+	ctx context.Context
+	// stop cancels ctx, stopping the watches and run loops of all groups
+	stop context.CancelFunc
+	// runs tracks the run loops of the groups
+	runs   sync.WaitGroup
 	cgroup map[string]*chanGroup
 	mu     sync.Mutex
+	// imported are the values of ImportState not used yet, guarded by the
+	// package mu
+	imported map[string]string
+	// starting are closed once the watch of their location started or
+	// failed, guarded by the package mu
+	starting map[string]chan struct{}
+	// clock is the clock of new groups, the real one if nil
+	clock clock
+}
+
+func newHdriver() *hdriver {
+	ctx, stop := context.WithCancel(context.Background())
+	return &hdriver{ctx: ctx, stop: stop, cgroup: make(map[string]*chanGroup), starting: make(map[string]chan struct{})}
 }
 
 // chanGroup represents a hotload location that is being monitored
 type chanGroup struct {
+	name      string
 	value     string
 	values    <-chan string
 	parentCtx context.Context
-	ctx       context.Context
-	cancel    context.CancelFunc
-	sqlDriver *driverInstance
-	mu        sync.RWMutex
-	forceKill bool
-	conns     []*managedConn
-	log       logger.Logger
+	// stopWatch stops the watch of the strategy and the run loop, canceling
+	// parentCtx
+	stopWatch   context.CancelFunc
+	ctx         context.Context
+	cancel      context.CancelFunc
+	sqlDriver   *driverInstance
+	driverName  string
+	mu          sync.RWMutex
+	resetPolicy ResetPolicy
+	normalize   normalizer
+	expandEnv   bool
+	strictEnv   bool
+	debug       bool
+	ignoreBlank bool
+	clock       clock
+	lastFetch   time.Time
+	lastChange  time.Time
+	canary      canary
+	retry       openRetry
+	readOnly    readOnlyMode
+
+	certFiles        []string
+	certPollInterval time.Duration
+	tunnel           *tunnelState
+	appName          string
+	// ready is closed once the group has a value, created by readyChan
+	ready chan struct{}
+
+	// openSem limits concurrent opens if maxConcurrentOpens is set
+	openSem  chan struct{}
+	inFlight atomic.Int64
+
+	transforms pipeline
+
+	history      []historyEntry
+	historyDepth int
+	// rolledBack is the value replaced by Rollback, ignored until the
+	// source delivers a different one
+	rolledBack string
+	// rollingBack is the rollback passed to the change pipeline, nil if
+	// there is none
+	rollingBack *pendingRollback
+
+	flap           flapGuard
+	quiesce        quiesceWindow
+	rotateLimit    rotateLimit
+	rotateSchedule rotateSchedule
+	healthGate     healthGate
+	override       override
+	dsnParts       *dsnParts
+	rotationWindow rotationWindow
+	maxValueSize   int
+	initSQL        []string
+	stabilizer     stabilizer
+	shard          string
+	leases         noRotateLeases
+	idleWatcher    idleWatcher
+	closeTimeout   time.Duration
+	buffer         valueBuffer
+	directives     directiveState
+
+	// closing is set by Shutdown, no new connections are opened
+	closing bool
+	nested  nestedCheck
+
+	changeTimeField string
+	conns           []*managedConn
+	// stale are the connections reset by a change that may still be open,
+	// listed by ConnectionDetails until they are closed
+	stale []*managedConn
+	// connsActive is whether conns was last seen non-empty, the transitions
+	// are queued for fireConnsHooks
+	connsActive      bool
+	connsTransitions []connsTransition
+	firingConnsHooks bool
+	log              logger.Logger
 }
 
 // monitor the location for changes
 func (cg *chanGroup) run() {
+	metrics.IncHotloadWatchGoroutines(runStrategy)
+	defer metrics.DecHotloadWatchGoroutines(runStrategy)
 	for {
 		select {
 		case <-cg.parentCtx.Done():
 			cg.cancel()
+			cg.stopHolds()
 			cg.log("cancelling chanGroup context")
 			return
 		case v := <-cg.values:
-			if v == cg.value {
-				// next update is the same, just ignore it
+			cg.fetched()
+			cg.trace("received value", cg.redact(v))
+			if cg.ignoreBlank && strings.TrimSpace(v) == "" {
+				// likely a source caught mid-write, wait for the full value
+				cg.log("ignoring blank connection information for location", cg.name)
+				continue
+			}
+			changed, ok := cg.changeTime(v)
+			if !ok {
+				changed = cg.now()
+			}
+			v, directives, err := cg.prepareValue(v)
+			if err != nil {
+				cg.log("retaining previous connection information for location", cg.name, err)
 				continue
 			}
-			cg.valueChanged(v)
-			cg.log("connection information changed")
+			cg.noteDirectives(v, directives)
+			if cg.holdUntilStable(v, changed) {
+				continue
+			}
+			cg.received(v, changed)
 		}
 	}
 }
 
-func (cg *chanGroup) valueChanged(v string) {
+// received handles the prepared value v of the strategy, changed at the
+// given time, and passes it through the change pipeline unless it is
+// unchanged or rolled back.
+func (cg *chanGroup) received(v string, changed time.Time) {
+	current := cg.currentValue()
+	if cg.sameValue(v, current) {
+		// unchanged values, e.g. keepalives of a polling strategy,
+		// only count as a fetch: no reset, no hooks, no audit event
+		cg.trace("value unchanged, ignoring")
+		cg.dropHeld()
+		cg.decide(RotationUnchanged, current, v)
+		return
+	}
+	if cg.ignoreRolledBack(v) {
+		cg.trace("value was rolled back, ignoring")
+		return
+	}
+	cg.trace("value changed from", cg.redact(current), "to", cg.redact(v))
+	cg.valueChanged(v)
+	cg.log("connection information changed for location", cg.name)
+	cg.observeChangeLatency(changed)
+}
+
+// prepareValue turns a value received from the strategy into the value
+// passed to the driver and returns the directive line it carried. The
+// directives are not applied, applyChangeLocked applies them with the value.
+func (cg *chanGroup) prepareValue(v string) (string, string, error) {
+	if err := cg.checkValueSize(v); err != nil {
+		return "", "", err
+	}
+	v, directives := splitDirectives(v)
+	v, err := cg.transforms.apply(v)
+	if err != nil {
+		return "", "", err
+	}
+	if v, err = cg.selectShard(v); err != nil {
+		return "", "", err
+	}
+	v = cg.dsnParts.assemble(v)
+	v, _, _ = splitChangeTime(v, cg.changeTimeField)
+	if cg.expandEnv {
+		if v, err = expandEnv(v, cg.strictEnv); err != nil {
+			return "", "", err
+		}
+	}
+	return v, directives, cg.nested.check(v)
+}
+
+// currentValue returns the connection information in use.
+func (cg *chanGroup) currentValue() string {
+	cg.mu.RLock()
+	defer cg.mu.RUnlock()
+	return cg.value
+}
+
+// sameValue reports whether two config values are equivalent, comparing
+// their normalized forms if a normalizer is configured.
+func (cg *chanGroup) sameValue(a, b string) bool {
+	if a == b {
+		return true
+	}
+	if cg.normalize != nil && cg.normalize(a) == cg.normalize(b) {
+		return true
+	}
+	if n := cg.driverNormalizer(); n != nil {
+		return n(a) == n(b)
+	}
+	return false
+}
+
+// applyChange switches the group to v and resets connections according to
+// the reset policy.
+func (cg *chanGroup) applyChange(v string) AuditEvent {
+	defer cg.fireConnsHooks()
 	cg.mu.Lock()
 	defer cg.mu.Unlock()
-	cg.cancel()
-	cg.ctx, cg.cancel = context.WithCancel(cg.parentCtx)
+	return cg.applyChangeLocked(v)
+}
+
+// applyChangeLocked is applyChange for callers holding cg.mu.
+func (cg *chanGroup) applyChangeLocked(v string) AuditEvent {
+	// the directives of v decide how this change resets connections
+	cg.applyDirectivesOf(v)
+	event := AuditEvent{
+		Location:    cg.name,
+		Driver:      cg.driverName,
+		OldHash:     HashValue(cg.value),
+		NewHash:     HashValue(v),
+		OldRedacted: cg.redact(cg.value),
+		NewRedacted: cg.redact(v),
+		Policy:      cg.resetPolicy,
+	}
+	if cg.resetPolicy != ResetPolicySoft {
+		cg.cancel()
+		cg.ctx, cg.cancel = context.WithCancel(cg.parentCtx)
+	}
 	cg.resetConnections()
 
+	if cg.canary.window > 0 {
+		cg.beginRamp()
+	}
+	rollback := cg.takeRollback(v)
+	if !rollback {
+		cg.pushHistory(cg.value, cg.now())
+	}
+	old := cg.value
+	cg.rolledBack = ""
+	if rollback {
+		cg.rolledBack = old
+	}
 	cg.value = v
+	cg.markReadyLocked()
+	cg.checkDuplicate(v)
+	cg.lastChange = cg.now()
+	cg.rotated(cg.lastChange)
+	event.Time = cg.lastChange
+	metrics.IncHotloadChangesCounter(cg.name)
+	cg.decide(RotationApplied, old, v)
+	return event
 }
 
 func (cg *chanGroup) resetConnections() {
-	for _, c := range cg.conns {
+	cg.trace("resetting", len(cg.conns), "connections with policy", cg.resetPolicy)
+	if cg.resetPolicy == ResetPolicySoft {
+		// existing connections keep using the previous value
+		return
+	}
+	// new connections get a new tunnel, the old one is torn down once the
+	// reset connections are closed
+	cg.tunnel.retire()
+	cg.resetConns(cg.conns)
+
+	cg.conns = make([]*managedConn, 0)
+	cg.connsChanged(cg.resetReason())
+}
+
+// resetReason returns the reason connections reset with the reset policy are
+// dropped with.
+func (cg *chanGroup) resetReason() CloseReason {
+	switch cg.resetPolicy {
+	case ResetPolicyForce:
+		return CloseReasonForce
+	case ResetPolicyDrain:
+		return CloseReasonDrain
+	}
+	return CloseReasonLazy
+}
+
+// resetConns resets conns according to the reset policy, which is not soft.
+// The caller removes them from cg.conns. cg.mu must be held.
+func (cg *chanGroup) resetConns(conns []*managedConn) {
+	var closing []*managedConn
+	for _, c := range conns {
 		c.Reset(true)
 
-		if cg.forceKill {
-			// ignore errors from close
-			c.Close()
+		switch cg.resetPolicy {
+		case ResetPolicyForce:
+			// the group is dropping the connection, so it must not call back
+			// into cg.remove which would deadlock on cg.mu
+			c.detach()
+			c.setCloseReason(CloseReasonForce)
+			closing = append(closing, c)
+		case ResetPolicyDrain:
+			c.detach()
+			c.setCloseReason(CloseReasonDrain)
+			cg.trace("draining connection")
+			if c.drainWhenIdle() {
+				closing = append(closing, c)
+			}
 		}
 	}
+	cg.closeConns(closing)
+	cg.keepStale(conns)
+}
 
-	cg.conns = make([]*managedConn, 0)
+// connsChanged updates the connections gauge of the group and queues the
+// hooks to fire if the group became active or idle, the latter with reason,
+// why the connections were closed or dropped. Callers must hold cg.mu and
+// call fireConnsHooks once they released it.
+func (cg *chanGroup) connsChanged(reason CloseReason) {
+	metrics.SetHotloadConnections(cg.name, len(cg.conns))
+	if active := len(cg.conns) > 0; active != cg.connsActive {
+		cg.connsActive = active
+		if active {
+			reason = ""
+		}
+		cg.connsTransitions = append(cg.connsTransitions, connsTransition{active: active, reason: reason})
+		if active {
+			cg.disarmIdleWatcher()
+		} else {
+			cg.armIdleWatcher()
+		}
+	}
 }
 
+// mergeConnectionStringOptions sets options in the query of the URL style
+// connection string dsn. Connection strings hotload cannot merge into
+// without changing their meaning are rejected with an error wrapping
+// ErrMalformedConnectionString, without options dsn is returned unchanged.
 func mergeConnectionStringOptions(dsn string, options map[string]string) (string, error) {
 	if len(options) == 0 {
 		return dsn, nil
 	}
-	u, err := url.ParseRequestURI(dsn)
-	if err != nil {
-		return "", fmt.Errorf("unable to parse connection string when specifying extra driver options: %v", err)
+	// only the query is rewritten, the rest of the connection string, e.g. a
+	// bracketed IPv6 host, is kept verbatim
+	d, ok := splitDSNURL(dsn)
+	if !ok {
+		return "", fmt.Errorf("unable to parse connection string when specifying extra driver options: %w", ErrMalformedConnectionString)
+	}
+	if d.ambiguousUserinfo() {
+		// e.g. postgres://app:pa?ss@db/app, the query would be rewritten
+		// with the password in it
+		return "", fmt.Errorf("unable to parse connection string when specifying extra driver options: %w: unescaped ? or # before the host", ErrMalformedConnectionString)
 	}
-	values, err := url.ParseQuery(u.RawQuery)
+	values, err := url.ParseQuery(d.query)
 	if err != nil {
-		return "", fmt.Errorf("unable to parse query options in connection string when specifying extra driver options: %v", err)
+		return "", fmt.Errorf("unable to parse query options in connection string when specifying extra driver options: %w: %w", ErrMalformedConnectionString, err)
 	}
 	for k, v := range options {
+		if k == "" {
+			return "", errors.New("unable to specify extra driver options: empty option name")
+		}
 		values.Set(k, v)
 	}
-	u.RawQuery = values.Encode()
-	return u.String(), nil
+	d.query, d.hasQuery = values.Encode(), true
+	return d.String(), nil
 }
 
+// openDriver opens a connection with the underlying driver, or its connection
+// factory with ctx, through the tunnel of the group if it has one. A
+// connection a misbehaving driver returns along with an error is closed, it
+// would leak otherwise. release must be called once the connection is closed.
+func (cg *chanGroup) openDriver(ctx context.Context, dsn string) (conn driver.Conn, release func(), err error) {
+	dsn, release, err = cg.tunnel.acquire(dsn)
+	if err != nil {
+		return nil, nil, err
+	}
+	if conn, err = cg.callDriver(ctx, dsn); err != nil {
+		release()
+		return nil, nil, err
+	}
+	return conn, release, nil
+}
+
+// callDriver opens a connection with dsn for openDriver. A panic of the
+// driver is recovered and returned as an error wrapping ErrDriverPanic, so a
+// buggy driver fails the open instead of crashing the process while
+// database/sql and hotload hold their locks.
+func (cg *chanGroup) callDriver(ctx context.Context, dsn string) (conn driver.Conn, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			// the panic value may quote the connection string
+			msg := strings.ReplaceAll(fmt.Sprint(r), dsn, cg.redact(dsn))
+			cg.log("recovered panic of driver", cg.driverName, "opening a connection for location", cg.name, msg, "\n"+string(debug.Stack()))
+			conn, err = nil, fmt.Errorf("%w: %s", ErrDriverPanic, msg)
+		}
+	}()
+	if cg.sqlDriver.open != nil {
+		conn, err = cg.sqlDriver.open(ctx, dsn)
+	} else {
+		conn, err = cg.sqlDriver.driver.Open(dsn)
+	}
+	if err != nil && conn != nil {
+		conn.Close()
+		conn = nil
+	}
+	return conn, err
+}
+
+// Open opens a connection with the current connection information. The
+// underlying driver is called without holding cg.mu, so opens do not hold up
+// changes and run concurrently up to maxConcurrentOpens.
 func (cg *chanGroup) Open() (driver.Conn, error) {
+	cg.inFlight.Add(1)
+	defer cg.inFlight.Add(-1)
+	return cg.open(context.Background())
+}
+
+// open is Open for the connector, reqCtx is the context of Connect that the
+// options of WithContextOptions are derived from. The caller counts the open
+// in inFlight.
+func (cg *chanGroup) open(reqCtx context.Context) (driver.Conn, error) {
+	if cg.openSem != nil {
+		select {
+		case cg.openSem <- struct{}{}:
+		case <-reqCtx.Done():
+			return nil, reqCtx.Err()
+		}
+		defer func() { <-cg.openSem }()
+	}
+
 	cg.mu.Lock()
-	defer cg.mu.Unlock()
-	dsn, err := mergeConnectionStringOptions(cg.value, cg.sqlDriver.options)
+	if cg.closing {
+		cg.mu.Unlock()
+		return nil, ErrShuttingDown
+	}
+	ctx, rampGen := cg.ctx, cg.canary.gen
+	dsn, readOnly, previous, err := cg.openDSN(reqCtx)
+	initSQL := cg.initSQL
+	cg.mu.Unlock()
 	if err != nil {
 		return nil, err
 	}
-	conn, err := cg.sqlDriver.driver.Open(dsn)
+	conn, release, err := cg.openDriver(ctx, dsn)
+	for attempt := 0; err != nil && attempt < cg.retry.retries; attempt++ {
+		delay := cg.retry.delay(attempt)
+		cg.trace("failed to open connection to", cg.redact(dsn), err, "retrying in", delay)
+		// mu is not held, the wait ends with the context of Connect
+		select {
+		case <-time.After(delay):
+		case <-reqCtx.Done():
+			cg.trace("stopped retrying to open connection to", cg.redact(dsn), reqCtx.Err())
+			return nil, cg.openError(dsn, err)
+		}
+		cg.mu.Lock()
+		ctx, rampGen = cg.ctx, cg.canary.gen
+		dsn, readOnly, previous, err = cg.openDSN(reqCtx)
+		initSQL = cg.initSQL
+		cg.mu.Unlock()
+		if err != nil {
+			return nil, err
+		}
+		conn, release, err = cg.openDriver(ctx, dsn)
+	}
+	if err == nil {
+		if err = runInitSQL(reqCtx, conn, initSQL); err != nil {
+			conn.Close()
+			release()
+		}
+	}
+	if err == nil {
+		conn = cg.wrapConn(conn)
+	}
 	if err != nil {
-		return conn, err
+		cg.trace("failed to open connection to", cg.redact(dsn), err)
+		return nil, cg.openError(dsn, err)
 	}
 
-	manConn := newManagedConn(cg.ctx, conn, cg.remove)
+	defer cg.fireConnsHooks()
+	cg.mu.Lock()
+	defer cg.mu.Unlock()
+	if cg.closing {
+		// Shutdown started while opening
+		conn.Close()
+		release()
+		return nil, ErrShuttingDown
+	}
+	// ctx is the context current when dsn was picked, if the value changed
+	// while opening the connection is already stale
+	manConn := newManagedConn(ctx, cg.name, conn, cg.remove)
+	manConn.created = cg.now()
+	manConn.trace = cg.trace
+	manConn.release = release
+	manConn.rotation = &cg.rotationWindow
+	manConn.clock = cg.now
+	manConn.closeDrained = func(c *managedConn) { cg.closeConns([]*managedConn{c}) }
+	if readOnly {
+		manConn.writeKeywords = cg.readOnly.writeKeywords()
+	}
+	if previous {
+		if rampGen == cg.canary.gen && cg.canary.from != "" {
+			// reset by endRamp
+			manConn.rampGen = rampGen
+		} else if cg.resetPolicy != ResetPolicySoft {
+			// the ramp completed while opening
+			manConn.Reset(true)
+		}
+	}
 	cg.conns = append(cg.conns, manConn)
+	cg.connsChanged("")
+	cg.log("opened connection for location", cg.name)
+	cg.trace("opened connection to", cg.redact(dsn), "open connections:", len(cg.conns))
 
 	return manConn, nil
 }
 
-func (cg *chanGroup) remove(conn *managedConn) {
+// openError counts a failed open and wraps the error of the driver opening
+// dsn with the location it came from, so errors of applications with
+// several databases can be told apart. The connection string itself is
+// only identified by its hash.
+func (cg *chanGroup) openError(dsn string, err error) error {
+	metrics.IncHotloadOpenFailuresCounter(cg.name)
+	strategy, _, _ := strings.Cut(cg.name, "://")
+	return fmt.Errorf("hotload: could not open %s (strategy %s, driver %s, hash %s): %w",
+		cg.name, strategy, cg.driverName, HashValue(dsn), err)
+}
+
+// openDSN returns the connection string for a new connection opened for
+// reqCtx, whether the connection is read-only and whether it uses the
+// previous value of a ramp. Callers must hold cg.mu.
+func (cg *chanGroup) openDSN(reqCtx context.Context) (dsn string, readOnly, previous bool, err error) {
+	v, previous := cg.canary.pick(cg.value, cg.now())
+	dsn, readOnly, err = cg.dsnFor(v)
+	if err != nil {
+		return "", false, false, err
+	}
+	dsn, err = cg.mergeContextOptions(reqCtx, dsn)
+	return dsn, readOnly, previous, err
+}
+
+// dsnFor returns the connection string to open for the connection
+// information v and whether it is read-only. Callers must hold cg.mu.
+func (cg *chanGroup) dsnFor(v string) (string, bool, error) {
+	v, readOnly := cg.readOnly.split(v)
+	if n := cg.driverNormalizer(); n != nil {
+		v = n(v)
+	}
+	v, err := cg.driverPooler().rewrite(v)
+	if err != nil {
+		return "", false, err
+	}
+	dsn, err := cg.mergeDriverOptions(v)
+	return dsn, readOnly, err
+}
+
+// validate runs the DSN validator of the group's driver on v, without the
+// hotload directives it may contain.
+func (cg *chanGroup) validate(v string) error {
+	v, _ = cg.readOnly.split(v)
+	return Validate(cg.driverName, v)
+}
+
+func (cg *chanGroup) remove(conn *managedConn, reason CloseReason) {
+	defer cg.fireConnsHooks()
 	cg.mu.Lock()
 	defer cg.mu.Unlock()
 	for i, c := range cg.conns {
 		if c == conn {
 			cg.conns = append(cg.conns[:i], cg.conns[i+1:]...)
+			cg.connsChanged(reason)
+			cg.trace("closed connection, open connections:", len(cg.conns))
 			return
 		}
 	}
+	// a stale connection, closed by database/sql
+	cg.keepStale(nil)
 }
 
 func (cg *chanGroup) parseValues(vs url.Values) {
 	cg.mu.Lock()
 	defer cg.mu.Unlock()
 	cg.log("parsing values", vs)
+	cg.parseResetOptions(vs)
+	if v, ok := vs[expandEnvKey]; ok {
+		firstValue := v[0]
+		cg.expandEnv = firstValue == "true" || firstValue == "strict"
+		cg.strictEnv = firstValue == "strict"
+		cg.log("expandEnv set to", firstValue)
+	}
+	if v, ok := vs[debugKey]; ok {
+		cg.debug = v[0] == "true"
+		cg.log("debug set to", v[0])
+	}
+	cg.parseIgnoreBlank(vs)
+	cg.parseCanary(vs)
+	cg.parseOpenRetry(vs)
+	cg.parseReadOnly(vs)
+	cg.parseCertFiles(vs)
+	cg.parseTransforms(vs)
+	cg.parseHistoryDepth(vs)
+	cg.parseFlapGuard(vs)
+	cg.parseRotateLimit(vs)
+	cg.parseRotateSchedule(vs)
+	cg.parseHealthGate(vs)
+	cg.parseRotationWindow(vs)
+	cg.parseMaxValueSize(vs)
+	cg.parseInitSQL(vs)
+	cg.parseStabilize(vs)
+	cg.parseShard(vs)
+	cg.parseIdleWatcherTimeout(vs)
+	cg.parseCloseTimeout(vs)
+	cg.parseChannelBuffer(vs)
+	cg.parseDSNParts(vs)
+	cg.parseTunnel(vs)
+	cg.parseAppName(vs)
+	if v := vs.Get(maxConcurrentOpensKey); v != "" {
+		if n, err := strconv.Atoi(v); err == nil && n > 0 {
+			cg.openSem = make(chan struct{}, n)
+			cg.log("maxConcurrentOpens set to", n)
+		} else {
+			cg.log("invalid maxConcurrentOpens, ignoring", v)
+		}
+	}
+	if v, ok := vs[changeTimeFieldKey]; ok {
+		cg.changeTimeField = v[0]
+		cg.log("changeTimeField set to", v[0])
+	}
+	if v, ok := vs[normalize]; ok {
+		firstValue := v[0]
+		if n, ok := normalizers[firstValue]; ok {
+			cg.normalize = n
+			cg.log("normalize set to", firstValue)
+		} else {
+			cg.log("unknown normalize value, ignoring", firstValue)
+		}
+	}
+}
+
+// parseResetOptions sets the reset policy from the forceKill and resetPolicy
+// options, resetPolicy wins. cg.mu must be held.
+func (cg *chanGroup) parseResetOptions(vs url.Values) {
 	if v, ok := vs[forceKill]; ok {
 		firstValue := v[0]
-		cg.forceKill = firstValue == "true"
-		cg.log("forceKill set to true")
+		if firstValue == "true" {
+			cg.resetPolicy = ResetPolicyForce
+			cg.log("forceKill set to true")
+		}
+	}
+	if v, ok := vs[resetPolicy]; ok {
+		firstValue := v[0]
+		if p, ok := parseResetPolicy(firstValue); ok {
+			cg.resetPolicy = p
+			cg.log("resetPolicy set to", firstValue)
+		} else {
+			cg.log("unknown resetPolicy value, ignoring", firstValue)
+		}
 	}
 }
 
+// parseIgnoreBlank sets the ignoreBlank option. cg.mu must be held.
+func (cg *chanGroup) parseIgnoreBlank(vs url.Values) {
+	if v, ok := vs[ignoreBlankKey]; ok {
+		cg.ignoreBlank = v[0] == "true"
+		cg.log("ignoreBlank set to", v[0])
+	}
+}
+
+// resolveDriver finds the target driver of a hotload URL and its registered
+// name. If the driver query parameter is set it names the driver and the
+// host is only a logical name for the location, otherwise the host names the
+// driver. Callers must hold mu.
+func resolveDriver(host string, vs url.Values) (*driverInstance, string, bool) {
+	name := host
+	if v := vs.Get(driverKey); v != "" {
+		name = v
+	}
+	return lookupDriver(name)
+}
+
 func (h *hdriver) Open(name string) (driver.Conn, error) {
+	return h.openContext(context.Background(), name)
+}
+
+// openContext opens a connection of the location name for reqCtx, the
+// context of Connect, see chanGroup.open.
+func (h *hdriver) openContext(reqCtx context.Context, name string) (driver.Conn, error) {
 	uri, err := url.Parse(name)
 	if err != nil {
 		return nil, err
 	}
 	mu.Lock()
-	defer mu.Unlock()
+	cgroup, err := h.watch(reqCtx, name, uri)
+	if err != nil {
+		mu.Unlock()
+		return nil, err
+	}
+	// counted before mu is released so retireIdle does not retire the group
+	// while it is opened, opens of the group and of other locations then run
+	// concurrently
+	cgroup.inFlight.Add(1)
+	mu.Unlock()
+	defer cgroup.inFlight.Add(-1)
+	return cgroup.open(reqCtx)
+}
 
-	// look up in the chan group
-	cgroup, ok := h.cgroup[name]
-	if !ok {
-		strategy, ok := strategies[uri.Scheme]
-		if !ok {
-			return nil, ErrUnsupportedStrategy
+// watch returns the chanGroup of the hotload connection string name, starting
+// to watch its strategy if it is not watched yet. mu must be held. It is
+// released while the strategy is started and its initial value awaited, so
+// other locations open meanwhile, and held again when watch returns.
+// Concurrent watches of the location wait for the one starting it, or until
+// reqCtx is done.
+func (h *hdriver) watch(reqCtx context.Context, name string, uri *url.URL) (*chanGroup, error) {
+	for {
+		// look up in the chan group
+		if cgroup, ok := h.cgroup[name]; ok {
+			return cgroup, nil
 		}
-		sqlDriver, ok := sqlDrivers[uri.Host]
+		if h.ctx.Err() != nil {
+			return nil, ErrShuttingDown
+		}
+		started, ok := h.starting[name]
 		if !ok {
-			return nil, ErrUnknownDriver
+			break
+		}
+		// looked up again, the start may have failed
+		mu.Unlock()
+		select {
+		case <-started:
+		case <-reqCtx.Done():
+			mu.Lock()
+			return nil, reqCtx.Err()
 		}
-		queryParams := uri.Query()
-		value, values, err := strategy.Watch(h.ctx, uri.Path, queryParams)
+		mu.Lock()
+	}
+	var ws watchStart
+	var ok bool
+	ws.queryParams, ws.options = splitParams(uri.Query())
+	ws.strategy, ok = strategies[uri.Scheme]
+	switch uri.Scheme {
+	case valueStrategyName:
+		ws.strategy, ok = fixedValues, true
+	case consensusStrategyName:
+		wait := initialValueTimeout(ws.queryParams, func(...interface{}) {}) > 0
+		c, err := newConsensus(ws.options, wait)
 		if err != nil {
 			return nil, err
 		}
-		ctx, cancel := context.WithCancel(h.ctx)
-		cgroup = &chanGroup{
-			value:     value,
-			values:    values,
-			parentCtx: h.ctx,
-			ctx:       ctx,
-			cancel:    cancel,
-			sqlDriver: sqlDriver,
-			conns:     make([]*managedConn, 0),
-			log:       GetLogger(),
+		ws.strategy, ok = c, true
+	}
+	if !ok {
+		return nil, ErrUnsupportedStrategy
+	}
+	ws.sqlDriver, ws.driverName, ok = resolveDriver(uri.Host, ws.queryParams)
+	if !ok {
+		// not cached, the driver is looked up again on the next open so
+		// a driver registered late, e.g. due to init ordering, is found
+		return nil, ErrUnknownDriver
+	}
+	// e.g. fsnotify://postgres/fsnotify://postgres/etc/db/dsn
+	ws.nested = newNestedCheck()
+	if err := ws.nested.check(strings.TrimPrefix(uri.Path, "/")); err != nil {
+		return nil, err
+	}
+	ws.imported, ws.hasImported = h.importedValue(name)
+
+	started := make(chan struct{})
+	h.starting[name] = started
+	defer func() {
+		delete(h.starting, name)
+		close(started)
+	}()
+	mu.Unlock()
+	cgroup, err := h.startWatch(name, uri, ws)
+	mu.Lock()
+	if err != nil {
+		return nil, err
+	}
+	if h.ctx.Err() != nil {
+		// Shutdown stopped the watch meanwhile
+		cgroup.cancel()
+		cgroup.stopWatch()
+		return nil, ErrShuttingDown
+	}
+	h.cgroup[name] = cgroup
+	delete(h.imported, name)
+	cgroup.idleWatcher.retire = func(gen int) { h.retireIdle(cgroup, gen) }
+	cgroup.mu.Lock()
+	cgroup.armIdleWatcher()
+	cgroup.mu.Unlock()
+	cgroup.checkDuplicate(cgroup.value)
+	h.startRun(cgroup)
+	if len(cgroup.certFiles) > 0 {
+		go cgroup.watchCerts()
+	}
+	if cgroup.rotateSchedule.schedule != nil {
+		go cgroup.watchSchedule()
+	}
+	return cgroup, nil
+}
+
+// watchStart is what watch looks up in the registries under mu to start
+// watching a location.
+type watchStart struct {
+	strategy    Strategy
+	queryParams url.Values
+	options     url.Values
+	sqlDriver   *driverInstance
+	driverName  string
+	nested      nestedCheck
+	// imported is the value of ImportState for the location, if hasImported
+	imported    string
+	hasImported bool
+}
+
+// startWatch starts to watch the strategy of the location name and returns
+// its chanGroup, with the initial value prepared but not registered yet. mu
+// is not held, the strategy may be slow to start or to send its initial
+// value.
+func (h *hdriver) startWatch(name string, uri *url.URL, ws watchStart) (*chanGroup, error) {
+	strategy, options, queryParams := ws.strategy, ws.options, ws.queryParams
+	// the watch of the location alone, stopped once it is idle
+	watchCtx, stopWatch := context.WithCancel(h.ctx)
+	value, values, err := strategy.Watch(watchCtx, uri.Path, options)
+	watchErr := err
+	if err != nil {
+		if !ws.hasImported {
+			stopWatch()
+			return nil, err
+		}
+		// watched again with backoff by coalesce
+		GetLogger()("could not watch strategy of location", name, err, "resuming with imported connection information")
+		closed := make(chan string)
+		close(closed)
+		value, values, err = "", closed, nil
+	}
+	if !ws.hasImported {
+		value, err = waitInitialValue(h.ctx, value, values, initialValueTimeout(queryParams, GetLogger()))
+		if err != nil {
+			stopWatch()
+			return nil, err
+		}
+	}
+	ctx, cancel := context.WithCancel(watchCtx)
+	var clk clock = realClock{}
+	if h.clock != nil {
+		clk = h.clock
+	}
+	cgroup := &chanGroup{
+		name:        name,
+		value:       value,
+		values:      values,
+		parentCtx:   watchCtx,
+		stopWatch:   stopWatch,
+		ctx:         ctx,
+		cancel:      cancel,
+		sqlDriver:   ws.sqlDriver,
+		driverName:  ws.driverName,
+		resetPolicy: ResetPolicyLazy,
+		clock:       clk,
+		nested:      ws.nested,
+		conns:       make([]*managedConn, 0),
+		log:         GetLogger(),
+	}
+	cgroup.lastFetch = cgroup.now()
+	cgroup.lastChange = cgroup.lastFetch
+	cgroup.parseValues(queryParams)
+	cgroup.parseURLDirectives(queryParams)
+	if value == "" && ws.hasImported {
+		// prepared by the exporting process already
+		cgroup.value = ws.imported
+	} else {
+		var directives string
+		cgroup.value, directives, err = cgroup.prepareValue(value)
+		cgroup.noteDirectives(cgroup.value, directives)
+		cgroup.applyDirectives(directives)
+	}
+	if err == nil {
+		err = cgroup.checkHost(cgroup.value)
+	}
+	if err == nil {
+		err = cgroup.initOverride()
+	}
+	if err != nil {
+		cancel()
+		stopWatch()
+		return nil, err
+	}
+	var rewatch rewatchFunc
+	if rw, ok := strategy.(Rewatcher); ok {
+		rewatch = func(ctx context.Context) (string, <-chan string, error) {
+			return rw.Rewatch(ctx, uri.Path, options)
+		}
+	} else if watchErr != nil {
+		rewatch = func(ctx context.Context) (string, <-chan string, error) {
+			return strategy.Watch(ctx, uri.Path, options)
 		}
-		cgroup.parseValues(queryParams)
-		h.cgroup[name] = cgroup
-		go cgroup.run()
 	}
-	return cgroup.Open()
+	cgroup.values = coalesce(watchCtx, name, values, rewatch, cgroup.log, &cgroup.buffer)
+	cgroup.trace("watching", uri.Path, "with strategy", uri.Scheme, "initial value", cgroup.redact(cgroup.value))
+	return cgroup, nil
+}
+
+// startRun starts the run loop of cg, tracked for Shutdown.
+func (h *hdriver) startRun(cg *chanGroup) {
+	h.runs.Add(1)
+	go func() {
+		defer h.runs.Done()
+		cg.run()
+	}()
 }
 
 // Deprecated: Use logger.WithLogger() instead, retained for backwards-compatibility only
@@ -1,9 +1,12 @@
 package hotload_test
 
 import (
+	"context"
 	"database/sql"
 	"database/sql/driver"
+	"errors"
 	"os"
+	"runtime"
 
 	"github.com/DATA-DOG/go-sqlmock"
 	"github.com/infobloxopen/hotload"
@@ -57,6 +60,93 @@ var _ = Describe("Driver", func() {
 		})
 	})
 
+	Context("RegisterSQLDriverFunc", func() {
+		It("Should panic on nil func or a name already in use", func() {
+			Expect(func() { hotload.RegisterSQLDriverFunc("", nil) }).
+				To(PanicWith(MatchRegexp("Register driver func is nil")))
+			fn := func(ctx context.Context, dsn string) (driver.Conn, error) { return nil, nil }
+			Expect(func() { hotload.RegisterSQLDriverFunc("sqlmock", fn) }).
+				To(PanicWith(MatchRegexp("Register called twice for driver")))
+		})
+
+		It("Should open connections with the func", func() {
+			target := getRandomDriver()
+			var dsns []string
+			hotload.RegisterSQLDriverFunc("sqlmockfunc", func(ctx context.Context, dsn string) (driver.Conn, error) {
+				Expect(ctx).ToNot(BeNil())
+				dsns = append(dsns, dsn)
+				return target.Open(dsn)
+			})
+			db, err := sql.Open("hotload", "fsnotify://sqlmockfunc"+configFile)
+			Expect(err).ToNot(HaveOccurred())
+			defer db.Close()
+			Expect(db.Ping()).ToNot(HaveOccurred())
+			Expect(dsns).To(ConsistOf("user=pqgotest dbname=pqgotest sslmode=verify-full"))
+		})
+
+		It("Should open IPv6 connection strings unchanged besides the driver options", func() {
+			var dsns []string
+			hotload.RegisterSQLDriverFunc("sqlmockipv6", func(ctx context.Context, dsn string) (driver.Conn, error) {
+				dsns = append(dsns, dsn)
+				return nil, errors.New("no database")
+			}, hotload.WithDriverOptions(map[string]string{"sslmode": "require"}))
+			for _, v := range []string{
+				"postgres://app:pw@[::1]:5432/app",
+				"postgres://app@[fe80::1%25eth0]:5432/app?connect_timeout=5",
+				"postgres://app@[fd00::1]:5432,[fd00::2]:5433/app",
+			} {
+				db, err := hotload.OpenWithValue("sqlmockipv6", v)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(db.Ping()).To(MatchError(ContainSubstring("no database")))
+				db.Close()
+			}
+			Expect(dsns).To(ContainElements(
+				"postgres://app:pw@[::1]:5432/app?sslmode=require",
+				"postgres://app@[fe80::1%25eth0]:5432/app?connect_timeout=5&sslmode=require",
+				"postgres://app@[fd00::1]:5432,[fd00::2]:5433/app?sslmode=require",
+			))
+		})
+	})
+
+	Context("RegisterDriverAlias", func() {
+		It("Should open connections of the target through the alias", func() {
+			target := getRandomDriver()
+			var dsns []string
+			hotload.RegisterDriverAlias("sqlmockalias", "sqlmockaliastarget")
+			hotload.RegisterSQLDriverFunc("sqlmockaliastarget", func(ctx context.Context, dsn string) (driver.Conn, error) {
+				dsns = append(dsns, dsn)
+				return target.Open(dsn)
+			})
+			Expect(hotload.RequireRegistered([]string{"sqlmockalias"}, nil)).To(Succeed())
+
+			db, err := sql.Open("hotload", "fsnotify://sqlmockalias"+configFile)
+			Expect(err).ToNot(HaveOccurred())
+			defer db.Close()
+			Expect(db.Ping()).ToNot(HaveOccurred())
+			Expect(dsns).To(HaveLen(1))
+			Expect(hotload.SQLDrivers()).ToNot(ContainElement("sqlmockalias"))
+		})
+
+		It("Should not resolve aliases of unregistered drivers", func() {
+			hotload.RegisterDriverAlias("sqlmockdangling", "not-registered")
+			Expect(hotload.RequireRegistered([]string{"sqlmockdangling"}, nil)).To(MatchError(hotload.ErrUnknownDriver))
+			_, err := hotload.OpenWithValue("sqlmockdangling", "user=pqgotest")
+			Expect(err).To(MatchError(hotload.ErrUnknownDriver))
+		})
+
+		It("Should panic on conflicting names", func() {
+			Expect(func() { hotload.RegisterDriverAlias("sqlmock", "postgres") }).
+				To(PanicWith(MatchRegexp("called with the name of driver sqlmock")))
+			hotload.RegisterDriverAlias("sqlmockconflict", "sqlmock")
+			Expect(func() { hotload.RegisterDriverAlias("sqlmockconflict", "sqlmock") }).
+				To(PanicWith(MatchRegexp("called twice for alias sqlmockconflict")))
+			Expect(func() { hotload.RegisterSQLDriver("sqlmockconflict", getRandomDriver()) }).
+				To(PanicWith(MatchRegexp("name of driver alias sqlmockconflict")))
+			Expect(func() { hotload.RegisterDriverAlias("pg", "pg") }).
+				To(PanicWith(MatchRegexp("alias and target are both pg")))
+		})
+	})
+
 	Context("RegisterStrategy", func() {
 		It("Should panic when registering the same strategy twice", func() {
 			strat := fsnotify.NewStrategy()
@@ -70,6 +160,51 @@ var _ = Describe("Driver", func() {
 		})
 	})
 
+	Context("RequireRegistered", func() {
+		It("Should succeed when everything is registered", func() {
+			Expect(hotload.RequireRegistered([]string{"sqlmock"}, []string{"fsnotify"})).To(Succeed())
+			Expect(hotload.RequireRegistered(nil, nil)).To(Succeed())
+		})
+
+		It("Should list what is missing", func() {
+			err := hotload.RequireRegistered([]string{"sqlmock", "mysql", "pgx"}, []string{"fsnotify", "vault"})
+			Expect(err).To(MatchError(hotload.ErrUnknownDriver))
+			Expect(err).To(MatchError(hotload.ErrUnsupportedStrategy))
+			Expect(err.Error()).To(ContainSubstring("mysql, pgx"))
+			Expect(err.Error()).To(ContainSubstring("vault"))
+			Expect(err.Error()).ToNot(ContainSubstring("sqlmock"))
+
+			err = hotload.RequireRegistered(nil, []string{"vault"})
+			Expect(err).ToNot(MatchError(hotload.ErrUnknownDriver))
+		})
+	})
+
+	Context("Driver", func() {
+		It("Should return the driver registered with database/sql", func() {
+			db, err := sql.Open("hotload", "fsnotify://sqlmock"+configFile)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(db.Driver()).To(BeIdenticalTo(hotload.Driver()))
+			Expect(db.Ping()).ToNot(HaveOccurred())
+			Expect(hotload.Driver().Stats()).To(HaveKey("fsnotify://sqlmock" + configFile))
+		})
+
+		It("Should open a connector for the location", func() {
+			c, err := hotload.Driver().OpenConnector("fsnotify://sqlmock" + configFile)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(c.Driver()).To(BeIdenticalTo(hotload.Driver()))
+			db := sql.OpenDB(c)
+			defer db.Close()
+			Expect(db.Ping()).ToNot(HaveOccurred())
+		})
+
+		It("Should return location errors from the connector", func() {
+			c, err := hotload.Driver().OpenConnector("sqlmaybe://sqlmock" + configFile)
+			Expect(err).ToNot(HaveOccurred())
+			_, err = c.Connect(context.Background())
+			Expect(err).To(MatchError(hotload.ErrUnsupportedStrategy))
+		})
+	})
+
 	Context("Open", func() {
 		It("Should throw an error with unknown driver", func() {
 			db, err := sql.Open("hotload", "fsnotify://sqlmaybe?"+configFile)
@@ -87,6 +222,28 @@ var _ = Describe("Driver", func() {
 			Expect(db.Ping()).ToNot(HaveOccurred())
 		})
 
+		It("Should resolve the driver from the driver query parameter", func() {
+			db, err := sql.Open("hotload", "fsnotify://orders"+configFile+"?driver=sqlmock")
+			Expect(err).ToNot(HaveOccurred())
+
+			Expect(db.Ping()).ToNot(HaveOccurred())
+		})
+
+		It("Should throw an error with an unknown driver query parameter", func() {
+			db, err := sql.Open("hotload", "fsnotify://sqlmock"+configFile+"?driver=sqlmaybe")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(db.Ping()).To(MatchError(hotload.ErrUnknownDriver))
+		})
+
+		It("Should find a driver registered after a failed open", func() {
+			db, err := sql.Open("hotload", "fsnotify://late"+configFile)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(db.Ping()).To(MatchError(hotload.ErrUnknownDriver))
+
+			hotload.RegisterSQLDriver("late", getRandomDriver())
+			Expect(db.Ping()).ToNot(HaveOccurred())
+		})
+
 		It("Should throw an unsupported strategy error", func() {
 			db, err := sql.Open("hotload", "fstransmogrify://sqlmock/"+configFile)
 			err = db.Ping()
@@ -129,4 +286,69 @@ var _ = Describe("Driver", func() {
 		//	}()
 		//})
 	})
+
+	Context("OpenWithValue", func() {
+		It("Should throw an error with an unknown driver", func() {
+			_, err := hotload.OpenWithValue("sqlmaybe", "user=pqgotest")
+			Expect(err).To(MatchError(hotload.ErrUnknownDriver))
+		})
+
+		It("Should open the database with the fixed value", func() {
+			db, err := hotload.OpenWithValue("sqlmock", "user=pqgotest dbname=pqgotest sslmode=verify-full")
+			Expect(err).ToNot(HaveOccurred())
+			defer db.Close()
+
+			Expect(db.Ping()).ToNot(HaveOccurred())
+		})
+
+		It("Should use the value set with SetValue", func() {
+			db, err := hotload.OpenWithValue("sqlmock", "user=pqgotest dbname=pqgotest sslmode=verify-full")
+			Expect(err).ToNot(HaveOccurred())
+			defer db.Close()
+			Expect(db.Ping()).ToNot(HaveOccurred())
+
+			_, mock, err := sqlmock.NewWithDSN("user=pqgotest dbname=setvalue sslmode=verify-full")
+			Expect(err).ToNot(HaveOccurred())
+			mock.ExpectExec("SELECT 1").WillReturnResult(sqlmock.NewResult(0, 0))
+			Expect(hotload.SetValue(db, "user=pqgotest dbname=setvalue sslmode=verify-full")).To(Succeed())
+
+			// the old connection has no expectations, Exec only succeeds once
+			// it was reset and the new value is used
+			Eventually(func() error {
+				_, err := db.Exec("SELECT 1")
+				return err
+			}).Should(Succeed())
+			Expect(mock.ExpectationsWereMet()).To(Succeed())
+		})
+
+		It("Should throw an error setting the value of a closed database", func() {
+			db, err := hotload.OpenWithValue("sqlmock", "user=pqgotest dbname=pqgotest sslmode=verify-full")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(db.Close()).To(Succeed())
+
+			Expect(hotload.SetValue(db, "user=pqgotest")).To(MatchError(hotload.ErrUnknownLocation))
+		})
+
+		It("Should stop the location once the database is closed", func() {
+			open := func() {
+				db, err := hotload.OpenWithValue("sqlmock", "user=pqgotest dbname=pqgotest sslmode=verify-full")
+				Expect(err).ToNot(HaveOccurred())
+				Expect(db.Ping()).ToNot(HaveOccurred())
+				// errors from closing the mock connection do not matter
+				db.Close()
+			}
+			open()
+			before := runtime.NumGoroutine()
+			for i := 0; i < 20; i++ {
+				open()
+			}
+			Eventually(runtime.NumGoroutine).Should(BeNumerically("<=", before+2))
+		})
+
+		It("Should throw an error setting the value of another database", func() {
+			db, err := sql.Open("hotload", "fsnotify://sqlmock"+configFile)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(hotload.SetValue(db, "user=pqgotest")).To(MatchError(hotload.ErrUnknownLocation))
+		})
+	})
 })
@@ -0,0 +1,97 @@
+package hotload
+
+import (
+	"net"
+	"net/url"
+	"sort"
+	"strings"
+)
+
+// dsnPartPrefix marks query parameters of the hotload connection string that
+// are parts of the connection string the driver is opened with, e.g.
+// dsn.host=db. Like control parameters they are not forwarded to strategies.
+const dsnPartPrefix = "dsn."
+
+// dsnSchemePart is the part that selects the URL form.
+const dsnSchemePart = "scheme"
+
+// dsnParts assembles the connection string from the structural parts given in
+// the hotload connection string and the credential delivered by the strategy,
+// so the source only holds the secret.
+type dsnParts struct {
+	parts map[string]string
+}
+
+// parseDSNParts reads the dsn. parameters. Without any the values of the
+// strategy are complete connection strings.
+func (cg *chanGroup) parseDSNParts(vs url.Values) {
+	parts := make(map[string]string)
+	for k, v := range vs {
+		if name, ok := strings.CutPrefix(k, dsnPartPrefix); ok && name != "" {
+			parts[name] = v[0]
+		}
+	}
+	if len(parts) == 0 {
+		return
+	}
+	cg.dsnParts = &dsnParts{parts: parts}
+	keys := make([]string, 0, len(parts))
+	for k := range parts {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	cg.log("assembling connection strings from", keys)
+}
+
+// assemble returns the connection string of the parts with secret as the
+// password. With a scheme part it is a URL, user, host, port and dbname form
+// the userinfo, authority and path, every other part the query:
+//
+//	postgres://app:secret@db:5432/orders?sslmode=require
+//
+// Otherwise it is a key/value connection string of the parts sorted by key,
+// followed by the password:
+//
+//	dbname=orders host=db port=5432 sslmode=require user=app password=secret
+//
+// Without parts secret is returned unchanged, an empty secret is no value.
+func (p *dsnParts) assemble(secret string) string {
+	if p == nil {
+		return secret
+	}
+	secret = strings.TrimSpace(secret)
+	if secret == "" {
+		return ""
+	}
+	if scheme, ok := p.parts[dsnSchemePart]; ok {
+		u := url.URL{Scheme: scheme, Host: p.parts["host"]}
+		if port := p.parts["port"]; port != "" {
+			u.Host = net.JoinHostPort(u.Host, port)
+		}
+		if db := p.parts["dbname"]; db != "" {
+			u.Path = "/" + db
+		}
+		u.User = url.UserPassword(p.parts["user"], secret)
+		q := url.Values{}
+		for k, v := range p.parts {
+			switch k {
+			case dsnSchemePart, "host", "port", "dbname", "user":
+			default:
+				q.Set(k, v)
+			}
+		}
+		u.RawQuery = q.Encode()
+		return u.String()
+	}
+	keys := make([]string, 0, len(p.parts))
+	for k := range p.parts {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	kvs := make([]string, 0, len(keys)+1)
+	for _, k := range keys {
+		kvs = append(kvs, k+"="+quoteKeyValue(p.parts[k]))
+	}
+	kvs = append(kvs, "password="+quoteKeyValue(secret))
+	return strings.Join(kvs, " ")
+}
@@ -0,0 +1,82 @@
+package hotload
+
+import (
+	"net/url"
+	"testing"
+
+	"github.com/infobloxopen/hotload/logger"
+)
+
+func Test_dsnParts_assemble(t *testing.T) {
+	tests := []struct {
+		name   string
+		parts  map[string]string
+		secret string
+		want   string
+	}{
+		{
+			name:   "key/value",
+			parts:  map[string]string{"host": "db", "port": "5432", "dbname": "orders", "user": "app", "sslmode": "require"},
+			secret: "s3cret\n",
+			want:   "dbname=orders host=db port=5432 sslmode=require user=app password=s3cret",
+		},
+		{
+			name:   "key/value quoting",
+			parts:  map[string]string{"host": "db", "application_name": "order service"},
+			secret: `it's`,
+			want:   `application_name='order service' host=db password='it\'s'`,
+		},
+		{
+			name:   "url",
+			parts:  map[string]string{"scheme": "postgres", "host": "db", "port": "5432", "dbname": "orders", "user": "app", "sslmode": "require"},
+			secret: "s3cret",
+			want:   "postgres://app:s3cret@db:5432/orders?sslmode=require",
+		},
+		{
+			name:   "url escaping",
+			parts:  map[string]string{"scheme": "postgres", "host": "fd00::1", "port": "5432", "user": "app"},
+			secret: "p@ss/word",
+			want:   "postgres://app:p%40ss%2Fword@[fd00::1]:5432",
+		},
+		{
+			name:   "empty secret",
+			parts:  map[string]string{"host": "db"},
+			secret: " \n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := &dsnParts{parts: tt.parts}
+			if got := p.assemble(tt.secret); got != tt.want {
+				t.Errorf("assemble() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+	var none *dsnParts
+	if got := none.assemble("host=db password=s3cret"); got != "host=db password=s3cret" {
+		t.Errorf("assemble() without parts = %q, want the value unchanged", got)
+	}
+}
+
+func TestDSNPartsFromLocation(t *testing.T) {
+	uri, err := url.Parse("fsnotify://postgres/run/secrets/db-password?dsn.host=db&dsn.dbname=orders&dsn.user=app&transforms=base64&requireNewline=true")
+	if err != nil {
+		t.Fatal(err)
+	}
+	control, options := splitParams(uri.Query())
+	for k := range options {
+		if k != "requireNewline" {
+			t.Errorf("splitParams() forwarded %s to the strategy", k)
+		}
+	}
+	cg := &chanGroup{log: logger.DefaultLogger}
+	cg.parseValues(control)
+	// transforms apply to the secret before the parts are assembled
+	got, _, err := cg.prepareValue("czNjcmV0")
+	if err != nil {
+		t.Fatalf("prepareValue() error = %v", err)
+	}
+	if want := "dbname=orders host=db user=app password=s3cret"; got != want {
+		t.Errorf("prepareValue() = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,115 @@
+package hotload
+
+import (
+	"net/url"
+	"strings"
+)
+
+// dsnURL is a URL style connection string split into its parts without
+// parsing the authority, so the bracketed IPv6 literals and multi-host lists
+// of e.g. postgres://[fd00::1]:5432,[fd00::2]:5432/app, which url.URL cannot
+// represent, survive verbatim. String reassembles the parts.
+type dsnURL struct {
+	// prefix is the scheme including ://
+	prefix string
+	// userinfo includes the trailing @, empty if there is none
+	userinfo string
+	hosts    string
+	path     string
+	// query is the raw query without the ?
+	query    string
+	hasQuery bool
+	// fragment includes the leading #, empty if there is none
+	fragment string
+}
+
+// splitDSNURL splits dsn, reporting false if it is not URL style.
+func splitDSNURL(dsn string) (dsnURL, bool) {
+	i := strings.Index(dsn, "://")
+	if i <= 0 || !validScheme(dsn[:i]) {
+		return dsnURL{}, false
+	}
+	d := dsnURL{prefix: dsn[:i+3]}
+	s := dsn[i+3:]
+	if j := strings.IndexByte(s, '#'); j >= 0 {
+		s, d.fragment = s[:j], s[j:]
+	}
+	if j := strings.IndexByte(s, '?'); j >= 0 {
+		s, d.query, d.hasQuery = s[:j], s[j+1:], true
+	}
+	if j := strings.IndexByte(s, '/'); j >= 0 {
+		s, d.path = s[:j], s[j:]
+	}
+	if j := strings.LastIndexByte(s, '@'); j >= 0 {
+		d.userinfo, s = s[:j+1], s[j+1:]
+	}
+	d.hosts = s
+	return d, true
+}
+
+func validScheme(s string) bool {
+	for i, c := range s {
+		switch {
+		case 'a' <= c && c <= 'z', 'A' <= c && c <= 'Z':
+		case i > 0 && ('0' <= c && c <= '9' || c == '+' || c == '-' || c == '.'):
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// ambiguousUserinfo reports whether the query or fragment of d look like
+// they hold a userinfo with an unescaped ? or #, an @ before the first of
+// the characters that separate or start query parameters and paths. The
+// authority of such connection strings has no userinfo, whatever follows
+// the ? or # is split off as the query or fragment.
+func (d dsnURL) ambiguousUserinfo() bool {
+	if d.userinfo != "" {
+		return false
+	}
+	for _, rest := range []string{d.query, strings.TrimPrefix(d.fragment, "#")} {
+		if i := strings.IndexAny(rest, "@=&/"); i >= 0 && rest[i] == '@' {
+			return true
+		}
+	}
+	return false
+}
+
+func (d dsnURL) String() string {
+	s := d.prefix + d.userinfo + d.hosts + d.path
+	if d.hasQuery {
+		s += "?" + d.query
+	}
+	return s + d.fragment
+}
+
+// hostnames returns the hosts of the authority without ports, brackets or
+// percent-encoding, e.g. fe80::1%eth0 for [fe80::1%25eth0]:5432.
+func (d dsnURL) hostnames() []string {
+	var hosts []string
+	for _, h := range strings.Split(d.hosts, ",") {
+		h = stripPort(h)
+		if unescaped, err := url.PathUnescape(h); err == nil {
+			h = unescaped
+		}
+		if h != "" {
+			hosts = append(hosts, h)
+		}
+	}
+	return hosts
+}
+
+// stripPort returns the host of host:port, [v6]:port or a bare host.
+func stripPort(hostport string) string {
+	if strings.HasPrefix(hostport, "[") {
+		if end := strings.IndexByte(hostport, ']'); end > 0 {
+			return hostport[1:end]
+		}
+		return hostport
+	}
+	if strings.Count(hostport, ":") == 1 {
+		hostport, _, _ = strings.Cut(hostport, ":")
+	}
+	return hostport
+}
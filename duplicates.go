@@ -0,0 +1,71 @@
+package hotload
+
+import (
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+var detectDuplicates atomic.Bool
+
+// SetDuplicateDetection turns on a warning, logged once per pair, when two
+// locations resolve to the same connection information, e.g. the same database
+// opened under two names or drivers. Each of them keeps its own pool, doubling
+// the connections to the database. It is off by default and only checks values
+// set while it is on.
+func SetDuplicateDetection(enabled bool) {
+	detectDuplicates.Store(enabled)
+}
+
+// dupIndex holds the fingerprint of the connection information of every
+// location.
+type dupIndex struct {
+	mu         sync.Mutex
+	byLocation map[string]string
+	warned     map[[2]string]bool
+}
+
+var duplicates = &dupIndex{
+	byLocation: make(map[string]string),
+	warned:     make(map[[2]string]bool),
+}
+
+// fingerprint hashes v without hotload directives, normalized like for change
+// detection so equivalent spellings of the same connection string match.
+func (cg *chanGroup) fingerprint(v string) string {
+	v, _ = cg.readOnly.split(v)
+	v = strings.TrimSpace(v)
+	if n := cg.driverNormalizer(); n != nil {
+		v = n(v)
+	} else if cg.normalize != nil {
+		v = cg.normalize(v)
+	}
+	return HashValue(v)
+}
+
+// checkDuplicate records v as the connection information of the group and
+// warns if another location uses the same.
+func (cg *chanGroup) checkDuplicate(v string) {
+	if !detectDuplicates.Load() || v == "" {
+		return
+	}
+	hash := cg.fingerprint(v)
+	d := duplicates
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.byLocation[cg.name] = hash
+	for other, h := range d.byLocation {
+		if other == cg.name || h != hash {
+			continue
+		}
+		pair := [2]string{other, cg.name}
+		if other > cg.name {
+			pair = [2]string{cg.name, other}
+		}
+		if d.warned[pair] {
+			continue
+		}
+		d.warned[pair] = true
+		cg.log("warning: locations", pair[0], "and", pair[1], "use the same connection information (hash", hash+"), the database is managed by two pools")
+	}
+}
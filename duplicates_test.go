@@ -0,0 +1,51 @@
+package hotload
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestCheckDuplicate(t *testing.T) {
+	detectDuplicates.Store(true)
+	defer detectDuplicates.Store(false)
+
+	var mu sync.Mutex
+	var warnings []string
+	log := func(args ...interface{}) {
+		mu.Lock()
+		defer mu.Unlock()
+		warnings = append(warnings, fmt.Sprintln(args...))
+	}
+	group := func(name string) *chanGroup {
+		return &chanGroup{name: name, log: log, sqlDriver: &driverInstance{normalizer: NormalizePostgres}}
+	}
+	a, b, c := group("dup-test://a"), group("dup-test://b"), group("dup-test://c")
+	defer func() {
+		duplicates.mu.Lock()
+		defer duplicates.mu.Unlock()
+		for name := range duplicates.byLocation {
+			if strings.HasPrefix(name, "dup-test://") {
+				delete(duplicates.byLocation, name)
+			}
+		}
+	}()
+
+	a.checkDuplicate("host=db dbname=app")
+	c.checkDuplicate("host=db dbname=other")
+	if len(warnings) != 0 {
+		t.Fatalf("warnings = %q, want none", warnings)
+	}
+	b.checkDuplicate("dbname=app  host=db")
+	b.checkDuplicate("dbname=app host=db")
+	if len(warnings) != 1 || !strings.Contains(warnings[0], "dup-test://a and dup-test://b") {
+		t.Fatalf("warnings = %q, want one for a and b", warnings)
+	}
+
+	// c moving to the same database pairs it with a and b
+	c.checkDuplicate("host=db dbname=app")
+	if len(warnings) != 3 {
+		t.Fatalf("warnings = %q, want one more for c with a and b each", warnings)
+	}
+}
@@ -0,0 +1,29 @@
+package hotload
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// ErrUndefinedEnv is returned when expandEnv=strict is set and the config
+// value references an environment variable that is not defined.
+var ErrUndefinedEnv = fmt.Errorf("undefined environment variable in connection string")
+
+// expandEnv replaces ${var} or $var in v with the value of the environment
+// variable. In strict mode referencing an undefined variable is an error,
+// otherwise it is replaced by the empty string like os.ExpandEnv.
+func expandEnv(v string, strict bool) (string, error) {
+	var missing []string
+	out := os.Expand(v, func(k string) string {
+		val, ok := os.LookupEnv(k)
+		if !ok {
+			missing = append(missing, k)
+		}
+		return val
+	})
+	if strict && len(missing) > 0 {
+		return "", fmt.Errorf("%w: %s", ErrUndefinedEnv, strings.Join(missing, ", "))
+	}
+	return out, nil
+}
@@ -0,0 +1,62 @@
+package hotload
+
+import (
+	"errors"
+	"os"
+	"testing"
+)
+
+func Test_expandEnv(t *testing.T) {
+	os.Setenv("HOTLOAD_TEST_DB_HOST", "db.example.com")
+	os.Setenv("HOTLOAD_TEST_DB_PORT", "6543")
+	defer os.Unsetenv("HOTLOAD_TEST_DB_HOST")
+	defer os.Unsetenv("HOTLOAD_TEST_DB_PORT")
+
+	tests := []struct {
+		name    string
+		value   string
+		strict  bool
+		want    string
+		wantErr error
+	}{
+		{
+			name:  "defined variables",
+			value: "postgres://${HOTLOAD_TEST_DB_HOST}:$HOTLOAD_TEST_DB_PORT/db",
+			want:  "postgres://db.example.com:6543/db",
+		},
+		{
+			name:  "no variables",
+			value: "user=a dbname=b",
+			want:  "user=a dbname=b",
+		},
+		{
+			name:  "missing variable is empty when not strict",
+			value: "host=${HOTLOAD_TEST_MISSING} dbname=b",
+			want:  "host= dbname=b",
+		},
+		{
+			name:    "missing variable is an error when strict",
+			value:   "host=${HOTLOAD_TEST_MISSING} dbname=b",
+			strict:  true,
+			wantErr: ErrUndefinedEnv,
+		},
+		{
+			name:   "defined variables when strict",
+			value:  "host=${HOTLOAD_TEST_DB_HOST}",
+			strict: true,
+			want:   "host=db.example.com",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := expandEnv(tt.value, tt.strict)
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("expandEnv() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if got != tt.want {
+				t.Errorf("expandEnv() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,104 @@
+// Package envfile implements a hotload strategy that reads the connection
+// string from a file, watched with fsnotify, unless a named environment
+// variable is set, in which case the environment variable takes precedence.
+// Clearing the environment variable reverts to the file contents.
+//
+// This is meant for local development where the file holds the team default
+// and individuals override it transiently:
+//
+//	db, err := sql.Open("hotload", "envfile://postgres/tmp/myconfig.txt?env=MY_DSN")
+package envfile
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"os"
+	"time"
+
+	"github.com/infobloxopen/hotload"
+	"github.com/infobloxopen/hotload/fsnotify"
+	"github.com/infobloxopen/hotload/logger"
+	"github.com/infobloxopen/hotload/metrics"
+	"github.com/infobloxopen/hotload/strategy"
+)
+
+func init() {
+	hotload.RegisterStrategy(strategyName, NewStrategy())
+}
+
+const strategyName = "envfile"
+
+// EnvKey is the query parameter naming the environment variable that
+// overrides the file contents.
+const EnvKey = "env"
+
+// ErrMissingEnv is returned by Watch when the env query parameter is not set.
+// It wraps strategy.ErrMissingOption.
+var ErrMissingEnv = fmt.Errorf("envfile: %w", strategy.MissingOption(EnvKey))
+
+var pollPeriod = time.Second
+
+// NewStrategy returns a strategy that watches files with fsnotify.
+func NewStrategy() *Strategy {
+	return &Strategy{
+		file: fsnotify.NewStrategy(),
+	}
+}
+
+// Strategy implements the hotload Strategy interface by combining an env
+// variable with a file watched by another strategy.
+type Strategy struct {
+	file hotload.Strategy
+}
+
+func current(env string, fileValue string) string {
+	if v, ok := os.LookupEnv(env); ok {
+		return v
+	}
+	return fileValue
+}
+
+// Watch implements the hotload.Strategy interface.
+func (s *Strategy) Watch(ctx context.Context, pth string, options url.Values) (value string, values <-chan string, err error) {
+	env := options.Get(EnvKey)
+	if env == "" {
+		return "", nil, ErrMissingEnv
+	}
+	fileValue, fileValues, err := s.file.Watch(ctx, pth, options)
+	if err != nil {
+		return "", nil, err
+	}
+	value = current(env, fileValue)
+	out := make(chan string)
+	go s.run(ctx, env, fileValue, value, fileValues, out)
+	return value, out, nil
+}
+
+func (s *Strategy) run(ctx context.Context, env, fileValue, last string, fileValues <-chan string, out chan<- string) {
+	metrics.IncHotloadWatchGoroutines(strategyName)
+	defer metrics.DecHotloadWatchGoroutines(strategyName)
+	log := logger.GetLogger()
+	ticker := time.NewTicker(pollPeriod)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case v := <-fileValues:
+			fileValue = v
+		case <-ticker.C:
+		}
+		v := current(env, fileValue)
+		if v == last {
+			continue
+		}
+		log("envfile: value changed for env", env)
+		select {
+		case out <- v:
+			last = v
+		case <-ctx.Done():
+			return
+		}
+	}
+}
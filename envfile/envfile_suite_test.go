@@ -0,0 +1,18 @@
+package envfile
+
+import (
+	"testing"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+func TestEnvfile(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Envfile Suite")
+}
+
+var _ = BeforeSuite(func() {
+	pollPeriod = 10 * time.Millisecond
+})
@@ -0,0 +1,72 @@
+package envfile
+
+import (
+	"context"
+	"net/url"
+	"os"
+	"time"
+
+	"github.com/infobloxopen/hotload/strategy"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Strategy", func() {
+	const env = "HOTLOAD_ENVFILE_TEST_DSN"
+	var (
+		pth    string
+		ctx    context.Context
+		cancel context.CancelFunc
+		opts   url.Values
+	)
+
+	BeforeEach(func() {
+		f, err := os.CreateTemp("", "envfile_")
+		Expect(err).ToNot(HaveOccurred())
+		f.WriteString("file")
+		f.Close()
+		pth = f.Name()
+		ctx, cancel = context.WithCancel(context.Background())
+		opts = url.Values{EnvKey: []string{env}}
+		os.Unsetenv(env)
+	})
+
+	AfterEach(func() {
+		cancel()
+		os.Unsetenv(env)
+		os.Remove(pth)
+	})
+
+	It("Should require the env query parameter", func() {
+		_, _, err := NewStrategy().Watch(ctx, pth, url.Values{})
+		Expect(err).To(MatchError(ErrMissingEnv))
+		Expect(err).To(MatchError(strategy.ErrMissingOption))
+	})
+
+	It("Should return the file contents when the env variable is not set", func() {
+		v, _, err := NewStrategy().Watch(ctx, pth, opts)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(v).To(Equal("file"))
+	})
+
+	It("Should prefer the env variable and revert to the file when cleared", func() {
+		os.Setenv(env, "env")
+		v, values, err := NewStrategy().Watch(ctx, pth, opts)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(v).To(Equal("env"))
+
+		os.Setenv(env, "env2")
+		Eventually(values).Should(Receive(Equal("env2")))
+
+		os.Unsetenv(env)
+		Eventually(values).Should(Receive(Equal("file")))
+	})
+
+	It("Should emit file changes when the env variable is not set", func() {
+		_, values, err := NewStrategy().Watch(ctx, pth, opts)
+		Expect(err).ToNot(HaveOccurred())
+
+		Expect(os.WriteFile(pth, []byte("file2"), 0660)).To(Succeed())
+		Eventually(values, 5*time.Second).Should(Receive(Equal("file2")))
+	})
+})
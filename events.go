@@ -0,0 +1,95 @@
+package hotload
+
+import (
+	"context"
+	"time"
+)
+
+// EventBufferSize is the capacity of the channels returned by Events.
+const EventBufferSize = 64
+
+// ChangeEvent describes a decision of the change pipeline on a value of the
+// strategy of a location, see RotationOutcome. Like AuditEvent it never
+// contains raw connection strings.
+type ChangeEvent struct {
+	Time     time.Time
+	Location string
+	// OldHash and NewHash identify the value in use and the value decided
+	// on without revealing them, see HashValue.
+	OldHash string
+	NewHash string
+	Outcome RotationOutcome
+}
+
+// eventStream is a channel returned by Events.
+type eventStream struct {
+	location string
+	ch       chan ChangeEvent
+}
+
+// eventStreams are the open streams, guarded by hooksMu. Events are sent
+// with hooksMu read locked, a stream is closed once it is removed.
+var eventStreams = make(map[*eventStream]bool)
+
+// Events returns a channel of the ChangeEvents of the location name, of all
+// locations if name is empty, that is closed once ctx is done. Publishing
+// never blocks the change pipeline: the channel buffers EventBufferSize
+// events, once it is full the oldest event is dropped for the newest one, so
+// a consumer that falls behind misses events rather than delaying rotations.
+//
+//	for e := range hotload.Events(ctx, "fsnotify://postgres/etc/db/dsn") {
+//		log.Println(e.Location, e.Outcome, e.NewHash)
+//	}
+func Events(ctx context.Context, name string) <-chan ChangeEvent {
+	s := &eventStream{location: name, ch: make(chan ChangeEvent, EventBufferSize)}
+	hooksMu.Lock()
+	eventStreams[s] = true
+	hooksMu.Unlock()
+	go func() {
+		<-ctx.Done()
+		hooksMu.Lock()
+		delete(eventStreams, s)
+		hooksMu.Unlock()
+		close(s.ch)
+	}()
+	return s.ch
+}
+
+// send delivers e, dropping the oldest buffered event if the channel is
+// full.
+func (s *eventStream) send(e ChangeEvent) {
+	for {
+		select {
+		case s.ch <- e:
+			return
+		default:
+		}
+		select {
+		case <-s.ch:
+		default:
+		}
+	}
+}
+
+// publishEvent sends the decision o on the change of the group from old to v
+// to the streams of the group. It is called with or without cg.mu held.
+func (cg *chanGroup) publishEvent(o RotationOutcome, old, v string) {
+	hooksMu.RLock()
+	defer hooksMu.RUnlock()
+	if len(eventStreams) == 0 {
+		// no hashing for the keepalives of polling strategies
+		return
+	}
+	e := ChangeEvent{
+		Time:     cg.now(),
+		Location: cg.name,
+		OldHash:  HashValue(old),
+		NewHash:  HashValue(v),
+		Outcome:  o,
+	}
+	for s := range eventStreams {
+		if s.location == "" || s.location == cg.name {
+			s.send(e)
+		}
+	}
+}
@@ -0,0 +1,76 @@
+package hotload
+
+import (
+	"context"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestEvents(t *testing.T) {
+	s := &docStrategy{doc: "dbname=a"}
+	RegisterStrategy("test-events", s)
+	RegisterSQLDriver("test-events", &recordingDriver{})
+	defer func() {
+		UnregisterStrategy("test-events")
+		mu.Lock()
+		delete(sqlDrivers, "test-events")
+		mu.Unlock()
+	}()
+	h := newHdriver()
+	defer h.stop()
+	const name = "test-events://test-events/dsn"
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	events := Events(ctx, name)
+	others := Events(ctx, "test-events://test-events/other")
+	if _, err := h.Open(name); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		value    string
+		outcome  RotationOutcome
+		old, new string
+	}{
+		{"dbname=b", RotationApplied, "dbname=a", "dbname=b"},
+		{"dbname=b", RotationUnchanged, "dbname=b", "dbname=b"},
+		{"dbname=c", RotationApplied, "dbname=b", "dbname=c"},
+	}
+	for _, tt := range tests {
+		// one value at a time, values sent faster are coalesced
+		s.set(tt.value)
+		select {
+		case e := <-events:
+			if e.Location != name || e.Outcome != tt.outcome || e.OldHash != HashValue(tt.old) || e.NewHash != HashValue(tt.new) {
+				t.Fatalf("got %+v, want %s from %q to %q", e, tt.outcome, tt.old, tt.new)
+			}
+			if e.Time.IsZero() {
+				t.Errorf("event %+v has no time", e)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("no event for %q", tt.value)
+		}
+	}
+
+	cancel()
+	for e := range events {
+		t.Errorf("unexpected event %+v", e)
+	}
+	for e := range others {
+		t.Errorf("event %+v of another location", e)
+	}
+}
+
+func TestEventStreamDropsOldest(t *testing.T) {
+	s := &eventStream{ch: make(chan ChangeEvent, EventBufferSize)}
+	for i := 0; i < EventBufferSize+3; i++ {
+		s.send(ChangeEvent{Location: strconv.Itoa(i)})
+	}
+	if n := len(s.ch); n != EventBufferSize {
+		t.Fatalf("buffered %d events, want %d", n, EventBufferSize)
+	}
+	if e := <-s.ch; e.Location != "3" {
+		t.Errorf("oldest buffered event is %s, want 3", e.Location)
+	}
+}
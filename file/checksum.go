@@ -0,0 +1,70 @@
+package file
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/infobloxopen/hotload/logger"
+)
+
+// ChecksumFileKey is the query parameter with a checksum file of the watched
+// file, e.g. a checksum annotation of a ConfigMap projected by the downward
+// API. Relative paths are relative to the directory of the watched file.
+// While the checksum file is present the watched file is only re-read when
+// the checksum changes, which saves reading large files that change rarely.
+// Without it changes are detected by modtime and contents.
+const ChecksumFileKey = "checksumFile"
+
+// checksum tracks the checksum file of a watched file.
+type checksum struct {
+	path string
+	last string
+}
+
+func newChecksum(pth, file string) *checksum {
+	if file == "" {
+		return nil
+	}
+	if !filepath.IsAbs(file) {
+		file = filepath.Join(filepath.Dir(pth), file)
+	}
+	c := &checksum{path: file}
+	c.check()
+	return c
+}
+
+// check reads the checksum file. ok is false if there is no checksum file
+// or it could not be read, changes are detected by modtime then. changed
+// tells whether the checksum differs from the one of the last check.
+func (c *checksum) check() (ok, changed bool) {
+	if c == nil {
+		return false, false
+	}
+	b, err := os.ReadFile(c.path)
+	if err != nil {
+		if !errors.Is(err, fs.ErrNotExist) {
+			logger.GetLogger()("file: could not read checksum file, comparing contents", c.path, err)
+		}
+		c.last = ""
+		return false, false
+	}
+	sum := strings.TrimSpace(string(b))
+	if sum == "" {
+		c.last = ""
+		return false, false
+	}
+	changed = sum != c.last
+	c.last = sum
+	return true, changed
+}
+
+// forget makes the next check report a change, e.g. to retry a failed read
+// of the watched file.
+func (c *checksum) forget() {
+	if c != nil {
+		c.last = ""
+	}
+}
@@ -0,0 +1,151 @@
+// Package file implements a hotload strategy that polls a file for changes
+// using modtime.ModTimeMonitor. Unlike the fsnotify strategy it has no
+// dependency on fsnotify, at the cost of noticing changes up to one poll
+// interval later.
+//
+//	import _ "github.com/infobloxopen/hotload/file"
+//
+//	db, err := sql.Open("hotload", "file://postgres/tmp/myconfig.txt?pollInterval=5s")
+package file
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/infobloxopen/hotload"
+	"github.com/infobloxopen/hotload/logger"
+	"github.com/infobloxopen/hotload/metrics"
+	"github.com/infobloxopen/hotload/modtime"
+	"github.com/infobloxopen/hotload/strategy"
+)
+
+const strategyName = "file"
+
+// PollIntervalKey is the query parameter overriding how often the file's
+// modtime is checked.
+const PollIntervalKey = "pollInterval"
+
+// DefaultPollInterval is how often the file's modtime is checked unless
+// overridden with the pollInterval query parameter.
+var DefaultPollInterval = time.Second * 2
+
+func init() {
+	hotload.RegisterStrategy(strategyName, NewStrategy())
+}
+
+// NewStrategy implements a hotload strategy that monitors config changes
+// in a file by polling its modtime.
+func NewStrategy() *Strategy {
+	return &Strategy{}
+}
+
+// Strategy implements the hotload Strategy interface by polling the
+// modtime of a file.
+type Strategy struct{}
+
+func readConfigFile(path string, stripComments bool) (string, error) {
+	v, err := os.ReadFile(path)
+	if err != nil {
+		return "", strategy.ReadError(path, err)
+	}
+	if stripComments {
+		return strategy.StripComments(string(v)), nil
+	}
+	return strings.TrimSpace(string(v)), nil
+}
+
+func pollInterval(options url.Values) time.Duration {
+	v := options.Get(PollIntervalKey)
+	if v == "" {
+		return DefaultPollInterval
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil || d <= 0 {
+		logger.GetLogger()("file: invalid "+PollIntervalKey+", using default", v)
+		return DefaultPollInterval
+	}
+	return d
+}
+
+// Watch implements the hotload.Strategy interface. The watch stops when ctx
+// is canceled.
+func (s *Strategy) Watch(ctx context.Context, pth string, options url.Values) (value string, values <-chan string, err error) {
+	if ctx.Err() != nil {
+		return "", nil, fmt.Errorf("%w: %w", strategy.ErrWatchClosed, ctx.Err())
+	}
+	pth = path.Clean(pth)
+	fi, err := os.Stat(pth)
+	if err != nil {
+		return "", nil, strategy.ReadError(pth, err)
+	}
+	strip := strategy.StripCommentsEnabled(options)
+	value, err = readConfigFile(pth, strip)
+	if err != nil {
+		return "", nil, err
+	}
+
+	intv := pollInterval(options)
+	mtm := modtime.NewModTimeMonitor(ctx, modtime.WithCheckInterval(intv))
+	if err := mtm.AddMonitoredPath(strategyName, pth); err != nil {
+		return "", nil, err
+	}
+	sum := newChecksum(pth, options.Get(ChecksumFileKey))
+	out := make(chan string)
+	go poll(ctx, mtm, pth, strip, intv, sum, fi.ModTime(), value, out)
+	return value, out, nil
+}
+
+func poll(ctx context.Context, mtm *modtime.ModTimeMonitor, pth string, strip bool, intv time.Duration, sum *checksum, lastMod time.Time, last string, out chan<- string) {
+	metrics.IncHotloadWatchGoroutines(strategyName)
+	defer metrics.DecHotloadWatchGoroutines(strategyName)
+	log := logger.GetLogger()
+	ticker := time.NewTicker(intv)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		sts, err := mtm.GetPathStatus(strategyName, pth)
+		if err != nil {
+			log("file: GetPathStatus", pth, err)
+			continue
+		}
+		if ok, changed := sum.check(); ok {
+			// the checksum decides, the modtime is kept for when it is gone
+			lastMod = sts.ModTime
+			if !changed {
+				continue
+			}
+		} else {
+			if sts.ModTime.IsZero() || sts.ModTime.Equal(lastMod) {
+				continue
+			}
+			lastMod = sts.ModTime
+		}
+		v, err := readConfigFile(pth, strip)
+		if err != nil {
+			// retry on the next modtime change, or the next poll with a
+			// checksum
+			log("file:", err)
+			sum.forget()
+			continue
+		}
+		if v == last {
+			continue
+		}
+		log("file: Path changed", pth)
+		select {
+		case out <- v:
+			last = v
+		case <-ctx.Done():
+			return
+		}
+	}
+}
@@ -0,0 +1,116 @@
+package file
+
+import (
+	"context"
+	"net/url"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/infobloxopen/hotload/strategy"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Strategy", func() {
+	var (
+		pth    string
+		ctx    context.Context
+		cancel context.CancelFunc
+		opts   url.Values
+	)
+
+	BeforeEach(func() {
+		f, err := os.CreateTemp("", "file_")
+		Expect(err).ToNot(HaveOccurred())
+		f.WriteString(" a \n")
+		f.Close()
+		pth = f.Name()
+		ctx, cancel = context.WithCancel(context.Background())
+		opts = url.Values{PollIntervalKey: []string{"20ms"}}
+	})
+
+	AfterEach(func() {
+		cancel()
+		os.Remove(pth)
+	})
+
+	It("Should return an error if the file does not exist", func() {
+		_, _, err := NewStrategy().Watch(ctx, "/does/not/exist", opts)
+		Expect(err).To(MatchError(strategy.ErrResourceNotFound))
+	})
+
+	It("Should return an error if the context is already canceled", func() {
+		cancel()
+		_, _, err := NewStrategy().Watch(ctx, pth, opts)
+		Expect(err).To(MatchError(strategy.ErrWatchClosed))
+	})
+
+	It("Should return the trimmed file contents", func() {
+		v, _, err := NewStrategy().Watch(ctx, pth, opts)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(v).To(Equal("a"))
+	})
+
+	It("Should strip comments and blank lines when stripComments is set", func() {
+		Expect(os.WriteFile(pth, []byte("# the db\n\npostgres://localhost/db\n"), 0660)).To(Succeed())
+		opts.Set(strategy.StripCommentsKey, "true")
+		v, _, err := NewStrategy().Watch(ctx, pth, opts)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(v).To(Equal("postgres://localhost/db"))
+	})
+
+	It("Should emit the new contents when the modtime changes", func() {
+		_, values, err := NewStrategy().Watch(ctx, pth, opts)
+		Expect(err).ToNot(HaveOccurred())
+
+		Expect(os.WriteFile(pth, []byte("b"), 0660)).To(Succeed())
+		later := time.Now().Add(time.Second)
+		Expect(os.Chtimes(pth, later, later)).To(Succeed())
+		Eventually(values).Should(Receive(Equal("b")))
+	})
+
+	It("Should stop polling when the context is canceled", func() {
+		_, values, err := NewStrategy().Watch(ctx, pth, opts)
+		Expect(err).ToNot(HaveOccurred())
+		cancel()
+		time.Sleep(50 * time.Millisecond)
+
+		Expect(os.WriteFile(pth, []byte("b"), 0660)).To(Succeed())
+		later := time.Now().Add(time.Second)
+		Expect(os.Chtimes(pth, later, later)).To(Succeed())
+		Consistently(values, 200*time.Millisecond).ShouldNot(Receive())
+	})
+
+	It("Should only re-read the file when its checksum changes", func() {
+		sumPath := pth + ".sha256"
+		Expect(os.WriteFile(sumPath, []byte("sum-a\n"), 0660)).To(Succeed())
+		defer os.Remove(sumPath)
+		opts.Set(ChecksumFileKey, filepath.Base(sumPath))
+		_, values, err := NewStrategy().Watch(ctx, pth, opts)
+		Expect(err).ToNot(HaveOccurred())
+
+		Expect(os.WriteFile(pth, []byte("b"), 0660)).To(Succeed())
+		later := time.Now().Add(time.Second)
+		Expect(os.Chtimes(pth, later, later)).To(Succeed())
+		Consistently(values, 200*time.Millisecond).ShouldNot(Receive())
+
+		Expect(os.WriteFile(sumPath, []byte("sum-b\n"), 0660)).To(Succeed())
+		Eventually(values).Should(Receive(Equal("b")))
+	})
+
+	It("Should compare contents when the checksum file is absent", func() {
+		opts.Set(ChecksumFileKey, filepath.Base(pth)+".missing")
+		_, values, err := NewStrategy().Watch(ctx, pth, opts)
+		Expect(err).ToNot(HaveOccurred())
+
+		Expect(os.WriteFile(pth, []byte("b"), 0660)).To(Succeed())
+		later := time.Now().Add(time.Second)
+		Expect(os.Chtimes(pth, later, later)).To(Succeed())
+		Eventually(values).Should(Receive(Equal("b")))
+	})
+
+	It("Should fall back to the default interval when pollInterval is invalid", func() {
+		Expect(pollInterval(url.Values{PollIntervalKey: []string{"soon"}})).To(Equal(DefaultPollInterval))
+	})
+})
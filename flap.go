@@ -0,0 +1,130 @@
+package hotload
+
+import (
+	"net/url"
+	"strconv"
+	"time"
+)
+
+const flapLimitKey = "flapLimit"
+const flapWindowKey = "flapWindow"
+
+// DefaultFlapWindow is the window flapLimit applies to when flapWindow is not
+// set.
+const DefaultFlapWindow = time.Minute
+
+// flapGuard stops a flapping source from resetting connections continuously.
+// Once limit changes were applied within window, further changes are held
+// back, only the latest one is kept and applied when the rate subsides.
+type flapGuard struct {
+	limit   int
+	window  time.Duration
+	changes []time.Time
+	pending string
+	// held is set while pending is a change to apply, holding is set while
+	// changes are held back
+	held    bool
+	holding bool
+	timer   clockTimer
+}
+
+// parseFlapGuard reads the flap options. The guard is off unless flapLimit
+// is set.
+func (cg *chanGroup) parseFlapGuard(vs url.Values) {
+	v := vs.Get(flapLimitKey)
+	if v == "" {
+		return
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil || n <= 0 {
+		cg.log("invalid flapLimit, ignoring", v)
+		return
+	}
+	cg.flap.limit = n
+	cg.flap.window = DefaultFlapWindow
+	cg.log("flapLimit set to", n)
+	if v := vs.Get(flapWindowKey); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d <= 0 {
+			cg.log("invalid flapWindow, ignoring", v)
+			return
+		}
+		cg.flap.window = d
+		cg.log("flapWindow set to", d)
+	}
+}
+
+// holdIfFlapping records a change to v and reports whether it must be held
+// back because the source is flapping.
+func (cg *chanGroup) holdIfFlapping(v string) bool {
+	cg.mu.Lock()
+	defer cg.mu.Unlock()
+	f := &cg.flap
+	if f.limit <= 0 {
+		return false
+	}
+	now := cg.now()
+	recent := f.changes[:0]
+	for _, t := range f.changes {
+		if now.Sub(t) < f.window {
+			recent = append(recent, t)
+		}
+	}
+	f.changes = recent
+	if len(f.changes) < f.limit && !f.holding {
+		f.changes = append(f.changes, now)
+		return false
+	}
+	if !f.holding {
+		cg.log("connection information source is flapping, holding changes for location", cg.name)
+	}
+	f.holding = true
+	f.pending, f.held = v, true
+	if f.timer == nil {
+		wait := f.window
+		if len(f.changes) > 0 {
+			wait = f.changes[0].Add(f.window).Sub(now)
+		}
+		f.timer = cg.afterFunc(wait, cg.releaseFlapping)
+	}
+	return true
+}
+
+// releaseFlapping applies the latest held back change once the oldest change
+// in the window has expired, unless the source went back to the current
+// value meanwhile.
+func (cg *chanGroup) releaseFlapping() {
+	cg.mu.Lock()
+	f := &cg.flap
+	v, held := f.pending, f.held
+	f.timer = nil
+	f.holding = false
+	f.pending, f.held = "", false
+	cg.mu.Unlock()
+	if !held || cg.sameValue(v, cg.currentValue()) {
+		return
+	}
+	cg.log("applying held back connection information for location", cg.name)
+	cg.valueChanged(v)
+}
+
+// dropFlapping forgets the held back change, the source went back to the
+// value in use. Changes are still held back until the rate subsides.
+func (cg *chanGroup) dropFlapping() {
+	cg.mu.Lock()
+	defer cg.mu.Unlock()
+	cg.flap.pending, cg.flap.held = "", false
+}
+
+// stopFlapping stops the release of held back changes, the group is torn
+// down.
+func (cg *chanGroup) stopFlapping() {
+	cg.mu.Lock()
+	defer cg.mu.Unlock()
+	f := &cg.flap
+	if f.timer != nil {
+		f.timer.Stop()
+		f.timer = nil
+	}
+	f.pending, f.held, f.holding = "", false, false
+}
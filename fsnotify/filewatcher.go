@@ -1,7 +1,9 @@
 package fsnotify
 
 import (
+	"bytes"
 	"context"
+	"fmt"
 	"net/url"
 	"os"
 	"path"
@@ -12,11 +14,26 @@ import (
 	rfsnotify "github.com/fsnotify/fsnotify"
 	"github.com/infobloxopen/hotload"
 	"github.com/infobloxopen/hotload/logger"
+	"github.com/infobloxopen/hotload/metrics"
+	"github.com/infobloxopen/hotload/strategy"
 	"github.com/pkg/errors"
 )
 
+const strategyName = "fsnotify"
+
+// RequireNewlineKey is the option that makes the strategy treat contents
+// without a trailing newline as a partial write, see ErrPartialWrite.
+const RequireNewlineKey = "requireNewline"
+
+// ErrPartialWrite is wrapped by the errors of reads of a file that does not
+// end with a newline while requireNewline is set. Writers that update the
+// file in place, e.g. echo dsn > file, truncate it first and write the
+// newline last, so such a read likely caught the file mid-write. The value is
+// not emitted, the strategy waits for the next event.
+var ErrPartialWrite = errors.New("fsnotify: partial write")
+
 func init() {
-	hotload.RegisterStrategy("fsnotify", NewStrategy())
+	hotload.RegisterStrategy(strategyName, NewStrategy())
 }
 
 var resyncPeriod = time.Second * 2
@@ -41,32 +58,43 @@ type pathWatch struct {
 	path   string
 	values chan string
 	value  string
+	// requireNewline rejects contents without a trailing newline
+	requireNewline bool
 }
 
-func readConfigFile(path string) (v []byte, err error) {
+func readConfigFile(path string, requireNewline bool) (v []byte, err error) {
 	v, err = os.ReadFile(path)
 	if err != nil {
-		return nil, errors.Wrapf(err, "could not read %v", path)
+		return nil, strategy.ReadError(path, err)
+	}
+	if requireNewline && !bytes.HasSuffix(v, []byte("\n")) {
+		return nil, strategy.ReadError(path, ErrPartialWrite)
 	}
 	v = []byte(strings.TrimSpace(string(v)))
 	return
 }
 
-func resync(w watcher, pth string) (string, error) {
+func resync(w watcher, pth string, requireNewline bool) (string, error) {
 	log := logger.GetLogger()
 	log("fsnotify: Path Name-Resync ", pth)
+	metrics.IncHotloadWatchRestarts(strategyName)
 	err := w.Remove(pth)
 	if err != nil && !errors.Is(err, rfsnotify.ErrNonExistentWatch) {
 		return "", err
 	}
-	bs, err := readConfigFile(pth)
+	if err := w.Add(pth); err != nil {
+		return "", err
+	}
+	bs, err := readConfigFile(pth, requireNewline)
 	if err != nil {
 		return "", err
 	}
-	return string(bs), w.Add(pth)
+	return string(bs), nil
 }
 
 func (s *Strategy) run() {
+	// runs for the life of the process
+	metrics.IncHotloadWatchGoroutines(strategyName)
 	log := logger.GetLogger()
 	failedPaths := make(map[string]struct{})
 	for {
@@ -77,7 +105,12 @@ func (s *Strategy) run() {
 				continue
 			}
 
-			val, err := resync(s.watcher, e.Name)
+			val, err := resync(s.watcher, e.Name, s.requiresNewline(e.Name))
+			if errors.Is(err, ErrPartialWrite) {
+				// the write completing the file sends another event, the
+				// resync catches it should it fall between Remove and Add
+				log("fsnotify: partial write, waiting for the next event ", e.Name)
+			}
 			if err != nil {
 				failedPaths[e.Name] = struct{}{}
 				break
@@ -90,7 +123,7 @@ func (s *Strategy) run() {
 		case <-time.After(resyncPeriod):
 			var fixedPaths []string
 			for pth := range failedPaths {
-				val, err := resync(s.watcher, pth)
+				val, err := resync(s.watcher, pth, s.requiresNewline(pth))
 				if err == nil {
 					fixedPaths = append(fixedPaths, pth)
 					s.setVal(pth, val)
@@ -103,6 +136,13 @@ func (s *Strategy) run() {
 	}
 }
 
+func (s *Strategy) requiresNewline(pth string) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	pw, ok := s.paths[pth]
+	return ok && pw.requireNewline
+}
+
 func (s *Strategy) setVal(pth string, val string) {
 	log := logger.GetLogger()
 	s.mu.Lock()
@@ -128,7 +168,7 @@ func (s *Strategy) Watch(ctx context.Context, pth string, options url.Values) (v
 	if s.watcher == nil {
 		watcher, err := notifyConstructor()
 		if err != nil {
-			return "", nil, err
+			return "", nil, fmt.Errorf("%w: %w", strategy.ErrWatchFailed, err)
 		}
 		s.watcher = watcher
 		go s.run()
@@ -137,19 +177,29 @@ func (s *Strategy) Watch(ctx context.Context, pth string, options url.Values) (v
 	if !found {
 		log("fsnotify: Path Name-Init ", pth)
 		if err := s.watcher.Add(pth); err != nil {
-			return "", nil, err
+			return "", nil, strategy.WatchError(pth, err)
+		}
+		requireNewline := options.Get(RequireNewlineKey) == "true"
+		bs, err := readConfigFile(pth, requireNewline)
+		if errors.Is(err, ErrPartialWrite) {
+			// start empty, hotload waits for the complete value
+			log("fsnotify: partial write, waiting for the next event ", pth)
+			bs, err = nil, nil
 		}
-		bs, err := readConfigFile(pth)
 		if err != nil {
 			s.watcher.Remove(pth)
 			return "", nil, err
 		}
 		notifier = &pathWatch{
-			path:   pth,
-			value:  string(bs),
-			values: make(chan string),
+			path:           pth,
+			value:          string(bs),
+			values:         make(chan string),
+			requireNewline: requireNewline,
 		}
 		s.paths[pth] = notifier
 	}
+	if strategy.StripCommentsEnabled(options) {
+		return strategy.StripComments(notifier.value), strategy.MapValues(ctx, notifier.values, strategy.StripComments), nil
+	}
 	return notifier.value, notifier.values, nil
 }
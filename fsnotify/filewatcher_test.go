@@ -8,6 +8,7 @@ import (
 	"time"
 
 	rfsnotify "github.com/fsnotify/fsnotify"
+	"github.com/infobloxopen/hotload/strategy"
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/ginkgo/extensions/table"
 	. "github.com/onsi/gomega"
@@ -147,6 +148,27 @@ var _ = Describe("FileWatcher", func() {
 				os.Remove(args.pth)
 			},
 		}),
+		Entry("commented file with stripComments --> comments stripped", test{
+			setup: func(args *args) {
+				f, _ := os.CreateTemp("", "unittest_")
+				f.Write([]byte("# primary database\n\n" + paramsURL + "\n"))
+				args.pth = f.Name()
+				args.options = url.Values{strategy.StripCommentsKey: []string{"true"}}
+				f.Close()
+			},
+			wantErr: false,
+			post: func(args *args, value string, values <-chan string) error {
+				if value != paramsURL {
+					return fmt.Errorf("expected '"+paramsURL+"' got %v", value)
+				}
+				os.WriteFile(args.pth, []byte("# updated\nb"), 0660)
+				assertStringFromChannel("wating for update b", "b", values)
+				return nil
+			},
+			tearDown: func(args *args) {
+				os.Remove(args.pth)
+			},
+		}),
 		Entry("a, update b", test{
 			setup: func(args *args) {
 				f, _ := os.CreateTemp("", "unittest_")
@@ -220,6 +242,11 @@ var _ = Describe("FileWatcher", func() {
 		}),
 	)
 
+	It("Should wrap ErrResourceNotFound when the file does not exist", func() {
+		_, _, err := s.Watch(context.Background(), "/does/not/exist", nil)
+		Expect(err).To(MatchError(strategy.ErrResourceNotFound))
+	})
+
 	Context("run", func() {
 		var strat *Strategy
 		var watcher *testWatcher
@@ -235,8 +262,9 @@ var _ = Describe("FileWatcher", func() {
 			bp := "badpath"
 			strat.watcher.Add(bp)
 			go s.run()
+			events := watcher.eventChannel
 			go func() {
-				watcher.eventChannel <- rfsnotify.Event{
+				events <- rfsnotify.Event{
 					Name: "chaff",
 					Op:   rfsnotify.Chmod,
 				}
@@ -246,5 +274,42 @@ var _ = Describe("FileWatcher", func() {
 			// run didn't pass through resync
 			Expect(v).To(BeTrue())
 		})
+
+		It("Should wait for the complete write with requireNewline", func() {
+			f, err := os.CreateTemp("", "unittest_")
+			Expect(err).ToNot(HaveOccurred())
+			pth := f.Name()
+			defer os.Remove(pth)
+			// truncated and only partially rewritten
+			f.Write([]byte("host=d"))
+			f.Close()
+
+			options := url.Values{RequireNewlineKey: []string{"true"}}
+			value, values, err := strat.Watch(context.Background(), pth, options)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(value).To(BeEmpty())
+			go strat.run()
+
+			watcher.eventChannel <- rfsnotify.Event{Name: pth, Op: rfsnotify.Write}
+			Consistently(values, 100*time.Millisecond).ShouldNot(Receive())
+
+			Expect(os.WriteFile(pth, []byte("host=db dbname=app\n"), 0660)).To(Succeed())
+			watcher.eventChannel <- rfsnotify.Event{Name: pth, Op: rfsnotify.Write}
+			assertStringFromChannel("waiting for the complete write", "host=db dbname=app", values)
+		})
+
+		It("Should wrap ErrPartialWrite for contents without a newline", func() {
+			f, err := os.CreateTemp("", "unittest_")
+			Expect(err).ToNot(HaveOccurred())
+			defer os.Remove(f.Name())
+			f.Write([]byte("host=d"))
+			f.Close()
+			_, err = readConfigFile(f.Name(), true)
+			Expect(err).To(MatchError(ErrPartialWrite))
+			Expect(err).To(MatchError(strategy.ErrReadFailed))
+			bs, err := readConfigFile(f.Name(), false)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(string(bs)).To(Equal("host=d"))
+		})
 	})
 })
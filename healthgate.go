@@ -0,0 +1,110 @@
+package hotload
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"net/url"
+	"time"
+)
+
+const healthGateKey = "healthGate"
+const healthQueryKey = "healthQuery"
+
+// defaultHealthQuery is the health query without healthQuery=.
+const defaultHealthQuery = "SELECT 1"
+
+// HealthCheckTimeout bounds the health check of new connection information.
+// Opens of drivers registered with RegisterSQLDriver cannot be canceled, the
+// timeout only applies to their health query.
+var HealthCheckTimeout = 10 * time.Second
+
+// ErrHealthCheckFailed is wrapped by the errors of changes rejected because a
+// connection opened with the new connection information failed the health
+// query.
+var ErrHealthCheckFailed = errors.New("hotload: health check of new connection information failed")
+
+// healthGate probes changes before they are applied.
+type healthGate struct {
+	enabled bool
+	query   string
+}
+
+func (cg *chanGroup) parseHealthGate(vs url.Values) {
+	if v, ok := vs[healthGateKey]; ok {
+		cg.healthGate.enabled = v[0] == "true"
+		cg.log("healthGate set to", v[0])
+	}
+	if q := vs.Get(healthQueryKey); q != "" {
+		cg.healthGate.query = q
+		cg.log("healthQuery set to", q)
+	}
+}
+
+// checkHealth opens a connection with v, the way the group's connections are
+// opened, and runs the health query on it. It returns an error wrapping
+// ErrHealthCheckFailed if either fails, nil without healthGate=true.
+func (cg *chanGroup) checkHealth(v string) error {
+	cg.mu.RLock()
+	gate := cg.healthGate
+	if !gate.enabled || cg.sqlDriver == nil {
+		cg.mu.RUnlock()
+		return nil
+	}
+	dsn, _, err := cg.dsnFor(v)
+	initSQL := cg.initSQL
+	cg.mu.RUnlock()
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrHealthCheckFailed, err)
+	}
+	query := gate.query
+	if query == "" {
+		query = defaultHealthQuery
+	}
+	ctx, cancel := context.WithTimeout(cg.parentCtx, HealthCheckTimeout)
+	defer cancel()
+	conn, release, err := cg.openDriver(ctx, dsn)
+	if err != nil {
+		return fmt.Errorf("%w: could not open: %w", ErrHealthCheckFailed, err)
+	}
+	defer release()
+	// ignore errors from close
+	defer conn.Close()
+	if err := runInitSQL(ctx, conn, initSQL); err != nil {
+		return fmt.Errorf("%w: %w", ErrHealthCheckFailed, err)
+	}
+	if err := runHealthQuery(ctx, conn, query); err != nil {
+		return fmt.Errorf("%w: %s: %w", ErrHealthCheckFailed, query, err)
+	}
+	cg.trace("health check passed for location", cg.name)
+	return nil
+}
+
+// runHealthQuery runs query on conn and discards the rows.
+func runHealthQuery(ctx context.Context, conn driver.Conn, query string) error {
+	if qc, ok := conn.(driver.QueryerContext); ok {
+		rows, err := qc.QueryContext(ctx, query, nil)
+		if err != driver.ErrSkip {
+			if err != nil {
+				return err
+			}
+			return rows.Close()
+		}
+	}
+	stmt, err := conn.Prepare(query)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+	var rows driver.Rows
+	if sc, ok := stmt.(driver.StmtQueryContext); ok {
+		rows, err = sc.QueryContext(ctx, nil)
+	} else {
+		rows, err = stmt.Query(nil)
+	}
+	if err != nil {
+		return err
+	}
+	return rows.Close()
+}
@@ -0,0 +1,156 @@
+package hotload
+
+import (
+	"errors"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+const historyDepthKey = "historyDepth"
+
+// DefaultHistoryDepth is the number of previous values kept for Rollback
+// when historyDepth is not set.
+const DefaultHistoryDepth = 5
+
+var (
+	// ErrUnknownLocation is returned for hotload locations that were never
+	// opened.
+	ErrUnknownLocation = errors.New("hotload: unknown location")
+	// ErrNoHistory is returned by Rollback when there is no previous value.
+	ErrNoHistory = errors.New("hotload: no previous value to roll back to")
+)
+
+// HistoryEntry describes a previous value of a location. Like AuditEvent it
+// never contains the raw value.
+type HistoryEntry struct {
+	Hash     string
+	Redacted string
+	// Replaced is when the value was replaced by the next one.
+	Replaced time.Time
+}
+
+type historyEntry struct {
+	HistoryEntry
+	value string
+}
+
+// parseHistoryDepth reads the historyDepth option, 0 disables the history.
+func (cg *chanGroup) parseHistoryDepth(vs url.Values) {
+	cg.historyDepth = DefaultHistoryDepth
+	v := vs.Get(historyDepthKey)
+	if v == "" {
+		return
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil || n < 0 {
+		cg.log("invalid historyDepth, ignoring", v)
+		return
+	}
+	cg.historyDepth = n
+	cg.log("historyDepth set to", n)
+}
+
+// pushHistory records old, the value being replaced. Callers must hold cg.mu.
+func (cg *chanGroup) pushHistory(old string, now time.Time) {
+	if old == "" || cg.historyDepth <= 0 {
+		return
+	}
+	cg.history = append(cg.history, historyEntry{
+		HistoryEntry: HistoryEntry{Hash: HashValue(old), Redacted: cg.redact(old), Replaced: now},
+		value:        old,
+	})
+	if extra := len(cg.history) - cg.historyDepth; extra > 0 {
+		cg.history = append([]historyEntry(nil), cg.history[extra:]...)
+	}
+}
+
+// Rollback re-applies the previous value of the hotload location name, the
+// connection string given to sql.Open, and resets its connections with its
+// reset policy. It is an emergency lever when a bad value was pushed: the
+// source is not changed, it keeps being watched, and until it delivers a
+// different value the rolled back value is ignored. Rolling back again goes
+// further back in the history, which holds up to historyDepth values.
+//
+// The previous value passes the change pipeline like a change of the source:
+// it may be vetoed by a guard, held back e.g. by a no-rotate lease, or staged
+// for its rotation group, and it is audited and published as an event once
+// applied.
+func Rollback(name string) error {
+	return hotloadDriver.Rollback(name)
+}
+
+func (h *hdriver) Rollback(name string) error {
+	cg, ok := h.group(name)
+	if !ok {
+		return ErrUnknownLocation
+	}
+	return cg.rollback()
+}
+
+// pendingRollback is a rollback from the value from to value, the last
+// history entry.
+type pendingRollback struct {
+	from  string
+	value string
+}
+
+func (cg *chanGroup) rollback() error {
+	cg.mu.Lock()
+	if len(cg.history) == 0 {
+		cg.mu.Unlock()
+		return ErrNoHistory
+	}
+	prev := cg.history[len(cg.history)-1]
+	cg.rollingBack = &pendingRollback{from: cg.value, value: prev.value}
+	cg.mu.Unlock()
+
+	cg.log("rolling back connection information for location", cg.name, "to", prev.Hash)
+	cg.valueChanged(prev.value)
+	return nil
+}
+
+// takeRollback reports whether applying v completes the pending rollback, and
+// if so drops the history entry rolled back to: the rolled back value is not
+// history to roll back to. A rollback superseded by another change is
+// forgotten. cg.mu must be held.
+func (cg *chanGroup) takeRollback(v string) bool {
+	r := cg.rollingBack
+	cg.rollingBack = nil
+	if r == nil || r.value != v || r.from != cg.value {
+		return false
+	}
+	if n := len(cg.history); n == 0 || cg.history[n-1].value != v {
+		return false
+	}
+	cg.history = cg.history[:len(cg.history)-1]
+	return true
+}
+
+// ignoreRolledBack reports whether v is the value that was rolled back and
+// should be ignored until the source delivers a different one.
+func (cg *chanGroup) ignoreRolledBack(v string) bool {
+	cg.mu.RLock()
+	defer cg.mu.RUnlock()
+	return cg.rolledBack != "" && cg.sameValue(v, cg.rolledBack)
+}
+
+// History returns the previous values of the hotload location name, oldest
+// first, or nil if the location is unknown.
+func History(name string) []HistoryEntry {
+	return hotloadDriver.History(name)
+}
+
+func (h *hdriver) History(name string) []HistoryEntry {
+	cg, ok := h.group(name)
+	if !ok {
+		return nil
+	}
+	cg.mu.RLock()
+	defer cg.mu.RUnlock()
+	entries := make([]HistoryEntry, 0, len(cg.history))
+	for _, e := range cg.history {
+		entries = append(entries, e.HistoryEntry)
+	}
+	return entries
+}
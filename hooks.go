@@ -0,0 +1,89 @@
+package hotload
+
+import "sync"
+
+var (
+	hooksMu          sync.RWMutex
+	resetBadConnHook func(location string)
+	activeHook       func(location string)
+	idleHook         func(location string, reason CloseReason)
+)
+
+// OnResetBadConn registers fn to be called, with the hotload location, every
+// time a connection is reported bad to database/sql because hotload reset it
+// after a config change. database/sql retries these transparently, so this
+// makes the otherwise invisible cost of rotations visible. Pass nil to remove
+// the callback. fn must not block.
+func OnResetBadConn(fn func(location string)) {
+	hooksMu.Lock()
+	defer hooksMu.Unlock()
+	resetBadConnHook = fn
+}
+
+func getResetBadConnHook() func(string) {
+	hooksMu.RLock()
+	defer hooksMu.RUnlock()
+	return resetBadConnHook
+}
+
+// OnLocationActive registers fn to be called, with the hotload location,
+// every time a location without connections opens one. Together with
+// OnLocationIdle it tells when a location is in use, e.g. to release the
+// resources of idle locations. Pass nil to remove the callback.
+func OnLocationActive(fn func(location string)) {
+	hooksMu.Lock()
+	defer hooksMu.Unlock()
+	activeHook = fn
+}
+
+// OnLocationIdle registers fn to be called, with the hotload location, every
+// time the last connection of a location is closed, or its connections are
+// dropped by a change, KillConnections or Shutdown. reason is the close
+// reason of the last connection, or of the connections dropped, e.g.
+// CloseReasonForce for a change with resetPolicy=force. Calls for a location
+// are made in order and outside of hotload's locks, fn may call back into
+// hotload but should not block. Pass nil to remove the callback.
+func OnLocationIdle(fn func(location string, reason CloseReason)) {
+	hooksMu.Lock()
+	defer hooksMu.Unlock()
+	idleHook = fn
+}
+
+func getConnsHooks() (active func(string), idle func(string, CloseReason)) {
+	hooksMu.RLock()
+	defer hooksMu.RUnlock()
+	return activeHook, idleHook
+}
+
+// connsTransition is a group becoming active or idle, queued by connsChanged.
+type connsTransition struct {
+	active bool
+	// reason is why the connections were closed if the group became idle
+	reason CloseReason
+}
+
+// fireConnsHooks calls the active and idle hooks for the transitions recorded
+// by connsChanged. cg.mu must not be held. Transitions recorded while a hook
+// runs, e.g. one closing a connection, are fired by the loop already running.
+func (cg *chanGroup) fireConnsHooks() {
+	cg.mu.Lock()
+	if cg.firingConnsHooks {
+		cg.mu.Unlock()
+		return
+	}
+	cg.firingConnsHooks = true
+	for len(cg.connsTransitions) > 0 {
+		t := cg.connsTransitions[0]
+		cg.connsTransitions = cg.connsTransitions[1:]
+		cg.mu.Unlock()
+		onActive, onIdle := getConnsHooks()
+		if t.active && onActive != nil {
+			onActive(cg.name)
+		} else if !t.active && onIdle != nil {
+			onIdle(cg.name, t.reason)
+		}
+		cg.mu.Lock()
+	}
+	cg.firingConnsHooks = false
+	cg.mu.Unlock()
+}
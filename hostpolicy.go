@@ -0,0 +1,169 @@
+package hotload
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"path"
+	"regexp"
+	"strings"
+)
+
+// ErrHostNotAllowed is wrapped by the errors of connection information
+// rejected by the host policy of its driver.
+var ErrHostNotAllowed = errors.New("hotload: database host not allowed")
+
+// hostPolicy restricts the database hosts connection strings of a driver may
+// point at. Patterns are path.Match patterns matched against lowercased
+// hostnames, e.g. *.db.internal or 10.0.*.
+type hostPolicy struct {
+	allow []string
+	deny  []string
+}
+
+// WithAllowedHosts restricts the connection strings of the driver to hosts
+// matching one of patterns, path.Match patterns like *.db.internal. Changes
+// pointing at any other host, or at no host hotload can find, are rejected:
+// the previous value is retained, the rejection is logged and recorded by the
+// audit sinks. An initial value that is not allowed fails the open. It panics
+// if a pattern is malformed.
+func WithAllowedHosts(patterns ...string) driverOption {
+	checkHostPatterns(patterns)
+	return func(d *driverInstance) {
+		d.hosts.allow = append(d.hosts.allow, lowerAll(patterns)...)
+	}
+}
+
+// WithDeniedHosts rejects connection strings of the driver pointing at a host
+// matching one of patterns, like WithAllowedHosts. Denied patterns take
+// precedence over allowed ones. It panics if a pattern is malformed.
+func WithDeniedHosts(patterns ...string) driverOption {
+	checkHostPatterns(patterns)
+	return func(d *driverInstance) {
+		d.hosts.deny = append(d.hosts.deny, lowerAll(patterns)...)
+	}
+}
+
+func checkHostPatterns(patterns []string) {
+	for _, p := range patterns {
+		if _, err := path.Match(p, ""); err != nil {
+			panic("hotload: malformed host pattern " + p)
+		}
+	}
+}
+
+func lowerAll(ss []string) []string {
+	lower := make([]string, len(ss))
+	for i, s := range ss {
+		lower[i] = strings.ToLower(s)
+	}
+	return lower
+}
+
+func (hp hostPolicy) empty() bool {
+	return len(hp.allow) == 0 && len(hp.deny) == 0
+}
+
+// check returns an error wrapping ErrHostNotAllowed unless every host of dsn
+// is permitted.
+func (hp hostPolicy) check(dsn string) error {
+	if hp.empty() {
+		return nil
+	}
+	hosts := dsnHosts(dsn)
+	if len(hosts) == 0 && len(hp.allow) > 0 {
+		return fmt.Errorf("%w: no host in connection string", ErrHostNotAllowed)
+	}
+	for _, h := range hosts {
+		if matchAny(hp.deny, h) || (len(hp.allow) > 0 && !matchAny(hp.allow, h)) {
+			return fmt.Errorf("%w: %s", ErrHostNotAllowed, h)
+		}
+	}
+	return nil
+}
+
+func matchAny(patterns []string, host string) bool {
+	for _, p := range patterns {
+		if ok, _ := path.Match(p, host); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// kvHostRe matches the parameters of a key/value connection string that name
+// the database host.
+var kvHostRe = regexp.MustCompile(`(^|\s)(host|hostaddr)\s*=\s*('(?:[^'\\]|\\.)*'|\S*)`)
+
+// dsnHosts returns the lowercased hosts of a URL or key/value style
+// connection string, several for multi-host strings like
+// postgres://db1:5432,db2:5432/app. The host and hostaddr parameters are
+// included, drivers like pgx and lib/pq connect to them instead of the URL
+// authority.
+func dsnHosts(dsn string) []string {
+	var hosts []string
+	if d, ok := splitDSNURL(strings.TrimSpace(dsn)); ok {
+		hosts = d.hostnames()
+		// an unparsable query hides nothing from the policy, no hosts
+		// makes an allowlist reject it
+		q, err := url.ParseQuery(d.query)
+		if err != nil {
+			return nil
+		}
+		for _, key := range []string{"host", "hostaddr"} {
+			for _, v := range q[key] {
+				hosts = append(hosts, splitHosts(v)...)
+			}
+		}
+	} else {
+		// the last occurrence of a key wins, like in the drivers
+		byKey := make(map[string][]string)
+		for _, m := range kvHostRe.FindAllStringSubmatch(dsn, -1) {
+			byKey[m[2]] = splitHosts(unquoteKeyValue(m[3]))
+		}
+		hosts = append(byKey["host"], byKey["hostaddr"]...)
+	}
+	return lowerAll(hosts)
+}
+
+// splitHosts returns the hosts of a comma separated host parameter without
+// ports.
+func splitHosts(v string) []string {
+	var hosts []string
+	for _, h := range strings.Split(v, ",") {
+		if h = stripPort(strings.TrimSpace(h)); h != "" {
+			hosts = append(hosts, h)
+		}
+	}
+	return hosts
+}
+
+// checkHost checks v against the host policy of the group's driver, without
+// the hotload directives it may contain.
+func (cg *chanGroup) checkHost(v string) error {
+	if cg.sqlDriver == nil {
+		return nil
+	}
+	v, _ = cg.readOnly.split(v)
+	return cg.sqlDriver.hosts.check(v)
+}
+
+// rejectChange logs and audits a change to v refused with err. The current
+// value is retained.
+func (cg *chanGroup) rejectChange(v string, err error) {
+	cg.log("rejected connection information for location", cg.name, err)
+	cg.mu.RLock()
+	event := AuditEvent{
+		Time:        cg.now(),
+		Location:    cg.name,
+		Driver:      cg.driverName,
+		OldHash:     HashValue(cg.value),
+		NewHash:     HashValue(v),
+		OldRedacted: cg.redact(cg.value),
+		NewRedacted: cg.redact(v),
+		Policy:      cg.resetPolicy,
+		Rejected:    err,
+	}
+	cg.mu.RUnlock()
+	recordAudit(event)
+}
@@ -0,0 +1,109 @@
+package hotload
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestHostPolicy(t *testing.T) {
+	allow := hostPolicy{allow: []string{"*.db.internal", "10.0.*", "::1"}}
+	deny := hostPolicy{deny: []string{"evil.example.com"}}
+	both := hostPolicy{allow: []string{"*.db.internal"}, deny: []string{"legacy.db.internal"}}
+	tests := []struct {
+		name    string
+		policy  hostPolicy
+		dsn     string
+		wantErr bool
+	}{
+		{name: "no policy", dsn: "host=anything"},
+		{name: "allowed url", policy: allow, dsn: "postgres://app:pw@Primary.DB.internal:5432/app"},
+		{name: "allowed key/value", policy: allow, dsn: "host=10.0.1.5 port=5432 dbname=app"},
+		{name: "allowed quoted key/value", policy: allow, dsn: "host='a.db.internal' dbname=app"},
+		{name: "allowed ipv6", policy: allow, dsn: "postgres://[::1]:5432/app"},
+		{name: "not allowed url", policy: allow, dsn: "postgres://app:pw@attacker.example.com/app", wantErr: true},
+		{name: "not allowed key/value", policy: allow, dsn: "host=10.1.0.5 dbname=app", wantErr: true},
+		{name: "suffix is not enough", policy: allow, dsn: "host=db.internal.evil.com", wantErr: true},
+		{name: "one of several hosts not allowed", policy: allow, dsn: "postgres://a.db.internal:5432,evil.com:5432/app", wantErr: true},
+		{name: "several hosts allowed", policy: allow, dsn: "host=a.db.internal,b.db.internal dbname=app"},
+		{name: "no host with allowlist", policy: allow, dsn: "dbname=app", wantErr: true},
+		{name: "denied", policy: deny, dsn: "postgres://evil.example.com/app", wantErr: true},
+		{name: "not denied", policy: deny, dsn: "postgres://db.example.com/app"},
+		{name: "no host with denylist", policy: deny, dsn: "dbname=app"},
+		{name: "denied multi-host ipv6", policy: hostPolicy{deny: []string{"fd00::2"}}, dsn: "postgres://[fd00::1]:5432,[fd00::2]:5432/app", wantErr: true},
+		{name: "allowed ipv6 zone", policy: hostPolicy{allow: []string{"fe80::*"}}, dsn: "postgres://[fe80::1%25eth0]:5432/app"},
+		{name: "url host parameter", policy: allow, dsn: "postgres://app@a.db.internal/app?host=evil.example.com", wantErr: true},
+		{name: "url hostaddr parameter", policy: allow, dsn: "postgres://app@a.db.internal/app?sslmode=require&hostaddr=192.168.1.1", wantErr: true},
+		{name: "url allowed host parameter", policy: allow, dsn: "postgres://app@a.db.internal/app?host=b.db.internal&hostaddr=10.0.0.7"},
+		{name: "url malformed query", policy: allow, dsn: "postgres://app@a.db.internal/app?host=%zz", wantErr: true},
+		{name: "key/value hostaddr", policy: allow, dsn: "host=a.db.internal hostaddr=192.168.1.1 dbname=app", wantErr: true},
+		{name: "key/value quoted hostaddr", policy: deny, dsn: "host=db.example.com hostaddr='evil.example.com' dbname=app", wantErr: true},
+		{name: "key/value allowed hostaddr", policy: allow, dsn: "host=a.db.internal hostaddr=10.0.0.7 dbname=app"},
+		{name: "deny takes precedence", policy: both, dsn: "host=legacy.db.internal", wantErr: true},
+		{name: "allowed besides deny", policy: both, dsn: "host=new.db.internal"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.policy.check(tt.dsn)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("check() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil && !errors.Is(err, ErrHostNotAllowed) {
+				t.Errorf("check() error = %v, should wrap ErrHostNotAllowed", err)
+			}
+		})
+	}
+}
+
+func TestHostPatternsMalformed(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Error("WithAllowedHosts() should panic on a malformed pattern")
+		}
+	}()
+	WithAllowedHosts("[db")
+}
+
+func TestValueChangedRejectsHost(t *testing.T) {
+	hooksMu.RLock()
+	sinks := auditSinks
+	hooksMu.RUnlock()
+	defer func() {
+		hooksMu.Lock()
+		auditSinks = sinks
+		hooksMu.Unlock()
+	}()
+	rs := &recordingSink{}
+	RegisterAuditSink(rs)
+
+	di := &driverInstance{}
+	WithAllowedHosts("*.db.internal")(di)
+	cg := &chanGroup{
+		name:        "fsnotify://postgres/hosts",
+		driverName:  "postgres",
+		sqlDriver:   di,
+		value:       "host=a.db.internal dbname=app",
+		resetPolicy: ResetPolicyForce,
+		log:         func(...interface{}) {},
+	}
+	cg.ctx, cg.cancel = noopContext()
+	cg.parentCtx = cg.ctx
+
+	cg.valueChanged("host=attacker.example.com dbname=app")
+	if cg.value != "host=a.db.internal dbname=app" {
+		t.Errorf("value = %q, want the previous value retained", cg.value)
+	}
+	if len(rs.events) != 1 || !errors.Is(rs.events[0].Rejected, ErrHostNotAllowed) {
+		t.Fatalf("events = %+v, want one rejection", rs.events)
+	}
+	if rs.events[0].NewHash != HashValue("host=attacker.example.com dbname=app") {
+		t.Errorf("NewHash = %s, want the hash of the rejected value", rs.events[0].NewHash)
+	}
+
+	cg.valueChanged("host=b.db.internal dbname=app")
+	if cg.value != "host=b.db.internal dbname=app" {
+		t.Errorf("value = %q, want the allowed value applied", cg.value)
+	}
+	if len(rs.events) != 2 || rs.events[1].Rejected != nil {
+		t.Errorf("events = %+v, want an applied rotation", rs.events)
+	}
+}
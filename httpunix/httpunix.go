@@ -0,0 +1,200 @@
+// Package httpunix implements a hotload strategy that fetches the connection
+// string over HTTP from a local agent listening on a unix domain socket, e.g.
+// a cloud credential agent, and polls it for changes. The path is the HTTP
+// path, socket the path of the socket:
+//
+//	db, err := sql.Open("hotload", "http+unix://postgres/v1/db/orders?socket=/run/agent/agent.sock&pollInterval=30s")
+//
+// Other query parameters are passed on to the agent as the query of the
+// request. The response body of a 200 is the value, 404 means the resource
+// does not exist. An ETag of the response is sent back in If-None-Match and a
+// 304 keeps the value.
+package httpunix
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/infobloxopen/hotload"
+	"github.com/infobloxopen/hotload/logger"
+	"github.com/infobloxopen/hotload/metrics"
+	"github.com/infobloxopen/hotload/strategy"
+)
+
+func init() {
+	hotload.RegisterStrategy(strategyName, NewStrategy())
+}
+
+const strategyName = "http+unix"
+
+// SocketKey is the query parameter with the path of the unix socket of the
+// agent.
+const SocketKey = "socket"
+
+// PollIntervalKey is the query parameter with the poll interval, e.g. 30s.
+const PollIntervalKey = "pollInterval"
+
+// DefaultPollInterval is the poll interval without pollInterval=.
+var DefaultPollInterval = 30 * time.Second
+
+// RequestTimeout bounds every request to the agent.
+var RequestTimeout = 10 * time.Second
+
+// maxBodySize bounds the response bodies read from the agent.
+const maxBodySize = 1 << 20
+
+// ErrMissingSocket is returned by Watch when the socket query parameter is
+// not set.
+var ErrMissingSocket = fmt.Errorf("http+unix: %w", strategy.MissingOption(SocketKey))
+
+// ErrUnexpectedStatus is wrapped by the errors of responses with other
+// statuses than 200, 304 and 404.
+var ErrUnexpectedStatus = errors.New("http+unix: unexpected status")
+
+// NewStrategy returns a new http+unix strategy.
+func NewStrategy() *Strategy {
+	return &Strategy{}
+}
+
+// Strategy implements the hotload Strategy interface with HTTP over a unix
+// socket.
+type Strategy struct{}
+
+// client fetches one resource from the agent.
+type client struct {
+	http      *http.Client
+	transport *http.Transport
+	socket    string
+	url       string
+}
+
+// Watch implements the hotload.Strategy interface. Errors of the first fetch
+// are returned, a socket or resource that does not exist wraps
+// strategy.ErrResourceNotFound. Later errors, e.g. while the agent restarts,
+// are logged and the fetch is retried at the next poll while the previous
+// value is kept. Polling stops and the connections to the agent are closed
+// when ctx is canceled.
+func (s *Strategy) Watch(ctx context.Context, pth string, options url.Values) (value string, values <-chan string, err error) {
+	socket := options.Get(SocketKey)
+	if socket == "" {
+		return "", nil, ErrMissingSocket
+	}
+	interval := DefaultPollInterval
+	if v := options.Get(PollIntervalKey); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d <= 0 {
+			return "", nil, fmt.Errorf("http+unix: invalid %s %q", PollIntervalKey, v)
+		}
+		interval = d
+	}
+	c := newClient(socket, pth, options)
+	value, etag, _, err := c.fetch(ctx, "")
+	if err != nil {
+		c.transport.CloseIdleConnections()
+		return "", nil, err
+	}
+	out := make(chan string)
+	go c.run(ctx, interval, value, etag, out)
+	return value, out, nil
+}
+
+func newClient(socket, pth string, options url.Values) *client {
+	transport := &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, "unix", socket)
+		},
+	}
+	query := url.Values{}
+	for k, v := range options {
+		if k != SocketKey && k != PollIntervalKey {
+			query[k] = v
+		}
+	}
+	// the host is not used to connect, the socket is
+	u := url.URL{Scheme: "http", Host: "localhost", Path: "/" + strings.TrimLeft(pth, "/"), RawQuery: query.Encode()}
+	return &client{
+		http:      &http.Client{Transport: transport, Timeout: RequestTimeout},
+		transport: transport,
+		socket:    socket,
+		url:       u.String(),
+	}
+}
+
+// fetch gets the resource, with If-None-Match if etag is set. It returns the
+// value and ETag of the response, notModified for a 304.
+func (c *client) fetch(ctx context.Context, etag string) (value, newETag string, notModified bool, err error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.url, nil)
+	if err != nil {
+		return "", "", false, err
+	}
+	if etag != "" {
+		req.Header.Set("If-None-Match", etag)
+	}
+	resp, err := c.http.Do(req)
+	if err != nil {
+		// e.g. a socket that does not exist yet, wrapping fs.ErrNotExist
+		return "", "", false, strategy.ReadError(c.socket, err)
+	}
+	defer resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusOK:
+		body, err := io.ReadAll(io.LimitReader(resp.Body, maxBodySize))
+		if err != nil {
+			return "", "", false, strategy.ReadError(c.url, err)
+		}
+		return strings.TrimSpace(string(body)), resp.Header.Get("ETag"), false, nil
+	case http.StatusNotModified:
+		return "", etag, true, nil
+	case http.StatusNotFound:
+		return "", "", false, fmt.Errorf("could not fetch %v: %w: %s", c.url, strategy.ErrResourceNotFound, resp.Status)
+	}
+	return "", "", false, strategy.ReadError(c.url, fmt.Errorf("%w %s", ErrUnexpectedStatus, resp.Status))
+}
+
+func (c *client) run(ctx context.Context, interval time.Duration, last, etag string, out chan<- string) {
+	metrics.IncHotloadWatchGoroutines(strategyName)
+	defer metrics.DecHotloadWatchGoroutines(strategyName)
+	defer c.transport.CloseIdleConnections()
+	log := logger.GetLogger()
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		v, newETag, notModified, err := c.fetch(ctx, etag)
+		if err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			// e.g. the agent restarting, keep the previous value
+			log("http+unix:", err)
+			continue
+		}
+		if notModified {
+			continue
+		}
+		etag = newETag
+		if v == last {
+			continue
+		}
+		// the value may hold credentials, only log that it changed
+		log("http+unix: resource changed", c.url)
+		select {
+		case out <- v:
+			last = v
+		case <-ctx.Done():
+			return
+		}
+	}
+}
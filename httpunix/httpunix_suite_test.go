@@ -0,0 +1,13 @@
+package httpunix
+
+import (
+	"testing"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+func TestHTTPUnix(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "HTTPUnix Suite")
+}
@@ -0,0 +1,164 @@
+package httpunix
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/infobloxopen/hotload/strategy"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+// agent serves value with its version as ETag on a unix socket.
+type agent struct {
+	mu       sync.Mutex
+	value    string
+	version  string
+	status   int
+	requests int
+	queries  []string
+	server   *httptest.Server
+}
+
+func (a *agent) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.requests++
+	a.queries = append(a.queries, r.URL.Path+"?"+r.URL.RawQuery)
+	if a.status != 0 {
+		w.WriteHeader(a.status)
+		return
+	}
+	if r.Header.Get("If-None-Match") == a.version {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	w.Header().Set("ETag", a.version)
+	w.Write([]byte(a.value + "\n"))
+}
+
+func (a *agent) set(value, version string, status int) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.value, a.version, a.status = value, version, status
+}
+
+func (a *agent) count() int {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.requests
+}
+
+// listen serves a on socket.
+func (a *agent) listen(socket string) {
+	l, err := net.Listen("unix", socket)
+	Expect(err).ToNot(HaveOccurred())
+	a.server = httptest.NewUnstartedServer(a)
+	a.server.Listener = l
+	a.server.Start()
+}
+
+var _ = Describe("Strategy", func() {
+	var (
+		ctx    context.Context
+		cancel context.CancelFunc
+		socket string
+		dir    string
+		a      *agent
+	)
+
+	BeforeEach(func() {
+		ctx, cancel = context.WithCancel(context.Background())
+		var err error
+		dir, err = os.MkdirTemp("", "httpunix")
+		Expect(err).ToNot(HaveOccurred())
+		socket = filepath.Join(dir, "agent.sock")
+		a = &agent{value: "host=db1 dbname=app", version: `"1"`}
+		a.listen(socket)
+	})
+
+	AfterEach(func() {
+		cancel()
+		a.server.Close()
+		os.RemoveAll(dir)
+	})
+
+	options := func(extra ...string) url.Values {
+		vs := url.Values{SocketKey: {socket}, PollIntervalKey: {"10ms"}}
+		for i := 0; i+1 < len(extra); i += 2 {
+			vs.Set(extra[i], extra[i+1])
+		}
+		return vs
+	}
+
+	It("Should fetch the value and emit changes", func() {
+		v, values, err := NewStrategy().Watch(ctx, "/v1/db", options("role", "app"))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(v).To(Equal("host=db1 dbname=app"))
+		a.mu.Lock()
+		Expect(a.queries[0]).To(Equal("/v1/db?role=app"), "the socket and poll interval are not passed on")
+		a.mu.Unlock()
+
+		a.set("host=db2 dbname=app", `"2"`, 0)
+		Eventually(values).Should(Receive(Equal("host=db2 dbname=app")))
+	})
+
+	It("Should keep the value while the agent answers 304", func() {
+		_, values, err := NewStrategy().Watch(ctx, "/v1/db", options())
+		Expect(err).ToNot(HaveOccurred())
+		start := a.count()
+		Eventually(a.count).Should(BeNumerically(">", start+2))
+		Consistently(values, 50*time.Millisecond).ShouldNot(Receive())
+	})
+
+	It("Should fail the first fetch without the socket or resource", func() {
+		_, _, err := NewStrategy().Watch(ctx, "/v1/db", url.Values{SocketKey: {filepath.Join(filepath.Dir(socket), "missing.sock")}})
+		Expect(err).To(MatchError(strategy.ErrResourceNotFound))
+
+		a.set("", "", http.StatusNotFound)
+		_, _, err = NewStrategy().Watch(ctx, "/v1/db", options())
+		Expect(err).To(MatchError(strategy.ErrResourceNotFound))
+
+		a.set("", "", http.StatusInternalServerError)
+		_, _, err = NewStrategy().Watch(ctx, "/v1/db", options())
+		Expect(err).To(MatchError(ErrUnexpectedStatus))
+		Expect(err).To(MatchError(strategy.ErrReadFailed))
+	})
+
+	It("Should fail on bad options", func() {
+		_, _, err := NewStrategy().Watch(ctx, "/v1/db", url.Values{})
+		Expect(err).To(MatchError(strategy.ErrMissingOption))
+		_, _, err = NewStrategy().Watch(ctx, "/v1/db", options(PollIntervalKey, "often"))
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("Should retry polls while the socket is gone", func() {
+		_, values, err := NewStrategy().Watch(ctx, "/v1/db", options())
+		Expect(err).ToNot(HaveOccurred())
+		a.server.Close()
+		os.Remove(socket)
+		Consistently(values, 50*time.Millisecond).ShouldNot(Receive())
+
+		restarted := &agent{value: "host=db3 dbname=app", version: `"3"`}
+		restarted.listen(socket)
+		defer restarted.server.Close()
+		Eventually(values).Should(Receive(Equal("host=db3 dbname=app")))
+	})
+
+	It("Should stop polling when ctx is canceled", func() {
+		_, _, err := NewStrategy().Watch(ctx, "/v1/db", options())
+		Expect(err).ToNot(HaveOccurred())
+		Eventually(a.count).Should(BeNumerically(">", 2))
+		cancel()
+		time.Sleep(20 * time.Millisecond)
+		stopped := a.count()
+		Consistently(a.count, 50*time.Millisecond).Should(Equal(stopped))
+	})
+})
@@ -0,0 +1,83 @@
+package hotload
+
+import (
+	"net/url"
+	"time"
+)
+
+const idleWatcherTimeoutKey = "idleWatcherTimeout"
+
+// idleWatcher stops watching the strategy of a location once it had no
+// connections for timeout.
+type idleWatcher struct {
+	timeout time.Duration
+	timer   clockTimer
+	// gen tells the latest timer from stopped ones that fired anyway
+	gen int
+	// retire removes the group from its driver, nil for groups that are not
+	// registered with one
+	retire func(gen int)
+}
+
+// parseIdleWatcherTimeout reads idleWatcherTimeout. The strategy of a
+// location is watched for as long as the process runs unless it is set.
+func (cg *chanGroup) parseIdleWatcherTimeout(vs url.Values) {
+	v := vs.Get(idleWatcherTimeoutKey)
+	if v == "" {
+		return
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil || d <= 0 {
+		cg.log("invalid idleWatcherTimeout, ignoring", v)
+		return
+	}
+	cg.idleWatcher.timeout = d
+	cg.log("idleWatcherTimeout set to", d)
+}
+
+// armIdleWatcher starts the idle timeout of the group, which has no
+// connections. cg.mu must be held.
+func (cg *chanGroup) armIdleWatcher() {
+	w := &cg.idleWatcher
+	cg.disarmIdleWatcher()
+	if w.timeout <= 0 || w.retire == nil {
+		return
+	}
+	gen, retire := w.gen, w.retire
+	w.timer = cg.afterFunc(w.timeout, func() { retire(gen) })
+}
+
+// disarmIdleWatcher stops the idle timeout, the group has connections again.
+// cg.mu must be held.
+func (cg *chanGroup) disarmIdleWatcher() {
+	w := &cg.idleWatcher
+	w.gen++
+	if w.timer != nil {
+		w.timer.Stop()
+		w.timer = nil
+	}
+}
+
+// retireIdle stops watching the strategy of cg and removes it if it is still
+// idle since the timer gen was started. The next open of the location
+// watches the strategy again, with the value it has then.
+func (h *hdriver) retireIdle(cg *chanGroup, gen int) {
+	// opens are counted in inFlight under mu, none starts while it is held
+	mu.Lock()
+	defer mu.Unlock()
+	if h.cgroup[cg.name] != cg {
+		return
+	}
+	cg.mu.Lock()
+	idle := gen == cg.idleWatcher.gen && len(cg.conns) == 0 && cg.inFlight.Load() == 0 && !cg.closing
+	if idle {
+		cg.disarmIdleWatcher()
+	}
+	cg.mu.Unlock()
+	if !idle {
+		return
+	}
+	delete(h.cgroup, cg.name)
+	cg.stopWatch()
+	cg.log("stopped watching the strategy of idle location", cg.name)
+}
@@ -0,0 +1,77 @@
+package hotload
+
+import (
+	"testing"
+	"time"
+)
+
+func TestIdleWatcherTimeout(t *testing.T) {
+	s := &docStrategy{doc: "dbname=a"}
+	RegisterStrategy("test-idle", s)
+	RegisterSQLDriver("test-idle", &recordingDriver{})
+	defer func() {
+		UnregisterStrategy("test-idle")
+		mu.Lock()
+		delete(sqlDrivers, "test-idle")
+		mu.Unlock()
+	}()
+	clock := newFakeClock()
+	h := newHdriver()
+	h.clock = clock
+	defer h.stop()
+	const name = "test-idle://test-idle/dsn?idleWatcherTimeout=10m"
+	active := func() bool {
+		_, ok := h.group(name)
+		return ok
+	}
+
+	conn, err := h.Open(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cg, _ := h.group(name)
+	clock.Advance(time.Hour)
+	if !active() {
+		t.Fatal("location with a connection was retired")
+	}
+
+	conn.Close()
+	clock.Advance(9 * time.Minute)
+	if !active() {
+		t.Fatal("location retired before idleWatcherTimeout")
+	}
+	// activity restarts the timeout
+	conn, err = h.Open(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn.Close()
+	clock.Advance(9 * time.Minute)
+	if !active() {
+		t.Fatal("location retired before idleWatcherTimeout since its last connection")
+	}
+	clock.Advance(time.Minute)
+	if active() {
+		t.Fatal("idle location was not retired")
+	}
+	select {
+	case <-cg.parentCtx.Done():
+	default:
+		t.Fatal("the watch of the idle location was not stopped")
+	}
+
+	// the next open watches the strategy again, with its current value
+	s.mu.Lock()
+	s.doc = "dbname=b"
+	s.mu.Unlock()
+	if _, err := h.Open(name); err != nil {
+		t.Fatalf("Open() after retiring error = %v", err)
+	}
+	next, ok := h.group(name)
+	if !ok || next == cg {
+		t.Fatal("the location was not watched again")
+	}
+	if v := next.currentValue(); v != "dbname=b" {
+		t.Errorf("re-watched location uses %q, want dbname=b", v)
+	}
+}
@@ -0,0 +1,106 @@
+package hotload
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"time"
+
+	"github.com/infobloxopen/hotload/logger"
+)
+
+const initialValueTimeoutKey = "initialValueTimeout"
+
+// ErrNoInitialValue is returned by Open when initialValueTimeout is set and
+// the strategy delivered no initial value within the timeout.
+var ErrNoInitialValue = errors.New("hotload: no initial value from strategy")
+
+// initialValueTimeout returns the initialValueTimeout option, 0 if it is not
+// set or malformed.
+func initialValueTimeout(vs url.Values, log logger.Logger) time.Duration {
+	v := vs.Get(initialValueTimeoutKey)
+	if v == "" {
+		return 0
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil || d <= 0 {
+		log("invalid initialValueTimeout, ignoring", v)
+		return 0
+	}
+	return d
+}
+
+// WaitForValue blocks until the hotload location name, the connection string
+// given to sql.Open, has connection information or ctx is done, and returns
+// the connection information. It starts watching the strategy of name if no
+// connection was opened yet, but opens no connection, so startup can wait for
+// push based strategies that start empty without looping on db.Ping. The
+// value holds secrets, pass it through Redact before logging it.
+func WaitForValue(ctx context.Context, name string) (string, error) {
+	return hotloadDriver.WaitForValue(ctx, name)
+}
+
+func (h *hdriver) WaitForValue(ctx context.Context, name string) (string, error) {
+	uri, err := url.Parse(name)
+	if err != nil {
+		return "", err
+	}
+	mu.Lock()
+	cg, err := h.watch(ctx, name, uri)
+	mu.Unlock()
+	if err != nil {
+		return "", err
+	}
+	select {
+	case <-cg.readyChan():
+		return cg.currentValue(), nil
+	case <-ctx.Done():
+		return "", ctx.Err()
+	}
+}
+
+// readyChan returns a channel that is closed once the group has a value.
+func (cg *chanGroup) readyChan() <-chan struct{} {
+	cg.mu.Lock()
+	defer cg.mu.Unlock()
+	if cg.ready == nil {
+		cg.ready = make(chan struct{})
+		cg.markReadyLocked()
+	}
+	return cg.ready
+}
+
+// markReadyLocked closes the ready channel if the group has a value. cg.mu
+// must be held.
+func (cg *chanGroup) markReadyLocked() {
+	if cg.ready == nil || cg.value == "" {
+		return
+	}
+	select {
+	case <-cg.ready:
+	default:
+		close(cg.ready)
+	}
+}
+
+// waitInitialValue returns value, or, if it is empty and timeout is
+// positive, the first value received on values within timeout.
+func waitInitialValue(ctx context.Context, value string, values <-chan string, timeout time.Duration) (string, error) {
+	if value != "" || timeout <= 0 {
+		return value, nil
+	}
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case v, ok := <-values:
+		if !ok {
+			return "", fmt.Errorf("%w: values channel closed", ErrNoInitialValue)
+		}
+		return v, nil
+	case <-timer.C:
+		return "", fmt.Errorf("%w after %s", ErrNoInitialValue, timeout)
+	case <-ctx.Done():
+		return "", fmt.Errorf("%w: %w", ErrNoInitialValue, ctx.Err())
+	}
+}
@@ -0,0 +1,145 @@
+package hotload
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func Test_waitInitialValue(t *testing.T) {
+	closed := make(chan string)
+	close(closed)
+	delivered := make(chan string, 1)
+	delivered <- "dbname=streamed"
+	tests := []struct {
+		name    string
+		value   string
+		values  <-chan string
+		timeout time.Duration
+		want    string
+		wantErr bool
+	}{
+		{name: "synchronous value", value: "dbname=sync", values: make(chan string), timeout: time.Second, want: "dbname=sync"},
+		{name: "no timeout keeps empty value", values: make(chan string)},
+		{name: "value from channel", values: delivered, timeout: time.Second, want: "dbname=streamed"},
+		{name: "timeout elapses", values: make(chan string), timeout: 10 * time.Millisecond, wantErr: true},
+		{name: "channel closed", values: closed, timeout: time.Second, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := waitInitialValue(context.Background(), tt.value, tt.values, tt.timeout)
+			if errors.Is(err, ErrNoInitialValue) != tt.wantErr {
+				t.Fatalf("waitInitialValue() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("waitInitialValue() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+// pushStrategy starts empty and delivers its values later on values.
+type pushStrategy struct {
+	values chan string
+}
+
+func (s *pushStrategy) Watch(ctx context.Context, pth string, options url.Values) (string, <-chan string, error) {
+	return "", s.values, nil
+}
+
+func TestWaitForValue(t *testing.T) {
+	s := &pushStrategy{values: make(chan string)}
+	RegisterStrategy("test-wait", s)
+	RegisterSQLDriver("test-wait", &testDriver{})
+	defer func() {
+		UnregisterStrategy("test-wait")
+		mu.Lock()
+		delete(sqlDrivers, "test-wait")
+		for name := range hotloadDriver.cgroup {
+			if strings.HasPrefix(name, "test-wait://") {
+				delete(hotloadDriver.cgroup, name)
+			}
+		}
+		mu.Unlock()
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if _, err := WaitForValue(ctx, "test-wait://test-wait/empty"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("WaitForValue() error = %v, want %v", err, context.DeadlineExceeded)
+	}
+
+	go func() { s.values <- "dbname=pushed" }()
+	got, err := WaitForValue(context.Background(), "test-wait://test-wait/empty")
+	if err != nil {
+		t.Fatalf("WaitForValue() error = %v", err)
+	}
+	if got != "dbname=pushed" {
+		t.Errorf("WaitForValue() = %q, want %q", got, "dbname=pushed")
+	}
+
+	if _, err := WaitForValue(context.Background(), "unknown://test-wait/empty"); !errors.Is(err, ErrUnsupportedStrategy) {
+		t.Errorf("WaitForValue() error = %v, want %v", err, ErrUnsupportedStrategy)
+	}
+}
+
+func TestInitialValueWaitsWithoutMu(t *testing.T) {
+	s := &pushStrategy{values: make(chan string)}
+	RegisterStrategy("test-initial", s)
+	RegisterStrategy("test-initial-other", fixedStrategy{value: "dbname=other"})
+	RegisterSQLDriver("test-initial", &recordingDriver{})
+	defer func() {
+		UnregisterStrategy("test-initial")
+		UnregisterStrategy("test-initial-other")
+		mu.Lock()
+		delete(sqlDrivers, "test-initial")
+		mu.Unlock()
+	}()
+	h := newHdriver()
+	defer h.stop()
+
+	// both opens wait for the one value, the location is watched once
+	const name = "test-initial://test-initial/dsn?initialValueTimeout=5s"
+	const opens = 2
+	errs := make(chan error, opens)
+	for i := 0; i < opens; i++ {
+		go func() {
+			_, err := h.Open(name)
+			errs <- err
+		}()
+	}
+	time.Sleep(10 * time.Millisecond)
+	// other locations are opened meanwhile
+	done := make(chan error, 1)
+	go func() {
+		_, err := h.Open("test-initial-other://test-initial/dsn")
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("open of another location waited for the initial value")
+	}
+
+	s.values <- "dbname=pushed"
+	for i := 0; i < opens; i++ {
+		select {
+		case err := <-errs:
+			if err != nil {
+				t.Errorf("Open() error = %v", err)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("open did not get the initial value")
+		}
+	}
+	cg, _ := h.group(name)
+	if n := cg.stats().Connections; n != opens {
+		t.Errorf("%d connections, want %d", n, opens)
+	}
+}
@@ -0,0 +1,69 @@
+package hotload
+
+import (
+	"context"
+	"database/sql/driver"
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+const initSQLKey = "initSQL"
+
+// parseInitSQL reads initSQL, statements separated by semicolons that are run
+// on every new connection. One or more initSQL parameters may be given, in
+// the URL the semicolons must be escaped as %3B. Without it no statements
+// run, so a directive line without initSQL restores the statements of the
+// URL.
+func (cg *chanGroup) parseInitSQL(vs url.Values) {
+	var stmts []string
+	for _, v := range vs[initSQLKey] {
+		for _, s := range strings.Split(v, ";") {
+			if s = strings.TrimSpace(s); s != "" {
+				stmts = append(stmts, s)
+			}
+		}
+	}
+	if len(stmts) > 0 || len(cg.initSQL) > 0 {
+		cg.log("initSQL set to", len(stmts), "statements")
+	}
+	cg.initSQL = stmts
+}
+
+// runInitSQL runs the init statements on a new connection before it is handed
+// out, the first failing one fails the open.
+func runInitSQL(ctx context.Context, conn driver.Conn, stmts []string) error {
+	for _, s := range stmts {
+		if err := execStatement(ctx, conn, s); err != nil {
+			return fmt.Errorf("hotload: initSQL %q: %w", s, err)
+		}
+	}
+	return nil
+}
+
+// execStatement runs query on conn without arguments.
+func execStatement(ctx context.Context, conn driver.Conn, query string) error {
+	if ec, ok := conn.(driver.ExecerContext); ok {
+		_, err := ec.ExecContext(ctx, query, nil)
+		if err != driver.ErrSkip {
+			return err
+		}
+	}
+	if e, ok := conn.(driver.Execer); ok {
+		_, err := e.Exec(query, nil)
+		if err != driver.ErrSkip {
+			return err
+		}
+	}
+	stmt, err := conn.Prepare(query)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+	if sc, ok := stmt.(driver.StmtExecContext); ok {
+		_, err = sc.ExecContext(ctx, nil)
+	} else {
+		_, err = stmt.Exec(nil)
+	}
+	return err
+}
@@ -0,0 +1,124 @@
+package hotload
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+)
+
+var errInitFailed = errors.New("init failed")
+
+// execDriver records the statements executed on its connections, statements
+// containing "fail" fail.
+type execDriver struct {
+	mu     sync.Mutex
+	stmts  []string
+	closed int
+}
+
+func (d *execDriver) Open(name string) (driver.Conn, error) {
+	return &execConn{driver: d}, nil
+}
+
+func (d *execDriver) executed() ([]string, int) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	stmts, closed := d.stmts, d.closed
+	d.stmts, d.closed = nil, 0
+	return stmts, closed
+}
+
+type execConn struct {
+	testConn
+	driver *execDriver
+}
+
+func (c *execConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	c.driver.mu.Lock()
+	defer c.driver.mu.Unlock()
+	c.driver.stmts = append(c.driver.stmts, query)
+	if strings.Contains(query, "fail") {
+		return nil, errInitFailed
+	}
+	return driver.RowsAffected(0), nil
+}
+
+func (c *execConn) Close() error {
+	c.driver.mu.Lock()
+	defer c.driver.mu.Unlock()
+	c.driver.closed++
+	return nil
+}
+
+func TestInitSQL(t *testing.T) {
+	d := &execDriver{}
+	RegisterSQLDriver("test-initsql", d)
+	RegisterStrategy("test-initsql", fixedStrategy{value: "dbname=app"})
+	RegisterStrategy("test-initsql-directive", fixedStrategy{value: "#hotload: initSQL=SET+search_path+TO+tenant\ndbname=app"})
+	defer func() {
+		UnregisterStrategy("test-initsql")
+		UnregisterStrategy("test-initsql-directive")
+		mu.Lock()
+		delete(sqlDrivers, "test-initsql")
+		mu.Unlock()
+	}()
+	h := newHdriver()
+	defer h.stop()
+
+	tests := []struct {
+		name       string
+		location   string
+		wantStmts  []string
+		wantErr    error
+		wantClosed int
+	}{
+		{
+			name:      "statements of the URL in order",
+			location:  "test-initsql://test-initsql/a?initSQL=SET+search_path+TO+app%3B+SET+statement_timeout+%3D+5000",
+			wantStmts: []string{"SET search_path TO app", "SET statement_timeout = 5000"},
+		},
+		{
+			name:      "several parameters",
+			location:  "test-initsql://test-initsql/b?initSQL=SET+a+%3D+1&initSQL=SET+b+%3D+2",
+			wantStmts: []string{"SET a = 1", "SET b = 2"},
+		},
+		{
+			name:      "directive of the value",
+			location:  "test-initsql-directive://test-initsql/c?initSQL=SET+search_path+TO+app",
+			wantStmts: []string{"SET search_path TO tenant"},
+		},
+		{
+			name:     "without initSQL",
+			location: "test-initsql://test-initsql/d",
+		},
+		{
+			name:       "failing statement fails the open",
+			location:   "test-initsql://test-initsql/e?initSQL=SET+a+%3D+1%3B+SET+fail%3B+SET+b+%3D+2",
+			wantStmts:  []string{"SET a = 1", "SET fail"},
+			wantErr:    errInitFailed,
+			wantClosed: 1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conn, err := h.Open(tt.location)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Open() error = %v, want %v", err, tt.wantErr)
+			}
+			if err == nil && conn == nil {
+				t.Fatal("Open() returned no connection")
+			}
+			stmts, closed := d.executed()
+			if !reflect.DeepEqual(stmts, tt.wantStmts) {
+				t.Errorf("executed %q, want %q", stmts, tt.wantStmts)
+			}
+			if closed != tt.wantClosed {
+				t.Errorf("closed %d connections, want %d", closed, tt.wantClosed)
+			}
+		})
+	}
+}
@@ -159,4 +159,23 @@ var _ = Describe("hotload integration tests", func() {
 		expectValueInDb(hltDb, 0)
 		expectValueInDb(hlt1Db, 1)
 	})
+
+	It("should point a single sql.DB at the new db when the file changes", func() {
+		// idle connections and a long lifetime must not keep the old db alive
+		db.SetMaxIdleConns(5)
+		db.SetConnMaxLifetime(time.Hour)
+		currentDb := func() string {
+			var name string
+			err := db.QueryRow("SELECT current_database()").Scan(&name)
+			Expect(err).ToNot(HaveOccurred(), fmt.Sprintf("error reading current database: %v", err))
+			return name
+		}
+		Expect(currentDb()).To(Equal("hotload_test"))
+
+		setDSN(hotloadTest1Dsn, configPath)
+		Eventually(currentDb, 5*time.Second).Should(Equal("hotload_test1"))
+
+		setDSN(hotloadTestDsn, configPath)
+		Eventually(currentDb, 5*time.Second).Should(Equal("hotload_test"))
+	})
 })
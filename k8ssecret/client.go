@@ -0,0 +1,211 @@
+package k8ssecret
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+)
+
+// serviceAccountDir is where Kubernetes mounts the service account of a pod.
+var serviceAccountDir = "/var/run/secrets/kubernetes.io/serviceaccount"
+
+// restClient reads Secrets from the Kubernetes API with a bearer token, a
+// client certificate or both.
+type restClient struct {
+	host      string
+	tokenFile string
+	http      *http.Client
+}
+
+// InClusterClient returns a Client that uses the service account of the pod
+// it runs in, like client-go's rest.InClusterConfig. The token is read for
+// every request so rotated tokens are picked up.
+func InClusterClient() (Client, error) {
+	host, port := os.Getenv("KUBERNETES_SERVICE_HOST"), os.Getenv("KUBERNETES_SERVICE_PORT")
+	if host == "" || port == "" {
+		return nil, errors.New("k8s-secret: not running in a cluster, KUBERNETES_SERVICE_HOST and KUBERNETES_SERVICE_PORT not set")
+	}
+	ca, err := os.ReadFile(serviceAccountDir + "/ca.crt")
+	if err != nil {
+		return nil, fmt.Errorf("k8s-secret: could not read service account CA: %w", err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(ca) {
+		return nil, errors.New("k8s-secret: no certificates in service account CA")
+	}
+	return NewClient("https://"+net.JoinHostPort(host, port), &tls.Config{RootCAs: pool}, serviceAccountDir+"/token"), nil
+}
+
+// NewClient returns a Client for the API server at host, e.g.
+// https://kube.example.com:6443, outside the cluster. tlsConfig is used for
+// every connection; to authenticate with a client certificate, e.g. of a
+// kubeconfig, set its Certificates or GetClientCertificate, and RootCAs to
+// the CA of the cluster. With a tokenFile the token is sent as well and read
+// for every request, without one the client certificate is the only
+// credential.
+func NewClient(host string, tlsConfig *tls.Config, tokenFile string) Client {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = tlsConfig
+	return newRESTClient(strings.TrimSuffix(host, "/"), tokenFile, &http.Client{Transport: transport})
+}
+
+func newRESTClient(host, tokenFile string, c *http.Client) *restClient {
+	return &restClient{host: host, tokenFile: tokenFile, http: c}
+}
+
+// status is the body of API errors and watch error events.
+type status struct {
+	Message string `json:"message"`
+	Reason  string `json:"reason"`
+	Code    int    `json:"code"`
+}
+
+func (st status) err(namespace, name string) error {
+	msg := st.Message
+	if msg == "" {
+		msg = st.Reason
+	}
+	switch st.Code {
+	case http.StatusForbidden, http.StatusUnauthorized:
+		return fmt.Errorf("%w: secret %s/%s: %s", ErrForbidden, namespace, name, msg)
+	case http.StatusNotFound:
+		return fmt.Errorf("k8s-secret: secret %s/%s: %w", namespace, name, fs.ErrNotExist)
+	case http.StatusGone:
+		return fmt.Errorf("%w: %s", ErrGone, msg)
+	}
+	return fmt.Errorf("k8s-secret: secret %s/%s: %d %s", namespace, name, st.Code, msg)
+}
+
+type objectMeta struct {
+	ResourceVersion string `json:"resourceVersion"`
+}
+
+// secretObject is the JSON form of a Secret.
+type secretObject struct {
+	Metadata objectMeta        `json:"metadata"`
+	Data     map[string]string `json:"data"`
+}
+
+func (o *secretObject) secret() *Secret {
+	return &Secret{ResourceVersion: o.Metadata.ResourceVersion, Data: o.Data}
+}
+
+func (c *restClient) do(ctx context.Context, namespace, name, pth string, query url.Values) (*http.Response, error) {
+	u := fmt.Sprintf("%s/api/v1/namespaces/%s/secrets%s", c.host, url.PathEscape(namespace), pth)
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return nil, err
+	}
+	if c.tokenFile != "" {
+		token, err := os.ReadFile(c.tokenFile)
+		if err != nil {
+			return nil, fmt.Errorf("k8s-secret: could not read service account token: %w", err)
+		}
+		req.Header.Set("Authorization", "Bearer "+string(bytes.TrimSpace(token)))
+	}
+	req.Header.Set("Accept", "application/json")
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
+		st := status{Code: resp.StatusCode}
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		if json.Unmarshal(body, &st) != nil || st.Message == "" {
+			st.Message = strings.TrimSpace(string(body))
+		}
+		st.Code = resp.StatusCode
+		return nil, st.err(namespace, name)
+	}
+	return resp, nil
+}
+
+// Get implements Client.
+func (c *restClient) Get(ctx context.Context, namespace, name string) (*Secret, error) {
+	resp, err := c.do(ctx, namespace, name, "/"+url.PathEscape(name), nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	var o secretObject
+	if err := json.NewDecoder(resp.Body).Decode(&o); err != nil {
+		return nil, fmt.Errorf("k8s-secret: secret %s/%s: %w: %w", namespace, name, errDecodeResponse, err)
+	}
+	return o.secret(), nil
+}
+
+var errDecodeResponse = errors.New("invalid response")
+
+// watchEvent is the JSON form of a watch event, Object is a Secret or, for
+// ERROR events, a Status.
+type watchEvent struct {
+	Type   EventType       `json:"type"`
+	Object json.RawMessage `json:"object"`
+}
+
+// Watch implements Client.
+func (c *restClient) Watch(ctx context.Context, namespace, name, resourceVersion string) (<-chan Event, error) {
+	query := url.Values{
+		"watch":         {"1"},
+		"fieldSelector": {"metadata.name=" + name},
+	}
+	if resourceVersion != "" {
+		query.Set("resourceVersion", resourceVersion)
+	}
+	resp, err := c.do(ctx, namespace, name, "", query)
+	if err != nil {
+		return nil, err
+	}
+	events := make(chan Event)
+	go func() {
+		defer close(events)
+		defer resp.Body.Close()
+		dec := json.NewDecoder(resp.Body)
+		for {
+			var we watchEvent
+			if err := dec.Decode(&we); err != nil {
+				// the API server ended the watch or ctx was canceled
+				return
+			}
+			e := Event{Type: we.Type}
+			if we.Type == Error {
+				var st status
+				if err := json.Unmarshal(we.Object, &st); err != nil {
+					st.Message = err.Error()
+				}
+				e.Err = st.err(namespace, name)
+			} else {
+				var o secretObject
+				if err := json.Unmarshal(we.Object, &o); err != nil {
+					e = Event{Type: Error, Err: fmt.Errorf("k8s-secret: secret %s/%s: %w: %w", namespace, name, errDecodeResponse, err)}
+				} else {
+					e.Secret = o.secret()
+				}
+			}
+			select {
+			case events <- e:
+			case <-ctx.Done():
+				return
+			}
+			if e.Type == Error {
+				return
+			}
+		}
+	}()
+	return events, nil
+}
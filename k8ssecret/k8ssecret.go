@@ -0,0 +1,254 @@
+// Package k8ssecret implements a hotload strategy that reads the connection
+// string from a key of a Kubernetes Secret and watches the Secret for
+// updates. The path is the namespace and name of the Secret, key selects the
+// data key:
+//
+//	db, err := sql.Open("hotload", "k8s-secret://postgres/orders/orders-db?key=dsn")
+//
+// Secret data is served base64 encoded, the strategy decodes it. The decoded
+// value is never logged. By default the strategy talks to the API server with
+// the in-cluster service account, which needs get and watch on the Secret.
+// Permission errors are returned as ErrForbidden.
+package k8ssecret
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/infobloxopen/hotload"
+	"github.com/infobloxopen/hotload/logger"
+	"github.com/infobloxopen/hotload/metrics"
+	"github.com/infobloxopen/hotload/strategy"
+)
+
+func init() {
+	hotload.RegisterStrategy(strategyName, NewStrategy(nil))
+}
+
+const strategyName = "k8s-secret"
+
+// KeyKey is the query parameter with the data key of the Secret.
+const KeyKey = "key"
+
+// ErrMissingKey is returned by Watch when the key query parameter is not set.
+// It wraps strategy.ErrMissingOption.
+var ErrMissingKey = fmt.Errorf("k8s-secret: %w", strategy.MissingOption(KeyKey))
+
+// ErrForbidden is returned when the API server denies access to the Secret,
+// usually because RBAC does not grant get or watch on it.
+var ErrForbidden = errors.New("k8s-secret: access to secret forbidden, check RBAC get and watch permissions")
+
+// ErrGone is returned by Client.Watch when the resource version is too old.
+var ErrGone = errors.New("k8s-secret: resource version too old")
+
+// rewatchDelay is the delay before a Secret is watched again after its watch
+// ended. After errors the Secret is read again first.
+var rewatchDelay = time.Second
+
+// Secret is the part of a Kubernetes Secret the strategy uses.
+type Secret struct {
+	ResourceVersion string
+	// Data holds the base64 encoded values, as served by the API server.
+	Data map[string]string
+}
+
+// EventType is the type of a watch event.
+type EventType string
+
+const (
+	Added    EventType = "ADDED"
+	Modified EventType = "MODIFIED"
+	Deleted  EventType = "DELETED"
+	Error    EventType = "ERROR"
+)
+
+// Event is a change of a watched Secret. Err is set for Error events, e.g.
+// ErrGone if the watch must restart from the current Secret.
+type Event struct {
+	Type   EventType
+	Secret *Secret
+	Err    error
+}
+
+// Client is the subset of the Kubernetes API used by the strategy.
+// InClusterClient implements it with the service account of the pod,
+// applications can adapt other clients.
+type Client interface {
+	// Get reads the Secret.
+	Get(ctx context.Context, namespace, name string) (*Secret, error)
+	// Watch streams changes of the Secret after resourceVersion. The
+	// channel is closed when the watch ends, the API server ends watches
+	// regularly.
+	Watch(ctx context.Context, namespace, name, resourceVersion string) (<-chan Event, error)
+}
+
+// NewStrategy returns a strategy that reads Secrets through client. With a
+// nil client the in-cluster client is created on first use.
+func NewStrategy(client Client) *Strategy {
+	return &Strategy{client: client}
+}
+
+// Strategy implements the hotload Strategy interface with Kubernetes Secrets.
+type Strategy struct {
+	mu     sync.Mutex
+	client Client
+}
+
+func (s *Strategy) getClient() (Client, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.client == nil {
+		c, err := InClusterClient()
+		if err != nil {
+			return nil, err
+		}
+		s.client = c
+	}
+	return s.client, nil
+}
+
+// secretRef is the Secret key a location reads.
+type secretRef struct {
+	namespace, name, key string
+}
+
+func (r secretRef) String() string {
+	return fmt.Sprintf("secret %s/%s key %s", r.namespace, r.name, r.key)
+}
+
+func parseRef(pth string, options url.Values) (secretRef, error) {
+	key := options.Get(KeyKey)
+	if key == "" {
+		return secretRef{}, ErrMissingKey
+	}
+	parts := strings.Split(strings.Trim(pth, "/"), "/")
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return secretRef{}, fmt.Errorf("k8s-secret: path %q is not /namespace/name", pth)
+	}
+	return secretRef{namespace: parts[0], name: parts[1], key: key}, nil
+}
+
+// decode returns the decoded value of the key of secret.
+func (r secretRef) decode(secret *Secret) (string, error) {
+	enc, ok := secret.Data[r.key]
+	if !ok {
+		return "", fmt.Errorf("k8s-secret: %v: %w", r, strategy.ErrResourceNotFound)
+	}
+	v, err := base64.StdEncoding.DecodeString(enc)
+	if err != nil {
+		return "", fmt.Errorf("k8s-secret: %v: %w: %w", r, strategy.ErrDecodeFailed, err)
+	}
+	return strings.TrimSpace(string(v)), nil
+}
+
+// Watch implements the hotload.Strategy interface. Errors reading the Secret
+// are returned, later errors are logged and the Secret is read and watched
+// again. The watch stops when ctx is canceled.
+func (s *Strategy) Watch(ctx context.Context, pth string, options url.Values) (value string, values <-chan string, err error) {
+	ref, err := parseRef(pth, options)
+	if err != nil {
+		return "", nil, err
+	}
+	client, err := s.getClient()
+	if err != nil {
+		return "", nil, strategy.WatchError(ref.String(), err)
+	}
+	secret, err := client.Get(ctx, ref.namespace, ref.name)
+	if err != nil {
+		return "", nil, strategy.ReadError(ref.String(), err)
+	}
+	value, err = ref.decode(secret)
+	if err != nil {
+		return "", nil, err
+	}
+	out := make(chan string)
+	go run(ctx, client, ref, secret.ResourceVersion, value, out)
+	return value, out, nil
+}
+
+func run(ctx context.Context, client Client, ref secretRef, rv, last string, out chan<- string) {
+	metrics.IncHotloadWatchGoroutines(strategyName)
+	defer metrics.DecHotloadWatchGoroutines(strategyName)
+	log := logger.GetLogger()
+	for {
+		events, err := client.Watch(ctx, ref.namespace, ref.name, rv)
+		if err == nil {
+			rv, last, err = follow(ctx, ref, rv, last, events, out)
+		}
+		if ctx.Err() != nil {
+			return
+		}
+		if err != nil {
+			log("k8s-secret: watch of", ref, "failed, reading it again:", err)
+			metrics.IncHotloadWatchRestarts(strategyName)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(rewatchDelay):
+		}
+		if err == nil {
+			// the API server ends watches regularly, resume where it ended
+			continue
+		}
+		// start over from the current Secret, it may have changed meanwhile
+		secret, err := client.Get(ctx, ref.namespace, ref.name)
+		if err != nil {
+			log("k8s-secret: could not read", ref, err)
+			rv = ""
+			continue
+		}
+		rv = secret.ResourceVersion
+		last = emit(ctx, ref, secret, last, out)
+	}
+}
+
+// follow emits the changes of events until the channel is closed and returns
+// the last resource version and value.
+func follow(ctx context.Context, ref secretRef, rv, last string, events <-chan Event, out chan<- string) (string, string, error) {
+	log := logger.GetLogger()
+	for {
+		select {
+		case <-ctx.Done():
+			return rv, last, nil
+		case e, ok := <-events:
+			if !ok {
+				return rv, last, nil
+			}
+			switch e.Type {
+			case Added, Modified:
+				rv = e.Secret.ResourceVersion
+				last = emit(ctx, ref, e.Secret, last, out)
+			case Deleted:
+				log("k8s-secret:", ref, "was deleted, keeping the previous value")
+			case Error:
+				return rv, last, e.Err
+			}
+		}
+	}
+}
+
+// emit sends the value of secret if it changed and returns the current value.
+func emit(ctx context.Context, ref secretRef, secret *Secret, last string, out chan<- string) string {
+	v, err := ref.decode(secret)
+	if err != nil {
+		logger.GetLogger()("k8s-secret: ignoring update:", err)
+		return last
+	}
+	if v == last {
+		return last
+	}
+	logger.GetLogger()("k8s-secret:", ref, "changed")
+	select {
+	case out <- v:
+		return v
+	case <-ctx.Done():
+		return last
+	}
+}
@@ -0,0 +1,18 @@
+package k8ssecret
+
+import (
+	"testing"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+func TestK8sSecret(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "K8sSecret Suite")
+}
+
+var _ = BeforeSuite(func() {
+	rewatchDelay = 10 * time.Millisecond
+})
@@ -0,0 +1,313 @@
+package k8ssecret
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/infobloxopen/hotload/strategy"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+func b64(s string) string {
+	return base64.StdEncoding.EncodeToString([]byte(s))
+}
+
+// fakeClient serves a single Secret, watches receive the events sent on
+// events.
+type fakeClient struct {
+	mu       sync.Mutex
+	secret   *Secret
+	getErr   error
+	watchErr error
+	gets     int
+	events   chan Event
+}
+
+func (c *fakeClient) Get(ctx context.Context, namespace, name string) (*Secret, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.gets++
+	if c.getErr != nil {
+		return nil, c.getErr
+	}
+	return c.secret, nil
+}
+
+func (c *fakeClient) Watch(ctx context.Context, namespace, name, resourceVersion string) (<-chan Event, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.watchErr != nil {
+		return nil, c.watchErr
+	}
+	return c.events, nil
+}
+
+func (c *fakeClient) set(f func(c *fakeClient)) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	f(c)
+}
+
+func (c *fakeClient) getCount() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.gets
+}
+
+var _ = Describe("Strategy", func() {
+	var (
+		ctx    context.Context
+		cancel context.CancelFunc
+		client *fakeClient
+		opts   url.Values
+	)
+
+	BeforeEach(func() {
+		ctx, cancel = context.WithCancel(context.Background())
+		client = &fakeClient{
+			secret: &Secret{ResourceVersion: "1", Data: map[string]string{"dsn": b64("dbname=one\n")}},
+			events: make(chan Event),
+		}
+		opts = url.Values{KeyKey: {"dsn"}}
+	})
+
+	AfterEach(func() {
+		cancel()
+	})
+
+	It("Should decode the key", func() {
+		v, _, err := NewStrategy(client).Watch(ctx, "/orders/orders-db", opts)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(v).To(Equal("dbname=one"))
+	})
+
+	It("Should require the key and a namespace and name", func() {
+		_, _, err := NewStrategy(client).Watch(ctx, "/orders/orders-db", url.Values{})
+		Expect(err).To(MatchError(strategy.ErrMissingOption))
+		_, _, err = NewStrategy(client).Watch(ctx, "/orders", opts)
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("Should fail on a missing key or invalid base64", func() {
+		_, _, err := NewStrategy(client).Watch(ctx, "/orders/orders-db", url.Values{KeyKey: {"other"}})
+		Expect(err).To(MatchError(strategy.ErrResourceNotFound))
+		client.secret.Data["dsn"] = "not base64!"
+		_, _, err = NewStrategy(client).Watch(ctx, "/orders/orders-db", opts)
+		Expect(err).To(MatchError(strategy.ErrDecodeFailed))
+		Expect(err.Error()).ToNot(ContainSubstring("not base64"))
+	})
+
+	It("Should surface forbidden errors", func() {
+		client.getErr = fmt.Errorf("%w: denied", ErrForbidden)
+		_, _, err := NewStrategy(client).Watch(ctx, "/orders/orders-db", opts)
+		Expect(err).To(MatchError(ErrForbidden))
+		Expect(err).To(MatchError(strategy.ErrReadFailed))
+	})
+
+	It("Should emit updates and skip unchanged values", func() {
+		_, values, err := NewStrategy(client).Watch(ctx, "/orders/orders-db", opts)
+		Expect(err).ToNot(HaveOccurred())
+		client.events <- Event{Type: Modified, Secret: &Secret{ResourceVersion: "2", Data: map[string]string{"dsn": b64("dbname=one")}}}
+		client.events <- Event{Type: Modified, Secret: &Secret{ResourceVersion: "3", Data: map[string]string{"dsn": b64("dbname=two")}}}
+		Eventually(values).Should(Receive(Equal("dbname=two")))
+		client.events <- Event{Type: Deleted, Secret: &Secret{ResourceVersion: "4"}}
+		Consistently(values, "50ms").ShouldNot(Receive())
+	})
+
+	It("Should read the secret again after watch errors", func() {
+		_, values, err := NewStrategy(client).Watch(ctx, "/orders/orders-db", opts)
+		Expect(err).ToNot(HaveOccurred())
+		client.set(func(c *fakeClient) {
+			c.secret = &Secret{ResourceVersion: "5", Data: map[string]string{"dsn": b64("dbname=two")}}
+		})
+		client.events <- Event{Type: Error, Err: ErrGone}
+		Eventually(values).Should(Receive(Equal("dbname=two")))
+		Expect(client.getCount()).To(Equal(2))
+	})
+
+	It("Should stop watching when ctx is canceled", func() {
+		_, values, err := NewStrategy(client).Watch(ctx, "/orders/orders-db", opts)
+		Expect(err).ToNot(HaveOccurred())
+		cancel()
+		Consistently(func() bool {
+			select {
+			case client.events <- Event{Type: Modified, Secret: &Secret{Data: map[string]string{"dsn": b64("dbname=two")}}}:
+				return true
+			default:
+				return false
+			}
+		}, "50ms").Should(BeFalse())
+		Consistently(values, "50ms").ShouldNot(Receive())
+	})
+})
+
+var _ = Describe("restClient", func() {
+	var (
+		ctx       context.Context
+		cancel    context.CancelFunc
+		mux       *http.ServeMux
+		server    *httptest.Server
+		client    *restClient
+		tokenFile string
+		dir       string
+	)
+
+	BeforeEach(func() {
+		ctx, cancel = context.WithCancel(context.Background())
+		mux = http.NewServeMux()
+		server = httptest.NewServer(mux)
+		var err error
+		dir, err = os.MkdirTemp("", "k8ssecret")
+		Expect(err).ToNot(HaveOccurred())
+		tokenFile = filepath.Join(dir, "token")
+		Expect(os.WriteFile(tokenFile, []byte("tok\n"), 0600)).To(Succeed())
+		client = newRESTClient(server.URL, tokenFile, server.Client())
+	})
+
+	AfterEach(func() {
+		cancel()
+		server.Close()
+		os.RemoveAll(dir)
+	})
+
+	secretJSON := func(rv, dsn string) map[string]interface{} {
+		return map[string]interface{}{
+			"metadata": map[string]string{"resourceVersion": rv},
+			"data":     map[string]string{"dsn": b64(dsn)},
+		}
+	}
+
+	It("Should get the secret with the token", func() {
+		mux.HandleFunc("/api/v1/namespaces/orders/secrets/orders-db", func(w http.ResponseWriter, r *http.Request) {
+			if r.Header.Get("Authorization") != "Bearer tok" {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			json.NewEncoder(w).Encode(secretJSON("7", "dbname=one"))
+		})
+		s, err := client.Get(ctx, "orders", "orders-db")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(s.ResourceVersion).To(Equal("7"))
+		Expect(s.Data["dsn"]).To(Equal(b64("dbname=one")))
+	})
+
+	It("Should map forbidden and not found", func() {
+		mux.HandleFunc("/api/v1/namespaces/orders/secrets/orders-db", func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusForbidden)
+			w.Write([]byte(`{"kind":"Status","message":"secrets \"orders-db\" is forbidden","reason":"Forbidden","code":403}`))
+		})
+		_, err := client.Get(ctx, "orders", "orders-db")
+		Expect(err).To(MatchError(ErrForbidden))
+		Expect(err.Error()).To(ContainSubstring("is forbidden"))
+
+		_, err = client.Get(ctx, "orders", "missing")
+		Expect(strategy.ReadError("secret", err)).To(MatchError(strategy.ErrResourceNotFound))
+	})
+
+	It("Should stream watch events", func() {
+		mux.HandleFunc("/api/v1/namespaces/orders/secrets", func(w http.ResponseWriter, r *http.Request) {
+			q := r.URL.Query()
+			if q.Get("watch") != "1" || q.Get("fieldSelector") != "metadata.name=orders-db" || q.Get("resourceVersion") != "7" {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			enc := json.NewEncoder(w)
+			enc.Encode(map[string]interface{}{"type": "MODIFIED", "object": secretJSON("8", "dbname=two")})
+			enc.Encode(map[string]interface{}{"type": "ERROR", "object": map[string]interface{}{"code": 410, "message": "too old"}})
+		})
+		events, err := client.Watch(ctx, "orders", "orders-db", "7")
+		Expect(err).ToNot(HaveOccurred())
+		var e Event
+		Eventually(events).Should(Receive(&e))
+		Expect(e.Type).To(Equal(Modified))
+		Expect(e.Secret.ResourceVersion).To(Equal("8"))
+		Eventually(events).Should(Receive(&e))
+		Expect(e.Type).To(Equal(Error))
+		Expect(e.Err).To(MatchError(ErrGone))
+		Eventually(events).Should(BeClosed())
+	})
+})
+
+// clientCert returns a self-signed client certificate and a pool to verify it.
+func clientCert() (tls.Certificate, *x509.CertPool) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	Expect(err).ToNot(HaveOccurred())
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "hotload"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	Expect(err).ToNot(HaveOccurred())
+	cert, err := x509.ParseCertificate(der)
+	Expect(err).ToNot(HaveOccurred())
+	pool := x509.NewCertPool()
+	pool.AddCert(cert)
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key, Leaf: cert}, pool
+}
+
+var _ = Describe("NewClient", func() {
+	var (
+		server *httptest.Server
+		cert   tls.Certificate
+		roots  *x509.CertPool
+	)
+
+	BeforeEach(func() {
+		var clientCAs *x509.CertPool
+		cert, clientCAs = clientCert()
+		mux := http.NewServeMux()
+		mux.HandleFunc("/api/v1/namespaces/orders/secrets/orders-db", func(w http.ResponseWriter, r *http.Request) {
+			if r.Header.Get("Authorization") != "" || len(r.TLS.PeerCertificates) == 0 {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"metadata": map[string]string{"resourceVersion": "3"},
+				"data":     map[string]string{"dsn": b64("dbname=" + r.TLS.PeerCertificates[0].Subject.CommonName)},
+			})
+		})
+		server = httptest.NewUnstartedServer(mux)
+		server.TLS = &tls.Config{ClientAuth: tls.RequireAndVerifyClientCert, ClientCAs: clientCAs}
+		server.StartTLS()
+		roots = x509.NewCertPool()
+		roots.AddCert(server.Certificate())
+	})
+
+	AfterEach(func() {
+		server.Close()
+	})
+
+	It("Should authenticate with the client certificate", func() {
+		client := NewClient(server.URL+"/", &tls.Config{RootCAs: roots, Certificates: []tls.Certificate{cert}}, "")
+		v, _, err := NewStrategy(client).Watch(context.Background(), "/orders/orders-db", url.Values{KeyKey: {"dsn"}})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(v).To(Equal("dbname=hotload"))
+	})
+
+	It("Should fail without a client certificate", func() {
+		client := NewClient(server.URL, &tls.Config{RootCAs: roots}, "")
+		_, err := client.Get(context.Background(), "orders", "orders-db")
+		Expect(err).To(HaveOccurred())
+	})
+})
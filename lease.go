@@ -0,0 +1,123 @@
+package hotload
+
+import (
+	"sync"
+	"time"
+)
+
+// MaxNoRotateHold bounds how long a lease of AcquireNoRotate holds back
+// changes. A lease that is not released within it expires, so a caller that
+// never releases cannot stop rotations for good.
+var MaxNoRotateHold = 30 * time.Second
+
+// noRotateLeases holds back changes of a location while leases are active,
+// only the latest one is kept and applied once the last lease is released.
+type noRotateLeases struct {
+	active  map[int]clockTimer
+	next    int
+	pending string
+	held    bool
+}
+
+// AcquireNoRotate stops connection information changes of the hotload
+// location name, the connection string given to sql.Open, from resetting
+// connections until release is called, e.g. around a critical sequence of
+// statements that is not a single transaction:
+//
+//	release := hotload.AcquireNoRotate(name)
+//	defer release()
+//
+// Changes are held back like during QuiesceFor, the latest one is applied once
+// the last lease of the location is released. Leases expire after
+// MaxNoRotateHold. Calling release again is a no-op. Unknown locations have
+// no connections that could be reset, their release does nothing.
+func AcquireNoRotate(name string) (release func()) {
+	return hotloadDriver.AcquireNoRotate(name)
+}
+
+func (h *hdriver) AcquireNoRotate(name string) (release func()) {
+	cg, ok := h.group(name)
+	if !ok {
+		return func() {}
+	}
+	return cg.acquireNoRotate()
+}
+
+func (cg *chanGroup) acquireNoRotate() func() {
+	cg.mu.Lock()
+	defer cg.mu.Unlock()
+	l := &cg.leases
+	if l.active == nil {
+		l.active = make(map[int]clockTimer)
+	}
+	l.next++
+	id := l.next
+	l.active[id] = cg.afterFunc(MaxNoRotateHold, func() {
+		cg.log("no-rotate lease expired for location", cg.name, "after", MaxNoRotateHold)
+		cg.releaseNoRotate(id)
+	})
+	var once sync.Once
+	return func() { once.Do(func() { cg.releaseNoRotate(id) }) }
+}
+
+// releaseNoRotate ends the lease id. Once no lease is left the change held
+// back meanwhile is applied, unless the source went back to the current value.
+func (cg *chanGroup) releaseNoRotate(id int) {
+	cg.mu.Lock()
+	l := &cg.leases
+	timer, ok := l.active[id]
+	if !ok {
+		cg.mu.Unlock()
+		return
+	}
+	timer.Stop()
+	delete(l.active, id)
+	if len(l.active) > 0 || !l.held {
+		cg.mu.Unlock()
+		return
+	}
+	v := l.pending
+	l.pending, l.held = "", false
+	cg.mu.Unlock()
+	if cg.sameValue(v, cg.currentValue()) {
+		return
+	}
+	cg.log("applying held back connection information for location", cg.name)
+	cg.valueChanged(v)
+}
+
+// dropLeased forgets the change held back by the leases, the source went
+// back to the value in use. The leases stay active.
+func (cg *chanGroup) dropLeased() {
+	cg.mu.Lock()
+	defer cg.mu.Unlock()
+	cg.leases.pending, cg.leases.held = "", false
+}
+
+// stopLeases ends the leases without applying their held back change, the
+// group is torn down.
+func (cg *chanGroup) stopLeases() {
+	cg.mu.Lock()
+	defer cg.mu.Unlock()
+	l := &cg.leases
+	for id, timer := range l.active {
+		timer.Stop()
+		delete(l.active, id)
+	}
+	l.pending, l.held = "", false
+}
+
+// holdIfLeased reports whether the change to v must be held back because a
+// lease of AcquireNoRotate is active.
+func (cg *chanGroup) holdIfLeased(v string) bool {
+	cg.mu.Lock()
+	defer cg.mu.Unlock()
+	l := &cg.leases
+	if len(l.active) == 0 {
+		return false
+	}
+	cg.log("no-rotate lease active, holding change for location", cg.name)
+	l.pending = v
+	l.held = true
+	return true
+}
@@ -0,0 +1,205 @@
+package metrics
+
+import "sync/atomic"
+
+// Kind is the kind of an Instrument. It maps to the instrument types of
+// metrics backends.
+type Kind int
+
+const (
+	// Counter values are increments of a monotonic sum.
+	Counter Kind = iota
+	// UpDownCounter values are increments or decrements of a sum.
+	UpDownCounter
+	// Histogram values are observations of a distribution.
+	Histogram
+	// Gauge values replace the current value.
+	Gauge
+)
+
+// Instrument describes a hotload metric independently of the metrics
+// backend. The Prometheus collectors are built from it, Recorders use it
+// to create the instruments of other backends.
+type Instrument struct {
+	Name string
+	Help string
+	Kind Kind
+	// Labels are the names of the label values passed to Recorder.Record,
+	// in order.
+	Labels []string
+}
+
+var (
+	SqlStmts = Instrument{
+		Name:   SqlStmtsSummaryName,
+		Help:   "The number of sql stmts called in a transaction by statement type per grpc service and method",
+		Kind:   Histogram,
+		Labels: []string{GRPCServiceKey, GRPCMethodKey, StatementKey},
+	}
+	HotloadModtimeLatency = Instrument{
+		Name:   HotloadModtimeLatencyHistogramName,
+		Help:   "Hotload modtime latency histogram (seconds)",
+		Kind:   Histogram,
+		Labels: []string{PathKey, StrategyKey},
+	}
+	HotloadChangeLatency = Instrument{
+		Name:   HotloadChangeLatencyHistogramName,
+		Help:   "Hotload config change propagation latency histogram (seconds)",
+		Kind:   Histogram,
+		Labels: []string{LocationKey},
+	}
+	HotloadResetBadConn = Instrument{
+		Name:   HotloadResetBadConnCounterName,
+		Help:   "Number of connections reported bad after a hotload reset",
+		Kind:   Counter,
+		Labels: []string{LocationKey},
+	}
+	HotloadWatchGoroutines = Instrument{
+		Name:   HotloadWatchGoroutinesGaugeName,
+		Help:   "Number of active hotload watch goroutines",
+		Kind:   UpDownCounter,
+		Labels: []string{StrategyKey},
+	}
+	HotloadWatchRestarts = Instrument{
+		Name:   HotloadWatchRestartsCounterName,
+		Help:   "Number of hotload watcher restarts",
+		Kind:   Counter,
+		Labels: []string{StrategyKey},
+	}
+	HotloadConnectionsClosed = Instrument{
+		Name:   HotloadConnectionsClosedCounterName,
+		Help:   "Number of hotload connections closed by reason",
+		Kind:   Counter,
+		Labels: []string{LocationKey, ReasonKey},
+	}
+	HotloadConnectionsAbandoned = Instrument{
+		Name:   HotloadConnectionsAbandonedCounterName,
+		Help:   "Number of hotload connections abandoned because their close did not return within closeTimeout",
+		Kind:   Counter,
+		Labels: []string{LocationKey},
+	}
+	HotloadLastFetch = Instrument{
+		Name:   HotloadLastFetchGaugeName,
+		Help:   "Unix time hotload last received a value from the strategy",
+		Kind:   Gauge,
+		Labels: []string{LocationKey},
+	}
+	HotloadChanges = Instrument{
+		Name:   HotloadChangesCounterName,
+		Help:   "Number of hotload connection information changes applied",
+		Kind:   Counter,
+		Labels: []string{LocationKey},
+	}
+	HotloadOpenFailures = Instrument{
+		Name:   HotloadOpenFailuresCounterName,
+		Help:   "Number of hotload connection opens the driver failed",
+		Kind:   Counter,
+		Labels: []string{LocationKey},
+	}
+	HotloadConnections = Instrument{
+		Name:   HotloadConnectionsGaugeName,
+		Help:   "Number of open hotload connections",
+		Kind:   Gauge,
+		Labels: []string{LocationKey},
+	}
+	HotloadLastRotation = Instrument{
+		Name:   HotloadLastRotationGaugeName,
+		Help:   "Unix time hotload last reset the connections of the location",
+		Kind:   Gauge,
+		Labels: []string{LocationKey},
+	}
+	HotloadCoalescedUpdates = Instrument{
+		Name:   HotloadCoalescedUpdatesCounterName,
+		Help:   "Number of strategy updates replaced by a newer one before hotload applied them",
+		Kind:   Counter,
+		Labels: []string{LocationKey},
+	}
+	HotloadPendingUpdates = Instrument{
+		Name:   HotloadPendingUpdatesGaugeName,
+		Help:   "Number of strategy updates waiting to be applied by hotload",
+		Kind:   Gauge,
+		Labels: []string{LocationKey},
+	}
+	HotloadQueriesAfterRotation = Instrument{
+		Name:   HotloadQueriesAfterRotationCounterName,
+		Help:   "Number of queries and execs attempted within the rotation window after a rotation",
+		Kind:   Counter,
+		Labels: []string{LocationKey},
+	}
+	HotloadRotationOutcomes = Instrument{
+		Name:   HotloadRotationOutcomesCounterName,
+		Help:   "Number of hotload connection information changes by outcome of the change pipeline",
+		Kind:   Counter,
+		Labels: []string{LocationKey, StrategyKey, OutcomeKey},
+	}
+)
+
+// Instruments returns every hotload instrument.
+func Instruments() []Instrument {
+	return []Instrument{
+		SqlStmts,
+		HotloadModtimeLatency,
+		HotloadChangeLatency,
+		HotloadResetBadConn,
+		HotloadWatchGoroutines,
+		HotloadWatchRestarts,
+		HotloadConnectionsClosed,
+		HotloadConnectionsAbandoned,
+		HotloadLastFetch,
+		HotloadChanges,
+		HotloadOpenFailures,
+		HotloadConnections,
+		HotloadLastRotation,
+		HotloadQueriesAfterRotation,
+		HotloadCoalescedUpdates,
+		HotloadPendingUpdates,
+		HotloadRotationOutcomes,
+	}
+}
+
+// Recorder is a metrics backend receiving every hotload measurement, e.g. the
+// OpenTelemetry adapter of the github.com/infobloxopen/hotload/metrics/otel
+// module. Record is called with the
+// increment for counters, the observation for histograms and the current
+// value for gauges. labelValues are in the order of inst.Labels. Record must
+// be safe for concurrent use and should not block.
+type Recorder interface {
+	Record(inst Instrument, value float64, labelValues ...string)
+}
+
+type recorderBox struct {
+	r Recorder
+}
+
+var recorder atomic.Pointer[recorderBox]
+
+var prometheusDisabled atomic.Bool
+
+// SetPrometheusEnabled turns the updates of the Prometheus collectors on or
+// off. They are on by default, the collectors are registered with the default
+// Prometheus registry. Applications sending the metrics to another backend
+// with SetRecorder can turn them off.
+func SetPrometheusEnabled(enabled bool) {
+	prometheusDisabled.Store(!enabled)
+}
+
+func prometheusEnabled() bool {
+	return !prometheusDisabled.Load()
+}
+
+// SetRecorder makes r receive every measurement in addition to the Prometheus
+// collectors. Pass nil to remove it. Without a Recorder nothing but the
+// Prometheus collectors is updated, recording is a no-op.
+func SetRecorder(r Recorder) {
+	if r == nil {
+		recorder.Store(nil)
+		return
+	}
+	recorder.Store(&recorderBox{r: r})
+}
+
+func record(inst Instrument, value float64, labelValues ...string) {
+	if b := recorder.Load(); b != nil {
+		b.r.Record(inst, value, labelValues...)
+	}
+}
@@ -0,0 +1,138 @@
+// Package otel sends the hotload metrics to the OpenTelemetry Metrics API. It
+// is a module of its own so hotload itself does not depend on OpenTelemetry.
+//
+//	if err := otel.Use(provider); err != nil {
+//		log.Fatal(err)
+//	}
+package otel
+
+import (
+	"context"
+	"sync"
+
+	"github.com/infobloxopen/hotload/metrics"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/metric/noop"
+)
+
+// MeterName is the name of the meter the hotload instruments are created on.
+const MeterName = "github.com/infobloxopen/hotload"
+
+// Recorder is a metrics.Recorder creating an OpenTelemetry instrument for
+// every instrument of metrics.Instruments on the meter of a MeterProvider.
+// Gauges are observable gauges reporting the last value recorded for each set
+// of labels.
+type Recorder struct {
+	counters   map[string]metric.Float64Counter
+	upDowns    map[string]metric.Float64UpDownCounter
+	histograms map[string]metric.Float64Histogram
+	gauges     map[string]*gauge
+}
+
+// gauge holds the last values of a gauge, read by its callback.
+type gauge struct {
+	mu     sync.Mutex
+	values map[attribute.Distinct]gaugeValue
+}
+
+type gaugeValue struct {
+	set   attribute.Set
+	value float64
+}
+
+// NewRecorder creates the hotload instruments on the meter of mp. A nil mp
+// uses a no-op MeterProvider, recording then costs next to nothing.
+func NewRecorder(mp metric.MeterProvider) (*Recorder, error) {
+	if mp == nil {
+		mp = noop.NewMeterProvider()
+	}
+	meter := mp.Meter(MeterName)
+	r := &Recorder{
+		counters:   make(map[string]metric.Float64Counter),
+		upDowns:    make(map[string]metric.Float64UpDownCounter),
+		histograms: make(map[string]metric.Float64Histogram),
+		gauges:     make(map[string]*gauge),
+	}
+	for _, inst := range metrics.Instruments() {
+		desc := metric.WithDescription(inst.Help)
+		var err error
+		switch inst.Kind {
+		case metrics.Counter:
+			r.counters[inst.Name], err = meter.Float64Counter(inst.Name, desc)
+		case metrics.UpDownCounter:
+			r.upDowns[inst.Name], err = meter.Float64UpDownCounter(inst.Name, desc)
+		case metrics.Histogram:
+			r.histograms[inst.Name], err = meter.Float64Histogram(inst.Name, desc)
+		case metrics.Gauge:
+			g := &gauge{values: make(map[attribute.Distinct]gaugeValue)}
+			r.gauges[inst.Name] = g
+			_, err = meter.Float64ObservableGauge(inst.Name, desc, metric.WithFloat64Callback(g.observe))
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	return r, nil
+}
+
+// Use sends every hotload measurement to mp, in addition to the Prometheus
+// collectors unless metrics.SetPrometheusEnabled turned them off.
+func Use(mp metric.MeterProvider) error {
+	r, err := NewRecorder(mp)
+	if err != nil {
+		return err
+	}
+	metrics.SetRecorder(r)
+	return nil
+}
+
+// Record implements metrics.Recorder.
+func (r *Recorder) Record(inst metrics.Instrument, value float64, labelValues ...string) {
+	set := attributes(inst, labelValues)
+	ctx := context.Background()
+	switch inst.Kind {
+	case metrics.Counter:
+		if c, ok := r.counters[inst.Name]; ok {
+			c.Add(ctx, value, metric.WithAttributeSet(set))
+		}
+	case metrics.UpDownCounter:
+		if c, ok := r.upDowns[inst.Name]; ok {
+			c.Add(ctx, value, metric.WithAttributeSet(set))
+		}
+	case metrics.Histogram:
+		if h, ok := r.histograms[inst.Name]; ok {
+			h.Record(ctx, value, metric.WithAttributeSet(set))
+		}
+	case metrics.Gauge:
+		if g, ok := r.gauges[inst.Name]; ok {
+			g.set(set, value)
+		}
+	}
+}
+
+// attributes pairs the label values with the label names of inst.
+func attributes(inst metrics.Instrument, labelValues []string) attribute.Set {
+	kvs := make([]attribute.KeyValue, 0, len(labelValues))
+	for i, v := range labelValues {
+		if i < len(inst.Labels) {
+			kvs = append(kvs, attribute.String(inst.Labels[i], v))
+		}
+	}
+	return attribute.NewSet(kvs...)
+}
+
+func (g *gauge) set(set attribute.Set, value float64) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.values[set.Equivalent()] = gaugeValue{set: set, value: value}
+}
+
+func (g *gauge) observe(_ context.Context, o metric.Float64Observer) error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	for _, v := range g.values {
+		o.Observe(v.value, metric.WithAttributeSet(v.set))
+	}
+	return nil
+}
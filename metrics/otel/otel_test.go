@@ -0,0 +1,91 @@
+package otel
+
+import (
+	"context"
+	"testing"
+
+	"github.com/infobloxopen/hotload/metrics"
+	"go.opentelemetry.io/otel/attribute"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+)
+
+func TestRecorder(t *testing.T) {
+	reader := sdkmetric.NewManualReader()
+	r, err := NewRecorder(sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader)))
+	if err != nil {
+		t.Fatalf("NewRecorder() error = %v", err)
+	}
+	r.Record(metrics.HotloadChanges, 1, "fsnotify://postgres/a")
+	r.Record(metrics.HotloadChanges, 1, "fsnotify://postgres/a")
+	r.Record(metrics.HotloadConnections, 3, "fsnotify://postgres/a")
+	r.Record(metrics.HotloadConnections, 2, "fsnotify://postgres/a")
+	r.Record(metrics.HotloadWatchGoroutines, 1, "fsnotify")
+	r.Record(metrics.HotloadWatchGoroutines, -1, "fsnotify")
+	r.Record(metrics.HotloadChangeLatency, 0.5, "fsnotify://postgres/a")
+
+	var rm metricdata.ResourceMetrics
+	if err := reader.Collect(context.Background(), &rm); err != nil {
+		t.Fatalf("Collect() error = %v", err)
+	}
+	got := make(map[string]metricdata.Aggregation)
+	for _, sm := range rm.ScopeMetrics {
+		for _, m := range sm.Metrics {
+			got[m.Name] = m.Data
+		}
+	}
+	location := attribute.NewSet(attribute.String(metrics.LocationKey, "fsnotify://postgres/a"))
+
+	changes, ok := got[metrics.HotloadChanges.Name].(metricdata.Sum[float64])
+	if !ok || !changes.IsMonotonic || len(changes.DataPoints) != 1 || changes.DataPoints[0].Value != 2 {
+		t.Errorf("%s = %+v, want a monotonic sum of 2", metrics.HotloadChanges.Name, got[metrics.HotloadChanges.Name])
+	} else if !changes.DataPoints[0].Attributes.Equals(&location) {
+		t.Errorf("%s attributes = %v, want %v", metrics.HotloadChanges.Name, changes.DataPoints[0].Attributes, location)
+	}
+	conns, ok := got[metrics.HotloadConnections.Name].(metricdata.Gauge[float64])
+	if !ok || len(conns.DataPoints) != 1 || conns.DataPoints[0].Value != 2 {
+		t.Errorf("%s = %+v, want a gauge of the last value 2", metrics.HotloadConnections.Name, got[metrics.HotloadConnections.Name])
+	}
+	goroutines, ok := got[metrics.HotloadWatchGoroutines.Name].(metricdata.Sum[float64])
+	if !ok || goroutines.IsMonotonic || len(goroutines.DataPoints) != 1 || goroutines.DataPoints[0].Value != 0 {
+		t.Errorf("%s = %+v, want a non-monotonic sum of 0", metrics.HotloadWatchGoroutines.Name, got[metrics.HotloadWatchGoroutines.Name])
+	}
+	latency, ok := got[metrics.HotloadChangeLatency.Name].(metricdata.Histogram[float64])
+	if !ok || len(latency.DataPoints) != 1 || latency.DataPoints[0].Count != 1 {
+		t.Errorf("%s = %+v, want one observation", metrics.HotloadChangeLatency.Name, got[metrics.HotloadChangeLatency.Name])
+	}
+}
+
+func TestUse(t *testing.T) {
+	defer metrics.SetRecorder(nil)
+	defer metrics.SetPrometheusEnabled(true)
+	metrics.SetPrometheusEnabled(false)
+	reader := sdkmetric.NewManualReader()
+	if err := Use(sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader))); err != nil {
+		t.Fatalf("Use() error = %v", err)
+	}
+	metrics.IncHotloadOpenFailuresCounter("fsnotify://postgres/b")
+
+	var rm metricdata.ResourceMetrics
+	if err := reader.Collect(context.Background(), &rm); err != nil {
+		t.Fatalf("Collect() error = %v", err)
+	}
+	for _, sm := range rm.ScopeMetrics {
+		for _, m := range sm.Metrics {
+			if m.Name == metrics.HotloadOpenFailures.Name {
+				return
+			}
+		}
+	}
+	t.Errorf("%s not recorded through the MeterProvider", metrics.HotloadOpenFailures.Name)
+}
+
+func TestNoopDefault(t *testing.T) {
+	r, err := NewRecorder(nil)
+	if err != nil {
+		t.Fatalf("NewRecorder(nil) error = %v", err)
+	}
+	for _, inst := range metrics.Instruments() {
+		r.Record(inst, 1, inst.Labels...)
+	}
+}
@@ -1,6 +1,8 @@
 package metrics
 
 import (
+	"time"
+
 	"github.com/prometheus/client_golang/prometheus"
 )
 
@@ -13,32 +15,309 @@ const (
 
 	StrategyKey = "strategy"
 	PathKey     = "path"
+	LocationKey = "location"
+	ReasonKey   = "reason"
+	OutcomeKey  = "outcome"
 )
 
 // SqlStmtsSummary is a prometheus metric to keep track of the number of times
 // a sql statement is called in a transaction by statement type per grpc service
 var SqlStmtsSummaryName = "transaction_sql_stmts"
 var SqlStmtsSummary = prometheus.NewSummaryVec(prometheus.SummaryOpts{
-	Name: SqlStmtsSummaryName,
-	Help: "The number of sql stmts called in a transaction by statement type per grpc service and method",
-}, []string{GRPCServiceKey, GRPCMethodKey, StatementKey})
+	Name: SqlStmts.Name,
+	Help: SqlStmts.Help,
+}, SqlStmts.Labels)
+
+func ObserveSqlStmtsSummary(service, method, stmt string, val float64) {
+	if prometheusEnabled() {
+		SqlStmtsSummary.WithLabelValues(service, method, stmt).Observe(val)
+	}
+	record(SqlStmts, val, service, method, stmt)
+}
 
 // HotloadModtimeLatencyHistogram is modtime latency histogram (in seconds)
 // ie: each sample datapoint is time.Now().Sub(Modtime)
 var HotloadModtimeLatencyHistogramName = "hotload_modtime_latency_histogram"
 var HotloadModtimeLatencyHistogram = prometheus.NewHistogramVec(prometheus.HistogramOpts{
-	Name: HotloadModtimeLatencyHistogramName,
-	Help: "Hotload modtime latency histogram (seconds)",
-}, []string{PathKey, StrategyKey})
+	Name: HotloadModtimeLatency.Name,
+	Help: HotloadModtimeLatency.Help,
+}, HotloadModtimeLatency.Labels)
 
 func ObserveHotloadModtimeLatencyHistogram(strategy, path string, val float64) {
-	HotloadModtimeLatencyHistogram.WithLabelValues(strategy, path).Observe(val)
+	// the Prometheus label values have always been swapped, they are kept
+	// for existing dashboards
+	if prometheusEnabled() {
+		HotloadModtimeLatencyHistogram.WithLabelValues(strategy, path).Observe(val)
+	}
+	record(HotloadModtimeLatency, val, path, strategy)
+}
+
+// HotloadChangeLatencyHistogram is the time (in seconds) from a config change
+// to hotload applying it, per hotload location. The change time is embedded in
+// the value (changeTimeField) or, failing that, the time the value was
+// received from the strategy.
+var HotloadChangeLatencyHistogramName = "hotload_change_latency_seconds"
+var HotloadChangeLatencyHistogram = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+	Name: HotloadChangeLatency.Name,
+	Help: HotloadChangeLatency.Help,
+}, HotloadChangeLatency.Labels)
+
+func ObserveHotloadChangeLatencyHistogram(location string, val float64) {
+	if prometheusEnabled() {
+		HotloadChangeLatencyHistogram.WithLabelValues(location).Observe(val)
+	}
+	record(HotloadChangeLatency, val, location)
+}
+
+// HotloadResetBadConnCounter counts connections reported bad to database/sql
+// because hotload reset them after a config change, per hotload location.
+// Each one is a transparent retry by database/sql.
+var HotloadResetBadConnCounterName = "hotload_reset_bad_conn_total"
+var HotloadResetBadConnCounter = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Name: HotloadResetBadConn.Name,
+	Help: HotloadResetBadConn.Help,
+}, HotloadResetBadConn.Labels)
+
+func IncHotloadResetBadConnCounter(location string) {
+	if prometheusEnabled() {
+		HotloadResetBadConnCounter.WithLabelValues(location).Inc()
+	}
+	record(HotloadResetBadConn, 1, location)
+}
+
+// HotloadWatchGoroutinesGauge is the number of active watch goroutines per
+// strategy. The run loop of each hotload location is counted under the
+// "hotload" strategy. A steady rise indicates a goroutine leak.
+var HotloadWatchGoroutinesGaugeName = "hotload_watch_goroutines"
+var HotloadWatchGoroutinesGauge = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+	Name: HotloadWatchGoroutines.Name,
+	Help: HotloadWatchGoroutines.Help,
+}, HotloadWatchGoroutines.Labels)
+
+func IncHotloadWatchGoroutines(strategy string) {
+	if prometheusEnabled() {
+		HotloadWatchGoroutinesGauge.WithLabelValues(strategy).Inc()
+	}
+	record(HotloadWatchGoroutines, 1, strategy)
+}
+
+func DecHotloadWatchGoroutines(strategy string) {
+	if prometheusEnabled() {
+		HotloadWatchGoroutinesGauge.WithLabelValues(strategy).Dec()
+	}
+	record(HotloadWatchGoroutines, -1, strategy)
+}
+
+// HotloadWatchRestartsCounter counts watchers re-established by a strategy,
+// e.g. after the watched file was replaced. A fast rise indicates a crash loop.
+var HotloadWatchRestartsCounterName = "hotload_watch_restarts_total"
+var HotloadWatchRestartsCounter = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Name: HotloadWatchRestarts.Name,
+	Help: HotloadWatchRestarts.Help,
+}, HotloadWatchRestarts.Labels)
+
+func IncHotloadWatchRestarts(strategy string) {
+	if prometheusEnabled() {
+		HotloadWatchRestartsCounter.WithLabelValues(strategy).Inc()
+	}
+	record(HotloadWatchRestarts, 1, strategy)
+}
+
+// HotloadConnectionsClosedCounter counts closed hotload connections per
+// hotload location and reason: force, drain, lazy, kill, shutdown or pool.
+// It tells connection churn caused by changes apart from normal pool churn.
+var HotloadConnectionsClosedCounterName = "hotload_connections_closed_total"
+var HotloadConnectionsClosedCounter = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Name: HotloadConnectionsClosed.Name,
+	Help: HotloadConnectionsClosed.Help,
+}, HotloadConnectionsClosed.Labels)
+
+func IncHotloadConnectionsClosedCounter(location, reason string) {
+	if prometheusEnabled() {
+		HotloadConnectionsClosedCounter.WithLabelValues(location, reason).Inc()
+	}
+	record(HotloadConnectionsClosed, 1, location, reason)
+}
+
+// HotloadConnectionsAbandonedCounter counts hotload connections per hotload
+// location whose close hung past closeTimeout during a reset. Each of them
+// leaks a connection and a goroutine until the driver returns.
+var HotloadConnectionsAbandonedCounterName = "hotload_connections_abandoned_total"
+var HotloadConnectionsAbandonedCounter = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Name: HotloadConnectionsAbandoned.Name,
+	Help: HotloadConnectionsAbandoned.Help,
+}, HotloadConnectionsAbandoned.Labels)
+
+func AddHotloadConnectionsAbandonedCounter(location string, n int) {
+	if prometheusEnabled() {
+		HotloadConnectionsAbandonedCounter.WithLabelValues(location).Add(float64(n))
+	}
+	record(HotloadConnectionsAbandoned, float64(n), location)
+}
+
+// HotloadLastFetchGauge is the unix time a strategy last delivered a value
+// for a hotload location, changed or not. It tracks the freshness of the
+// source, an unchanged value does not reset connections.
+var HotloadLastFetchGaugeName = "hotload_last_fetch_timestamp_seconds"
+var HotloadLastFetchGauge = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+	Name: HotloadLastFetch.Name,
+	Help: HotloadLastFetch.Help,
+}, HotloadLastFetch.Labels)
+
+func SetHotloadLastFetch(location string, t time.Time) {
+	v := float64(t.UnixNano()) / 1e9
+	if prometheusEnabled() {
+		HotloadLastFetchGauge.WithLabelValues(location).Set(v)
+	}
+	record(HotloadLastFetch, v, location)
+}
+
+// HotloadChangesCounter counts connection information changes applied per
+// hotload location.
+var HotloadChangesCounterName = "hotload_changes_total"
+var HotloadChangesCounter = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Name: HotloadChanges.Name,
+	Help: HotloadChanges.Help,
+}, HotloadChanges.Labels)
+
+func IncHotloadChangesCounter(location string) {
+	if prometheusEnabled() {
+		HotloadChangesCounter.WithLabelValues(location).Inc()
+	}
+	record(HotloadChanges, 1, location)
+}
+
+// HotloadOpenFailuresCounter counts connection opens the underlying driver
+// failed, after retries, per hotload location.
+var HotloadOpenFailuresCounterName = "hotload_open_failures_total"
+var HotloadOpenFailuresCounter = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Name: HotloadOpenFailures.Name,
+	Help: HotloadOpenFailures.Help,
+}, HotloadOpenFailures.Labels)
+
+func IncHotloadOpenFailuresCounter(location string) {
+	if prometheusEnabled() {
+		HotloadOpenFailuresCounter.WithLabelValues(location).Inc()
+	}
+	record(HotloadOpenFailures, 1, location)
+}
+
+// HotloadConnectionsGauge is the number of open connections hotload is
+// tracking per hotload location.
+var HotloadConnectionsGaugeName = "hotload_connections"
+var HotloadConnectionsGauge = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+	Name: HotloadConnections.Name,
+	Help: HotloadConnections.Help,
+}, HotloadConnections.Labels)
+
+func SetHotloadConnections(location string, n int) {
+	if prometheusEnabled() {
+		HotloadConnectionsGauge.WithLabelValues(location).Set(float64(n))
+	}
+	record(HotloadConnections, float64(n), location)
+}
+
+// HotloadLastRotationGauge is the unix time hotload last reset the
+// connections of a hotload location, on a change or a scheduled rotation.
+// time() - hotload_last_rotation_timestamp_seconds is the time since.
+var HotloadLastRotationGaugeName = "hotload_last_rotation_timestamp_seconds"
+var HotloadLastRotationGauge = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+	Name: HotloadLastRotation.Name,
+	Help: HotloadLastRotation.Help,
+}, HotloadLastRotation.Labels)
+
+func SetHotloadLastRotation(location string, t time.Time) {
+	v := float64(t.UnixNano()) / 1e9
+	if prometheusEnabled() {
+		HotloadLastRotationGauge.WithLabelValues(location).Set(v)
+	}
+	record(HotloadLastRotation, v, location)
+}
+
+// HotloadQueriesAfterRotationCounter counts the queries and execs attempted
+// on connections of a hotload location shortly after a rotation, to
+// correlate query errors with rotations.
+var HotloadQueriesAfterRotationCounterName = "hotload_queries_after_rotation_total"
+var HotloadQueriesAfterRotationCounter = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Name: HotloadQueriesAfterRotation.Name,
+	Help: HotloadQueriesAfterRotation.Help,
+}, HotloadQueriesAfterRotation.Labels)
+
+func IncHotloadQueriesAfterRotationCounter(location string) {
+	if prometheusEnabled() {
+		HotloadQueriesAfterRotationCounter.WithLabelValues(location).Inc()
+	}
+	record(HotloadQueriesAfterRotation, 1, location)
+}
+
+// HotloadCoalescedUpdatesCounter counts values a strategy sent while the
+// previous one was still waiting to be applied, e.g. during a slow reset. The
+// waiting value is dropped in favor of the newer one. A fast rising counter
+// points to a source that is too chatty.
+var HotloadCoalescedUpdatesCounterName = "hotload_coalesced_updates_total"
+var HotloadCoalescedUpdatesCounter = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Name: HotloadCoalescedUpdates.Name,
+	Help: HotloadCoalescedUpdates.Help,
+}, HotloadCoalescedUpdates.Labels)
+
+func IncHotloadCoalescedUpdatesCounter(location string) {
+	if prometheusEnabled() {
+		HotloadCoalescedUpdatesCounter.WithLabelValues(location).Inc()
+	}
+	record(HotloadCoalescedUpdates, 1, location)
+}
+
+// HotloadPendingUpdatesGauge is the backlog of values of a hotload location
+// received from the strategy but not yet applied, updates are coalesced so it
+// is 0 or 1.
+var HotloadPendingUpdatesGaugeName = "hotload_pending_updates"
+var HotloadPendingUpdatesGauge = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+	Name: HotloadPendingUpdates.Name,
+	Help: HotloadPendingUpdates.Help,
+}, HotloadPendingUpdates.Labels)
+
+func SetHotloadPendingUpdates(location string, n int) {
+	if prometheusEnabled() {
+		HotloadPendingUpdatesGauge.WithLabelValues(location).Set(float64(n))
+	}
+	record(HotloadPendingUpdates, float64(n), location)
+}
+
+// HotloadRotationOutcomesCounter counts the decisions of the change pipeline
+// per hotload location, strategy and outcome: applied, unchanged,
+// rejected_validation, vetoed, health_gate_failed or flapping_suppressed.
+var HotloadRotationOutcomesCounterName = "hotload_rotation_outcomes_total"
+var HotloadRotationOutcomesCounter = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Name: HotloadRotationOutcomes.Name,
+	Help: HotloadRotationOutcomes.Help,
+}, HotloadRotationOutcomes.Labels)
+
+func IncHotloadRotationOutcomesCounter(location, strategy, outcome string) {
+	if prometheusEnabled() {
+		HotloadRotationOutcomesCounter.WithLabelValues(location, strategy, outcome).Inc()
+	}
+	record(HotloadRotationOutcomes, 1, location, strategy, outcome)
 }
 
 func GetCollectors() []prometheus.Collector {
 	return []prometheus.Collector{
 		SqlStmtsSummary,
 		HotloadModtimeLatencyHistogram,
+		HotloadResetBadConnCounter,
+		HotloadChangeLatencyHistogram,
+		HotloadWatchGoroutinesGauge,
+		HotloadWatchRestartsCounter,
+		HotloadConnectionsClosedCounter,
+		HotloadConnectionsAbandonedCounter,
+		HotloadLastFetchGauge,
+		HotloadChangesCounter,
+		HotloadOpenFailuresCounter,
+		HotloadConnectionsGauge,
+		HotloadLastRotationGauge,
+		HotloadQueriesAfterRotationCounter,
+		HotloadCoalescedUpdatesCounter,
+		HotloadPendingUpdatesGauge,
+		HotloadRotationOutcomesCounter,
 	}
 }
 
@@ -46,6 +325,21 @@ func GetCollectors() []prometheus.Collector {
 func ResetCollectors() {
 	SqlStmtsSummary.Reset()
 	HotloadModtimeLatencyHistogram.Reset()
+	HotloadResetBadConnCounter.Reset()
+	HotloadChangeLatencyHistogram.Reset()
+	HotloadWatchGoroutinesGauge.Reset()
+	HotloadWatchRestartsCounter.Reset()
+	HotloadConnectionsClosedCounter.Reset()
+	HotloadConnectionsAbandonedCounter.Reset()
+	HotloadLastFetchGauge.Reset()
+	HotloadChangesCounter.Reset()
+	HotloadOpenFailuresCounter.Reset()
+	HotloadConnectionsGauge.Reset()
+	HotloadLastRotationGauge.Reset()
+	HotloadQueriesAfterRotationCounter.Reset()
+	HotloadCoalescedUpdatesCounter.Reset()
+	HotloadPendingUpdatesGauge.Reset()
+	HotloadRotationOutcomesCounter.Reset()
 }
 
 func init() {
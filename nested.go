@@ -0,0 +1,55 @@
+package hotload
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ErrNestedLocation is returned for connection information that is itself a
+// hotload connection string, e.g. a source holding
+// fsnotify://postgres/etc/db/dsn instead of the postgres connection string.
+// This is almost always a value wrapped twice by a copy-paste mistake.
+var ErrNestedLocation = errors.New("hotload: connection information is a hotload connection string, it was likely wrapped twice")
+
+// nestedCheck holds the strategy and driver names registered when a location
+// started watching, so values can be checked without holding mu.
+type nestedCheck struct {
+	strategies map[string]bool
+	drivers    map[string]bool
+}
+
+// newNestedCheck returns the check for the registered names. Callers must
+// hold mu.
+func newNestedCheck() nestedCheck {
+	nc := nestedCheck{
+		strategies: map[string]bool{valueStrategyName: true, consensusStrategyName: true},
+		drivers:    make(map[string]bool),
+	}
+	for name := range strategies {
+		nc.strategies[name] = true
+	}
+	for name := range sqlDrivers {
+		nc.drivers[name] = true
+	}
+	for alias := range driverAliases {
+		nc.drivers[alias] = true
+	}
+	return nc
+}
+
+// check returns an error wrapping ErrNestedLocation if v is a URL whose
+// scheme is a strategy and whose host is a driver. Connection strings of the
+// drivers themselves, e.g. file:///var/lib/app.db, have no driver as host.
+func (nc nestedCheck) check(v string) error {
+	d, ok := splitDSNURL(strings.TrimSpace(v))
+	if !ok || d.userinfo != "" {
+		return nil
+	}
+	scheme := strings.TrimSuffix(d.prefix, "://")
+	if !nc.strategies[scheme] || !nc.drivers[d.hosts] {
+		return nil
+	}
+	return fmt.Errorf("%w: it names strategy %s and driver %s, the source must hold the connection string of the driver",
+		ErrNestedLocation, scheme, d.hosts)
+}
@@ -0,0 +1,75 @@
+package hotload
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"testing"
+)
+
+// fixedStrategy returns value for every path.
+type fixedStrategy struct {
+	value string
+}
+
+func (s fixedStrategy) Watch(ctx context.Context, pth string, options url.Values) (string, <-chan string, error) {
+	return s.value, make(chan string), nil
+}
+
+func Test_nestedCheck(t *testing.T) {
+	nc := nestedCheck{
+		strategies: map[string]bool{"fsnotify": true, "file": true},
+		drivers:    map[string]bool{"postgres": true},
+	}
+	tests := []struct {
+		name    string
+		value   string
+		wantErr bool
+	}{
+		{name: "doubly wrapped", value: "fsnotify://postgres/etc/db/dsn", wantErr: true},
+		{name: "doubly wrapped with query", value: " fsnotify://postgres/etc/db/dsn?forceKill=true\n", wantErr: true},
+		{name: "postgres URL", value: "postgres://app:secret@db:5432/app"},
+		{name: "strategy scheme without driver host", value: "file:///var/lib/app.db"},
+		{name: "strategy scheme with database host", value: "file://db.internal/app"},
+		{name: "userinfo", value: "fsnotify://app@postgres/app"},
+		{name: "key/value", value: "host=db dbname=app"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := nc.check(tt.value); errors.Is(err, ErrNestedLocation) != tt.wantErr {
+				t.Errorf("check() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestWatchNestedLocation(t *testing.T) {
+	RegisterStrategy("test-nested", fixedStrategy{value: "test-nested://test-nested/etc/db/dsn"})
+	RegisterSQLDriver("test-nested", &testDriver{})
+	defer func() {
+		UnregisterStrategy("test-nested")
+		mu.Lock()
+		delete(sqlDrivers, "test-nested")
+		mu.Unlock()
+	}()
+	h := newHdriver()
+	defer h.stop()
+
+	for _, name := range []string{
+		// the source holds a hotload connection string
+		"test-nested://test-nested/etc/db/dsn",
+		// the hotload connection string wraps another one
+		"test-nested://test-nested/test-nested://test-nested/etc/db/dsn",
+	} {
+		uri, err := url.Parse(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		mu.Lock()
+		_, err = h.watch(context.Background(), name, uri)
+		mu.Unlock()
+		if !errors.Is(err, ErrNestedLocation) {
+			t.Errorf("watch(%s) error = %v, want %v", name, err, ErrNestedLocation)
+		}
+	}
+}
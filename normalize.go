@@ -0,0 +1,111 @@
+package hotload
+
+import (
+	"net/url"
+	"sort"
+	"strings"
+)
+
+// normalizer canonicalizes a config value so that semantically equal values
+// compare equal. The normalized form is only used for change detection, the
+// raw value is always what gets passed to the underlying driver.
+type normalizer func(string) string
+
+var normalizers = map[string]normalizer{
+	"url":      normalizeURL,
+	"postgres": NormalizePostgres,
+}
+
+// normalizeURL canonicalizes URL style connection strings by lowercasing the
+// scheme and host and sorting the query parameters. Values that do not parse
+// as a URL are returned unchanged.
+func normalizeURL(v string) string {
+	u, err := url.Parse(strings.TrimSpace(v))
+	if err != nil || u.Scheme == "" {
+		return v
+	}
+	u.Scheme = strings.ToLower(u.Scheme)
+	u.Host = strings.ToLower(u.Host)
+	values, err := url.ParseQuery(u.RawQuery)
+	if err != nil {
+		return v
+	}
+	// Encode sorts by key, sort values too so repeated keys are order independent
+	for k := range values {
+		sort.Strings(values[k])
+	}
+	u.RawQuery = values.Encode()
+	return u.String()
+}
+
+// NormalizePostgres canonicalizes postgres connection strings. URL style
+// values are normalized like with normalize=url, key/value style ones get
+// lowercased keys sorted alphabetically, single spaces and no spaces around
+// the equal signs. Values that do not parse are returned unchanged. It is
+// meant for WithNormalizer:
+//
+//	hotload.RegisterSQLDriver("postgres", pq.Driver{}, hotload.WithNormalizer(hotload.NormalizePostgres))
+func NormalizePostgres(v string) string {
+	if strings.Contains(v, "://") {
+		return normalizeURL(v)
+	}
+	pairs, ok := splitKeyValues(v)
+	if !ok {
+		return v
+	}
+	sort.SliceStable(pairs, func(i, j int) bool { return pairs[i][0] < pairs[j][0] })
+	kvs := make([]string, len(pairs))
+	for i, p := range pairs {
+		kvs[i] = p[0] + "=" + p[1]
+	}
+	return strings.Join(kvs, " ")
+}
+
+// splitKeyValues splits a key/value style connection string into its pairs
+// with lowercased keys. Quoted values are kept quoted.
+func splitKeyValues(v string) ([][2]string, bool) {
+	var pairs [][2]string
+	s := strings.TrimSpace(v)
+	for s != "" {
+		eq := strings.IndexByte(s, '=')
+		if eq <= 0 {
+			return nil, false
+		}
+		key := strings.ToLower(strings.TrimSpace(s[:eq]))
+		if key == "" || strings.ContainsAny(key, " \t\n'") {
+			return nil, false
+		}
+		s = strings.TrimLeft(s[eq+1:], " \t\n")
+		var val string
+		if strings.HasPrefix(s, "'") {
+			end := 1
+			for ; end < len(s) && s[end] != '\''; end++ {
+				if s[end] == '\\' {
+					end++
+				}
+			}
+			if end >= len(s) {
+				return nil, false
+			}
+			val, s = s[:end+1], s[end+1:]
+		} else {
+			end := strings.IndexAny(s, " \t\n")
+			if end < 0 {
+				end = len(s)
+			}
+			val, s = s[:end], s[end:]
+		}
+		pairs = append(pairs, [2]string{key, val})
+		s = strings.TrimLeft(s, " \t\n")
+	}
+	return pairs, true
+}
+
+// driverNormalizer returns the normalizer the group's driver was registered
+// with, nil if there is none.
+func (cg *chanGroup) driverNormalizer() normalizer {
+	if cg.sqlDriver == nil {
+		return nil
+	}
+	return cg.sqlDriver.normalizer
+}
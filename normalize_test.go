@@ -0,0 +1,90 @@
+package hotload
+
+import "testing"
+
+func Test_normalizeURL(t *testing.T) {
+	tests := []struct {
+		name string
+		a    string
+		b    string
+		same bool
+	}{
+		{
+			name: "reordered query params",
+			a:    "postgres://localhost:5432/db?sslmode=disable&connect_timeout=5",
+			b:    "postgres://localhost:5432/db?connect_timeout=5&sslmode=disable",
+			same: true,
+		},
+		{
+			name: "host case",
+			a:    "postgres://LOCALHOST:5432/db",
+			b:    "postgres://localhost:5432/db",
+			same: true,
+		},
+		{
+			name: "different database",
+			a:    "postgres://localhost:5432/db1",
+			b:    "postgres://localhost:5432/db2",
+			same: false,
+		},
+		{
+			name: "non url values are compared verbatim",
+			a:    "user=a dbname=b",
+			b:    "dbname=b user=a",
+			same: false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := normalizeURL(tt.a) == normalizeURL(tt.b); got != tt.same {
+				t.Errorf("normalizeURL(%q) == normalizeURL(%q) is %v, want %v", tt.a, tt.b, got, tt.same)
+			}
+		})
+	}
+}
+
+func TestNormalizePostgres(t *testing.T) {
+	tests := []struct {
+		name string
+		v    string
+		want string
+	}{
+		{
+			name: "sorted lowercased keys",
+			v:    "user=app  Host=db dbname=app",
+			want: "dbname=app host=db user=app",
+		},
+		{
+			name: "spaces around equal signs",
+			v:    "host = db port= 5432",
+			want: "host=db port=5432",
+		},
+		{
+			name: "quoted values are kept",
+			v:    `password='a b\'c' host=db`,
+			want: `host=db password='a b\'c'`,
+		},
+		{
+			name: "url",
+			v:    "postgres://app@DB:5432/app?sslmode=disable&connect_timeout=5",
+			want: "postgres://app@db:5432/app?connect_timeout=5&sslmode=disable",
+		},
+		{
+			name: "unterminated quote is unchanged",
+			v:    "host=db password='secret",
+			want: "host=db password='secret",
+		},
+		{
+			name: "not key/value is unchanged",
+			v:    "bad dsn",
+			want: "bad dsn",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := NormalizePostgres(tt.v); got != tt.want {
+				t.Errorf("NormalizePostgres(%q) = %q, want %q", tt.v, got, tt.want)
+			}
+		})
+	}
+}
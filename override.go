@@ -0,0 +1,166 @@
+package hotload
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"sync/atomic"
+)
+
+// OverrideEnvPrefix is the prefix of the environment variables overriding the
+// connection information of locations, see EnableEnvOverrides.
+const OverrideEnvPrefix = "HOTLOAD_OVERRIDE_"
+
+var envOverrides atomic.Bool
+
+// EnableEnvOverrides turns environment overrides on or off. While on, a
+// location whose OverrideEnvName variable is set uses its value as the
+// connection information instead of the value of the strategy, e.g. to point
+// a service at a local database in development or CI without changing its
+// configuration. Overrides are read when a location is first opened and by
+// ReloadOverrides.
+//
+// Overrides are an escape hatch for development and tests, they are off by
+// default and only an explicit call enables them, so a stray environment
+// variable cannot redirect a production service. Do not call it in
+// production code.
+func EnableEnvOverrides(enabled bool) {
+	envOverrides.Store(enabled)
+}
+
+// OverrideEnvName returns the environment variable that overrides the
+// connection information of the hotload location name: OverrideEnvPrefix
+// followed by the location without its query, uppercased, with every run of
+// other characters than letters and digits replaced by an underscore, e.g.
+// HOTLOAD_OVERRIDE_FSNOTIFY_POSTGRES_TMP_MYCONFIG_TXT for
+// fsnotify://postgres/tmp/myconfig.txt?forceKill=true.
+func OverrideEnvName(name string) string {
+	name, _, _ = strings.Cut(name, "?")
+	var b strings.Builder
+	b.WriteString(OverrideEnvPrefix)
+	sep := false
+	for _, c := range strings.ToUpper(name) {
+		if 'A' <= c && c <= 'Z' || '0' <= c && c <= '9' {
+			if sep && b.Len() > len(OverrideEnvPrefix) {
+				b.WriteByte('_')
+			}
+			b.WriteRune(c)
+			sep = false
+			continue
+		}
+		sep = true
+	}
+	return b.String()
+}
+
+// lookupOverride returns the value of the override variable env, empty if
+// overrides are off or it is not set.
+func lookupOverride(env string) string {
+	if !envOverrides.Load() {
+		return ""
+	}
+	return os.Getenv(env)
+}
+
+// override is the environment override of a location.
+type override struct {
+	env string
+	// raw is the value of the variable, empty without an override
+	raw string
+	// value is raw prepared like a value of the strategy
+	value string
+	// source is the latest value of the strategy, restored once the
+	// override is removed
+	source string
+}
+
+// initOverride replaces the initial value of the group with its override, if
+// it has one. The group must not be shared yet.
+func (cg *chanGroup) initOverride() error {
+	cg.override.env = OverrideEnvName(cg.name)
+	raw := lookupOverride(cg.override.env)
+	if raw == "" {
+		return nil
+	}
+	v, directives, err := cg.prepareValue(raw)
+	if err == nil {
+		err = cg.checkHost(v)
+	}
+	if err != nil {
+		return fmt.Errorf("hotload: invalid %s: %w", cg.override.env, err)
+	}
+	cg.override.raw, cg.override.value, cg.override.source = raw, v, cg.value
+	cg.value = v
+	cg.noteDirectives(v, directives)
+	cg.applyDirectives(directives)
+	cg.log("connection information for location", cg.name, "overridden by", cg.override.env)
+	return nil
+}
+
+// overridden reports whether the change of the strategy to v must be ignored
+// because the location is overridden. v is restored once the override is
+// removed.
+func (cg *chanGroup) overridden(v string) bool {
+	cg.mu.Lock()
+	defer cg.mu.Unlock()
+	o := &cg.override
+	if o.raw == "" || v == o.value {
+		return false
+	}
+	o.source = v
+	cg.trace("connection information overridden by", o.env, "ignoring value of the strategy")
+	return true
+}
+
+// ReloadOverrides reads the override variables of all active locations again
+// and applies the ones that changed. A location whose override was removed
+// switches back to the latest value of its strategy. It does nothing unless
+// EnableEnvOverrides turned overrides on, or overrides were removed since.
+func ReloadOverrides() {
+	hotloadDriver.ReloadOverrides()
+}
+
+func (h *hdriver) ReloadOverrides() {
+	for _, cg := range h.groups() {
+		cg.reloadOverride()
+	}
+}
+
+func (cg *chanGroup) reloadOverride() {
+	raw := lookupOverride(cg.override.env)
+	cg.mu.Lock()
+	o := &cg.override
+	if raw == o.raw {
+		cg.mu.Unlock()
+		return
+	}
+	if o.raw == "" {
+		o.source = cg.value
+	}
+	v := o.source
+	cg.mu.Unlock()
+	if raw != "" {
+		var directives string
+		var err error
+		if v, directives, err = cg.prepareValue(raw); err != nil {
+			cg.log("retaining previous connection information for location", cg.name, "invalid", cg.override.env, err)
+			return
+		}
+		cg.noteDirectives(v, directives)
+	}
+	cg.mu.Lock()
+	o.raw, o.value = raw, ""
+	if raw != "" {
+		o.value = v
+	}
+	cg.mu.Unlock()
+	if raw == "" {
+		cg.log("override", cg.override.env, "removed, restoring connection information of the strategy for location", cg.name)
+	} else {
+		cg.log("connection information for location", cg.name, "overridden by", cg.override.env)
+	}
+	if v == "" || cg.sameValue(v, cg.currentValue()) {
+		return
+	}
+	cg.valueChanged(v)
+}
@@ -0,0 +1,93 @@
+package hotload
+
+import (
+	"context"
+	"net/url"
+	"testing"
+)
+
+func TestOverrideEnvName(t *testing.T) {
+	tests := []struct {
+		name string
+		want string
+	}{
+		{name: "fsnotify://postgres/tmp/myconfig.txt?forceKill=true", want: "HOTLOAD_OVERRIDE_FSNOTIFY_POSTGRES_TMP_MYCONFIG_TXT"},
+		{name: "k8ssecret://pg/orders-db/dsn", want: "HOTLOAD_OVERRIDE_K8SSECRET_PG_ORDERS_DB_DSN"},
+	}
+	for _, tt := range tests {
+		if got := OverrideEnvName(tt.name); got != tt.want {
+			t.Errorf("OverrideEnvName(%q) = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestEnvOverrides(t *testing.T) {
+	const name = "test-override://test-override/etc/db/dsn"
+	env := OverrideEnvName(name)
+	RegisterStrategy("test-override", fixedStrategy{value: "dbname=source"})
+	RegisterSQLDriver("test-override", &testDriver{})
+	defer func() {
+		UnregisterStrategy("test-override")
+		mu.Lock()
+		delete(sqlDrivers, "test-override")
+		mu.Unlock()
+	}()
+	watch := func(h *hdriver) *chanGroup {
+		t.Helper()
+		uri, err := url.Parse(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		cg, err := h.watch(context.Background(), name, uri)
+		if err != nil {
+			t.Fatalf("watch() error = %v", err)
+		}
+		return cg
+	}
+	t.Setenv(env, "dbname=local")
+
+	// without the opt-in the variable is ignored
+	disabled := newHdriver()
+	defer disabled.stop()
+	if v := watch(disabled).currentValue(); v != "dbname=source" {
+		t.Fatalf("value without EnableEnvOverrides = %q, want the value of the strategy", v)
+	}
+
+	EnableEnvOverrides(true)
+	defer EnableEnvOverrides(false)
+	h := newHdriver()
+	defer h.stop()
+	cg := watch(h)
+	if v := cg.currentValue(); v != "dbname=local" {
+		t.Fatalf("value = %q, want the override", v)
+	}
+	if !cg.stats().Overridden {
+		t.Errorf("stats().Overridden = false, want true")
+	}
+	// changes of the strategy are kept for later but not applied
+	cg.valueChanged("dbname=source2")
+	if v := cg.currentValue(); v != "dbname=local" {
+		t.Fatalf("value after a change of the strategy = %q, want the override", v)
+	}
+
+	t.Setenv(env, "dbname=local2")
+	h.ReloadOverrides()
+	if v := cg.currentValue(); v != "dbname=local2" {
+		t.Fatalf("value after reloading a changed override = %q, want %q", v, "dbname=local2")
+	}
+
+	t.Setenv(env, "")
+	h.ReloadOverrides()
+	if v := cg.currentValue(); v != "dbname=source2" {
+		t.Fatalf("value after removing the override = %q, want the latest value of the strategy", v)
+	}
+	if cg.stats().Overridden {
+		t.Errorf("stats().Overridden = true after removing the override")
+	}
+	cg.valueChanged("dbname=source3")
+	if v := cg.currentValue(); v != "dbname=source3" {
+		t.Errorf("value after a change of the strategy = %q, want it applied", v)
+	}
+}
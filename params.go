@@ -0,0 +1,94 @@
+package hotload
+
+import (
+	"net/url"
+	"sort"
+	"strings"
+)
+
+// ControlPrefix marks hotload control parameters in a hotload connection
+// string, hl.resetPolicy=force is the same as resetPolicy=force. Use it for a
+// control parameter whose name a strategy also uses, the prefixed form wins
+// over the plain one.
+const ControlPrefix = "hl."
+
+// controlParams are the query parameters hotload reads itself. They are not
+// forwarded to strategies.
+var controlParams = map[string]bool{
+	forceKill:              true,
+	driverOptions:          true,
+	normalize:              true,
+	resetPolicy:            true,
+	expandEnvKey:           true,
+	driverKey:              true,
+	maxConcurrentOpensKey:  true,
+	debugKey:               true,
+	rampWindowKey:          true,
+	rampStartKey:           true,
+	openRetriesKey:         true,
+	openRetryBackoffKey:    true,
+	changeTimeFieldKey:     true,
+	readOnlyKey:            true,
+	readOnlyKeywordsKey:    true,
+	certFilesKey:           true,
+	certPollIntervalKey:    true,
+	initialValueTimeoutKey: true,
+	transformsKey:          true,
+	historyDepthKey:        true,
+	flapLimitKey:           true,
+	flapWindowKey:          true,
+	tunnelHostKey:          true,
+	tunnelUserKey:          true,
+	tunnelKeyKey:           true,
+	appNameKey:             true,
+	ignoreBlankKey:         true,
+	minRotateIntervalKey:   true,
+	rotateScheduleKey:      true,
+	healthGateKey:          true,
+	healthQueryKey:         true,
+	rotationWindowKey:      true,
+	maxValueSizeKey:        true,
+	initSQLKey:             true,
+	stabilizeForKey:        true,
+	shardKey:               true,
+	idleWatcherTimeoutKey:  true,
+	closeTimeoutKey:        true,
+	channelBufferKey:       true,
+}
+
+// ControlParams returns a sorted list of the reserved query parameters
+// hotload reads itself and does not forward to strategies.
+func ControlParams() []string {
+	list := make([]string, 0, len(controlParams))
+	for name := range controlParams {
+		list = append(list, name)
+	}
+	sort.Strings(list)
+	return list
+}
+
+// splitParams separates the query parameters of a hotload connection string
+// into the hotload control parameters and the options of the strategy.
+// Parameters with ControlPrefix, and the dsn. parts of the connection string,
+// are always control parameters, if both forms of a control parameter are
+// given the plain one is a strategy option.
+func splitParams(vs url.Values) (control, options url.Values) {
+	control, options = url.Values{}, url.Values{}
+	for k, v := range vs {
+		if name, ok := strings.CutPrefix(k, ControlPrefix); ok {
+			control[name] = v
+			continue
+		}
+		if strings.HasPrefix(k, dsnPartPrefix) {
+			control[k] = v
+			continue
+		}
+		// with a prefixed form the plain one belongs to the strategy
+		if _, prefixed := vs[ControlPrefix+k]; !controlParams[k] || prefixed {
+			options[k] = v
+			continue
+		}
+		control[k] = v
+	}
+	return control, options
+}
@@ -0,0 +1,55 @@
+package hotload
+
+import (
+	"net/url"
+	"reflect"
+	"testing"
+)
+
+func Test_splitParams(t *testing.T) {
+	tests := []struct {
+		name        string
+		query       string
+		wantControl url.Values
+		wantOptions url.Values
+	}{
+		{
+			name:        "control and strategy params",
+			query:       "resetPolicy=force&debug=true&pollInterval=5s",
+			wantControl: url.Values{"resetPolicy": {"force"}, "debug": {"true"}},
+			wantOptions: url.Values{"pollInterval": {"5s"}},
+		},
+		{
+			name:        "prefixed control param",
+			query:       "hl.resetPolicy=drain&env=MY_DSN",
+			wantControl: url.Values{"resetPolicy": {"drain"}},
+			wantOptions: url.Values{"env": {"MY_DSN"}},
+		},
+		{
+			name:        "prefixed wins over plain",
+			query:       "debug=verbose&hl.debug=true",
+			wantControl: url.Values{"debug": {"true"}},
+			wantOptions: url.Values{"debug": {"verbose"}},
+		},
+		{
+			name:        "no params",
+			wantControl: url.Values{},
+			wantOptions: url.Values{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			vs, err := url.ParseQuery(tt.query)
+			if err != nil {
+				t.Fatal(err)
+			}
+			control, options := splitParams(vs)
+			if !reflect.DeepEqual(control, tt.wantControl) {
+				t.Errorf("splitParams() control = %v, want %v", control, tt.wantControl)
+			}
+			if !reflect.DeepEqual(options, tt.wantOptions) {
+				t.Errorf("splitParams() options = %v, want %v", options, tt.wantOptions)
+			}
+		})
+	}
+}
@@ -0,0 +1,138 @@
+package hotload
+
+import (
+	"strings"
+
+	"github.com/infobloxopen/hotload/metrics"
+)
+
+// A changed value of a location passes the stages of the change pipeline in
+// a fixed order, and each stage only runs if the previous ones let the value
+// through:
+//
+//  1. guards, in the order of changeGuards, may veto the value. A vetoed
+//     value is logged and recorded as a rejected AuditEvent, and is not
+//     passed to the later guards, the holds or the hooks.
+//  2. holds, in the order of hold, may defer the value. A held value
+//     enters the pipeline again once it is released, guards included, and
+//     is dropped if the source goes back to the value in use meanwhile.
+//  3. the value is applied and the connections are reset, by the location
+//     alone or by its rotation group.
+//  4. hooks run once the value is applied: the OnLocationActive and
+//     OnLocationIdle hooks of connections closed by the reset, then the
+//     audit sinks with the AuditEvent of the change.
+//
+// Every decision, from an unchanged value to an applied one, is counted as a
+// RotationOutcome and published to the Events streams as it is made.
+//
+// Values of locations overridden by the environment skip the pipeline, they
+// enter it once the override is removed.
+
+// RotationOutcome tells how the change pipeline decided on a value of the
+// strategy. It is the outcome label of the hotload_rotation_outcomes_total
+// metric.
+type RotationOutcome string
+
+const (
+	// RotationApplied is a value applied and connections reset.
+	RotationApplied RotationOutcome = "applied"
+	// RotationUnchanged is a value equivalent to the one in use, e.g. a
+	// keepalive of a polling strategy.
+	RotationUnchanged RotationOutcome = "unchanged"
+	// RotationRejectedValidation is a value the DSN validator of the driver
+	// rejected.
+	RotationRejectedValidation RotationOutcome = "rejected_validation"
+	// RotationVetoed is a value the host policy vetoed.
+	RotationVetoed RotationOutcome = "vetoed"
+	// RotationHealthGateFailed is a value that failed the health gate.
+	RotationHealthGateFailed RotationOutcome = "health_gate_failed"
+	// RotationFlappingSuppressed is a value held back because the source is
+	// flapping.
+	RotationFlappingSuppressed RotationOutcome = "flapping_suppressed"
+)
+
+// decide counts the decision o of the pipeline on the change from old to v
+// and publishes it to the Events streams.
+func (cg *chanGroup) decide(o RotationOutcome, old, v string) {
+	strategy, _, _ := strings.Cut(cg.name, "://")
+	metrics.IncHotloadRotationOutcomesCounter(cg.name, strategy, string(o))
+	cg.publishEvent(o, old, v)
+}
+
+// changeGuard vetoes values with an error, named in traces and counted as
+// outcome.
+type changeGuard struct {
+	name    string
+	check   func(cg *chanGroup, v string) error
+	outcome RotationOutcome
+}
+
+// changeGuards are the guards of the pipeline, in order. Cheap checks of the
+// value itself run before the health gate opens a connection.
+var changeGuards = []changeGuard{
+	{name: "validator", check: (*chanGroup).validate, outcome: RotationRejectedValidation},
+	{name: "host policy", check: (*chanGroup).checkHost, outcome: RotationVetoed},
+	{name: "health gate", check: (*chanGroup).checkHealth, outcome: RotationHealthGateFailed},
+}
+
+// hold runs the holds of the pipeline in order and reports whether one of
+// them took v. Unlike the guards they are not a table, they release the
+// values they took into valueChanged. Only flapping is counted as an
+// outcome, the other holds defer values the way the application asked for.
+func (cg *chanGroup) hold(v string) bool {
+	if cg.holdIfQuiesced(v) || cg.holdIfLeased(v) {
+		return true
+	}
+	if cg.holdIfFlapping(v) {
+		cg.decide(RotationFlappingSuppressed, cg.currentValue(), v)
+		return true
+	}
+	return cg.holdIfRotatedRecently(v)
+}
+
+// dropHeld drops the changes the holds took, and the value staged for a
+// rotation group, once the source went back to the value in use, e.g. a
+// source going from A to B and back to A while B is held, so the holds do not
+// apply B when they end. Unchanged values never reach the holds, received
+// tells them instead.
+func (cg *chanGroup) dropHeld() {
+	cg.dropFlapping()
+	cg.dropQuiesced()
+	cg.dropRotateLimited()
+	cg.dropLeased()
+	cg.unstage()
+}
+
+// stopHolds stops the timers of the holds and of stabilizeFor and drops the
+// value staged for a rotation group, the group is torn down.
+func (cg *chanGroup) stopHolds() {
+	cg.stopFlapping()
+	cg.stopQuiesce()
+	cg.stopRotateLimit()
+	cg.stopLeases()
+	cg.stopStabilizer()
+	cg.unstage()
+}
+
+// valueChanged passes the changed value v through the change pipeline.
+func (cg *chanGroup) valueChanged(v string) {
+	if cg.overridden(v) {
+		return
+	}
+	for _, g := range changeGuards {
+		if err := g.check(cg, v); err != nil {
+			cg.trace("value vetoed by the", g.name)
+			cg.decide(g.outcome, cg.currentValue(), v)
+			cg.rejectChange(v, err)
+			return
+		}
+	}
+	if cg.hold(v) {
+		return
+	}
+	if rg := rotationGroupOf(cg.name); rg != nil {
+		rg.stage(cg, v)
+		return
+	}
+	recordAudit(cg.applyChange(v))
+}
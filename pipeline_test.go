@@ -0,0 +1,151 @@
+package hotload
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"sync"
+
+	"github.com/infobloxopen/hotload/metrics"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+// stageRecorder records the stages of the change pipeline a value reached.
+type stageRecorder struct {
+	mu     sync.Mutex
+	stages []string
+}
+
+func (sr *stageRecorder) add(stage string) {
+	sr.mu.Lock()
+	defer sr.mu.Unlock()
+	sr.stages = append(sr.stages, stage)
+}
+
+func (sr *stageRecorder) get() []string {
+	sr.mu.Lock()
+	defer sr.mu.Unlock()
+	return append([]string(nil), sr.stages...)
+}
+
+// stageSink records the value of the location when audit events arrive.
+type stageSink struct {
+	cg       *chanGroup
+	recorder *stageRecorder
+}
+
+func (ss stageSink) Record(event AuditEvent) {
+	if event.Rejected != nil {
+		ss.recorder.add("rejected")
+		return
+	}
+	ss.recorder.add("audit " + ss.cg.currentValue())
+}
+
+var _ = Describe("Change pipeline", func() {
+	const driverName = "pipeline-test"
+	var cg *chanGroup
+	var hd *healthDriver
+	var recorder *stageRecorder
+	var vetoed error
+	var sinks []AuditSink
+
+	BeforeEach(func() {
+		hooksMu.RLock()
+		sinks = auditSinks
+		hooksMu.RUnlock()
+		hd = &healthDriver{}
+		recorder = &stageRecorder{}
+		vetoed = nil
+		cg = &chanGroup{
+			name:       "fsnotify://pipeline-test/pipeline",
+			driverName: driverName,
+			value:      "dbname=a",
+			sqlDriver:  &driverInstance{driver: hd},
+			log:        func(...interface{}) {},
+		}
+		cg.parentCtx = context.Background()
+		cg.ctx, cg.cancel = context.WithCancel(cg.parentCtx)
+		cg.parseValues(url.Values{healthGateKey: {"true"}})
+		RegisterDSNValidator(driverName, DSNValidatorFunc(func(dsn string) error {
+			// the health gate has not probed the value yet
+			recorder.add(fmt.Sprintf("validate %s after %d probes", dsn, len(hd.probes())))
+			return vetoed
+		}))
+		RegisterAuditSink(stageSink{cg: cg, recorder: recorder})
+	})
+
+	AfterEach(func() {
+		RegisterDSNValidator(driverName, nil)
+		hooksMu.Lock()
+		auditSinks = sinks
+		hooksMu.Unlock()
+	})
+
+	It("Should run the guards, apply the value, then run the hooks", func() {
+		ctx := cg.ctx
+		cg.valueChanged("dbname=b")
+		Expect(hd.probes()).To(HaveLen(1))
+		Expect(recorder.get()).To(Equal([]string{"validate dbname=b after 0 probes", "audit dbname=b"}),
+			"audit sinks see the applied value")
+		Expect(ctx.Err()).To(HaveOccurred(), "connections are reset before the hooks run")
+	})
+
+	It("Should not run later stages once a guard vetoes the value", func() {
+		ctx := cg.ctx
+		vetoed = errors.New("missing host")
+		cg.valueChanged("dbname=b")
+		Expect(recorder.get()).To(Equal([]string{"validate dbname=b after 0 probes", "rejected"}))
+		Expect(hd.probes()).To(BeEmpty(), "the health gate does not run")
+		Expect(cg.currentValue()).To(Equal("dbname=a"))
+		Expect(ctx.Err()).ToNot(HaveOccurred(), "connections are not reset")
+	})
+
+	It("Should count the outcome of each decision", func() {
+		outcome := func(o RotationOutcome) float64 {
+			return testutil.ToFloat64(metrics.HotloadRotationOutcomesCounter.WithLabelValues(cg.name, "fsnotify", string(o)))
+		}
+		metrics.HotloadRotationOutcomesCounter.Reset()
+		cg.received("dbname=b", cg.now())
+		cg.received("dbname=b", cg.now())
+		vetoed = errors.New("missing host")
+		cg.received("dbname=c", cg.now())
+		vetoed = nil
+		cg.received("dbname=unhealthy", cg.now())
+		cg.sqlDriver.hosts.deny = []string{"evil"}
+		cg.received("host=evil dbname=c", cg.now())
+
+		Expect(outcome(RotationApplied)).To(Equal(1.0))
+		Expect(outcome(RotationUnchanged)).To(Equal(1.0))
+		Expect(outcome(RotationRejectedValidation)).To(Equal(1.0))
+		Expect(outcome(RotationHealthGateFailed)).To(Equal(1.0))
+		Expect(outcome(RotationVetoed)).To(Equal(1.0))
+		Expect(outcome(RotationFlappingSuppressed)).To(BeZero())
+
+		cg.parseValues(url.Values{flapLimitKey: {"1"}})
+		cg.received("dbname=d", cg.now())
+		cg.received("dbname=e", cg.now())
+		Expect(outcome(RotationApplied)).To(Equal(2.0))
+		Expect(outcome(RotationFlappingSuppressed)).To(Equal(1.0))
+	})
+
+	It("Should run the guards again for values released by a hold", func() {
+		release := cg.acquireNoRotate()
+		cg.valueChanged("dbname=b")
+		Expect(recorder.get()).To(Equal([]string{"validate dbname=b after 0 probes"}))
+		Expect(cg.currentValue()).To(Equal("dbname=a"), "the value is held")
+
+		vetoed = errors.New("missing host")
+		release()
+		Expect(recorder.get()).To(Equal([]string{
+			"validate dbname=b after 0 probes",
+			"validate dbname=b after 1 probes",
+			"rejected",
+		}))
+		Expect(hd.probes()).To(HaveLen(1), "the vetoed value is not probed again")
+		Expect(cg.currentValue()).To(Equal("dbname=a"))
+	})
+})
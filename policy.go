@@ -0,0 +1,27 @@
+package hotload
+
+// ResetPolicy controls what happens to existing connections when the
+// connection information for a hotload location changes.
+type ResetPolicy string
+
+const (
+	// ResetPolicyLazy marks existing connections for reset, they are closed
+	// the next time database/sql tries to use them. This is the default.
+	ResetPolicyLazy ResetPolicy = "lazy"
+	// ResetPolicyForce closes existing connections immediately.
+	ResetPolicyForce ResetPolicy = "force"
+	// ResetPolicyDrain closes idle connections immediately and connections
+	// in a transaction as soon as the transaction completes.
+	ResetPolicyDrain ResetPolicy = "drain"
+	// ResetPolicySoft leaves existing connections alone, only connections
+	// opened after the change use the new connection information.
+	ResetPolicySoft ResetPolicy = "soft"
+)
+
+func parseResetPolicy(s string) (ResetPolicy, bool) {
+	switch p := ResetPolicy(s); p {
+	case ResetPolicyLazy, ResetPolicyForce, ResetPolicyDrain, ResetPolicySoft:
+		return p, true
+	}
+	return "", false
+}
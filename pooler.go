@@ -0,0 +1,97 @@
+package hotload
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+// PoolerConfig points connections of a driver at a connection pooling proxy,
+// e.g. PgBouncer or ProxySQL, instead of the database in the connection
+// string.
+type PoolerConfig struct {
+	// Addr is the host:port of the pooler. The host and port of every
+	// connection string are replaced with it.
+	Addr string
+	// StripParams are connection string parameters removed before opening,
+	// e.g. settings the pooler does not support in transaction pooling mode.
+	StripParams []string
+}
+
+// WithPooler rewrites the connection strings of the driver to connect through
+// the pooler in cfg whenever a connection is opened, so every rotated value
+// targets the pooler the same way. The rewrite happens after normalization
+// and before the driver options are merged, parameters added with
+// WithDriverOptions are not stripped. Host policies check the value before
+// it is rewritten. It panics if cfg.Addr is not a host:port.
+func WithPooler(cfg PoolerConfig) driverOption {
+	if _, _, err := net.SplitHostPort(cfg.Addr); err != nil {
+		panic("hotload: invalid pooler address " + cfg.Addr)
+	}
+	return func(d *driverInstance) {
+		d.pooler = &cfg
+	}
+}
+
+// rewrite points dsn at the pooler and strips its StripParams. A nil pooler
+// returns dsn unchanged.
+func (p *PoolerConfig) rewrite(dsn string) (string, error) {
+	if p == nil {
+		return dsn, nil
+	}
+	host, port, _ := net.SplitHostPort(p.Addr)
+	if d, ok := splitDSNURL(strings.TrimSpace(dsn)); ok {
+		d.hosts = p.Addr
+		if len(p.StripParams) > 0 {
+			values, err := url.ParseQuery(d.query)
+			if err != nil {
+				return "", fmt.Errorf("hotload: could not parse connection string for pooler: %w", err)
+			}
+			for _, k := range p.StripParams {
+				values.Del(k)
+			}
+			d.query = values.Encode()
+			d.hasQuery = d.query != ""
+		}
+		return d.String(), nil
+	}
+	for _, k := range append([]string{"host", "port"}, p.StripParams...) {
+		dsn = removeKeyValue(dsn, k)
+	}
+	return strings.TrimSpace(dsn + " host=" + quoteKeyValue(host) + " port=" + port), nil
+}
+
+// removeKeyValue removes every key=value pair with key from a key/value style
+// connection string.
+func removeKeyValue(dsn, key string) string {
+	re := regexp.MustCompile(`(?:^|\s+)` + regexp.QuoteMeta(key) + `\s*=\s*('(?:[^'\\]|\\.)*'|\S*)`)
+	return strings.TrimSpace(re.ReplaceAllString(dsn, ""))
+}
+
+// quoteKeyValue quotes v for a key/value connection string if needed, e.g.
+// IPv6 literals are fine bare but values with spaces are not.
+func quoteKeyValue(v string) string {
+	if v != "" && !strings.ContainsAny(v, ` '\`) {
+		return v
+	}
+	return "'" + strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace(v) + "'"
+}
+
+// unquoteKeyValue reverses quoteKeyValue.
+func unquoteKeyValue(v string) string {
+	if len(v) < 2 || v[0] != '\'' || v[len(v)-1] != '\'' {
+		return v
+	}
+	return strings.NewReplacer(`\\`, `\`, `\'`, `'`).Replace(v[1 : len(v)-1])
+}
+
+// driverPooler returns the pooler the group's driver was registered with, nil
+// if there is none.
+func (cg *chanGroup) driverPooler() *PoolerConfig {
+	if cg.sqlDriver == nil {
+		return nil
+	}
+	return cg.sqlDriver.pooler
+}
@@ -0,0 +1,97 @@
+package hotload
+
+import (
+	"context"
+	"testing"
+)
+
+func TestPoolerRewrite(t *testing.T) {
+	bouncer := &PoolerConfig{Addr: "pgbouncer:6432", StripParams: []string{"statement_cache_capacity"}}
+	tests := []struct {
+		name   string
+		pooler *PoolerConfig
+		dsn    string
+		want   string
+	}{
+		{name: "no pooler", dsn: "host=db port=5432", want: "host=db port=5432"},
+		{
+			name:   "url",
+			pooler: bouncer,
+			dsn:    "postgres://app:pw@db.internal:5432/app?sslmode=require&statement_cache_capacity=100",
+			want:   "postgres://app:pw@pgbouncer:6432/app?sslmode=require",
+		},
+		{
+			name:   "multi-host url",
+			pooler: bouncer,
+			dsn:    "postgres://app@db1:5432,db2:5432/app",
+			want:   "postgres://app@pgbouncer:6432/app",
+		},
+		{
+			name:   "key/value",
+			pooler: bouncer,
+			dsn:    "host=db.internal port=5432 user=app statement_cache_capacity=100 dbname=app",
+			want:   "user=app dbname=app host=pgbouncer port=6432",
+		},
+		{
+			name:   "key/value without port",
+			pooler: bouncer,
+			dsn:    "host='db.internal' dbname=app",
+			want:   "dbname=app host=pgbouncer port=6432",
+		},
+		{
+			name:   "ipv6 pooler",
+			pooler: &PoolerConfig{Addr: "[fd00::1]:6432"},
+			dsn:    "postgres://app@db:5432/app",
+			want:   "postgres://app@[fd00::1]:6432/app",
+		},
+		{
+			name:   "multi-host ipv6 url",
+			pooler: bouncer,
+			dsn:    "postgres://app@[fd00::1]:5432,[fd00::2]:5432/app?statement_cache_capacity=0",
+			want:   "postgres://app@pgbouncer:6432/app",
+		},
+		{
+			name:   "ipv6 pooler key/value",
+			pooler: &PoolerConfig{Addr: "[fd00::1]:6432"},
+			dsn:    "host=db dbname=app",
+			want:   "dbname=app host=fd00::1 port=6432",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.pooler.rewrite(tt.dsn)
+			if err != nil {
+				t.Fatalf("rewrite() error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("rewrite() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPoolerOpenDSN(t *testing.T) {
+	di := &driverInstance{}
+	WithPooler(PoolerConfig{Addr: "proxysql:6033", StripParams: []string{"interpolateParams"}})(di)
+	WithDriverOptions(map[string]string{"binary_parameters": "yes"})(di)
+	cg := &chanGroup{sqlDriver: di, value: "postgres://app@db:5432/app?interpolateParams=true"}
+	for _, v := range []string{cg.value, "postgres://app@db-rotated:5432/app"} {
+		cg.value = v
+		got, _, _, err := cg.openDSN(context.Background())
+		if err != nil {
+			t.Fatalf("openDSN() error = %v", err)
+		}
+		if want := "postgres://app@proxysql:6033/app?binary_parameters=yes"; got != want {
+			t.Errorf("openDSN() = %q, want %q", got, want)
+		}
+	}
+}
+
+func TestPoolerInvalidAddr(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Error("WithPooler() should panic on an address without port")
+		}
+	}()
+	WithPooler(PoolerConfig{Addr: "pgbouncer"})
+}
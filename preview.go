@@ -0,0 +1,111 @@
+package hotload
+
+// RotationPlan is what a rotation of a location to a candidate value would
+// do, see PreviewRotation.
+type RotationPlan struct {
+	// Location is the hotload connection string given to sql.Open.
+	Location string
+	// Changed is false if the candidate is equivalent to the value in use,
+	// the guards are not run then.
+	Changed bool
+	// Outcome is the outcome of the guards: RotationUnchanged,
+	// RotationApplied if every guard passed, or the outcome of the first
+	// guard that failed.
+	Outcome RotationOutcome
+	// Guards are the results of every guard, in the order of the change
+	// pipeline.
+	Guards []GuardResult
+	// Policy is the reset policy of the location, ResetPolicyForce with
+	// forceKill=true.
+	Policy ResetPolicy
+	// Connections is the number of open connections of the location.
+	Connections int
+	// InTransaction is the number of them in a transaction, which
+	// ResetPolicyDrain closes once the transaction completes.
+	InTransaction int
+	// Reset is the number of connections the rotation would reset, none
+	// with ResetPolicySoft.
+	Reset int
+	// Overridden is true while the location is overridden by the
+	// environment, the candidate would not be applied before the override
+	// is removed.
+	Overridden bool
+}
+
+// GuardResult is the result of a guard of the change pipeline.
+type GuardResult struct {
+	// Name is the guard: validator, host policy or health gate.
+	Name string
+	// Err is why the guard vetoed the candidate, nil if it passed.
+	Err error
+}
+
+// Passed reports whether every guard passed.
+func (p RotationPlan) Passed() bool {
+	for _, g := range p.Guards {
+		if g.Err != nil {
+			return false
+		}
+	}
+	return true
+}
+
+// PreviewRotation reports what a rotation of the hotload location name to
+// candidate would do, e.g. for admission controllers checking a value before
+// it is published, without changing the location: its value, connections,
+// metrics, audit sinks and Events streams are left alone. candidate is
+// connection information as the location uses it, after the transforms of
+// the location and without hotload directives.
+//
+// Every guard is run, unlike in the change pipeline also after one failed,
+// so the plan tells every reason to veto the candidate. The health gate
+// opens and closes a connection to the candidate like before a rotation.
+// Holds, e.g. QuiesceFor or minRotateInterval, are not previewed, they
+// defer a rotation but do not change what it does. It returns
+// ErrUnknownLocation if the location was never opened.
+func PreviewRotation(name, candidate string) (RotationPlan, error) {
+	return hotloadDriver.PreviewRotation(name, candidate)
+}
+
+func (h *hdriver) PreviewRotation(name, candidate string) (RotationPlan, error) {
+	cg, ok := h.group(name)
+	if !ok {
+		return RotationPlan{}, ErrUnknownLocation
+	}
+	return cg.preview(candidate), nil
+}
+
+func (cg *chanGroup) preview(candidate string) RotationPlan {
+	cg.mu.RLock()
+	p := RotationPlan{
+		Location:    cg.name,
+		Policy:      cg.resetPolicy,
+		Connections: len(cg.conns),
+		Overridden:  cg.override.raw != "",
+	}
+	for _, c := range cg.conns {
+		if c.InTx() {
+			p.InTransaction++
+		}
+	}
+	if p.Policy != ResetPolicySoft {
+		p.Reset = p.Connections
+	}
+	current := cg.value
+	cg.mu.RUnlock()
+
+	p.Outcome = RotationUnchanged
+	if cg.sameValue(candidate, current) {
+		return p
+	}
+	p.Changed = true
+	p.Outcome = RotationApplied
+	for _, g := range changeGuards {
+		err := g.check(cg, candidate)
+		p.Guards = append(p.Guards, GuardResult{Name: g.name, Err: err})
+		if err != nil && p.Outcome == RotationApplied {
+			p.Outcome = g.outcome
+		}
+	}
+	return p
+}
@@ -0,0 +1,91 @@
+package hotload
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestPreviewRotation(t *testing.T) {
+	const driverName = "preview-test"
+	errNoDatabase := errors.New("missing dbname")
+	RegisterDSNValidator(driverName, DSNValidatorFunc(func(dsn string) error {
+		if !strings.Contains(dsn, "dbname=") {
+			return errNoDatabase
+		}
+		return nil
+	}))
+	defer RegisterDSNValidator(driverName, nil)
+	ctx := context.Background()
+	cg := &chanGroup{
+		name:       "fsnotify://preview-test/preview",
+		driverName: driverName,
+		value:      "dbname=a",
+		sqlDriver:  &driverInstance{driver: &healthDriver{}},
+		log:        func(...interface{}) {},
+		parentCtx:  ctx,
+		ctx:        ctx,
+	}
+	cg.parseValues(url.Values{healthGateKey: {"true"}, forceKill: {"true"}})
+	idle, busy := &testConn{}, &testConn{}
+	cg.conns = []*managedConn{newManagedConn(ctx, cg.name, idle, nil), newManagedConn(ctx, cg.name, busy, nil)}
+	cg.conns[1].setInTx(true)
+
+	tests := []struct {
+		name      string
+		candidate string
+		changed   bool
+		outcome   RotationOutcome
+		failed    []string
+	}{
+		{name: "unchanged", candidate: "dbname=a", outcome: RotationUnchanged},
+		{name: "passes", candidate: "dbname=b", changed: true, outcome: RotationApplied},
+		{name: "invalid", candidate: "host=b", changed: true, outcome: RotationRejectedValidation, failed: []string{"validator"}},
+		{name: "unhealthy", candidate: "dbname=unhealthy", changed: true, outcome: RotationHealthGateFailed, failed: []string{"health gate"}},
+		{name: "invalid and unhealthy", candidate: "host=unhealthy", changed: true, outcome: RotationRejectedValidation, failed: []string{"validator", "health gate"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := cg.preview(tt.candidate)
+			if p.Changed != tt.changed || p.Outcome != tt.outcome {
+				t.Fatalf("preview() = changed %v, outcome %s, want %v, %s", p.Changed, p.Outcome, tt.changed, tt.outcome)
+			}
+			if p.Policy != ResetPolicyForce || p.Connections != 2 || p.InTransaction != 1 || p.Reset != 2 {
+				t.Errorf("preview() = %+v, want 2 connections reset with force, 1 in a transaction", p)
+			}
+			var failed []string
+			for _, g := range p.Guards {
+				if g.Err != nil {
+					failed = append(failed, g.Name)
+				}
+			}
+			if strings.Join(failed, ",") != strings.Join(tt.failed, ",") {
+				t.Errorf("failed guards = %v, want %v", failed, tt.failed)
+			}
+			if p.Passed() != (len(tt.failed) == 0) {
+				t.Errorf("Passed() = %v with failed guards %v", p.Passed(), failed)
+			}
+			if tt.changed && len(p.Guards) != len(changeGuards) {
+				t.Errorf("ran %d guards, want all %d", len(p.Guards), len(changeGuards))
+			}
+		})
+	}
+
+	if v := cg.currentValue(); v != "dbname=a" {
+		t.Errorf("preview changed the value to %q", v)
+	}
+	for _, c := range cg.conns {
+		if c.GetReset() || c.GetKill() {
+			t.Error("preview reset a connection")
+		}
+	}
+	if idle.closed || busy.closed {
+		t.Error("preview closed a connection")
+	}
+
+	if _, err := PreviewRotation("fsnotify://preview-test/unknown", "dbname=b"); !errors.Is(err, ErrUnknownLocation) {
+		t.Errorf("PreviewRotation() of an unknown location error = %v", err)
+	}
+}
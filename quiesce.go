@@ -0,0 +1,105 @@
+package hotload
+
+import "time"
+
+// quiesceWindow holds back changes of a location during a maintenance
+// window, only the latest one is kept and applied when the window ends.
+type quiesceWindow struct {
+	active  bool
+	until   time.Time
+	pending string
+	held    bool
+	timer   clockTimer
+	// gen tells a timer of a window that was since replaced from the
+	// current one
+	gen int
+}
+
+// QuiesceFor stops connection information changes of the hotload location
+// name, the connection string given to sql.Open, from resetting connections
+// for d, e.g. during database maintenance. The source is still watched, the
+// latest change is held back and applied once the window ends. Calling it
+// again replaces the window, a d of 0 ends it now. It returns
+// ErrUnknownLocation if the location was never opened.
+func QuiesceFor(name string, d time.Duration) error {
+	return hotloadDriver.QuiesceFor(name, d)
+}
+
+func (h *hdriver) QuiesceFor(name string, d time.Duration) error {
+	cg, ok := h.group(name)
+	if !ok {
+		return ErrUnknownLocation
+	}
+	cg.quiesceFor(d)
+	return nil
+}
+
+func (cg *chanGroup) quiesceFor(d time.Duration) {
+	cg.mu.Lock()
+	defer cg.mu.Unlock()
+	q := &cg.quiesce
+	if q.timer != nil {
+		q.timer.Stop()
+	}
+	q.gen++
+	gen := q.gen
+	q.active = true
+	q.until = cg.now().Add(d)
+	q.timer = cg.afterFunc(d, func() { cg.endQuiesce(gen) })
+	cg.log("quiescing location", cg.name, "for", d)
+}
+
+// holdIfQuiesced reports whether the change to v must be held back because
+// the location is quiesced.
+func (cg *chanGroup) holdIfQuiesced(v string) bool {
+	cg.mu.Lock()
+	defer cg.mu.Unlock()
+	q := &cg.quiesce
+	if !q.active {
+		return false
+	}
+	cg.log("location is quiesced, holding change for location", cg.name, "until", q.until)
+	q.pending = v
+	q.held = true
+	return true
+}
+
+// endQuiesce ends the window gen and applies the change held back during
+// it, unless the source went back to the current value meanwhile.
+func (cg *chanGroup) endQuiesce(gen int) {
+	cg.mu.Lock()
+	q := &cg.quiesce
+	if q.gen != gen {
+		cg.mu.Unlock()
+		return
+	}
+	v, held := q.pending, q.held
+	*q = quiesceWindow{gen: q.gen}
+	cg.mu.Unlock()
+	cg.log("quiesce window ended for location", cg.name)
+	if !held || cg.sameValue(v, cg.currentValue()) {
+		return
+	}
+	cg.log("applying held back connection information for location", cg.name)
+	cg.valueChanged(v)
+}
+
+// dropQuiesced forgets the change held back during the window, the source
+// went back to the value in use. The window stays active.
+func (cg *chanGroup) dropQuiesced() {
+	cg.mu.Lock()
+	defer cg.mu.Unlock()
+	cg.quiesce.pending, cg.quiesce.held = "", false
+}
+
+// stopQuiesce ends the window without applying its held back change, the
+// group is torn down.
+func (cg *chanGroup) stopQuiesce() {
+	cg.mu.Lock()
+	defer cg.mu.Unlock()
+	q := &cg.quiesce
+	if q.timer != nil {
+		q.timer.Stop()
+	}
+	*q = quiesceWindow{gen: q.gen + 1}
+}
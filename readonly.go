@@ -0,0 +1,158 @@
+package hotload
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"unicode"
+)
+
+const readOnlyKey = "readOnly"
+const readOnlyKeywordsKey = "readOnlyKeywords"
+
+// ReadOnlyDirective marks a location read-only when it starts the watched
+// value, on its own line or followed by whitespace, and the readOnly option
+// is set to directive. It is removed before the value is passed to the
+// driver.
+const ReadOnlyDirective = "hotload:read-only"
+
+// ErrReadOnly is returned for statements that look like writes on a
+// read-only location.
+var ErrReadOnly = errors.New("hotload: location is read-only")
+
+// defaultWriteKeywords are the leading keywords of statements treated as
+// writes on a read-only location.
+var defaultWriteKeywords = []string{
+	"insert", "update", "delete", "merge", "upsert", "replace", "truncate",
+	"create", "alter", "drop", "grant", "revoke", "copy",
+}
+
+// readOnlyMode decides whether a location rejects writes. The check is a
+// heuristic on the leading keyword of a statement, it is meant to fail fast
+// after rotating to a replica, not to enforce access control.
+type readOnlyMode struct {
+	// mode is "" (off), "true" (always read-only) or "directive" (read-only
+	// while the value starts with ReadOnlyDirective)
+	mode     string
+	keywords []string
+}
+
+// split removes a leading ReadOnlyDirective from v and reports whether
+// connections opened with the returned value are read-only.
+func (m readOnlyMode) split(v string) (string, bool) {
+	if m.mode == "" {
+		return v, false
+	}
+	trimmed := strings.TrimSpace(v)
+	end := strings.IndexFunc(trimmed, unicode.IsSpace)
+	if end < 0 {
+		end = len(trimmed)
+	}
+	directive := trimmed[:end] == ReadOnlyDirective
+	if directive {
+		v = strings.TrimSpace(trimmed[end:])
+	}
+	return v, m.mode == "true" || directive
+}
+
+func (m readOnlyMode) writeKeywords() []string {
+	if len(m.keywords) > 0 {
+		return m.keywords
+	}
+	return defaultWriteKeywords
+}
+
+// parseReadOnly reads the read-only options. Read-only mode is off unless
+// readOnly is set.
+func (cg *chanGroup) parseReadOnly(vs url.Values) {
+	switch v := vs.Get(readOnlyKey); v {
+	case "":
+	case "true", "directive":
+		cg.readOnly.mode = v
+		cg.log("readOnly set to", v)
+	default:
+		cg.log("unknown readOnly value, ignoring", v)
+	}
+	if v := vs.Get(readOnlyKeywordsKey); v != "" {
+		cg.readOnly.keywords = nil
+		for _, k := range strings.Split(v, ",") {
+			if k = strings.ToLower(strings.TrimSpace(k)); k != "" {
+				cg.readOnly.keywords = append(cg.readOnly.keywords, k)
+			}
+		}
+		cg.log("readOnlyKeywords set to", cg.readOnly.keywords)
+	}
+}
+
+// checkWrite returns ErrReadOnly if query starts with one of keywords, or is
+// a WITH statement using one of keywords, as in a writable CTE.
+func checkWrite(query string, keywords []string) error {
+	kw := strings.ToLower(leadingKeyword(query))
+	if kw == "with" {
+		kw = cteWriteKeyword(query, keywords)
+	}
+	for _, k := range keywords {
+		if kw == k {
+			return fmt.Errorf("%w: rejected %s statement", ErrReadOnly, strings.ToUpper(kw))
+		}
+	}
+	return nil
+}
+
+// cteWriteKeyword returns the first word of query that is one of keywords,
+// skipping SQL comments, string literals and quoted identifiers.
+func cteWriteKeyword(query string, keywords []string) string {
+	isWord := func(b byte) bool {
+		return b == '_' || b >= 'a' && b <= 'z' || b >= 'A' && b <= 'Z' || b >= '0' && b <= '9'
+	}
+	q := query
+	for q != "" {
+		switch {
+		case strings.HasPrefix(q, "--"):
+			_, q, _ = strings.Cut(q, "\n")
+		case strings.HasPrefix(q, "/*"):
+			_, q, _ = strings.Cut(q, "*/")
+		case q[0] == '\'' || q[0] == '"':
+			_, q, _ = strings.Cut(q[1:], q[:1])
+		case isWord(q[0]):
+			end := 1
+			for end < len(q) && isWord(q[end]) {
+				end++
+			}
+			w := strings.ToLower(q[:end])
+			for _, k := range keywords {
+				if w == k {
+					return w
+				}
+			}
+			q = q[end:]
+		default:
+			q = q[1:]
+		}
+	}
+	return ""
+}
+
+// leadingKeyword returns the first word of query, skipping whitespace,
+// parentheses and SQL comments.
+func leadingKeyword(query string) string {
+	q := query
+	for {
+		q = strings.TrimLeft(q, " \t\r\n(")
+		switch {
+		case strings.HasPrefix(q, "--"):
+			_, q, _ = strings.Cut(q, "\n")
+		case strings.HasPrefix(q, "/*"):
+			_, q, _ = strings.Cut(q, "*/")
+		default:
+			end := strings.IndexFunc(q, func(r rune) bool {
+				return !(r == '_' || r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z')
+			})
+			if end < 0 {
+				return q
+			}
+			return q[:end]
+		}
+	}
+}
@@ -0,0 +1,58 @@
+package hotload
+
+import (
+	"errors"
+	"testing"
+)
+
+func Test_checkWrite(t *testing.T) {
+	tests := []struct {
+		name     string
+		query    string
+		keywords []string
+		write    bool
+	}{
+		{name: "insert", query: "INSERT INTO t VALUES (1)", keywords: defaultWriteKeywords, write: true},
+		{name: "lower case update", query: "  update t set a = 1", keywords: defaultWriteKeywords, write: true},
+		{name: "leading comments", query: "-- note\n/* hint */ DELETE FROM t", keywords: defaultWriteKeywords, write: true},
+		{name: "insert returning", query: "INSERT INTO t VALUES (1) RETURNING id", keywords: defaultWriteKeywords, write: true},
+		{name: "writable cte", query: "WITH n AS (INSERT INTO t VALUES (1) RETURNING id) SELECT * FROM n", keywords: defaultWriteKeywords, write: true},
+		{name: "read-only cte", query: "WITH n AS (SELECT created_at FROM t WHERE s = 'update') SELECT * FROM n", keywords: defaultWriteKeywords},
+		{name: "select", query: "SELECT * FROM t", keywords: defaultWriteKeywords},
+		{name: "parenthesized select", query: "(SELECT 1)", keywords: defaultWriteKeywords},
+		{name: "custom keywords", query: "DELETE FROM t", keywords: []string{"insert"}},
+		{name: "not read-only", query: "INSERT INTO t VALUES (1)"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := checkWrite(tt.query, tt.keywords)
+			if got := errors.Is(err, ErrReadOnly); got != tt.write {
+				t.Errorf("checkWrite(%q) = %v, want write %v", tt.query, err, tt.write)
+			}
+		})
+	}
+}
+
+func Test_readOnlyMode_split(t *testing.T) {
+	tests := []struct {
+		name     string
+		mode     string
+		v        string
+		dsn      string
+		readOnly bool
+	}{
+		{name: "off leaves directive alone", v: ReadOnlyDirective + "\nhost=replica", dsn: ReadOnlyDirective + "\nhost=replica"},
+		{name: "directive", mode: "directive", v: ReadOnlyDirective + "\nhost=replica", dsn: "host=replica", readOnly: true},
+		{name: "directive joined by stripComments", mode: "directive", v: ReadOnlyDirective + " host=replica dbname=app", dsn: "host=replica dbname=app", readOnly: true},
+		{name: "no directive", mode: "directive", v: "host=primary", dsn: "host=primary"},
+		{name: "always", mode: "true", v: "host=primary", dsn: "host=primary", readOnly: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dsn, readOnly := readOnlyMode{mode: tt.mode}.split(tt.v)
+			if dsn != tt.dsn || readOnly != tt.readOnly {
+				t.Errorf("split(%q) = %q, %v, want %q, %v", tt.v, dsn, readOnly, tt.dsn, tt.readOnly)
+			}
+		})
+	}
+}
@@ -0,0 +1,93 @@
+package hotload
+
+import (
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+const redacted = "REDACTED"
+
+// secretKeys are connection string parameters whose values are masked by Redact.
+var secretKeys = []string{"password", "passwd", "pwd", "sslpassword", "secret", "token"}
+
+var kvSecretRe = regexp.MustCompile(`(?i)((?:^|\s)(?:` + strings.Join(secretKeys, "|") + `)\s*=\s*)('(?:[^'\\]|\\.)*'|\S*)`)
+
+var querySecretRe = regexp.MustCompile(`(?i)((?:^|&)(?:` + strings.Join(secretKeys, "|") + `)=)[^&]*`)
+
+// Redact masks credentials in a connection string so it can be logged. It
+// handles URL style connection strings (password in the userinfo or in the
+// query) and key/value style connection strings.
+func Redact(dsn string) string {
+	if strings.Contains(dsn, "://") {
+		if u, err := url.Parse(dsn); err == nil {
+			if _, ok := u.User.Password(); ok {
+				u.User = url.UserPassword(u.User.Username(), redacted)
+			}
+			q := u.Query()
+			for k := range q {
+				if isSecretKey(k) {
+					q.Set(k, redacted)
+				}
+			}
+			u.RawQuery = q.Encode()
+			return u.String()
+		}
+		// e.g. multi-host IPv6 authorities url.Parse rejects
+		if d, ok := splitDSNURL(dsn); ok {
+			if user, _, ok := strings.Cut(d.userinfo, ":"); ok {
+				d.userinfo = user + ":" + redacted + "@"
+			}
+			d.query = querySecretRe.ReplaceAllString(d.query, "${1}"+redacted)
+			return d.String()
+		}
+	}
+	return kvSecretRe.ReplaceAllString(dsn, "${1}"+redacted)
+}
+
+var redactors = make(map[string]func(string) string)
+
+// RegisterRedactor registers fn to mask credentials in connection strings of
+// the named driver, for formats Redact does not know, e.g. a credential in a
+// driver specific parameter. Hotload's logs, audit events, history and
+// snapshots of locations using the driver are redacted with fn instead of
+// Redact, fn may call Redact for the parts it does not handle itself.
+// Registering a redactor for a driver again replaces the previous one.
+// Passing a nil fn removes the redactor.
+func RegisterRedactor(driver string, fn func(dsn string) string) {
+	hooksMu.Lock()
+	defer hooksMu.Unlock()
+	if fn == nil {
+		delete(redactors, driver)
+		return
+	}
+	redactors[driver] = fn
+}
+
+// RedactDriver masks credentials in dsn with the redactor registered for the
+// named driver, with Redact if there is none.
+func RedactDriver(driver, dsn string) string {
+	hooksMu.RLock()
+	fn, ok := redactors[driver]
+	hooksMu.RUnlock()
+	if !ok {
+		return Redact(dsn)
+	}
+	return fn(dsn)
+}
+
+// redact masks credentials in v with the redactor of the group's driver and
+// caps its length, v is masked first so a cut never reveals part of a
+// credential.
+func (cg *chanGroup) redact(v string) string {
+	return capLogged(RedactDriver(cg.driverName, v))
+}
+
+func isSecretKey(k string) bool {
+	for _, s := range secretKeys {
+		if strings.EqualFold(k, s) {
+			return true
+		}
+	}
+	return false
+}
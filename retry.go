@@ -0,0 +1,53 @@
+package hotload
+
+import (
+	"net/url"
+	"strconv"
+	"time"
+)
+
+const openRetriesKey = "openRetries"
+const openRetryBackoffKey = "openRetryBackoff"
+
+// DefaultOpenRetryBackoff is the wait before the first retry of a failed open
+// when openRetries is set without openRetryBackoff.
+const DefaultOpenRetryBackoff = 100 * time.Millisecond
+
+// openRetry controls how often a failed open of the underlying driver is
+// retried. The backoff doubles after every attempt.
+type openRetry struct {
+	retries int
+	backoff time.Duration
+}
+
+// delay returns the wait before retry attempt n, starting at 0.
+func (r openRetry) delay(n int) time.Duration {
+	backoff := r.backoff
+	if backoff <= 0 {
+		backoff = DefaultOpenRetryBackoff
+	}
+	return backoff << uint(n)
+}
+
+// parseOpenRetry reads the retry options. Malformed values are logged and
+// the defaults, no retries, are kept.
+func (cg *chanGroup) parseOpenRetry(vs url.Values) {
+	if v := vs.Get(openRetriesKey); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			cg.log("invalid openRetries, ignoring", v)
+		} else {
+			cg.retry.retries = n
+			cg.log("openRetries set to", n)
+		}
+	}
+	if v := vs.Get(openRetryBackoffKey); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d <= 0 {
+			cg.log("invalid openRetryBackoff, ignoring", v)
+		} else {
+			cg.retry.backoff = d
+			cg.log("openRetryBackoff set to", d)
+		}
+	}
+}
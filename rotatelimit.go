@@ -0,0 +1,97 @@
+package hotload
+
+import (
+	"net/url"
+	"time"
+)
+
+const minRotateIntervalKey = "minRotateInterval"
+
+// rotateLimit caps how often changes reset connections. Changes arriving
+// within interval of the last applied one are held back, only the latest one
+// is kept and applied once the interval has passed.
+type rotateLimit struct {
+	interval time.Duration
+	last     time.Time
+	pending  string
+	held     bool
+	timer    clockTimer
+}
+
+// parseRotateLimit reads minRotateInterval. The limit is off unless it is
+// set.
+func (cg *chanGroup) parseRotateLimit(vs url.Values) {
+	v := vs.Get(minRotateIntervalKey)
+	if v == "" {
+		return
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil || d <= 0 {
+		cg.log("invalid minRotateInterval, ignoring", v)
+		return
+	}
+	cg.rotateLimit.interval = d
+	cg.log("minRotateInterval set to", d)
+}
+
+// holdIfRotatedRecently reports whether the change to v must be held back
+// because the last change was applied less than minRotateInterval ago.
+func (cg *chanGroup) holdIfRotatedRecently(v string) bool {
+	cg.mu.Lock()
+	defer cg.mu.Unlock()
+	r := &cg.rotateLimit
+	if r.interval <= 0 {
+		return false
+	}
+	now := cg.now()
+	if !r.held && (r.last.IsZero() || now.Sub(r.last) >= r.interval) {
+		r.last = now
+		return false
+	}
+	r.pending = v
+	r.held = true
+	if r.timer == nil {
+		next := r.last.Add(r.interval)
+		cg.log("rotated recently, holding changes for location", cg.name, "until", next)
+		r.timer = cg.afterFunc(next.Sub(now), cg.releaseRotateLimit)
+	}
+	return true
+}
+
+// releaseRotateLimit applies the latest change held back within the
+// interval, unless the source went back to the current value meanwhile.
+func (cg *chanGroup) releaseRotateLimit() {
+	cg.mu.Lock()
+	r := &cg.rotateLimit
+	v, held := r.pending, r.held
+	r.pending = ""
+	r.held = false
+	r.timer = nil
+	cg.mu.Unlock()
+	if !held || cg.sameValue(v, cg.currentValue()) {
+		return
+	}
+	cg.log("applying held back connection information for location", cg.name)
+	cg.valueChanged(v)
+}
+
+// dropRotateLimited forgets the change held back within the interval, the
+// source went back to the value in use.
+func (cg *chanGroup) dropRotateLimited() {
+	cg.mu.Lock()
+	defer cg.mu.Unlock()
+	cg.rotateLimit.pending, cg.rotateLimit.held = "", false
+}
+
+// stopRotateLimit stops the release of the held back change, the group is
+// torn down.
+func (cg *chanGroup) stopRotateLimit() {
+	cg.mu.Lock()
+	defer cg.mu.Unlock()
+	r := &cg.rotateLimit
+	if r.timer != nil {
+		r.timer.Stop()
+		r.timer = nil
+	}
+	r.pending, r.held = "", false
+}
@@ -0,0 +1,127 @@
+package hotload
+
+import (
+	"sort"
+	"sync"
+)
+
+// RotationGroup rotates several hotload locations together, e.g. the shards
+// of a sharded database. A change of a member is staged until every member
+// has received a new value, then all of them are switched at once: no new
+// connection uses a new value before all members are ready, and the
+// connections of all members are reset together.
+//
+// Every member must actually change for the rotation to complete. A member
+// receiving another new value while waiting replaces its staged value.
+type RotationGroup struct {
+	mu      sync.Mutex
+	names   []string
+	pending map[string]staged
+}
+
+type staged struct {
+	cg    *chanGroup
+	value string
+}
+
+var (
+	rotationMu     sync.RWMutex
+	rotationGroups = make(map[string]*RotationGroup)
+)
+
+// NewRotationGroup groups the hotload locations names, the connection strings
+// given to sql.Open, for atomic rotation. It panics if a location already
+// belongs to a rotation group or is given twice.
+func NewRotationGroup(names ...string) *RotationGroup {
+	rotationMu.Lock()
+	defer rotationMu.Unlock()
+	rg := &RotationGroup{
+		names:   append([]string(nil), names...),
+		pending: make(map[string]staged),
+	}
+	// sorted so members are always locked in the same order
+	sort.Strings(rg.names)
+	for i, name := range rg.names {
+		if i > 0 && rg.names[i-1] == name {
+			panic("hotload: NewRotationGroup called with location " + name + " twice")
+		}
+		if _, dup := rotationGroups[name]; dup {
+			panic("hotload: NewRotationGroup called twice for location " + name)
+		}
+	}
+	for _, name := range rg.names {
+		rotationGroups[name] = rg
+	}
+	return rg
+}
+
+// Close removes the rotation group, its members rotate independently again.
+// Staged values are discarded.
+func (rg *RotationGroup) Close() {
+	rotationMu.Lock()
+	defer rotationMu.Unlock()
+	for _, name := range rg.names {
+		if rotationGroups[name] == rg {
+			delete(rotationGroups, name)
+		}
+	}
+}
+
+func rotationGroupOf(name string) *RotationGroup {
+	rotationMu.RLock()
+	defer rotationMu.RUnlock()
+	return rotationGroups[name]
+}
+
+// unstage drops the value staged by cg, if it belongs to a rotation group:
+// the source went back to the value in use or the group is torn down.
+func (cg *chanGroup) unstage() {
+	rg := rotationGroupOf(cg.name)
+	if rg == nil {
+		return
+	}
+	rg.mu.Lock()
+	defer rg.mu.Unlock()
+	// a member opened again after it was retired stages with its new group
+	if s, ok := rg.pending[cg.name]; ok && s.cg == cg {
+		delete(rg.pending, cg.name)
+	}
+}
+
+// stage records the new value v of member cg and rotates all members once
+// every one of them has a staged value.
+func (rg *RotationGroup) stage(cg *chanGroup, v string) {
+	rg.mu.Lock()
+	rg.pending[cg.name] = staged{cg: cg, value: v}
+	if len(rg.pending) < len(rg.names) {
+		rg.mu.Unlock()
+		cg.log("staged connection information for rotation group, waiting for", len(rg.names)-len(rg.pending), "locations")
+		return
+	}
+	pending := rg.pending
+	rg.pending = make(map[string]staged)
+	rg.mu.Unlock()
+
+	// hold every member's lock so no connection opens with a mix of old and
+	// new values
+	members := make([]staged, 0, len(rg.names))
+	for _, name := range rg.names {
+		s := pending[name]
+		s.cg.mu.Lock()
+		members = append(members, s)
+	}
+	events := make([]AuditEvent, 0, len(members))
+	for _, s := range members {
+		events = append(events, s.cg.applyChangeLocked(s.value))
+	}
+	for _, s := range members {
+		s.cg.mu.Unlock()
+	}
+	for _, s := range members {
+		s.cg.fireConnsHooks()
+	}
+	for _, e := range events {
+		recordAudit(e)
+	}
+	cg.log("rotated rotation group", rg.names)
+}
@@ -0,0 +1,100 @@
+package hotload
+
+import (
+	"context"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("RotationGroup", func() {
+	newMember := func(name, value string, rd *recordingDriver) *chanGroup {
+		cg := &chanGroup{
+			name:      name,
+			value:     value,
+			sqlDriver: &driverInstance{driver: rd},
+			log:       func(...interface{}) {},
+		}
+		cg.parentCtx = context.Background()
+		cg.ctx, cg.cancel = context.WithCancel(cg.parentCtx)
+		return cg
+	}
+
+	It("Should not use any new value until every member has one", func() {
+		rdA, rdB := &recordingDriver{}, &recordingDriver{}
+		a := newMember("fsnotify://postgres/shard-a", "shard=a1", rdA)
+		b := newMember("fsnotify://postgres/shard-b", "shard=b1", rdB)
+		rg := NewRotationGroup(a.name, b.name)
+		defer rg.Close()
+
+		_, err := a.Open()
+		Expect(err).ToNot(HaveOccurred())
+		oldConn := a.conns[0]
+
+		a.valueChanged("shard=a2")
+		for _, cg := range []*chanGroup{a, b} {
+			_, err := cg.Open()
+			Expect(err).ToNot(HaveOccurred())
+		}
+		Expect(rdA.count("shard=a1")).To(Equal(2))
+		Expect(rdB.count("shard=b1")).To(Equal(1))
+		Expect(oldConn.GetReset()).To(BeFalse())
+
+		b.valueChanged("shard=b2")
+		Expect(oldConn.GetReset()).To(BeTrue())
+		for _, cg := range []*chanGroup{a, b} {
+			_, err := cg.Open()
+			Expect(err).ToNot(HaveOccurred())
+		}
+		Expect(rdA.count("shard=a2")).To(Equal(1))
+		Expect(rdB.count("shard=b2")).To(Equal(1))
+	})
+
+	It("Should drop a staged value once the member's source reverts", func() {
+		a := newMember("fsnotify://postgres/shard-e", "shard=e1", &recordingDriver{})
+		b := newMember("fsnotify://postgres/shard-f", "shard=f1", &recordingDriver{})
+		rg := NewRotationGroup(a.name, b.name)
+		defer rg.Close()
+
+		a.valueChanged("shard=e2")
+		a.received("shard=e1", time.Now())
+		b.valueChanged("shard=f2")
+		Expect(a.currentValue()).To(Equal("shard=e1"))
+		Expect(b.currentValue()).To(Equal("shard=f1"), "the rotation waits for a new value of a")
+	})
+
+	It("Should drop a staged value once the member is torn down", func() {
+		a := newMember("fsnotify://postgres/shard-g", "shard=g1", &recordingDriver{})
+		b := newMember("fsnotify://postgres/shard-h", "shard=h1", &recordingDriver{})
+		rg := NewRotationGroup(a.name, b.name)
+		defer rg.Close()
+
+		a.valueChanged("shard=g2")
+		a.stopHolds()
+		b.valueChanged("shard=h2")
+		Expect(a.currentValue()).To(Equal("shard=g1"))
+		Expect(b.currentValue()).To(Equal("shard=h1"), "the torn down member does not complete the rotation")
+
+		// the member opened again stages with its new group
+		reopened := newMember(a.name, "shard=g1", &recordingDriver{})
+		reopened.valueChanged("shard=g2")
+		Expect(reopened.currentValue()).To(Equal("shard=g2"))
+		Expect(b.currentValue()).To(Equal("shard=h2"))
+	})
+
+	It("Should panic on a location given twice", func() {
+		name := "fsnotify://postgres/shard-i"
+		Expect(func() { NewRotationGroup(name, name) }).To(PanicWith(MatchRegexp("twice")))
+		Expect(rotationGroupOf(name)).To(BeNil())
+	})
+
+	It("Should rotate members independently once closed", func() {
+		cg := newMember("fsnotify://postgres/shard-c", "shard=c1", &recordingDriver{})
+		rg := NewRotationGroup(cg.name, "fsnotify://postgres/shard-d")
+		Expect(func() { NewRotationGroup(cg.name) }).To(PanicWith(MatchRegexp("called twice")))
+		rg.Close()
+		cg.valueChanged("shard=c2")
+		Expect(cg.value).To(Equal("shard=c2"))
+	})
+})
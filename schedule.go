@@ -0,0 +1,234 @@
+package hotload
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const rotateScheduleKey = "rotateSchedule"
+
+// schedule returns the first scheduled time after t, the zero time if there
+// is none.
+type schedule interface {
+	next(t time.Time) time.Time
+}
+
+// intervalSchedule rotates every interval, counted from the last rotation.
+type intervalSchedule time.Duration
+
+func (s intervalSchedule) next(t time.Time) time.Time {
+	return t.Add(time.Duration(s))
+}
+
+// cronSchedule is a standard five field cron expression: minute, hour, day of
+// month, month and day of week.
+type cronSchedule struct {
+	minute, hour, dom, month, dow uint64
+	// like cron, if both days are restricted either one matches
+	domStar, dowStar bool
+}
+
+// maxScheduleSearch bounds the search for the next time of expressions like
+// 0 0 30 2 * that never match.
+const maxScheduleSearch = 5 * 366 * 24 * time.Hour
+
+func (s cronSchedule) next(t time.Time) time.Time {
+	t = t.Truncate(time.Minute).Add(time.Minute)
+	limit := t.Add(maxScheduleSearch)
+	for t.Before(limit) {
+		switch {
+		case s.month&(1<<uint(t.Month())) == 0:
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, t.Location())
+		case !s.dayMatches(t):
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, t.Location())
+		case s.hour&(1<<uint(t.Hour())) == 0:
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, t.Location())
+		case s.minute&(1<<uint(t.Minute())) == 0:
+			t = t.Add(time.Minute)
+		default:
+			return t
+		}
+	}
+	return time.Time{}
+}
+
+func (s cronSchedule) dayMatches(t time.Time) bool {
+	dom := s.dom&(1<<uint(t.Day())) != 0
+	dow := s.dow&(1<<uint(t.Weekday())) != 0
+	if s.domStar || s.dowStar {
+		return dom && dow
+	}
+	return dom || dow
+}
+
+var cronShorthands = map[string]string{
+	"@hourly":  "0 * * * *",
+	"@daily":   "0 0 * * *",
+	"@weekly":  "0 0 * * 0",
+	"@monthly": "0 0 1 * *",
+	"@yearly":  "0 0 1 1 *",
+}
+
+// parseSchedule parses an interval like 24h or a cron expression like
+// 0 3 * * 1 or @daily.
+func parseSchedule(v string) (schedule, error) {
+	if d, err := time.ParseDuration(v); err == nil {
+		if d <= 0 {
+			return nil, errors.New("interval must be positive")
+		}
+		return intervalSchedule(d), nil
+	}
+	if expr, ok := cronShorthands[v]; ok {
+		v = expr
+	}
+	fields := strings.Fields(v)
+	if len(fields) != 5 {
+		return nil, errors.New("expected an interval or five cron fields")
+	}
+	var s cronSchedule
+	var err error
+	if s.minute, err = parseCronField(fields[0], 0, 59); err != nil {
+		return nil, err
+	}
+	if s.hour, err = parseCronField(fields[1], 0, 23); err != nil {
+		return nil, err
+	}
+	if s.dom, err = parseCronField(fields[2], 1, 31); err != nil {
+		return nil, err
+	}
+	if s.month, err = parseCronField(fields[3], 1, 12); err != nil {
+		return nil, err
+	}
+	if s.dow, err = parseCronField(fields[4], 0, 7); err != nil {
+		return nil, err
+	}
+	// 7 is Sunday too
+	if s.dow&(1<<7) != 0 {
+		s.dow |= 1
+	}
+	s.domStar, s.dowStar = fields[2] == "*", fields[4] == "*"
+	return s, nil
+}
+
+// parseCronField parses a comma separated list of *, n, n-m, each with an
+// optional /step, into a bit set of the values between min and max.
+func parseCronField(field string, min, max int) (uint64, error) {
+	var bits uint64
+	for _, part := range strings.Split(field, ",") {
+		rng, stepStr, hasStep := strings.Cut(part, "/")
+		step := 1
+		if hasStep {
+			n, err := strconv.Atoi(stepStr)
+			if err != nil || n <= 0 {
+				return 0, fmt.Errorf("invalid cron step %q", part)
+			}
+			step = n
+		}
+		lo, hi := min, max
+		if rng != "*" {
+			first, last, isRange := strings.Cut(rng, "-")
+			var err error
+			if lo, err = strconv.Atoi(first); err != nil {
+				return 0, fmt.Errorf("invalid cron field %q", part)
+			}
+			hi = lo
+			if isRange {
+				if hi, err = strconv.Atoi(last); err != nil {
+					return 0, fmt.Errorf("invalid cron field %q", part)
+				}
+			} else if hasStep {
+				hi = max
+			}
+		}
+		if lo < min || hi > max || lo > hi {
+			return 0, fmt.Errorf("cron field %q out of range %d-%d", part, min, max)
+		}
+		for i := lo; i <= hi; i += step {
+			bits |= 1 << uint(i)
+		}
+	}
+	return bits, nil
+}
+
+// rotateSchedule resets the connections of a location at scheduled times,
+// whether or not its source changed.
+type rotateSchedule struct {
+	spec     string
+	schedule schedule
+	next     time.Time
+}
+
+// parseRotateSchedule reads rotateSchedule. Connections are only reset on
+// changes unless it is set.
+func (cg *chanGroup) parseRotateSchedule(vs url.Values) {
+	v := vs.Get(rotateScheduleKey)
+	if v == "" || v == cg.rotateSchedule.spec {
+		return
+	}
+	s, err := parseSchedule(v)
+	if err == nil && s.next(cg.now()).IsZero() {
+		err = errors.New("never matches")
+	}
+	if err != nil {
+		cg.log("invalid rotateSchedule, ignoring", v, err)
+		return
+	}
+	cg.rotateSchedule = rotateSchedule{spec: v, schedule: s, next: s.next(cg.now())}
+	cg.log("rotateSchedule set to", v, "next rotation at", cg.rotateSchedule.next)
+}
+
+// nextScheduledRotation returns when the connections are reset next, the zero
+// time without a schedule.
+func (cg *chanGroup) nextScheduledRotation() time.Time {
+	cg.mu.RLock()
+	defer cg.mu.RUnlock()
+	return cg.rotateSchedule.next
+}
+
+// watchSchedule resets the connections of the group at the times of its
+// rotateSchedule. It returns when the parent context is done.
+func (cg *chanGroup) watchSchedule() {
+	for {
+		next := cg.nextScheduledRotation()
+		if next.IsZero() {
+			return
+		}
+		timer := time.NewTimer(next.Sub(cg.now()))
+		select {
+		case <-cg.parentCtx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+		cg.rotateIfDue()
+	}
+}
+
+// rotateIfDue resets the connections according to the reset policy if the
+// scheduled time has come, and reports whether it did. New connections are
+// opened with the current value, factories computing credentials fetch new
+// ones.
+func (cg *chanGroup) rotateIfDue() bool {
+	defer cg.fireConnsHooks()
+	cg.mu.Lock()
+	defer cg.mu.Unlock()
+	rs := &cg.rotateSchedule
+	now := cg.now()
+	if rs.schedule == nil || now.Before(rs.next) {
+		return false
+	}
+	rs.next = rs.schedule.next(now)
+	cg.log("scheduled rotation of location", cg.name, "next rotation at", rs.next)
+	if cg.resetPolicy != ResetPolicySoft {
+		cg.cancel()
+		cg.ctx, cg.cancel = context.WithCancel(cg.parentCtx)
+	}
+	cg.resetConnections()
+	cg.rotated(now)
+	return true
+}
@@ -0,0 +1,51 @@
+package hotload
+
+import (
+	"testing"
+	"time"
+)
+
+func Test_parseSchedule(t *testing.T) {
+	// a Friday
+	start := time.Date(2021, 1, 1, 10, 30, 0, 0, time.UTC)
+	tests := []struct {
+		name    string
+		spec    string
+		want    time.Time
+		wantErr bool
+	}{
+		{name: "interval", spec: "36h", want: start.Add(36 * time.Hour)},
+		{name: "every minute", spec: "* * * * *", want: start.Add(time.Minute)},
+		{name: "daily at 3am", spec: "0 3 * * *", want: time.Date(2021, 1, 2, 3, 0, 0, 0, time.UTC)},
+		{name: "shorthand", spec: "@daily", want: time.Date(2021, 1, 2, 0, 0, 0, 0, time.UTC)},
+		{name: "steps", spec: "*/20 * * * *", want: time.Date(2021, 1, 1, 10, 40, 0, 0, time.UTC)},
+		{name: "range with step", spec: "0 8-18/4 * * *", want: time.Date(2021, 1, 1, 12, 0, 0, 0, time.UTC)},
+		{name: "list", spec: "15,45 10 * * *", want: time.Date(2021, 1, 1, 10, 45, 0, 0, time.UTC)},
+		{name: "day of week", spec: "0 0 * * 1", want: time.Date(2021, 1, 4, 0, 0, 0, 0, time.UTC)},
+		{name: "sunday as 7", spec: "0 0 * * 7", want: time.Date(2021, 1, 3, 0, 0, 0, 0, time.UTC)},
+		{name: "quarterly", spec: "0 0 1 */3 *", want: time.Date(2021, 4, 1, 0, 0, 0, 0, time.UTC)},
+		{name: "day of month or week", spec: "0 0 15 * 0", want: time.Date(2021, 1, 3, 0, 0, 0, 0, time.UTC)},
+		{name: "leap day", spec: "0 0 29 2 *", want: time.Date(2024, 2, 29, 0, 0, 0, 0, time.UTC)},
+		{name: "never", spec: "0 0 30 2 *"},
+		{name: "negative interval", spec: "-1h", wantErr: true},
+		{name: "too few fields", spec: "0 3 * *", wantErr: true},
+		{name: "out of range", spec: "60 * * * *", wantErr: true},
+		{name: "reversed range", spec: "0 5-3 * * *", wantErr: true},
+		{name: "zero step", spec: "*/0 * * * *", wantErr: true},
+		{name: "garbage", spec: "daily", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, err := parseSchedule(tt.spec)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseSchedule() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if got := s.next(start); !got.Equal(tt.want) {
+				t.Errorf("next() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,77 @@
+package hotload
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+)
+
+const shardKey = "shard"
+
+// ErrUnknownShard is wrapped by the errors of values of a shard location
+// that have no connection string for the shard.
+var ErrUnknownShard = errors.New("hotload: no connection string for shard")
+
+// parseShard reads shard, the name of the shard whose connection string the
+// location uses. The shard is part of the location, it cannot change.
+func (cg *chanGroup) parseShard(vs url.Values) {
+	if v := vs.Get(shardKey); v != "" && cg.shard == "" {
+		cg.shard = v
+		cg.log("shard set to", v)
+	}
+}
+
+// selectShard returns the connection string of the group's shard in the
+// shard document v, a JSON object of shard names and connection strings. v
+// is returned unchanged without shard.
+func (cg *chanGroup) selectShard(v string) (string, error) {
+	if cg.shard == "" {
+		return v, nil
+	}
+	var shards map[string]string
+	if err := json.Unmarshal([]byte(v), &shards); err != nil {
+		return "", fmt.Errorf("hotload: invalid shard document: %w", err)
+	}
+	dsn, ok := shards[cg.shard]
+	if !ok || dsn == "" {
+		return "", fmt.Errorf("%w %s", ErrUnknownShard, cg.shard)
+	}
+	return dsn, nil
+}
+
+// ShardLocation returns the hotload location of the shard named shard of the
+// location name, whose value is a shard document: name with shard=shard
+// added to its query. Each shard is a location of its own, a change of the
+// document only resets the connections of the shards whose connection
+// string changed.
+func ShardLocation(name, shard string) (string, error) {
+	u, err := url.Parse(name)
+	if err != nil {
+		return "", err
+	}
+	if shard == "" {
+		return "", errors.New("hotload: empty shard name")
+	}
+	q := u.Query()
+	q.Set(shardKey, shard)
+	u.RawQuery = q.Encode()
+	return u.String(), nil
+}
+
+// OpenShard opens a sql.DB for the shard named shard of the location name,
+// see ShardLocation. Every shard needs a sql.DB of its own, database/sql
+// pools the connections of a sql.DB without telling the driver which shard
+// a query is for.
+func OpenShard(name, shard string) (*sql.DB, error) {
+	return hotloadDriver.OpenShard(name, shard)
+}
+
+func (h *hdriver) OpenShard(name, shard string) (*sql.DB, error) {
+	location, err := ShardLocation(name, shard)
+	if err != nil {
+		return nil, err
+	}
+	return sql.OpenDB(&connector{name: location, driver: h}), nil
+}
@@ -0,0 +1,143 @@
+package hotload
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+)
+
+// docStrategy sends its document to every watch.
+type docStrategy struct {
+	mu      sync.Mutex
+	doc     string
+	watches []chan string
+}
+
+func (s *docStrategy) Watch(ctx context.Context, pth string, options url.Values) (string, <-chan string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	ch := make(chan string, 1)
+	s.watches = append(s.watches, ch)
+	return s.doc, ch, nil
+}
+
+func (s *docStrategy) set(doc string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.doc = doc
+	for _, ch := range s.watches {
+		ch <- doc
+	}
+}
+
+func TestSelectShard(t *testing.T) {
+	tests := []struct {
+		name    string
+		shard   string
+		doc     string
+		want    string
+		wantErr bool
+		is      error
+	}{
+		{name: "shard", shard: "b", doc: `{"a": "dbname=a", "b": "dbname=b"}`, want: "dbname=b"},
+		{name: "not sharded", doc: "dbname=a", want: "dbname=a"},
+		{name: "unknown shard", shard: "c", doc: `{"a": "dbname=a"}`, wantErr: true, is: ErrUnknownShard},
+		{name: "empty shard", shard: "a", doc: `{"a": ""}`, wantErr: true, is: ErrUnknownShard},
+		{name: "not a document", shard: "a", doc: "dbname=a", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cg := &chanGroup{shard: tt.shard}
+			got, err := cg.selectShard(tt.doc)
+			if (err != nil) != tt.wantErr || tt.is != nil && !errors.Is(err, tt.is) {
+				t.Fatalf("selectShard() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("selectShard() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestShardLocation(t *testing.T) {
+	got, err := ShardLocation("fsnotify://postgres/etc/shards.json?forceKill=true", "tenant-a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "fsnotify://postgres/etc/shards.json?forceKill=true&shard=tenant-a"; got != want {
+		t.Errorf("ShardLocation() = %q, want %q", got, want)
+	}
+	if _, err := ShardLocation("fsnotify://postgres/etc/shards.json", ""); err == nil {
+		t.Error("ShardLocation() accepted an empty shard")
+	}
+}
+
+func TestShardRotations(t *testing.T) {
+	s := &docStrategy{doc: `{"a": "dbname=a1", "b": "dbname=b1"}`}
+	RegisterStrategy("test-shards", s)
+	RegisterSQLDriver("test-shards", &recordingDriver{})
+	defer func() {
+		UnregisterStrategy("test-shards")
+		mu.Lock()
+		delete(sqlDrivers, "test-shards")
+		mu.Unlock()
+	}()
+	h := newHdriver()
+	defer h.stop()
+
+	const name = "test-shards://test-shards/shards.json"
+	conns := make(map[string]*managedConn)
+	groups := make(map[string]*chanGroup)
+	for _, shard := range []string{"a", "b"} {
+		location, err := ShardLocation(name, shard)
+		if err != nil {
+			t.Fatal(err)
+		}
+		conn, err := h.Open(location)
+		if err != nil {
+			t.Fatalf("Open(%s) error = %v", location, err)
+		}
+		conns[shard] = conn.(*managedConn)
+		groups[shard], _ = h.group(location)
+	}
+	if v := groups["a"].currentValue(); v != "dbname=a1" {
+		t.Fatalf("shard a opened with %q", v)
+	}
+	waitValue := func(shard, want string) {
+		t.Helper()
+		deadline := time.Now().Add(time.Second)
+		for groups[shard].currentValue() != want {
+			if time.Now().After(deadline) {
+				t.Fatalf("shard %s has %q, want %q", shard, groups[shard].currentValue(), want)
+			}
+			time.Sleep(time.Millisecond)
+		}
+	}
+
+	// only shard b rotates
+	s.set(`{"a": "dbname=a1", "b": "dbname=b2"}`)
+	waitValue("b", "dbname=b2")
+	if !conns["b"].GetReset() {
+		t.Error("connection of shard b was not reset")
+	}
+	if conns["a"].GetReset() {
+		t.Error("connection of shard a was reset by a change of shard b")
+	}
+
+	// then only shard a
+	s.set(`{"a": "dbname=a2", "b": "dbname=b2"}`)
+	waitValue("a", "dbname=a2")
+	if !conns["a"].GetReset() {
+		t.Error("connection of shard a was not reset")
+	}
+
+	// a document without the shard is rejected, the shard keeps its value
+	s.set(`{"a": "dbname=a3"}`)
+	waitValue("a", "dbname=a3")
+	if v := groups["b"].currentValue(); v != "dbname=b2" {
+		t.Errorf("shard b has %q after its removal from the document", v)
+	}
+}
@@ -0,0 +1,133 @@
+package hotload
+
+import (
+	"context"
+	"net/url"
+	"sync"
+)
+
+// SharedWatches returns a strategy that shares one watch of s among all
+// locations with the same path and options, e.g. hotload URLs that only
+// differ in hotload parameters or the driver, so an expensive source is
+// watched once:
+//
+//	hotload.RegisterStrategy("k8s-secret", hotload.SharedWatches(k8ssecret.NewStrategy(nil)))
+//
+// Every watch gets its own channel with the latest value of the shared watch,
+// a consumer that falls behind only misses intermediate values. Locations
+// that join later start with the latest value. The shared watch is canceled
+// once the contexts of all its watches are done, the next Watch watches s
+// again. If s closes its channel, the channels of all watches are closed.
+func SharedWatches(s Strategy) Strategy {
+	return &sharedStrategy{strategy: s, watches: make(map[string]*sharedWatch)}
+}
+
+type sharedStrategy struct {
+	strategy Strategy
+	mu       sync.Mutex
+	watches  map[string]*sharedWatch
+}
+
+// sharedWatch is a watch of the wrapped strategy and its consumers. Its
+// fields are guarded by the mutex of the sharedStrategy.
+type sharedWatch struct {
+	key       string
+	value     string
+	cancel    context.CancelFunc
+	consumers map[int]chan string
+	next      int
+	closed    bool
+}
+
+// Watch implements Strategy.
+func (s *sharedStrategy) Watch(ctx context.Context, pth string, options url.Values) (string, <-chan string, error) {
+	// Encode sorts the options, equal options in another order share too
+	key := pth + "?" + options.Encode()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	w, ok := s.watches[key]
+	if !ok {
+		wctx, cancel := context.WithCancel(context.Background())
+		value, values, err := s.strategy.Watch(wctx, pth, options)
+		if err != nil {
+			cancel()
+			return "", nil, err
+		}
+		w = &sharedWatch{key: key, value: value, cancel: cancel, consumers: make(map[int]chan string)}
+		s.watches[key] = w
+		go s.fanOut(wctx, w, values)
+	}
+	id := w.next
+	w.next++
+	// a single slot holding the latest value, see send
+	ch := make(chan string, 1)
+	w.consumers[id] = ch
+	go s.leave(ctx, w, id)
+	return w.value, ch, nil
+}
+
+// fanOut sends the values of the shared watch to its consumers until it is
+// torn down or the strategy closes values.
+func (s *sharedStrategy) fanOut(ctx context.Context, w *sharedWatch, values <-chan string) {
+	for {
+		var v string
+		var ok bool
+		select {
+		case <-ctx.Done():
+			return
+		case v, ok = <-values:
+		}
+		if !ok {
+			break
+		}
+		s.mu.Lock()
+		if !w.closed {
+			w.value = v
+			for _, ch := range w.consumers {
+				sendLatest(ch, v)
+			}
+		}
+		s.mu.Unlock()
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if w.closed {
+		return
+	}
+	for _, ch := range w.consumers {
+		close(ch)
+	}
+	s.remove(w)
+}
+
+// sendLatest replaces a value the consumer has not read yet with v, it never
+// blocks.
+func sendLatest(ch chan string, v string) {
+	select {
+	case <-ch:
+	default:
+	}
+	ch <- v
+}
+
+// leave removes the consumer id once ctx is done and tears the shared watch
+// down after its last consumer.
+func (s *sharedStrategy) leave(ctx context.Context, w *sharedWatch, id int) {
+	<-ctx.Done()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if w.closed {
+		return
+	}
+	delete(w.consumers, id)
+	if len(w.consumers) == 0 {
+		s.remove(w)
+	}
+}
+
+// remove stops the shared watch w, s.mu must be held.
+func (s *sharedStrategy) remove(w *sharedWatch) {
+	w.closed = true
+	w.cancel()
+	delete(s.watches, w.key)
+}
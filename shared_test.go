@@ -0,0 +1,146 @@
+package hotload
+
+import (
+	"context"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+)
+
+// countingStrategy counts its watches and sends the values of values to the
+// latest one.
+type countingStrategy struct {
+	mu      sync.Mutex
+	watches int
+	ctx     context.Context
+	values  chan string
+}
+
+func (s *countingStrategy) Watch(ctx context.Context, pth string, options url.Values) (string, <-chan string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.watches++
+	s.ctx = ctx
+	s.values = make(chan string)
+	return "dbname=initial", s.values, nil
+}
+
+func (s *countingStrategy) latest() (int, context.Context, chan string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.watches, s.ctx, s.values
+}
+
+func receive(t *testing.T, ch <-chan string, want string) {
+	t.Helper()
+	select {
+	case v := <-ch:
+		if v != want {
+			t.Fatalf("got %q, want %q", v, want)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("no value, want %q", want)
+	}
+}
+
+func TestSharedWatchesFanOut(t *testing.T) {
+	s := &countingStrategy{}
+	shared := SharedWatches(s)
+	ctx1, cancel1 := context.WithCancel(context.Background())
+	defer cancel1()
+	ctx2, cancel2 := context.WithCancel(context.Background())
+	defer cancel2()
+
+	v1, ch1, err := shared.Watch(ctx1, "/dsn", url.Values{"a": {"1"}, "b": {"2"}})
+	if err != nil || v1 != "dbname=initial" {
+		t.Fatalf("Watch() = %q, %v", v1, err)
+	}
+	_, _, values := s.latest()
+	values <- "dbname=second"
+	receive(t, ch1, "dbname=second")
+
+	// options in another order watch the same resource
+	v2, ch2, err := shared.Watch(ctx2, "/dsn", url.Values{"b": {"2"}, "a": {"1"}})
+	if err != nil || v2 != "dbname=second" {
+		t.Fatalf("Watch() = %q, %v, want the latest value", v2, err)
+	}
+	if n, _, _ := s.latest(); n != 1 {
+		t.Fatalf("strategy watched %d times, want 1", n)
+	}
+	values <- "dbname=third"
+	receive(t, ch1, "dbname=third")
+	receive(t, ch2, "dbname=third")
+
+	if _, _, err := shared.Watch(ctx2, "/other", nil); err != nil {
+		t.Fatal(err)
+	}
+	if n, _, _ := s.latest(); n != 2 {
+		t.Fatalf("strategy watched %d times, want 2 for another path", n)
+	}
+}
+
+func Test_sendLatest(t *testing.T) {
+	// a consumer that does not read only keeps the latest value
+	ch := make(chan string, 1)
+	sendLatest(ch, "dbname=first")
+	sendLatest(ch, "dbname=second")
+	receive(t, ch, "dbname=second")
+	select {
+	case v := <-ch:
+		t.Fatalf("got %q, want no value", v)
+	default:
+	}
+}
+
+func TestSharedWatchesTeardown(t *testing.T) {
+	s := &countingStrategy{}
+	shared := SharedWatches(s)
+	ctx1, cancel1 := context.WithCancel(context.Background())
+	ctx2, cancel2 := context.WithCancel(context.Background())
+	defer cancel2()
+	if _, _, err := shared.Watch(ctx1, "/dsn", nil); err != nil {
+		t.Fatal(err)
+	}
+	_, ch2, err := shared.Watch(ctx2, "/dsn", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, watchCtx, values := s.latest()
+
+	cancel1()
+	values <- "dbname=second"
+	receive(t, ch2, "dbname=second")
+	if watchCtx.Err() != nil {
+		t.Fatal("shared watch canceled while a consumer is left")
+	}
+
+	cancel2()
+	select {
+	case <-watchCtx.Done():
+	case <-time.After(time.Second):
+		t.Fatal("shared watch not canceled after the last consumer left")
+	}
+
+	ctx3, cancel3 := context.WithCancel(context.Background())
+	defer cancel3()
+	v, ch3, err := shared.Watch(ctx3, "/dsn", nil)
+	if err != nil || v != "dbname=initial" {
+		t.Fatalf("Watch() = %q, %v", v, err)
+	}
+	n, _, values := s.latest()
+	if n != 2 {
+		t.Fatalf("strategy watched %d times, want a new watch", n)
+	}
+
+	// a closed strategy channel closes the channels of the consumers
+	close(values)
+	select {
+	case _, ok := <-ch3:
+		if ok {
+			t.Fatal("got a value, want a closed channel")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("channel not closed")
+	}
+}
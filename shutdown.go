@@ -0,0 +1,161 @@
+package hotload
+
+import (
+	"context"
+	"errors"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// ErrShuttingDown is returned by Open once Shutdown was called.
+var ErrShuttingDown = errors.New("hotload: shutting down")
+
+// shutdownPollInterval is how often Shutdown checks whether connections have
+// drained.
+var shutdownPollInterval = 10 * time.Millisecond
+
+// Shutdown stops every hotload location from opening new connections and
+// drains the existing ones: idle connections are closed immediately,
+// connections in a transaction when the transaction completes. It returns
+// once every connection is closed, or when ctx is done, in which case the
+// remaining connections are closed and ctx.Err() is returned. The watches of
+// all locations are then stopped, and Shutdown only reports success once their
+// run loops have returned. Locations keep refusing new connections afterwards,
+// and opening new locations fails with ErrShuttingDown.
+func Shutdown(ctx context.Context) error {
+	return hotloadDriver.Shutdown(ctx)
+}
+
+func (h *hdriver) Shutdown(ctx context.Context) error {
+	err := shutdown(ctx, h.groups())
+	// connections are closed first so no run loop exits while its
+	// connections are still closing. Stopping under mu orders it with watch:
+	// no run loop is started once waitRuns may be waiting.
+	mu.Lock()
+	h.stop()
+	mu.Unlock()
+	if err != nil {
+		return err
+	}
+	return h.waitRuns(ctx)
+}
+
+// waitRuns waits for the run loops of all groups to return, or ctx to be
+// done.
+func (h *hdriver) waitRuns(ctx context.Context) error {
+	done := make(chan struct{})
+	go func() {
+		h.runs.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func shutdown(ctx context.Context, groups []*chanGroup) error {
+	for _, cg := range groups {
+		cg.drainForShutdown()
+	}
+	ticker := time.NewTicker(shutdownPollInterval)
+	defer ticker.Stop()
+	for {
+		open := 0
+		for _, cg := range groups {
+			open += cg.stats().Connections
+		}
+		if open == 0 {
+			for _, cg := range groups {
+				cg.tunnel.retire()
+			}
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			for _, cg := range groups {
+				cg.killConnections()
+			}
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// drainForShutdown refuses new opens and starts closing the connections of
+// the group.
+func (cg *chanGroup) drainForShutdown() {
+	cg.mu.Lock()
+	cg.closing = true
+	conns := append([]*managedConn(nil), cg.conns...)
+	cg.mu.Unlock()
+	cg.log("draining connections for shutdown of location", cg.name, len(conns))
+	var idle []*managedConn
+	for _, c := range conns {
+		c.Reset(true)
+		c.setCloseReason(CloseReasonShutdown)
+		if c.drainWhenIdle() {
+			idle = append(idle, c)
+		}
+	}
+	// not detached, closing calls back into cg.remove so Shutdown can tell
+	// when the group has drained
+	cg.closeConns(idle)
+}
+
+// reraise delivers sig to the process again once the handler stopped
+// catching it, so the default action, terminating the process, takes place.
+var reraise = func(sig os.Signal) {
+	p, err := os.FindProcess(os.Getpid())
+	if err == nil {
+		err = p.Signal(sig)
+	}
+	if err != nil {
+		GetLogger()("hotload: could not re-raise", sig, err)
+	}
+}
+
+// HandleSIGTERM installs a signal handler that calls Shutdown with a timeout
+// of grace when the process receives SIGTERM, then re-raises the signal so
+// the process terminates, or is handled by other handlers installed with
+// signal.Notify. The returned function removes the handler.
+//
+// This is opt-in: without it SIGTERM terminates the process immediately.
+func HandleSIGTERM(grace time.Duration) (remove func()) {
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, syscall.SIGTERM)
+	return handleSignals(hotloadDriver, sigs, grace)
+}
+
+// handleSignals shuts h down on the first signal received on sigs.
+func handleSignals(h *hdriver, sigs chan os.Signal, grace time.Duration) (remove func()) {
+	done := make(chan struct{})
+	var once sync.Once
+	remove = func() {
+		once.Do(func() {
+			signal.Stop(sigs)
+			close(done)
+		})
+	}
+	go func() {
+		select {
+		case <-done:
+			return
+		case sig := <-sigs:
+			GetLogger()("hotload: received", sig, "draining connections")
+			ctx, cancel := context.WithTimeout(context.Background(), grace)
+			defer cancel()
+			if err := h.Shutdown(ctx); err != nil {
+				GetLogger()("hotload: grace period elapsed, closed remaining connections")
+			}
+			remove()
+			reraise(sig)
+		}
+	}()
+	return remove
+}
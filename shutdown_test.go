@@ -0,0 +1,104 @@
+package hotload
+
+import (
+	"context"
+	"net/url"
+	"os"
+	"syscall"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Shutdown", func() {
+	var cg *chanGroup
+
+	BeforeEach(func() {
+		cg = &chanGroup{
+			name:      "fsnotify://postgres/shutdown",
+			sqlDriver: &driverInstance{driver: &recordingDriver{}},
+			log:       func(...interface{}) {},
+		}
+		cg.parentCtx = context.Background()
+		cg.ctx, cg.cancel = context.WithCancel(cg.parentCtx)
+	})
+
+	openInTx := func() (idle, inTx *managedConn) {
+		c1, err := cg.Open()
+		Expect(err).ToNot(HaveOccurred())
+		c2, err := cg.Open()
+		Expect(err).ToNot(HaveOccurred())
+		inTx = c2.(*managedConn)
+		inTx.setInTx(true)
+		return c1.(*managedConn), inTx
+	}
+
+	It("Should refuse new opens and wait for transactions to complete", func() {
+		_, inTx := openInTx()
+		done := make(chan error, 1)
+		go func() { done <- shutdown(context.Background(), []*chanGroup{cg}) }()
+
+		// the idle connection closes right away
+		Eventually(func() int { return cg.stats().Connections }).Should(Equal(1))
+		_, err := cg.Open()
+		Expect(err).To(MatchError(ErrShuttingDown))
+		Consistently(done, "50ms").ShouldNot(Receive())
+
+		inTx.endTx()
+		Eventually(done).Should(Receive(BeNil()))
+		Expect(cg.stats().Connections).To(BeZero())
+	})
+
+	It("Should close remaining connections when the grace period elapses", func() {
+		_, inTx := openInTx()
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+		Expect(shutdown(ctx, []*chanGroup{cg})).To(MatchError(context.DeadlineExceeded))
+		Expect(cg.stats().Connections).To(BeZero())
+		Expect(inTx.conn.(*testConn).closed).To(BeTrue())
+	})
+
+	It("Should stop the run loops before reporting success", func() {
+		h := newHdriver()
+		values := make(chan string)
+		cg.parentCtx, cg.values = h.ctx, values
+		cg.ctx, cg.cancel = context.WithCancel(cg.parentCtx)
+		mu.Lock()
+		h.cgroup[cg.name] = cg
+		mu.Unlock()
+		h.startRun(cg)
+		// the run loop is running once it took a value
+		values <- "dsn"
+
+		Expect(h.Shutdown(context.Background())).To(Succeed())
+		// the run loop cancels the group's context on its way out
+		cg.mu.RLock()
+		Expect(cg.ctx.Err()).To(HaveOccurred())
+		cg.mu.RUnlock()
+		done := make(chan struct{})
+		go func() {
+			h.runs.Wait()
+			close(done)
+		}()
+		Eventually(done).Should(BeClosed())
+
+		mu.Lock()
+		_, err := h.watch(context.Background(), "fsnotify://postgres/other", &url.URL{Scheme: "fsnotify", Host: "postgres", Path: "/other"})
+		mu.Unlock()
+		Expect(err).To(MatchError(ErrShuttingDown))
+	})
+
+	It("Should shut down and re-raise on SIGTERM", func() {
+		raised := make(chan os.Signal, 1)
+		defer func(orig func(os.Signal)) { reraise = orig }(reraise)
+		reraise = func(sig os.Signal) { raised <- sig }
+
+		// ginkgo handles a real SIGTERM itself, so deliver it directly
+		sigs := make(chan os.Signal, 1)
+		remove := handleSignals(newHdriver(), sigs, time.Second)
+		defer remove()
+		sigs <- syscall.SIGTERM
+		Eventually(raised).Should(Receive(Equal(syscall.SIGTERM)))
+	})
+})
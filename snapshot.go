@@ -0,0 +1,32 @@
+package hotload
+
+// ExportSnapshot returns the connection information currently in use by
+// every active hotload location, keyed by location, to reconstruct state
+// after an incident. Values are passed through Redact unless includeSecrets
+// is true.
+//
+// With includeSecrets the map holds raw connection strings, passwords and
+// tokens included. It is a break-glass tool: anything that stores, logs or
+// transmits the result exposes every database credential of the process, so
+// keep it off regular code paths, write it only to storage as protected as
+// the sources themselves and rotate the credentials if it leaks. Every export
+// with secrets is logged, without the values.
+func ExportSnapshot(includeSecrets bool) map[string]string {
+	return hotloadDriver.ExportSnapshot(includeSecrets)
+}
+
+func (h *hdriver) ExportSnapshot(includeSecrets bool) map[string]string {
+	groups := h.groups()
+	if includeSecrets {
+		GetLogger()("hotload: exporting snapshot with secrets of", len(groups), "locations")
+	}
+	snapshot := make(map[string]string, len(groups))
+	for _, cg := range groups {
+		v := cg.currentValue()
+		if !includeSecrets {
+			v = cg.redact(v)
+		}
+		snapshot[cg.name] = v
+	}
+	return snapshot
+}
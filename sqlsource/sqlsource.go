@@ -0,0 +1,181 @@
+// Package sqlsource implements a hotload strategy that reads the connection
+// string from a control database and polls it for changes, e.g. the "next"
+// DSN of a tenant kept in a control plane table. The control database is
+// opened with the database/sql driver bootstrapDriver and the connection
+// string bootstrapDSN, and query returns the value in the first column of
+// its first row. A path is passed to the query as its only argument:
+//
+//	db, err := sql.Open("hotload", "sqlsource://postgres/orders?bootstrapDriver=pgx&bootstrapDSN="+
+//		url.QueryEscape("host=control dbname=config")+"&query="+
+//		url.QueryEscape("SELECT dsn FROM service_dsns WHERE service = $1")+"&pollInterval=30s")
+//
+// The bootstrap connection string is part of the hotload connection string,
+// keep its credentials out of it, e.g. with a driver that reads them from
+// the environment.
+package sqlsource
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/infobloxopen/hotload"
+	"github.com/infobloxopen/hotload/logger"
+	"github.com/infobloxopen/hotload/metrics"
+	"github.com/infobloxopen/hotload/strategy"
+)
+
+func init() {
+	hotload.RegisterStrategy(strategyName, NewStrategy())
+}
+
+const strategyName = "sqlsource"
+
+const (
+	// BootstrapDriverKey is the query parameter with the database/sql driver
+	// name of the control database.
+	BootstrapDriverKey = "bootstrapDriver"
+	// BootstrapDSNKey is the query parameter with the connection string of
+	// the control database.
+	BootstrapDSNKey = "bootstrapDSN"
+	// QueryKey is the query parameter with the query returning the value.
+	QueryKey = "query"
+	// PollIntervalKey is the query parameter with the poll interval, e.g. 30s.
+	PollIntervalKey = "pollInterval"
+)
+
+// DefaultPollInterval is the poll interval without pollInterval=.
+var DefaultPollInterval = time.Minute
+
+// QueryTimeout bounds every query of the control database.
+var QueryTimeout = 10 * time.Second
+
+var (
+	// ErrMissingBootstrapDriver is returned by Watch when bootstrapDriver is
+	// not set.
+	ErrMissingBootstrapDriver = fmt.Errorf("sqlsource: %w", strategy.MissingOption(BootstrapDriverKey))
+	// ErrMissingBootstrapDSN is returned by Watch when bootstrapDSN is not
+	// set.
+	ErrMissingBootstrapDSN = fmt.Errorf("sqlsource: %w", strategy.MissingOption(BootstrapDSNKey))
+	// ErrMissingQuery is returned by Watch when query is not set.
+	ErrMissingQuery = fmt.Errorf("sqlsource: %w", strategy.MissingOption(QueryKey))
+)
+
+// NewStrategy returns a new sqlsource strategy.
+func NewStrategy() *Strategy {
+	return &Strategy{}
+}
+
+// Strategy implements the hotload Strategy interface with a query of a
+// control database.
+type Strategy struct{}
+
+// source is the query of one watch.
+type source struct {
+	db    *sql.DB
+	query string
+	args  []interface{}
+	// name identifies the source in errors and logs without the bootstrap
+	// connection string
+	name string
+}
+
+// Watch implements the hotload.Strategy interface. Every watch opens its own
+// bootstrap connection, which is closed when ctx is canceled. Errors of the
+// first query are returned, a query without rows wraps
+// strategy.ErrResourceNotFound. Later errors, e.g. while the control
+// database fails over, are logged and the previous value is kept.
+func (s *Strategy) Watch(ctx context.Context, pth string, options url.Values) (value string, values <-chan string, err error) {
+	driverName := options.Get(BootstrapDriverKey)
+	if driverName == "" {
+		return "", nil, ErrMissingBootstrapDriver
+	}
+	dsn := options.Get(BootstrapDSNKey)
+	if dsn == "" {
+		return "", nil, ErrMissingBootstrapDSN
+	}
+	src := &source{query: options.Get(QueryKey), name: driverName + " query"}
+	if src.query == "" {
+		return "", nil, ErrMissingQuery
+	}
+	if arg := strings.Trim(pth, "/"); arg != "" {
+		src.args = []interface{}{arg}
+		src.name += " of " + arg
+	}
+	interval := DefaultPollInterval
+	if v := options.Get(PollIntervalKey); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d <= 0 {
+			return "", nil, fmt.Errorf("sqlsource: invalid %s %q", PollIntervalKey, v)
+		}
+		interval = d
+	}
+	src.db, err = sql.Open(driverName, dsn)
+	if err != nil {
+		return "", nil, fmt.Errorf("sqlsource: could not open the bootstrap database: %w", err)
+	}
+	value, err = src.fetch(ctx)
+	if err != nil {
+		src.db.Close()
+		return "", nil, err
+	}
+	out := make(chan string)
+	go src.run(ctx, interval, value, out)
+	return value, out, nil
+}
+
+// fetch runs the query and returns the trimmed first column of its first
+// row.
+func (src *source) fetch(ctx context.Context) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeout)
+	defer cancel()
+	var v sql.NullString
+	err := src.db.QueryRowContext(ctx, src.query, src.args...).Scan(&v)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", fmt.Errorf("could not read %v: %w: %w", src.name, strategy.ErrResourceNotFound, err)
+	}
+	if err != nil {
+		return "", strategy.ReadError(src.name, err)
+	}
+	return strings.TrimSpace(v.String), nil
+}
+
+func (src *source) run(ctx context.Context, interval time.Duration, last string, out chan<- string) {
+	metrics.IncHotloadWatchGoroutines(strategyName)
+	defer metrics.DecHotloadWatchGoroutines(strategyName)
+	defer src.db.Close()
+	log := logger.GetLogger()
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		v, err := src.fetch(ctx)
+		if err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			// keep the previous value
+			log("sqlsource:", err)
+			continue
+		}
+		if v == last {
+			continue
+		}
+		// the value may hold credentials, only log that it changed
+		log("sqlsource: value changed", src.name)
+		select {
+		case out <- v:
+			last = v
+		case <-ctx.Done():
+			return
+		}
+	}
+}
@@ -0,0 +1,13 @@
+package sqlsource
+
+import (
+	"testing"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+func TestSQLSource(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "SQLSource Suite")
+}
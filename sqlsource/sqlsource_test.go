@@ -0,0 +1,210 @@
+package sqlsource
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/infobloxopen/hotload/strategy"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+// controlDriver is a control database serving one value per query
+// argument, failing while err is set.
+type controlDriver struct {
+	mu      sync.Mutex
+	values  map[string]string
+	err     error
+	queries int
+	open    int
+}
+
+func (d *controlDriver) Open(name string) (driver.Conn, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.open++
+	return &controlConn{driver: d}, nil
+}
+
+func (d *controlDriver) set(arg, value string, err error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.values[arg] = value
+	d.err = err
+}
+
+func (d *controlDriver) count() int {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.queries
+}
+
+func (d *controlDriver) conns() int {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.open
+}
+
+type controlConn struct {
+	driver *controlDriver
+}
+
+func (c *controlConn) Prepare(query string) (driver.Stmt, error) {
+	return &controlStmt{driver: c.driver}, nil
+}
+
+func (c *controlConn) Close() error {
+	c.driver.mu.Lock()
+	defer c.driver.mu.Unlock()
+	c.driver.open--
+	return nil
+}
+
+func (c *controlConn) Begin() (driver.Tx, error) {
+	return nil, errors.New("not supported")
+}
+
+type controlStmt struct {
+	driver *controlDriver
+}
+
+func (s *controlStmt) Close() error  { return nil }
+func (s *controlStmt) NumInput() int { return -1 }
+
+func (s *controlStmt) Exec(args []driver.Value) (driver.Result, error) {
+	return nil, errors.New("not supported")
+}
+
+func (s *controlStmt) Query(args []driver.Value) (driver.Rows, error) {
+	d := s.driver
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.queries++
+	if d.err != nil {
+		return nil, d.err
+	}
+	arg := ""
+	if len(args) > 0 {
+		arg = args[0].(string)
+	}
+	v, ok := d.values[arg]
+	if !ok {
+		return &controlRows{}, nil
+	}
+	return &controlRows{values: []string{v}}, nil
+}
+
+type controlRows struct {
+	values []string
+}
+
+func (r *controlRows) Columns() []string { return []string{"dsn"} }
+func (r *controlRows) Close() error      { return nil }
+
+func (r *controlRows) Next(dest []driver.Value) error {
+	if len(r.values) == 0 {
+		return io.EOF
+	}
+	dest[0], r.values = r.values[0], r.values[1:]
+	return nil
+}
+
+var control = &controlDriver{}
+
+func init() {
+	sql.Register("sqlsource-control", control)
+}
+
+var _ = Describe("Strategy", func() {
+	var (
+		ctx     context.Context
+		cancel  context.CancelFunc
+		options url.Values
+	)
+
+	BeforeEach(func() {
+		ctx, cancel = context.WithCancel(context.Background())
+		control.mu.Lock()
+		control.values = map[string]string{"orders": " host=db1 dbname=orders "}
+		control.err = nil
+		control.mu.Unlock()
+		options = url.Values{
+			BootstrapDriverKey: {"sqlsource-control"},
+			BootstrapDSNKey:    {"control"},
+			QueryKey:           {"SELECT dsn FROM service_dsns WHERE service = $1"},
+			PollIntervalKey:    {"10ms"},
+		}
+	})
+
+	AfterEach(func() {
+		cancel()
+	})
+
+	It("Should return the value and emit changes", func() {
+		v, values, err := NewStrategy().Watch(ctx, "/orders", options)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(v).To(Equal("host=db1 dbname=orders"))
+
+		control.set("orders", "host=db2 dbname=orders", nil)
+		Eventually(values).Should(Receive(Equal("host=db2 dbname=orders")))
+	})
+
+	It("Should fail the first query without rows", func() {
+		_, _, err := NewStrategy().Watch(ctx, "/payments", options)
+		Expect(err).To(MatchError(strategy.ErrResourceNotFound))
+	})
+
+	It("Should fail for missing and bad options", func() {
+		for _, key := range []string{BootstrapDriverKey, BootstrapDSNKey, QueryKey} {
+			o := url.Values{}
+			for k, v := range options {
+				o[k] = v
+			}
+			o.Del(key)
+			_, _, err := NewStrategy().Watch(ctx, "/orders", o)
+			Expect(err).To(MatchError(strategy.ErrMissingOption), key)
+		}
+		options.Set(PollIntervalKey, "often")
+		_, _, err := NewStrategy().Watch(ctx, "/orders", options)
+		Expect(err).To(HaveOccurred())
+		options.Set(PollIntervalKey, "10ms")
+		options.Set(BootstrapDriverKey, "no-such-driver")
+		_, _, err = NewStrategy().Watch(ctx, "/orders", options)
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("Should keep the last value while queries fail", func() {
+		_, values, err := NewStrategy().Watch(ctx, "/orders", options)
+		Expect(err).ToNot(HaveOccurred())
+		control.set("orders", "host=db2 dbname=orders", errors.New("connection refused"))
+		start := control.count()
+		Eventually(control.count).Should(BeNumerically(">", start+2))
+		Consistently(values, 50*time.Millisecond).ShouldNot(Receive())
+
+		control.set("orders", "host=db3 dbname=orders", nil)
+		Eventually(values).Should(Receive(Equal("host=db3 dbname=orders")))
+	})
+
+	It("Should close the bootstrap connection when ctx is canceled", func() {
+		_, _, err := NewStrategy().Watch(ctx, "/orders", options)
+		Expect(err).ToNot(HaveOccurred())
+		Eventually(control.count).Should(BeNumerically(">", 2))
+		Expect(control.conns()).To(BeNumerically(">", 0))
+		cancel()
+		Eventually(control.conns).Should(BeZero())
+		stopped := control.count()
+		Consistently(control.count, 50*time.Millisecond).Should(Equal(stopped))
+	})
+
+	It("Should wrap other query errors with ErrReadFailed", func() {
+		control.set("orders", "", errors.New("permission denied"))
+		_, _, err := NewStrategy().Watch(ctx, "/orders", options)
+		Expect(err).To(MatchError(strategy.ErrReadFailed))
+	})
+})
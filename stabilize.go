@@ -0,0 +1,101 @@
+package hotload
+
+import (
+	"net/url"
+	"time"
+)
+
+const stabilizeForKey = "stabilizeFor"
+
+// stabilizer holds back a new value until the source kept it for dwell, so
+// sources that write and then fix up a value are not acted on mid-way. Unlike
+// minRotateInterval, which limits how often changes apply, every newer value
+// restarts the wait.
+type stabilizer struct {
+	dwell   time.Duration
+	pending string
+	changed time.Time
+	held    bool
+	timer   clockTimer
+	gen     int
+}
+
+// parseStabilize reads stabilizeFor. Values apply right away unless it is
+// set.
+func (cg *chanGroup) parseStabilize(vs url.Values) {
+	v := vs.Get(stabilizeForKey)
+	if v == "" {
+		return
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil || d <= 0 {
+		cg.log("invalid stabilizeFor, ignoring", v)
+		return
+	}
+	cg.stabilizer.dwell = d
+	cg.log("stabilizeFor set to", d)
+}
+
+// holdUntilStable reports whether v, changed at the given time, must wait
+// until it was stable for stabilizeFor. The same value again keeps the wait
+// running, any other value restarts it. A value that goes back to the one in
+// use drops the waiting value and is not held.
+func (cg *chanGroup) holdUntilStable(v string, changed time.Time) bool {
+	cg.mu.Lock()
+	defer cg.mu.Unlock()
+	s := &cg.stabilizer
+	if s.dwell <= 0 {
+		return false
+	}
+	if s.held && cg.sameValue(v, s.pending) {
+		return true
+	}
+	if s.timer != nil {
+		s.timer.Stop()
+		s.timer = nil
+	}
+	s.gen++
+	if cg.sameValue(v, cg.value) {
+		if s.held {
+			cg.log("connection information went back to the value in use for location", cg.name)
+		}
+		s.pending, s.held = "", false
+		return false
+	}
+	s.pending, s.changed, s.held = v, changed, true
+	gen := s.gen
+	s.timer = cg.afterFunc(s.dwell, func() { cg.releaseStable(gen) })
+	cg.trace("holding change until stable for", s.dwell)
+	return true
+}
+
+// releaseStable applies the value held since generation gen, unless a newer
+// value replaced it meanwhile.
+func (cg *chanGroup) releaseStable(gen int) {
+	cg.mu.Lock()
+	s := &cg.stabilizer
+	if gen != s.gen || !s.held {
+		cg.mu.Unlock()
+		return
+	}
+	v, changed, dwell := s.pending, s.changed, s.dwell
+	s.pending, s.held, s.timer = "", false, nil
+	cg.mu.Unlock()
+	cg.log("connection information stable for", dwell, "for location", cg.name)
+	cg.received(v, changed)
+}
+
+// stopStabilizer drops the value waiting to become stable, the group is torn
+// down.
+func (cg *chanGroup) stopStabilizer() {
+	cg.mu.Lock()
+	defer cg.mu.Unlock()
+	s := &cg.stabilizer
+	if s.timer != nil {
+		s.timer.Stop()
+		s.timer = nil
+	}
+	// a timer that fired already finds a newer generation
+	s.gen++
+	s.pending, s.held = "", false
+}
@@ -0,0 +1,89 @@
+package hotload
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// stateVersion is the version of the format of ExportState.
+const stateVersion = 1
+
+// state is the document of ExportState.
+type state struct {
+	Version int `json:"version"`
+	// Locations maps the active locations to their connection information
+	Locations map[string]string `json:"locations"`
+}
+
+// ExportState returns the active hotload locations and the connection
+// information they use, serialized for ImportState in a successor process,
+// e.g. during a graceful binary upgrade that hands over its listeners. The
+// successor starts with the exported values instead of waiting for sources
+// that may be unavailable.
+//
+// The state holds raw connection strings, passwords and tokens included.
+// Pass it to the successor only over a channel as protected as the sources
+// themselves, e.g. an inherited pipe or a unix socket only the service user
+// can open, never through the environment, command line arguments, logs or
+// world readable files. Every export is logged, without the values.
+func ExportState() ([]byte, error) {
+	return hotloadDriver.ExportState()
+}
+
+func (h *hdriver) ExportState() ([]byte, error) {
+	groups := h.groups()
+	GetLogger()("hotload: exporting state with secrets of", len(groups), "locations")
+	st := state{Version: stateVersion, Locations: make(map[string]string, len(groups))}
+	for _, cg := range groups {
+		if v := cg.stateValue(); v != "" {
+			st.Locations[cg.name] = v
+		}
+	}
+	return json.Marshal(st)
+}
+
+// stateValue returns the connection information of the group from its
+// strategy, not its environment override, which the successor reads itself.
+func (cg *chanGroup) stateValue() string {
+	cg.mu.RLock()
+	defer cg.mu.RUnlock()
+	if cg.override.raw != "" {
+		return cg.override.source
+	}
+	return cg.value
+}
+
+// ImportState seeds the locations of data, a state of ExportState, with
+// their exported connection information. It replaces the state of previous
+// imports and must be called before the locations are opened. When a
+// location is opened first, its strategy is watched as usual: the imported
+// value is only used if the strategy has no initial value yet or fails to
+// watch, in which case the strategy is watched again with backoff and the
+// location switches to its values once it succeeds. Imported values are
+// prepared already, they are not transformed again, but pass host policies
+// and environment overrides like initial values.
+func ImportState(data []byte) error {
+	return hotloadDriver.ImportState(data)
+}
+
+func (h *hdriver) ImportState(data []byte) error {
+	var st state
+	if err := json.Unmarshal(data, &st); err != nil {
+		return fmt.Errorf("hotload: invalid state: %w", err)
+	}
+	if st.Version != stateVersion {
+		return fmt.Errorf("hotload: unsupported state version %d", st.Version)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	h.imported = st.Locations
+	GetLogger()("hotload: imported state of", len(st.Locations), "locations")
+	return nil
+}
+
+// importedValue returns the imported value of the location name, it is
+// forgotten once the location is watched. The package mu must be held.
+func (h *hdriver) importedValue(name string) (string, bool) {
+	v, ok := h.imported[name]
+	return v, ok && v != ""
+}
@@ -0,0 +1,125 @@
+package hotload
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/url"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// unavailableStrategy fails to watch while down, like a config service
+// that is unreachable during an upgrade.
+type unavailableStrategy struct {
+	docStrategy
+	down atomic.Bool
+}
+
+func (s *unavailableStrategy) Watch(ctx context.Context, pth string, options url.Values) (string, <-chan string, error) {
+	if s.down.Load() {
+		return "", nil, errors.New("source unavailable")
+	}
+	return s.docStrategy.Watch(ctx, pth, options)
+}
+
+func TestStateRoundTrip(t *testing.T) {
+	s := &unavailableStrategy{docStrategy: docStrategy{doc: "dbname=a"}}
+	RegisterStrategy("test-state", s)
+	RegisterSQLDriver("test-state", &recordingDriver{})
+	defer func() {
+		UnregisterStrategy("test-state")
+		mu.Lock()
+		delete(sqlDrivers, "test-state")
+		mu.Unlock()
+	}()
+	backoff := rewatchBackoff
+	rewatchBackoff = time.Millisecond
+	defer func() { rewatchBackoff = backoff }()
+	const name = "test-state://test-state/dsn?transforms=trim"
+
+	// the predecessor follows a change before it exports its state
+	h := newHdriver()
+	defer h.stop()
+	if _, err := h.Open(name); err != nil {
+		t.Fatal(err)
+	}
+	s.set(" dbname=b ")
+	cg, _ := h.group(name)
+	waitFor(t, func() bool { return cg.currentValue() == "dbname=b" })
+	data, err := h.ExportState()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var st state
+	if err := json.Unmarshal(data, &st); err != nil || st.Locations[name] != "dbname=b" {
+		t.Fatalf("ExportState() = %s, %v", data, err)
+	}
+
+	// the successor starts while the source is down
+	s.down.Store(true)
+	successor := newHdriver()
+	defer successor.stop()
+	if err := successor.ImportState(data); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := successor.Open(name); err != nil {
+		t.Fatalf("Open() with imported state error = %v", err)
+	}
+	cg, _ = successor.group(name)
+	if v := cg.currentValue(); v != "dbname=b" {
+		t.Errorf("successor uses %q, want the imported value", v)
+	}
+
+	// and follows the source once it is back
+	s.docStrategy.doc = " dbname=c "
+	s.down.Store(false)
+	waitFor(t, func() bool { return cg.currentValue() == "dbname=c" })
+}
+
+func TestImportStateWithAvailableSource(t *testing.T) {
+	RegisterStrategy("test-state-available", fixedStrategy{value: "dbname=source"})
+	RegisterSQLDriver("test-state-available", &recordingDriver{})
+	defer func() {
+		UnregisterStrategy("test-state-available")
+		mu.Lock()
+		delete(sqlDrivers, "test-state-available")
+		mu.Unlock()
+	}()
+	const name = "test-state-available://test-state-available/dsn"
+	h := newHdriver()
+	defer h.stop()
+	data, _ := json.Marshal(state{Version: stateVersion, Locations: map[string]string{name: "dbname=imported"}})
+	if err := h.ImportState(data); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := h.Open(name); err != nil {
+		t.Fatal(err)
+	}
+	cg, _ := h.group(name)
+	if v := cg.currentValue(); v != "dbname=source" {
+		t.Errorf("location uses %q, want the value of the source", v)
+	}
+}
+
+func TestImportStateInvalid(t *testing.T) {
+	h := newHdriver()
+	defer h.stop()
+	for _, data := range []string{"", "{", `{"version": 2, "locations": {}}`} {
+		if err := h.ImportState([]byte(data)); err == nil {
+			t.Errorf("ImportState(%q) accepted an invalid state", data)
+		}
+	}
+}
+
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("condition not met within a second")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
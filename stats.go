@@ -0,0 +1,137 @@
+package hotload
+
+import (
+	"time"
+
+	"github.com/infobloxopen/hotload/metrics"
+)
+
+// LocationStats is a snapshot of the state of a hotload location.
+type LocationStats struct {
+	// Location is the hotload connection string given to sql.Open.
+	Location string
+	// Connections is the number of open connections hotload is tracking.
+	Connections int
+	// LastFetch is when the strategy last delivered a value, changed or not.
+	// For push based strategies it indicates connectivity, for polling
+	// strategies it confirms the poll loop is alive.
+	LastFetch time.Time
+	// LastChange is when the connection information last changed.
+	LastChange time.Time
+	// OpensInFlight is the number of opens waiting for or calling the
+	// underlying driver.
+	OpensInFlight int
+	// Flapping is true while changes are held back because the source
+	// changed more than flapLimit times within flapWindow.
+	Flapping bool
+	// QuiescedUntil is when the maintenance window started by QuiesceFor
+	// ends, zero if the location is not quiesced.
+	QuiescedUntil time.Time
+	// Overridden is true while the connection information comes from an
+	// environment override instead of the strategy, see EnableEnvOverrides.
+	Overridden bool
+	// ChannelBuffer is the number of strategy values buffered for the
+	// change pipeline, see channelBuffer.
+	ChannelBuffer int
+	// MaxBacklog is the most strategy values that waited for the change
+	// pipeline at once. It reaching ChannelBuffer means values were
+	// replaced before they were applied.
+	MaxBacklog int
+}
+
+// Stats returns a snapshot of every active hotload location, keyed by
+// location.
+func Stats() map[string]LocationStats {
+	return hotloadDriver.Stats()
+}
+
+func (h *hdriver) Stats() map[string]LocationStats {
+	groups := h.groups()
+	stats := make(map[string]LocationStats, len(groups))
+	for _, cg := range groups {
+		stats[cg.name] = cg.stats()
+	}
+	return stats
+}
+
+func (cg *chanGroup) stats() LocationStats {
+	cg.mu.RLock()
+	defer cg.mu.RUnlock()
+	return LocationStats{
+		Location:      cg.name,
+		Connections:   len(cg.conns),
+		LastFetch:     cg.lastFetch,
+		LastChange:    cg.lastChange,
+		OpensInFlight: int(cg.inFlight.Load()),
+		Flapping:      cg.flap.holding,
+		QuiescedUntil: cg.quiesce.until,
+		Overridden:    cg.override.raw != "",
+		ChannelBuffer: cg.buffer.capacity(),
+		MaxBacklog:    int(cg.buffer.maxBacklog.Load()),
+	}
+}
+
+// ConnInfo is a snapshot of a connection hotload is tracking.
+type ConnInfo struct {
+	// Created is when the connection was opened.
+	Created time.Time
+	// Stale is true if the connection was reset by a change and will be
+	// discarded the next time database/sql tries to use it.
+	Stale bool
+	// InTx is true while the connection is in a transaction.
+	InTx bool
+}
+
+// ConnectionDetails returns a snapshot of the connections of the hotload
+// location name, the connection string given to sql.Open, or nil if the
+// location is unknown. Connections reset by a change are listed as Stale
+// until they are closed. It is meant for debugging, e.g. hunting connection
+// leaks.
+func ConnectionDetails(name string) []ConnInfo {
+	return hotloadDriver.ConnectionDetails(name)
+}
+
+func (h *hdriver) ConnectionDetails(name string) []ConnInfo {
+	cg, ok := h.group(name)
+	if !ok {
+		return nil
+	}
+	return cg.connectionDetails()
+}
+
+func (cg *chanGroup) connectionDetails() []ConnInfo {
+	cg.mu.RLock()
+	defer cg.mu.RUnlock()
+	infos := make([]ConnInfo, 0, len(cg.conns)+len(cg.stale))
+	for _, c := range append(cg.conns[:len(cg.conns):len(cg.conns)], cg.stale...) {
+		if c.closed.Load() {
+			continue
+		}
+		infos = append(infos, ConnInfo{
+			Created: c.Created(),
+			Stale:   c.Stale(),
+			InTx:    c.InTx(),
+		})
+	}
+	return infos
+}
+
+// keepStale adds the reset conns to cg.stale and drops the stale connections
+// closed meanwhile. Closed is read without the locks of the connections, one
+// may be calling back into the group. cg.mu must be held.
+func (cg *chanGroup) keepStale(conns []*managedConn) {
+	stale := make([]*managedConn, 0, len(cg.stale)+len(conns))
+	for _, c := range append(cg.stale, conns...) {
+		if !c.closed.Load() {
+			stale = append(stale, c)
+		}
+	}
+	cg.stale = stale
+}
+
+func (cg *chanGroup) fetched() {
+	cg.mu.Lock()
+	defer cg.mu.Unlock()
+	cg.lastFetch = cg.now()
+	metrics.SetHotloadLastFetch(cg.name, cg.lastFetch)
+}
@@ -0,0 +1,138 @@
+// Package stdin implements a hotload strategy that reads the connection
+// string from standard input, for one-shot tools and scripts that pipe the
+// DSN in:
+//
+//	echo "$DSN" | mytool
+//
+//	db, err := sql.Open("hotload", "stdin://postgres/")
+//
+// The first line is read before Watch returns. By default later input is
+// ignored; with follow=true every further non-empty line is a new value
+// until stdin is closed. The path is ignored, every location shares stdin.
+//
+// This is meant for ephemeral tools and debugging, not long-running
+// services.
+package stdin
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/infobloxopen/hotload"
+	"github.com/infobloxopen/hotload/logger"
+	"github.com/infobloxopen/hotload/metrics"
+	"github.com/infobloxopen/hotload/strategy"
+)
+
+func init() {
+	hotload.RegisterStrategy(strategyName, NewStrategy())
+}
+
+const strategyName = "stdin"
+
+// FollowKey is the query parameter that keeps reading stdin for updates.
+const FollowKey = "follow"
+
+// resource names stdin in errors.
+const resource = "stdin"
+
+// NewStrategy returns a strategy that reads from os.Stdin.
+func NewStrategy() *Strategy {
+	return newStrategy(os.Stdin)
+}
+
+func newStrategy(r io.Reader) *Strategy {
+	return &Strategy{scanner: bufio.NewScanner(r)}
+}
+
+// Strategy implements the hotload Strategy interface by reading lines from
+// standard input.
+type Strategy struct {
+	mu        sync.Mutex
+	scanner   *bufio.Scanner
+	read      bool
+	value     string
+	err       error
+	following bool
+	watchers  []*watcher
+}
+
+type watcher struct {
+	ctx    context.Context
+	values chan string
+}
+
+// Watch implements the hotload.Strategy interface. The first call blocks
+// until the first line of stdin was read, an empty stdin is an error.
+func (s *Strategy) Watch(ctx context.Context, pth string, options url.Values) (value string, values <-chan string, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.read {
+		s.read = true
+		s.value, s.err = s.readLine()
+	}
+	if s.err != nil {
+		return "", nil, s.err
+	}
+	w := &watcher{ctx: ctx, values: make(chan string)}
+	if follow, _ := strconv.ParseBool(options.Get(FollowKey)); follow {
+		s.watchers = append(s.watchers, w)
+		if !s.following {
+			s.following = true
+			go s.run()
+		}
+	}
+	return s.value, w.values, nil
+}
+
+// readLine returns the next non-empty line.
+func (s *Strategy) readLine() (string, error) {
+	for s.scanner.Scan() {
+		if v := strings.TrimSpace(s.scanner.Text()); v != "" {
+			return v, nil
+		}
+	}
+	if err := s.scanner.Err(); err != nil {
+		return "", strategy.ReadError(resource, err)
+	}
+	return "", strategy.ReadError(resource, io.ErrUnexpectedEOF)
+}
+
+func (s *Strategy) run() {
+	metrics.IncHotloadWatchGoroutines(strategyName)
+	defer metrics.DecHotloadWatchGoroutines(strategyName)
+	log := logger.GetLogger()
+	for {
+		// the scanner is only used by run once the first line was read
+		v, err := s.readLine()
+		if err != nil {
+			log("stdin: no further updates:", err)
+			return
+		}
+		s.mu.Lock()
+		s.value = v
+		// drop the watchers of closed locations
+		watchers := s.watchers[:0]
+		for _, w := range s.watchers {
+			if w.ctx.Err() == nil {
+				watchers = append(watchers, w)
+			}
+		}
+		s.watchers = watchers
+		watchers = append([]*watcher(nil), watchers...)
+		s.mu.Unlock()
+		log("stdin: value changed")
+		for _, w := range watchers {
+			select {
+			case w.values <- v:
+			case <-w.ctx.Done():
+			}
+		}
+	}
+}
@@ -0,0 +1,13 @@
+package stdin
+
+import (
+	"testing"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+func TestStdin(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Stdin Suite")
+}
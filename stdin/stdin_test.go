@@ -0,0 +1,63 @@
+package stdin
+
+import (
+	"context"
+	"io"
+	"net/url"
+	"strings"
+
+	"github.com/infobloxopen/hotload/strategy"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Strategy", func() {
+	var (
+		ctx    context.Context
+		cancel context.CancelFunc
+	)
+
+	BeforeEach(func() {
+		ctx, cancel = context.WithCancel(context.Background())
+	})
+
+	AfterEach(func() {
+		cancel()
+	})
+
+	It("Should return the first non-empty line", func() {
+		s := newStrategy(strings.NewReader("\n  dbname=one  \ndbname=two\n"))
+		v, values, err := s.Watch(ctx, "/", url.Values{})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(v).To(Equal("dbname=one"))
+		Consistently(values, "50ms").ShouldNot(Receive())
+	})
+
+	It("Should fail on empty input", func() {
+		_, _, err := newStrategy(strings.NewReader("\n")).Watch(ctx, "/", url.Values{})
+		Expect(err).To(MatchError(strategy.ErrReadFailed))
+		Expect(err).To(MatchError(io.ErrUnexpectedEOF))
+	})
+
+	It("Should share the value between locations", func() {
+		s := newStrategy(strings.NewReader("dbname=one\n"))
+		_, _, err := s.Watch(ctx, "/", url.Values{})
+		Expect(err).ToNot(HaveOccurred())
+		v, _, err := s.Watch(ctx, "/other", url.Values{})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(v).To(Equal("dbname=one"))
+	})
+
+	It("Should emit later lines with follow=true", func() {
+		r, w := io.Pipe()
+		defer w.Close()
+		s := newStrategy(r)
+		go io.WriteString(w, "dbname=one\n")
+		v, values, err := s.Watch(ctx, "/", url.Values{FollowKey: {"true"}})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(v).To(Equal("dbname=one"))
+
+		go io.WriteString(w, "dbname=two\n")
+		Eventually(values).Should(Receive(Equal("dbname=two")))
+	})
+})
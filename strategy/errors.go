@@ -0,0 +1,55 @@
+// Package strategy holds helpers shared by hotload strategies.
+//
+// Strategies wrap the sentinel errors below with %w so callers can branch on
+// the failure type with errors.Is, e.g. to tell a missing file from a
+// transient failure:
+//
+//	if errors.Is(err, strategy.ErrResourceNotFound) {
+//	    ...
+//	}
+package strategy
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+)
+
+var (
+	// ErrResourceNotFound means the watched resource does not exist.
+	ErrResourceNotFound = errors.New("resource not found")
+	// ErrReadFailed means the watched resource exists but could not be read.
+	ErrReadFailed = errors.New("could not read resource")
+	// ErrWatchFailed means the strategy could not start watching the resource.
+	ErrWatchFailed = errors.New("could not watch resource")
+	// ErrWatchClosed means the watch was closed, e.g. its context was canceled.
+	ErrWatchClosed = errors.New("watch closed")
+	// ErrDecodeFailed means the resource was read but its contents could not be decoded.
+	ErrDecodeFailed = errors.New("could not decode resource")
+	// ErrMissingOption means a required query parameter was not given.
+	ErrMissingOption = errors.New("missing required option")
+)
+
+// ReadError wraps an error reading resource with ErrResourceNotFound if it
+// doesn't exist, ErrReadFailed otherwise. The original error is still
+// reachable with errors.Is/As.
+func ReadError(resource string, err error) error {
+	if errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("could not read %v: %w: %w", resource, ErrResourceNotFound, err)
+	}
+	return fmt.Errorf("%w %v: %w", ErrReadFailed, resource, err)
+}
+
+// WatchError wraps an error watching resource with ErrResourceNotFound if it
+// doesn't exist, ErrWatchFailed otherwise.
+func WatchError(resource string, err error) error {
+	if errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("could not watch %v: %w: %w", resource, ErrResourceNotFound, err)
+	}
+	return fmt.Errorf("%w %v: %w", ErrWatchFailed, resource, err)
+}
+
+// MissingOption returns an error for the missing required query parameter key.
+func MissingOption(key string) error {
+	return fmt.Errorf("%w: %v", ErrMissingOption, key)
+}
@@ -0,0 +1,36 @@
+package strategy
+
+import (
+	"errors"
+	"io/fs"
+	"testing"
+)
+
+func TestErrors(t *testing.T) {
+	permErr := &fs.PathError{Op: "open", Path: "/x", Err: fs.ErrPermission}
+	notExistErr := &fs.PathError{Op: "open", Path: "/x", Err: fs.ErrNotExist}
+	tests := []struct {
+		name   string
+		err    error
+		want   []error
+		wantNo error
+	}{
+		{"read not found", ReadError("/x", notExistErr), []error{ErrResourceNotFound, fs.ErrNotExist}, ErrReadFailed},
+		{"read failed", ReadError("/x", permErr), []error{ErrReadFailed, fs.ErrPermission}, ErrResourceNotFound},
+		{"watch not found", WatchError("/x", notExistErr), []error{ErrResourceNotFound, fs.ErrNotExist}, ErrWatchFailed},
+		{"watch failed", WatchError("/x", permErr), []error{ErrWatchFailed, fs.ErrPermission}, ErrResourceNotFound},
+		{"missing option", MissingOption("key"), []error{ErrMissingOption}, ErrResourceNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, want := range tt.want {
+				if !errors.Is(tt.err, want) {
+					t.Errorf("errors.Is(%v, %v) = false, want true", tt.err, want)
+				}
+			}
+			if errors.Is(tt.err, tt.wantNo) {
+				t.Errorf("errors.Is(%v, %v) = true, want false", tt.err, tt.wantNo)
+			}
+		})
+	}
+}
@@ -0,0 +1,37 @@
+package strategy
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+var passwordRe = regexp.MustCompile(`(^|\s)password\s*=\s*('(?:[^'\\]|\\.)*'|\S*)\s*`)
+
+// SetPassword sets the password of dsn, which may be URL style
+// (postgres://user@host/db) or key/value style (user=app host=db). In
+// key/value style any existing password is replaced by a quoted one. An error
+// wraps ErrDecodeFailed and does not contain the connection string.
+func SetPassword(dsn, password string) (string, error) {
+	if strings.Contains(dsn, "://") {
+		u, err := url.Parse(dsn)
+		if err != nil {
+			// url.Error quotes the URL, which may contain a password
+			var ue *url.Error
+			if errors.As(err, &ue) {
+				err = ue.Err
+			}
+			return "", fmt.Errorf("%w: could not parse connection string: %w", ErrDecodeFailed, err)
+		}
+		u.User = url.UserPassword(u.User.Username(), password)
+		return u.String(), nil
+	}
+	dsn = strings.TrimSpace(passwordRe.ReplaceAllString(dsn, "$1"))
+	quoted := "'" + strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace(password) + "'"
+	if dsn == "" {
+		return "password=" + quoted, nil
+	}
+	return dsn + " password=" + quoted, nil
+}
@@ -0,0 +1,56 @@
+package strategy
+
+import (
+	"context"
+	"net/url"
+	"strings"
+)
+
+// StripCommentsKey is the query parameter that enables StripComments in
+// strategies reading files.
+const StripCommentsKey = "stripComments"
+
+// StripCommentsEnabled reports whether options ask for comments to be stripped.
+func StripCommentsEnabled(options url.Values) bool {
+	return options.Get(StripCommentsKey) == "true"
+}
+
+// StripComments removes blank lines and lines starting with # (ignoring
+// leading whitespace) from v, and joins the remaining lines with a single
+// space. A single line connection string is returned as is, a key/value
+// connection string split over several lines is merged into one.
+func StripComments(v string) string {
+	var kept []string
+	for _, line := range strings.Split(v, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		kept = append(kept, line)
+	}
+	return strings.Join(kept, " ")
+}
+
+// MapValues returns a channel delivering fn applied to every value received
+// on in, until ctx is done.
+func MapValues(ctx context.Context, in <-chan string, fn func(string) string) <-chan string {
+	out := make(chan string)
+	go func() {
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case v, ok := <-in:
+				if !ok {
+					return
+				}
+				select {
+				case out <- fn(v):
+				case <-ctx.Done():
+					return
+				}
+			}
+		}
+	}()
+	return out
+}
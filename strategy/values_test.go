@@ -0,0 +1,71 @@
+package strategy
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestStripComments(t *testing.T) {
+	tests := []struct {
+		name string
+		v    string
+		want string
+	}{
+		{"no comments", "postgres://localhost/db", "postgres://localhost/db"},
+		{"comment and blank lines", "# primary db\n\npostgres://localhost/db\n\n", "postgres://localhost/db"},
+		{"indented comment", "  # note\nuser=app dbname=db", "user=app dbname=db"},
+		{"merged key/value lines", "# app db\nuser=app\n# the db\ndbname=db\r\n", "user=app dbname=db"},
+		{"hash inside a line is kept", "user=app password=a#b", "user=app password=a#b"},
+		{"only comments", "# nothing\n#here", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := StripComments(tt.v); got != tt.want {
+				t.Errorf("StripComments() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMapValues(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	in := make(chan string)
+	out := MapValues(ctx, in, StripComments)
+	go func() { in <- "# c\nvalue" }()
+	select {
+	case v := <-out:
+		if v != "value" {
+			t.Errorf("MapValues() = %q, want %q", v, "value")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("MapValues() timed out")
+	}
+}
+
+func TestSetPassword(t *testing.T) {
+	tests := []struct {
+		name     string
+		dsn      string
+		password string
+		want     string
+	}{
+		{"url", "postgres://app:old@db/app", "p@ss", "postgres://app:p%40ss@db/app"},
+		{"key/value", "user=app password='o l\\'d' host=db", "p'w", "user=app host=db password='p\\'w'"},
+		{"empty", "", "pw", "password='pw'"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := SetPassword(tt.dsn, tt.password)
+			if err != nil || got != tt.want {
+				t.Errorf("SetPassword() = %q, %v, want %q", got, err, tt.want)
+			}
+		})
+	}
+	if _, err := SetPassword("postgres://app:secret@db:port/app", "pw"); !errors.Is(err, ErrDecodeFailed) || strings.Contains(err.Error(), "secret") {
+		t.Errorf("SetPassword() error = %v, want %v without the connection string", err, ErrDecodeFailed)
+	}
+}
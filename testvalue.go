@@ -0,0 +1,130 @@
+package hotload
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"net/url"
+	"sync"
+)
+
+// valueStrategyName is the scheme of the locations created by OpenWithValue.
+// It is not registered with RegisterStrategy so it never shows up in
+// Strategies.
+const valueStrategyName = "hotload-value"
+
+// fixedValues backs the locations created by OpenWithValue.
+var fixedValues = &valueStrategy{
+	sources: make(map[string]*valueSource),
+	dbs:     make(map[*sql.DB]*valueSource),
+}
+
+type valueSource struct {
+	value string
+	ch    chan string
+}
+
+// valueStrategy is a Strategy whose values are set through SetValue instead
+// of being watched.
+type valueStrategy struct {
+	mu      sync.Mutex
+	next    int
+	sources map[string]*valueSource
+	dbs     map[*sql.DB]*valueSource
+}
+
+func (s *valueStrategy) Watch(ctx context.Context, pth string, options url.Values) (string, <-chan string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	src, ok := s.sources[pth]
+	if !ok {
+		return "", nil, ErrUnknownLocation
+	}
+	return src.value, src.ch, nil
+}
+
+// OpenWithValue opens a database through hotload that uses the fixed
+// connection string value with the driver registered as driverName, without
+// any strategy watching a source. Connections are wrapped and reset exactly as
+// for any other hotload location, SetValue simulates a change in the
+// connection information.
+//
+// OpenWithValue is intended for tests of code that depends on hotload's
+// connection handling, production code should use a strategy.
+func OpenWithValue(driverName, value string) (*sql.DB, error) {
+	mu.RLock()
+	_, _, ok := lookupDriver(driverName)
+	mu.RUnlock()
+	if !ok {
+		return nil, ErrUnknownDriver
+	}
+
+	s := fixedValues
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.next++
+	pth := fmt.Sprintf("/%d", s.next)
+	src := &valueSource{value: value, ch: make(chan string, 1)}
+	db, err := sql.Open("hotload", valueStrategyName+"://"+driverName+pth)
+	if err != nil {
+		return nil, err
+	}
+	s.sources[pth] = src
+	s.dbs[db] = src
+	return db, nil
+}
+
+// stopLocation stops watching the location name and removes it, like
+// retireIdle but regardless of the connections it still has.
+func (h *hdriver) stopLocation(name string) {
+	mu.Lock()
+	cg, ok := h.cgroup[name]
+	if ok {
+		delete(h.cgroup, name)
+	}
+	mu.Unlock()
+	if !ok {
+		return
+	}
+	cg.stopWatch()
+	cg.log("stopped watching closed location", cg.name)
+}
+
+// forget removes the location pth once its sql.DB is closed, SetValue returns
+// ErrUnknownLocation for it from then on.
+func (s *valueStrategy) forget(pth string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	src, ok := s.sources[pth]
+	if !ok {
+		return
+	}
+	delete(s.sources, pth)
+	for db, dbSrc := range s.dbs {
+		if dbSrc == src {
+			delete(s.dbs, db)
+		}
+	}
+}
+
+// SetValue changes the connection string of a database opened with
+// OpenWithValue, as if its source had changed. The change is applied
+// asynchronously like changes from a strategy. It returns
+// ErrUnknownLocation if db was not opened with OpenWithValue or was closed.
+func SetValue(db *sql.DB, value string) error {
+	s := fixedValues
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	src, ok := s.dbs[db]
+	if !ok {
+		return ErrUnknownLocation
+	}
+	src.value = value
+	// only the latest value matters, replace one hotload has not read yet
+	select {
+	case <-src.ch:
+	default:
+	}
+	src.ch <- value
+	return nil
+}
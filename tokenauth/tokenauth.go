@@ -0,0 +1,196 @@
+// Package tokenauth implements a hotload strategy for IAM database
+// authentication, e.g. RDS IAM or Cloud SQL IAM, where the password is a
+// short-lived token computed by the application rather than read from a file.
+// The application registers a provider with the connection string and a
+// function returning a fresh token, and opens the location by the name of the
+// provider:
+//
+//	tokenauth.RegisterProvider("orders", "postgres://orders@db:5432/orders", func(ctx context.Context) (tokenauth.Token, error) {
+//		...
+//	})
+//
+//	db, err := sql.Open("hotload", "token://postgres/orders")
+//
+// The token is set as the password of the connection string and refreshed
+// every refresh interval, or earlier so it is replaced before it expires.
+// Every refresh is a new value, so connections rotate to the new token. Tokens
+// are never logged.
+package tokenauth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/infobloxopen/hotload"
+	"github.com/infobloxopen/hotload/logger"
+	"github.com/infobloxopen/hotload/metrics"
+	"github.com/infobloxopen/hotload/strategy"
+)
+
+func init() {
+	hotload.RegisterStrategy(strategyName, NewStrategy())
+}
+
+const strategyName = "token"
+
+// RefreshKey is the query parameter with the refresh interval, e.g. 10m.
+const RefreshKey = "refresh"
+
+// DefaultRefresh is the refresh interval without refresh=.
+var DefaultRefresh = 10 * time.Minute
+
+// ExpiryMargin is how long before its expiry a token is replaced.
+var ExpiryMargin = time.Minute
+
+// minRefresh bounds the refresh interval, tokens close to their expiry are
+// not refreshed in a busy loop.
+var minRefresh = time.Second
+
+// retryDelay is the delay before a failed refresh is retried.
+var retryDelay = 5 * time.Second
+
+// ErrUnknownProvider is returned by Watch for a provider that is not
+// registered.
+var ErrUnknownProvider = errors.New("tokenauth: provider is not registered")
+
+// Token is a credential returned by a TokenFunc.
+type Token struct {
+	Value string
+	// Expiry is when the token stops being valid, zero if unknown.
+	Expiry time.Time
+}
+
+// TokenFunc returns a fresh token, e.g. by signing an RDS IAM auth request.
+type TokenFunc func(ctx context.Context) (Token, error)
+
+type provider struct {
+	dsn string
+	fn  TokenFunc
+}
+
+var (
+	providersMu sync.RWMutex
+	providers   = make(map[string]provider)
+)
+
+// RegisterProvider makes the provider name available to token:// locations.
+// Tokens from fn are set as the password of dsn, a URL or key/value style
+// connection string. If RegisterProvider is called twice with the same name or
+// if fn is nil, it panics.
+func RegisterProvider(name, dsn string, fn TokenFunc) {
+	providersMu.Lock()
+	defer providersMu.Unlock()
+	if fn == nil {
+		panic("tokenauth: RegisterProvider fn is nil")
+	}
+	if _, dup := providers[name]; dup {
+		panic("tokenauth: RegisterProvider called twice for provider " + name)
+	}
+	providers[name] = provider{dsn: dsn, fn: fn}
+}
+
+// UnregisterProvider removes the provider name. Locations already watching it
+// keep refreshing.
+func UnregisterProvider(name string) {
+	providersMu.Lock()
+	defer providersMu.Unlock()
+	delete(providers, name)
+}
+
+// NewStrategy returns a strategy that builds connection strings from the
+// registered providers.
+func NewStrategy() *Strategy {
+	return &Strategy{}
+}
+
+// Strategy implements the hotload Strategy interface with token providers.
+type Strategy struct{}
+
+// Watch implements the hotload.Strategy interface. The path is the name of the
+// provider. Errors fetching the first token are returned, later errors are
+// logged and the refresh is retried while the previous value is kept. The
+// refresh loop stops when ctx is canceled.
+func (s *Strategy) Watch(ctx context.Context, pth string, options url.Values) (value string, values <-chan string, err error) {
+	name := strings.Trim(pth, "/")
+	providersMu.RLock()
+	p, ok := providers[name]
+	providersMu.RUnlock()
+	if !ok {
+		return "", nil, fmt.Errorf("%w: %s", ErrUnknownProvider, name)
+	}
+	refresh := DefaultRefresh
+	if v := options.Get(RefreshKey); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d <= 0 {
+			return "", nil, fmt.Errorf("tokenauth: invalid %s %q", RefreshKey, v)
+		}
+		refresh = d
+	}
+	value, next, err := p.fetch(ctx, name, refresh)
+	if err != nil {
+		return "", nil, err
+	}
+	out := make(chan string)
+	go p.run(ctx, name, refresh, next, out)
+	return value, out, nil
+}
+
+// fetch returns the connection string with a fresh token and when to refresh
+// it.
+func (p provider) fetch(ctx context.Context, name string, refresh time.Duration) (string, time.Duration, error) {
+	token, err := p.fn(ctx)
+	if err != nil {
+		return "", 0, strategy.ReadError("token of provider "+name, err)
+	}
+	dsn, err := strategy.SetPassword(p.dsn, token.Value)
+	if err != nil {
+		return "", 0, fmt.Errorf("tokenauth: provider %s: %w", name, err)
+	}
+	next := refresh
+	if !token.Expiry.IsZero() {
+		if d := time.Until(token.Expiry) - ExpiryMargin; d < next {
+			next = d
+		}
+	}
+	if next < minRefresh {
+		next = minRefresh
+	}
+	return dsn, next, nil
+}
+
+func (p provider) run(ctx context.Context, name string, refresh, next time.Duration, out chan<- string) {
+	metrics.IncHotloadWatchGoroutines(strategyName)
+	defer metrics.DecHotloadWatchGoroutines(strategyName)
+	log := logger.GetLogger()
+	timer := time.NewTimer(next)
+	defer timer.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-timer.C:
+		}
+		dsn, d, err := p.fetch(ctx, name, refresh)
+		if err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			log("tokenauth: could not refresh token, retrying:", err)
+			metrics.IncHotloadWatchRestarts(strategyName)
+			timer.Reset(retryDelay)
+			continue
+		}
+		log("tokenauth: refreshed token of provider", name)
+		select {
+		case out <- dsn:
+		case <-ctx.Done():
+			return
+		}
+		timer.Reset(d)
+	}
+}
@@ -0,0 +1,20 @@
+package tokenauth
+
+import (
+	"testing"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+func TestTokenAuth(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "TokenAuth Suite")
+}
+
+var _ = BeforeSuite(func() {
+	minRefresh = time.Millisecond
+	retryDelay = 10 * time.Millisecond
+	ExpiryMargin = 10 * time.Millisecond
+})
@@ -0,0 +1,112 @@
+package tokenauth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/infobloxopen/hotload/strategy"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+// tokens hands out numbered tokens, failing while err is set.
+type tokens struct {
+	mu     sync.Mutex
+	n      int
+	err    error
+	expiry time.Duration
+}
+
+func (t *tokens) fn(ctx context.Context) (Token, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.err != nil {
+		return Token{}, t.err
+	}
+	t.n++
+	tok := Token{Value: fmt.Sprintf("tok%d", t.n)}
+	if t.expiry > 0 {
+		tok.Expiry = time.Now().Add(t.expiry)
+	}
+	return tok, nil
+}
+
+func (t *tokens) setErr(err error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.err = err
+}
+
+var _ = Describe("Strategy", func() {
+	var (
+		ctx    context.Context
+		cancel context.CancelFunc
+		toks   *tokens
+	)
+
+	BeforeEach(func() {
+		ctx, cancel = context.WithCancel(context.Background())
+		toks = &tokens{}
+		RegisterProvider("test", "postgres://app@db:5432/app", toks.fn)
+		RegisterProvider("test-kv", "user=app host=db", toks.fn)
+	})
+
+	AfterEach(func() {
+		cancel()
+		UnregisterProvider("test")
+		UnregisterProvider("test-kv")
+	})
+
+	It("Should set the token as the password", func() {
+		v, _, err := NewStrategy().Watch(ctx, "/test", url.Values{})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(v).To(Equal("postgres://app:tok1@db:5432/app"))
+
+		v, _, err = NewStrategy().Watch(ctx, "/test-kv", url.Values{})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(v).To(Equal("user=app host=db password='tok2'"))
+	})
+
+	It("Should fail for unknown providers and bad options", func() {
+		_, _, err := NewStrategy().Watch(ctx, "/other", url.Values{})
+		Expect(err).To(MatchError(ErrUnknownProvider))
+		_, _, err = NewStrategy().Watch(ctx, "/test", url.Values{RefreshKey: {"soon"}})
+		Expect(err).To(HaveOccurred())
+		Expect(func() { RegisterProvider("test", "", toks.fn) }).To(PanicWith(MatchRegexp("called twice")))
+	})
+
+	It("Should return the error of the first token", func() {
+		toks.setErr(errors.New("no credentials"))
+		_, _, err := NewStrategy().Watch(ctx, "/test", url.Values{})
+		Expect(err).To(MatchError(strategy.ErrReadFailed))
+	})
+
+	It("Should refresh on the interval and retry failures", func() {
+		_, values, err := NewStrategy().Watch(ctx, "/test", url.Values{RefreshKey: {"20ms"}})
+		Expect(err).ToNot(HaveOccurred())
+		Eventually(values).Should(Receive(Equal("postgres://app:tok2@db:5432/app")))
+
+		toks.setErr(errors.New("throttled"))
+		Consistently(values, "50ms").ShouldNot(Receive())
+		toks.setErr(nil)
+		Eventually(values).Should(Receive(Equal("postgres://app:tok3@db:5432/app")))
+	})
+
+	It("Should refresh before the token expires", func() {
+		toks.expiry = 30 * time.Millisecond
+		_, values, err := NewStrategy().Watch(ctx, "/test", url.Values{})
+		Expect(err).ToNot(HaveOccurred())
+		Eventually(values, "200ms").Should(Receive(Equal("postgres://app:tok2@db:5432/app")))
+	})
+
+	It("Should stop refreshing when ctx is canceled", func() {
+		_, values, err := NewStrategy().Watch(ctx, "/test", url.Values{RefreshKey: {"10ms"}})
+		Expect(err).ToNot(HaveOccurred())
+		cancel()
+		Consistently(values, "50ms").ShouldNot(Receive())
+	})
+})
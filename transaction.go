@@ -33,14 +33,15 @@ func observeSQLStmtsSummary(ctx context.Context, execStmtsCounter, queryStmtsCou
 	service := labels[metrics.GRPCServiceKey]
 	method := labels[metrics.GRPCMethodKey]
 
-	metrics.SqlStmtsSummary.WithLabelValues(service, method, metrics.ExecStatement).Observe(float64(execStmtsCounter))
-	metrics.SqlStmtsSummary.WithLabelValues(service, method, metrics.QueryStatement).Observe(float64(queryStmtsCounter))
+	metrics.ObserveSqlStmtsSummary(service, method, metrics.ExecStatement, float64(execStmtsCounter))
+	metrics.ObserveSqlStmtsSummary(service, method, metrics.QueryStatement, float64(queryStmtsCounter))
 }
 
 func (t *managedTx) cleanup() {
 	observeSQLStmtsSummary(t.ctx, t.conn.execStmtsCounter, t.conn.queryStmtsCounter)
 	t.conn.resetExecStmtsCounter()
 	t.conn.resetQueryStmtsCounter()
+	t.conn.endTx()
 }
 
 type promLabelKeyType struct{}
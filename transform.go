@@ -0,0 +1,96 @@
+package hotload
+
+import (
+	"encoding/base64"
+	"fmt"
+	"net/url"
+	"strings"
+	"sync"
+
+	"github.com/infobloxopen/hotload/strategy"
+)
+
+const transformsKey = "transforms"
+
+// Transform turns a value received from a strategy into the value passed on
+// to the next transform, and finally to the driver.
+type Transform func(v string) (string, error)
+
+var (
+	transformsMu sync.RWMutex
+	transforms   = map[string]Transform{
+		"trim": func(v string) (string, error) {
+			return strings.TrimSpace(v), nil
+		},
+		"stripComments": func(v string) (string, error) {
+			return strategy.StripComments(v), nil
+		},
+		"base64": func(v string) (string, error) {
+			bs, err := base64.StdEncoding.DecodeString(strings.TrimSpace(v))
+			if err != nil {
+				return "", fmt.Errorf("%w: %w", strategy.ErrDecodeFailed, err)
+			}
+			return string(bs), nil
+		},
+		"expandEnv": func(v string) (string, error) {
+			return expandEnv(v, false)
+		},
+		"expandEnvStrict": func(v string) (string, error) {
+			return expandEnv(v, true)
+		},
+	}
+)
+
+// RegisterTransform registers fn under name for use in the transforms
+// option, e.g. transforms=trim,base64,expandEnv. Registering a name again
+// replaces the previous transform, including the built in ones: trim,
+// stripComments, base64, expandEnv and expandEnvStrict.
+func RegisterTransform(name string, fn Transform) {
+	if fn == nil {
+		panic("hotload: RegisterTransform transform is nil")
+	}
+	transformsMu.Lock()
+	defer transformsMu.Unlock()
+	transforms[name] = fn
+}
+
+// pipeline is an ordered list of transforms.
+type pipeline []namedTransform
+
+type namedTransform struct {
+	name string
+	fn   Transform
+}
+
+// apply runs the transforms in order, stopping at the first error.
+func (p pipeline) apply(v string) (string, error) {
+	for _, t := range p {
+		var err error
+		if v, err = t.fn(v); err != nil {
+			return "", fmt.Errorf("transform %s: %w", t.name, err)
+		}
+	}
+	return v, nil
+}
+
+// parseTransforms reads the comma separated transforms option. Unknown
+// transforms are logged and skipped.
+func (cg *chanGroup) parseTransforms(vs url.Values) {
+	v := vs.Get(transformsKey)
+	if v == "" {
+		return
+	}
+	transformsMu.RLock()
+	defer transformsMu.RUnlock()
+	cg.transforms = nil
+	for _, name := range strings.Split(v, ",") {
+		name = strings.TrimSpace(name)
+		fn, ok := transforms[name]
+		if !ok {
+			cg.log("unknown transform, ignoring", name)
+			continue
+		}
+		cg.transforms = append(cg.transforms, namedTransform{name: name, fn: fn})
+	}
+	cg.log("transforms set to", v)
+}
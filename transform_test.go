@@ -0,0 +1,61 @@
+package hotload
+
+import (
+	"encoding/base64"
+	"errors"
+	"net/url"
+	"os"
+	"testing"
+
+	"github.com/infobloxopen/hotload/strategy"
+)
+
+func Test_pipeline(t *testing.T) {
+	os.Setenv("HOTLOAD_TEST_TRANSFORM_DB", "orders")
+	defer os.Unsetenv("HOTLOAD_TEST_TRANSFORM_DB")
+	encoded := base64.StdEncoding.EncodeToString([]byte("dbname=${HOTLOAD_TEST_TRANSFORM_DB}"))
+	tests := []struct {
+		name       string
+		transforms string
+		v          string
+		want       string
+		wantErr    error
+	}{
+		{name: "trim, base64 then expandEnv", transforms: "trim,base64,expandEnv", v: "  " + encoded + "\n", want: "dbname=orders"},
+		{name: "order matters", transforms: "expandEnv,base64", v: encoded, want: "dbname=${HOTLOAD_TEST_TRANSFORM_DB}"},
+		{name: "stripComments", transforms: "stripComments", v: "# primary\nhost=db\ndbname=app", want: "host=db dbname=app"},
+		{name: "unknown transforms are skipped", transforms: "trim,rot13", v: " host=db ", want: "host=db"},
+		{name: "errors stop the pipeline", transforms: "base64,trim", v: "not base64!", wantErr: strategy.ErrDecodeFailed},
+		{name: "strict env", transforms: "expandEnvStrict", v: "${HOTLOAD_TEST_TRANSFORM_UNDEFINED}", wantErr: ErrUndefinedEnv},
+		{name: "no transforms", v: " host=db ", want: " host=db "},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cg := &chanGroup{log: func(...interface{}) {}}
+			cg.parseTransforms(url.Values{transformsKey: []string{tt.transforms}})
+			got, err := cg.transforms.apply(tt.v)
+			if !errors.Is(err, tt.wantErr) || (tt.wantErr != nil) != (err != nil) {
+				t.Fatalf("apply(%q) error = %v, want %v", tt.v, err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("apply(%q) = %q, want %q", tt.v, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRegisterTransform(t *testing.T) {
+	RegisterTransform("hotloadTestUpper", func(v string) (string, error) {
+		return v + "!", nil
+	})
+	defer func() {
+		transformsMu.Lock()
+		delete(transforms, "hotloadTestUpper")
+		transformsMu.Unlock()
+	}()
+	cg := &chanGroup{log: func(...interface{}) {}}
+	cg.parseTransforms(url.Values{transformsKey: []string{"trim,hotloadTestUpper"}})
+	if got, err := cg.transforms.apply(" v "); err != nil || got != "v!" {
+		t.Errorf("apply() = %q, %v, want %q", got, err, "v!")
+	}
+}
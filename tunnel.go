@@ -0,0 +1,223 @@
+package hotload
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+const tunnelHostKey = "tunnelHost"
+const tunnelUserKey = "tunnelUser"
+const tunnelKeyKey = "tunnelKey"
+
+// ErrNoTunneler is returned by opens of a location that sets tunnelHost while
+// no Tunneler is set.
+var ErrNoTunneler = errors.New("hotload: tunnelHost set but no tunneler registered")
+
+// TunnelConfig is the tunnel a location asks for with its tunnel options.
+type TunnelConfig struct {
+	// Host is the bastion, host or host:port, from tunnelHost.
+	Host string
+	// User is the user on the bastion, from tunnelUser.
+	User string
+	// KeyFile is the path of the private key, from tunnelKey.
+	KeyFile string
+}
+
+// Tunnel is an established tunnel forwarding a local address to the database.
+type Tunnel interface {
+	// LocalAddr is the host:port the driver connects to instead of the
+	// database.
+	LocalAddr() string
+	// Done is closed when the tunnel failed.
+	Done() <-chan struct{}
+	// Close tears the tunnel down.
+	Close() error
+}
+
+// Tunneler establishes tunnels to remoteAddr, the host:port of the database
+// in the connection string. hotload does not depend on an SSH library,
+// applications adapt one, e.g. golang.org/x/crypto/ssh, and set it with
+// SetTunneler.
+type Tunneler interface {
+	Tunnel(cfg TunnelConfig, remoteAddr string) (Tunnel, error)
+}
+
+var tunneler Tunneler
+
+// SetTunneler sets the Tunneler used by locations that set tunnelHost. Pass
+// nil to remove it.
+func SetTunneler(t Tunneler) {
+	hooksMu.Lock()
+	defer hooksMu.Unlock()
+	tunneler = t
+}
+
+func getTunneler() Tunneler {
+	hooksMu.RLock()
+	defer hooksMu.RUnlock()
+	return tunneler
+}
+
+// tunnelState is the tunnel of a location. The current tunnel is retired
+// when connections are reset, it fails or the database address changes, and
+// torn down once the last connection opened through it is closed.
+type tunnelState struct {
+	cfg     TunnelConfig
+	mu      sync.Mutex
+	current *tunnelRef
+}
+
+// tunnelRef counts the connections open through a tunnel.
+type tunnelRef struct {
+	tunnel  Tunnel
+	remote  string
+	refs    int
+	retired bool
+}
+
+func (cg *chanGroup) parseTunnel(vs url.Values) {
+	host := vs.Get(tunnelHostKey)
+	if host == "" {
+		return
+	}
+	cg.tunnel = &tunnelState{cfg: TunnelConfig{
+		Host:    host,
+		User:    vs.Get(tunnelUserKey),
+		KeyFile: vs.Get(tunnelKeyKey),
+	}}
+	cg.log("tunnelHost set to", host)
+}
+
+// acquire rewrites dsn to connect through the tunnel, establishing it first
+// if needed. release must be called once the connection is closed. Without a
+// tunnel dsn is returned unchanged. It is called without the package mu, a
+// slow Tunneler only holds up the opens of its location.
+func (ts *tunnelState) acquire(dsn string) (string, func(), error) {
+	if ts == nil {
+		return dsn, func() {}, nil
+	}
+	remote, err := dsnAddr(dsn)
+	if err != nil {
+		return "", nil, err
+	}
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+	if cur := ts.current; cur != nil {
+		select {
+		case <-cur.tunnel.Done():
+			ts.retireLocked()
+		default:
+			if cur.remote != remote {
+				ts.retireLocked()
+			}
+		}
+	}
+	if ts.current == nil {
+		t := getTunneler()
+		if t == nil {
+			return "", nil, ErrNoTunneler
+		}
+		tunnel, err := t.Tunnel(ts.cfg, remote)
+		if err != nil {
+			return "", nil, fmt.Errorf("hotload: could not establish tunnel to %s via %s: %w", remote, ts.cfg.Host, err)
+		}
+		ts.current = &tunnelRef{tunnel: tunnel, remote: remote}
+	}
+	dsn, err = setDSNAddr(dsn, ts.current.tunnel.LocalAddr())
+	if err != nil {
+		return "", nil, err
+	}
+	ref := ts.current
+	ref.refs++
+	var once sync.Once
+	return dsn, func() { once.Do(func() { ts.release(ref) }) }, nil
+}
+
+func (ts *tunnelState) release(ref *tunnelRef) {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+	ref.refs--
+	if ref.retired && ref.refs == 0 {
+		// ignore errors from close
+		ref.tunnel.Close()
+	}
+}
+
+// retire stops opening connections through the current tunnel, the next open
+// establishes a new one.
+func (ts *tunnelState) retire() {
+	if ts == nil {
+		return
+	}
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+	ts.retireLocked()
+}
+
+func (ts *tunnelState) retireLocked() {
+	ref := ts.current
+	if ref == nil {
+		return
+	}
+	ts.current = nil
+	ref.retired = true
+	if ref.refs == 0 {
+		// ignore errors from close
+		ref.tunnel.Close()
+	}
+}
+
+var kvAddrRe = regexp.MustCompile(`(^|\s)(host|port)\s*=\s*('(?:[^'\\]|\\.)*'|\S*)`)
+
+// dsnAddr returns the host:port of the database in a URL or key/value style
+// connection string. The port must be given explicitly.
+func dsnAddr(dsn string) (string, error) {
+	var host, port string
+	if strings.Contains(dsn, "://") {
+		u, err := url.Parse(dsn)
+		if err != nil {
+			return "", fmt.Errorf("hotload: could not parse connection string for tunnel: %w", err)
+		}
+		host, port = u.Hostname(), u.Port()
+	} else {
+		for _, m := range kvAddrRe.FindAllStringSubmatch(dsn, -1) {
+			if m[2] == "host" {
+				host = strings.Trim(m[3], "'")
+			} else {
+				port = strings.Trim(m[3], "'")
+			}
+		}
+	}
+	if host == "" || port == "" {
+		return "", errors.New("hotload: tunnel requires host and port in the connection string")
+	}
+	return net.JoinHostPort(host, port), nil
+}
+
+// setDSNAddr points the connection string dsn at addr.
+func setDSNAddr(dsn, addr string) (string, error) {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return "", fmt.Errorf("hotload: invalid tunnel address %s: %w", addr, err)
+	}
+	if strings.Contains(dsn, "://") {
+		u, err := url.Parse(dsn)
+		if err != nil {
+			return "", fmt.Errorf("hotload: could not parse connection string for tunnel: %w", err)
+		}
+		u.Host = addr
+		return u.String(), nil
+	}
+	return kvAddrRe.ReplaceAllStringFunc(dsn, func(m string) string {
+		sub := kvAddrRe.FindStringSubmatch(m)
+		if sub[2] == "host" {
+			return sub[1] + "host=" + host
+		}
+		return sub[1] + "port=" + port
+	}), nil
+}
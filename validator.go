@@ -0,0 +1,115 @@
+package hotload
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// DSNValidator validates connection strings for a driver before hotload
+// accepts them.
+type DSNValidator interface {
+	// Validate returns an error if dsn is not a valid connection string.
+	Validate(dsn string) error
+}
+
+// DSNValidatorFunc adapts a function to the DSNValidator interface.
+type DSNValidatorFunc func(dsn string) error
+
+// Validate implements DSNValidator.
+func (f DSNValidatorFunc) Validate(dsn string) error {
+	return f(dsn)
+}
+
+var validators = make(map[string]DSNValidator)
+
+// RegisterDSNValidator registers v to validate connection strings for the
+// named driver. When the connection information of a location using the
+// driver changes, the new value is validated first, before the other guards
+// of the change pipeline. If it is invalid the previous value is retained and
+// the rejection is logged and recorded in the audit sinks. Registering a
+// validator for a driver again replaces the previous one. Passing a nil v
+// removes the validator.
+func RegisterDSNValidator(driver string, v DSNValidator) {
+	mu.Lock()
+	defer mu.Unlock()
+	if v == nil {
+		delete(validators, driver)
+		return
+	}
+	validators[driver] = v
+}
+
+// Validate validates dsn with the validator registered for the named
+// driver. It returns nil if there is no validator for the driver.
+func Validate(driver, dsn string) error {
+	mu.RLock()
+	v, ok := validators[driver]
+	mu.RUnlock()
+	if !ok {
+		return nil
+	}
+	return v.Validate(dsn)
+}
+
+// ErrInvalidDSN is wrapped by the errors of the built-in validators.
+var ErrInvalidDSN = fmt.Errorf("invalid connection string")
+
+// PostgresDSNValidator is an example validator for lib/pq style connection
+// strings, URL (postgres://user@host/db) or key/value (user=app dbname=db),
+// that checks that the Required keywords are present. An empty Required
+// defaults to host, user and dbname.
+type PostgresDSNValidator struct {
+	Required []string
+}
+
+// Validate implements DSNValidator.
+func (p PostgresDSNValidator) Validate(dsn string) error {
+	required := p.Required
+	if len(required) == 0 {
+		required = []string{"host", "user", "dbname"}
+	}
+	keywords, err := postgresKeywords(dsn)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidDSN, err)
+	}
+	var missing []string
+	for _, k := range required {
+		if keywords[k] == "" {
+			missing = append(missing, k)
+		}
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("%w: missing %s", ErrInvalidDSN, strings.Join(missing, ", "))
+	}
+	return nil
+}
+
+func postgresKeywords(dsn string) (map[string]string, error) {
+	dsn = strings.TrimSpace(dsn)
+	keywords := make(map[string]string)
+	if strings.HasPrefix(dsn, "postgres://") || strings.HasPrefix(dsn, "postgresql://") {
+		u, err := url.Parse(dsn)
+		if err != nil {
+			return nil, err
+		}
+		keywords["host"] = u.Hostname()
+		keywords["port"] = u.Port()
+		keywords["user"] = u.User.Username()
+		keywords["dbname"] = strings.TrimPrefix(u.Path, "/")
+		for k, v := range u.Query() {
+			keywords[k] = v[0]
+		}
+		return keywords, nil
+	}
+	// quoted values may hold spaces, e.g. password='a b'
+	pairs, ok := splitKeyValues(dsn)
+	if !ok {
+		return nil, errors.New("malformed key/value connection string")
+	}
+	for _, p := range pairs {
+		keywords[p[0]] = unquoteKeyValue(p[1])
+	}
+	return keywords, nil
+}
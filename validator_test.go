@@ -0,0 +1,69 @@
+package hotload
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestPostgresDSNValidator(t *testing.T) {
+	tests := []struct {
+		name     string
+		required []string
+		dsn      string
+		wantErr  bool
+	}{
+		{name: "complete url", dsn: "postgres://app:pw@db:5432/app?sslmode=disable"},
+		{name: "complete postgresql url", dsn: "postgresql://app@db/app"},
+		{name: "url without database", dsn: "postgres://app@db", wantErr: true},
+		{name: "complete key/value", dsn: "host=db user=app dbname=app sslmode=disable"},
+		{name: "key/value without user", dsn: "host=db dbname=app", wantErr: true},
+		{name: "malformed key/value", dsn: "host=db user app dbname=app", wantErr: true},
+		{name: "quoted value with spaces", dsn: "host=db user=app password='a b' dbname=app"},
+		{name: "quoted value with escaped quote", dsn: `host=db password='it\'s = 1' user=app dbname=app`},
+		{name: "unterminated quote", dsn: "host=db user=app password='a b dbname=app", wantErr: true},
+		{name: "custom required keywords", required: []string{"sslmode"}, dsn: "host=db", wantErr: true},
+		{name: "quoted empty required keyword", dsn: "host=db user='' dbname=app", wantErr: true},
+		{name: "empty", dsn: "  ", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := PostgresDSNValidator{Required: tt.required}.Validate(tt.dsn)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil && !errors.Is(err, ErrInvalidDSN) {
+				t.Errorf("Validate() error = %v, should wrap ErrInvalidDSN", err)
+			}
+		})
+	}
+}
+
+func TestPostgresKeywordsQuoted(t *testing.T) {
+	got, err := postgresKeywords(`host=db password='it\'s a b' dbname = 'app'`)
+	if err != nil {
+		t.Fatalf("postgresKeywords() error = %v", err)
+	}
+	if got["password"] != "it's a b" || got["dbname"] != "app" || got["host"] != "db" {
+		t.Errorf("postgresKeywords() = %q, want the quoted values unquoted", got)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	RegisterDSNValidator("validate-test", DSNValidatorFunc(func(dsn string) error {
+		if dsn == "bad" {
+			return ErrInvalidDSN
+		}
+		return nil
+	}))
+	defer RegisterDSNValidator("validate-test", nil)
+
+	if err := Validate("validate-test", "bad"); !errors.Is(err, ErrInvalidDSN) {
+		t.Errorf("Validate() error = %v, want %v", err, ErrInvalidDSN)
+	}
+	if err := Validate("validate-test", "good"); err != nil {
+		t.Errorf("Validate() error = %v, want nil", err)
+	}
+	if err := Validate("no-validator", "bad"); err != nil {
+		t.Errorf("Validate() error = %v, want nil for a driver without validator", err)
+	}
+}
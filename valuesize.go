@@ -0,0 +1,59 @@
+package hotload
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+)
+
+const maxValueSizeKey = "maxValueSize"
+
+// DefaultMaxValueSize is the maximum size in bytes of connection information
+// when maxValueSize is not set.
+var DefaultMaxValueSize = 1 << 20
+
+// maxLoggedValueSize caps redacted values in logs, audit events, history and
+// snapshots.
+const maxLoggedValueSize = 1024
+
+// ErrValueTooLarge is wrapped by the errors of values exceeding the maximum
+// size, see maxValueSize.
+var ErrValueTooLarge = errors.New("hotload: connection information too large")
+
+// parseMaxValueSize reads maxValueSize, the maximum size of values of the
+// strategy in bytes.
+func (cg *chanGroup) parseMaxValueSize(vs url.Values) {
+	v := vs.Get(maxValueSizeKey)
+	if v == "" {
+		return
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil || n <= 0 {
+		cg.log("invalid maxValueSize, ignoring", v)
+		return
+	}
+	cg.maxValueSize = n
+	cg.log("maxValueSize set to", n)
+}
+
+// checkValueSize rejects values of a misconfigured source that exceed the
+// maximum size, before they are transformed, logged or stored.
+func (cg *chanGroup) checkValueSize(v string) error {
+	max := cg.maxValueSize
+	if max <= 0 {
+		max = DefaultMaxValueSize
+	}
+	if len(v) > max {
+		return fmt.Errorf("%w: %d bytes, maximum %d", ErrValueTooLarge, len(v), max)
+	}
+	return nil
+}
+
+// capLogged shortens v to maxLoggedValueSize bytes, noting its full length.
+func capLogged(v string) string {
+	if len(v) <= maxLoggedValueSize {
+		return v
+	}
+	return fmt.Sprintf("%s...(%d bytes)", v[:maxLoggedValueSize], len(v))
+}